@@ -0,0 +1,229 @@
+package audit
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/suteetoe/gomicro/database"
+	"github.com/suteetoe/gomicro/logger"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Actor types recorded on events
+const (
+	ActorUser      = "user"
+	ActorClient    = "client"
+	ActorAnonymous = "anonymous"
+)
+
+// Change holds the value of one field before and after an action
+type Change struct {
+	Before interface{} `json:"before,omitempty"`
+	After  interface{} `json:"after,omitempty"`
+}
+
+// Changes maps field names to their change; it is stored as JSONB
+type Changes map[string]Change
+
+// Value implements driver.Valuer
+func (c Changes) Value() (driver.Value, error) {
+	if c == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan implements sql.Scanner
+func (c *Changes) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*c = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, c)
+	case string:
+		return json.Unmarshal([]byte(v), c)
+	default:
+		return fmt.Errorf("cannot scan %T into audit.Changes", value)
+	}
+}
+
+// Event is a structured record of a security-relevant change
+type Event struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt    time.Time `gorm:"index" json:"created_at"`
+	Service      string    `gorm:"size:64;index" json:"service"`
+	TenantID     *uint     `gorm:"index" json:"tenant_id,omitempty"`
+	ActorType    string    `gorm:"size:16" json:"actor_type"`
+	ActorID      string    `gorm:"size:128;index" json:"actor_id"`
+	Action       string    `gorm:"size:128;index" json:"action"`
+	ResourceType string    `gorm:"size:64;index:idx_audit_events_resource" json:"resource_type"`
+	ResourceID   string    `gorm:"size:128;index:idx_audit_events_resource" json:"resource_id"`
+	Changes      Changes   `gorm:"type:jsonb" json:"changes,omitempty"`
+	RequestID    string    `gorm:"size:64" json:"request_id,omitempty"`
+	IP           string    `gorm:"size:64" json:"ip,omitempty"`
+}
+
+// TableName overrides the table name used by Event
+func (Event) TableName() string {
+	return "audit_events"
+}
+
+// Recorder writes audit events for one service
+type Recorder struct {
+	db      *gorm.DB
+	service string
+}
+
+// NewRecorder creates a recorder that stores events in db
+func NewRecorder(db *gorm.DB, service string) *Recorder {
+	return &Recorder{db: db, service: service}
+}
+
+// Migrate creates or updates the audit_events table
+func (r *Recorder) Migrate() error {
+	if err := r.db.AutoMigrate(&Event{}); err != nil {
+		return fmt.Errorf("failed to migrate audit events: %w", err)
+	}
+	return nil
+}
+
+// Record stores an event; Service and CreatedAt are filled in when empty
+func (r *Recorder) Record(ctx context.Context, event Event) error {
+	if event.Service == "" {
+		event.Service = r.service
+	}
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now().UTC()
+	}
+	// Events carry their tenant explicitly and may have none, so they bypass the tenant scope
+	if err := r.db.WithContext(database.WithoutTenantScope(ctx)).Create(&event).Error; err != nil {
+		return fmt.Errorf("failed to record audit event %s: %w", event.Action, err)
+	}
+	return nil
+}
+
+// RecordRequest stores an event with the actor, request ID and client IP of the current request.
+// The actor is the authenticated user_id, or else the client_id, set by the auth middleware.
+// Failures are logged rather than returned because the audited change has already been made.
+func (r *Recorder) RecordRequest(c echo.Context, event Event) {
+	if event.ActorID == "" {
+		if userID, ok := c.Get("user_id").(uint); ok && userID != 0 {
+			event.ActorType = ActorUser
+			event.ActorID = strconv.FormatUint(uint64(userID), 10)
+		} else if clientID, ok := c.Get("client_id").(string); ok && clientID != "" {
+			event.ActorType = ActorClient
+			event.ActorID = clientID
+		} else if event.ActorType == "" {
+			event.ActorType = ActorAnonymous
+		}
+	}
+	if event.RequestID == "" {
+		event.RequestID = requestID(c)
+	}
+	if event.IP == "" {
+		event.IP = c.RealIP()
+	}
+	if err := r.Record(c.Request().Context(), event); err != nil {
+		logger.FromEcho(c).Error("Failed to record audit event",
+			zap.String("action", event.Action),
+			zap.String("resource_type", event.ResourceType),
+			zap.String("resource_id", event.ResourceID),
+			zap.Error(err))
+	}
+}
+
+// requestID returns the ID set by the request ID middleware or the X-Request-ID header
+func requestID(c echo.Context) string {
+	if id, ok := c.Get("request_id").(string); ok && id != "" {
+		return id
+	}
+	if id := c.Response().Header().Get(echo.HeaderXRequestID); id != "" {
+		return id
+	}
+	return c.Request().Header.Get(echo.HeaderXRequestID)
+}
+
+// ignoredFields are bookkeeping fields left out of diffs
+var ignoredFields = map[string]struct{}{
+	"created_at": {}, "updated_at": {}, "deleted_at": {},
+	"CreatedAt": {}, "UpdatedAt": {}, "DeletedAt": {},
+}
+
+// Diff returns the fields that differ between the JSON forms of before and after.
+// Either side may be nil, e.g. for creates and deletes. Values of sensitive fields such as
+// secrets and passwords are replaced with logger.RedactedValue.
+func Diff(before, after interface{}) Changes {
+	beforeFields := toFields(before)
+	afterFields := toFields(after)
+
+	changes := Changes{}
+	for name, value := range beforeFields {
+		if _, ok := ignoredFields[name]; ok {
+			continue
+		}
+		if next, ok := afterFields[name]; !ok || !reflect.DeepEqual(value, next) {
+			changes[name] = Change{Before: value, After: afterFields[name]}
+		}
+	}
+	for name, value := range afterFields {
+		if _, ok := ignoredFields[name]; ok {
+			continue
+		}
+		if _, ok := beforeFields[name]; !ok {
+			changes[name] = Change{After: value}
+		}
+	}
+
+	for name, change := range changes {
+		if sensitive(name) {
+			if change.Before != nil {
+				change.Before = logger.RedactedValue
+			}
+			if change.After != nil {
+				change.After = logger.RedactedValue
+			}
+			changes[name] = change
+		}
+	}
+	return changes
+}
+
+// toFields decodes the JSON object form of value
+func toFields(value interface{}) map[string]interface{} {
+	if value == nil {
+		return nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil
+	}
+	return fields
+}
+
+// sensitive reports whether a field holds a secret or PII that must not be stored in clear
+func sensitive(name string) bool {
+	name = strings.ToLower(name)
+	for _, key := range logger.DefaultRedactKeys {
+		if name == key || strings.HasSuffix(name, "_"+key) {
+			return true
+		}
+	}
+	return false
+}
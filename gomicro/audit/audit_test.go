@@ -0,0 +1,248 @@
+package audit
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	apperrors "github.com/suteetoe/gomicro/errors"
+	"github.com/suteetoe/gomicro/internal/dbtest"
+	"github.com/suteetoe/gomicro/logger"
+	"go.uber.org/zap"
+)
+
+type client struct {
+	ID        uint      `json:"id"`
+	Name      string    `json:"name"`
+	Secret    string    `json:"client_secret"`
+	Email     string    `json:"owner_email"`
+	Scopes    []string  `json:"scopes"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func TestDiff(t *testing.T) {
+	before := client{ID: 1, Name: "billing", Secret: "old", Email: "a@example.com", Scopes: []string{"read"}, UpdatedAt: time.Unix(1, 0)}
+	after := before
+	after.Name = "invoicing"
+	after.Secret = "new"
+	after.Scopes = []string{"read", "write"}
+	after.UpdatedAt = time.Unix(2, 0)
+
+	tests := []struct {
+		name          string
+		before, after interface{}
+		want          Changes
+	}{
+		{
+			name:   "update",
+			before: before,
+			after:  after,
+			want: Changes{
+				"name":          {Before: "billing", After: "invoicing"},
+				"client_secret": {Before: logger.RedactedValue, After: logger.RedactedValue},
+				"scopes":        {Before: []interface{}{"read"}, After: []interface{}{"read", "write"}},
+			},
+		},
+		{
+			name:   "create",
+			before: nil,
+			after:  before,
+			want: Changes{
+				"id":            {After: float64(1)},
+				"name":          {After: "billing"},
+				"client_secret": {After: logger.RedactedValue},
+				"owner_email":   {After: logger.RedactedValue},
+				"scopes":        {After: []interface{}{"read"}},
+			},
+		},
+		{
+			name:   "delete",
+			before: map[string]interface{}{"id": 1, "password": "hunter2"},
+			after:  nil,
+			want: Changes{
+				"id":       {Before: float64(1)},
+				"password": {Before: logger.RedactedValue},
+			},
+		},
+		{
+			name:   "field removed",
+			before: map[string]interface{}{"name": "a", "token": "t"},
+			after:  map[string]interface{}{"name": "a"},
+			want:   Changes{"token": {Before: logger.RedactedValue}},
+		},
+		{
+			name:   "no change",
+			before: before,
+			after:  before,
+			want:   Changes{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Diff(tt.before, tt.after)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Diff = %v, want %v", got, tt.want)
+			}
+			// Secrets never reach the stored form
+			data, _ := json.Marshal(got)
+			for _, secret := range []string{"old", "new", "hunter2", "a@example.com"} {
+				if strings.Contains(string(data), `"`+secret+`"`) {
+					t.Errorf("stored changes %s contain %q", data, secret)
+				}
+			}
+		})
+	}
+}
+
+// fakeEvents stores the rows inserted into audit_events and answers queries of one tenant
+type fakeEvents struct {
+	rows    []map[string]driver.Value
+	queries []string
+	args    [][]driver.Value
+}
+
+var eventColumns = []string{"id", "created_at", "service", "tenant_id", "actor_type", "actor_id", "action",
+	"resource_type", "resource_id", "changes", "request_id", "ip"}
+
+func (f *fakeEvents) handle(query string, args []driver.Value) (dbtest.Result, error) {
+	switch {
+	case strings.HasPrefix(query, `INSERT INTO "audit_events"`):
+		columns := strings.Split(query[strings.Index(query, "(")+1:strings.Index(query, ")")], ",")
+		row := map[string]driver.Value{"id": int64(len(f.rows) + 1)}
+		for i, column := range columns {
+			row[strings.Trim(strings.TrimSpace(column), `"`)] = args[i]
+		}
+		f.rows = append(f.rows, row)
+		return dbtest.Result{Columns: []string{"id"}, Rows: [][]driver.Value{{row["id"]}}}, nil
+
+	case strings.HasPrefix(query, "SELECT"):
+		f.queries = append(f.queries, query)
+		f.args = append(f.args, args)
+		// Queries start with service = $1 AND tenant_id = $2
+		var matching [][]driver.Value
+		for _, row := range f.rows {
+			if row["service"] == args[0] && row["tenant_id"] == args[1] {
+				values := make([]driver.Value, len(eventColumns))
+				for i, column := range eventColumns {
+					values[i] = row[column]
+				}
+				matching = append(matching, values)
+			}
+		}
+		if strings.HasPrefix(query, "SELECT count(*)") {
+			return dbtest.Result{Columns: []string{"count"}, Rows: [][]driver.Value{{int64(len(matching))}}}, nil
+		}
+		return dbtest.Result{Columns: eventColumns, Rows: matching}, nil
+	}
+	return dbtest.Result{}, nil
+}
+
+func uintPtr(v uint) *uint { return &v }
+
+func TestQueryTenantIsolation(t *testing.T) {
+	fake := &fakeEvents{}
+	db := dbtest.Open(t, fake.handle)
+	recorder := NewRecorder(db, "test-service")
+	other := NewRecorder(db, "other-service")
+
+	ctx := context.Background()
+	for _, r := range []struct {
+		recorder *Recorder
+		event    Event
+	}{
+		{recorder, Event{TenantID: uintPtr(1), Action: "product.created", ResourceType: "product", ResourceID: "10"}},
+		{recorder, Event{TenantID: uintPtr(2), Action: "product.created", ResourceType: "product", ResourceID: "20"}},
+		{recorder, Event{Action: "client.registered", ResourceType: "client", ResourceID: "abc"}},
+		{other, Event{TenantID: uintPtr(1), Action: "supplier.created", ResourceType: "supplier", ResourceID: "30"}},
+	} {
+		if err := r.recorder.Record(ctx, r.event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := fake.rows[0]["service"]; got != "test-service" {
+		t.Errorf("recorded service %v", got)
+	}
+
+	page, err := recorder.Query(ctx, Filter{TenantID: 1, Action: "product.created", PageSize: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 1 || len(page.Events) != 1 || page.Events[0].ResourceID != "10" {
+		t.Errorf("tenant 1 got %+v", page)
+	}
+	if page.PageSize != MaxPageSize || page.Page != 1 {
+		t.Errorf("page %d of size %d", page.Page, page.PageSize)
+	}
+	for i, query := range fake.queries {
+		if !strings.Contains(query, "WHERE (service = $1 AND tenant_id = $2) AND action = $3") {
+			t.Errorf("query not scoped to the service and tenant: %s", query)
+		}
+		if want := []driver.Value{"test-service", int64(1), "product.created"}; !reflect.DeepEqual(fake.args[i][:3], want) {
+			t.Errorf("query arguments %v, want %v", fake.args[i], want)
+		}
+	}
+
+	// Events without a tenant are never listed
+	if _, err := recorder.Query(ctx, Filter{}); err == nil {
+		t.Error("queried without a tenant")
+	}
+}
+
+func TestHandler(t *testing.T) {
+	fake := &fakeEvents{}
+	recorder := NewRecorder(dbtest.Open(t, fake.handle), "test-service")
+	for _, tenantID := range []uint{1, 2} {
+		if err := recorder.Record(context.Background(), Event{TenantID: uintPtr(tenantID), Action: "product.created"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		tenantID   interface{}
+		role       string
+		query      string
+		wantStatus int
+		wantTotal  int64
+	}{
+		{"owner", uint(1), "owner", "", http.StatusOK, 1},
+		{"the tenant comes from the token, not the query", uint(1), "owner", "?tenant_id=2", http.StatusOK, 1},
+		{"member", uint(1), "member", "", http.StatusForbidden, 0},
+		{"no tenant", nil, "owner", "", http.StatusForbidden, 0},
+		{"malformed filter", uint(1), "owner", "?from=yesterday", http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			rec := httptest.NewRecorder()
+			c := e.NewContext(httptest.NewRequest(http.MethodGet, "/audit-events"+tt.query, nil), rec)
+			c.Set("tenant_id", tt.tenantID)
+			c.Set("role", tt.role)
+			c.Set("logger", zap.NewNop())
+
+			if err := recorder.Handler(TenantOwner("tenant_id", "role"))(c); err != nil {
+				if status := apperrors.StatusCode(err); status != tt.wantStatus {
+					t.Errorf("status %d, want %d: %v", status, tt.wantStatus, err)
+				}
+				return
+			}
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			var page Page
+			if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+				t.Fatal(err)
+			}
+			if page.Total != tt.wantTotal || len(page.Events) != int(tt.wantTotal) || *page.Events[0].TenantID != 1 {
+				t.Errorf("page %+v", page)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/suteetoe/gomicro/database"
+	apperrors "github.com/suteetoe/gomicro/errors"
+	"github.com/suteetoe/gomicro/logger"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultPageSize is used when a query does not set page_size
+	DefaultPageSize = 50
+	// MaxPageSize bounds page_size
+	MaxPageSize = 200
+)
+
+// ErrForbidden is returned by an Authorizer when the caller may not read the audit log
+var ErrForbidden = errors.New("audit log access denied")
+
+// Filter selects the events returned by Query
+type Filter struct {
+	TenantID     uint
+	Action       string
+	ResourceType string
+	ResourceID   string
+	ActorID      string
+	From         time.Time
+	To           time.Time
+	Page         int
+	PageSize     int
+}
+
+// Page is one page of events, newest first
+type Page struct {
+	Events   []Event `json:"events"`
+	Page     int     `json:"page"`
+	PageSize int     `json:"page_size"`
+	Total    int64   `json:"total"`
+}
+
+// Query returns the events of one tenant that match filter
+func (r *Recorder) Query(ctx context.Context, filter Filter) (*Page, error) {
+	if filter.TenantID == 0 {
+		return nil, errors.New("audit query requires a tenant")
+	}
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	if filter.PageSize < 1 {
+		filter.PageSize = DefaultPageSize
+	}
+	if filter.PageSize > MaxPageSize {
+		filter.PageSize = MaxPageSize
+	}
+
+	query := r.db.WithContext(database.WithoutTenantScope(ctx)).Model(&Event{}).
+		Where("service = ? AND tenant_id = ?", r.service, filter.TenantID)
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.ResourceType != "" {
+		query = query.Where("resource_type = ?", filter.ResourceType)
+	}
+	if filter.ResourceID != "" {
+		query = query.Where("resource_id = ?", filter.ResourceID)
+	}
+	if filter.ActorID != "" {
+		query = query.Where("actor_id = ?", filter.ActorID)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("created_at < ?", filter.To)
+	}
+
+	page := &Page{Page: filter.Page, PageSize: filter.PageSize, Events: []Event{}}
+	if err := query.Count(&page.Total).Error; err != nil {
+		return nil, fmt.Errorf("failed to count audit events: %w", err)
+	}
+	if err := query.Order("created_at DESC, id DESC").
+		Offset((filter.Page - 1) * filter.PageSize).
+		Limit(filter.PageSize).
+		Find(&page.Events).Error; err != nil {
+		return nil, fmt.Errorf("failed to query audit events: %w", err)
+	}
+	return page, nil
+}
+
+// Authorizer returns the tenant whose history the caller may read, or ErrForbidden
+type Authorizer func(c echo.Context) (uint, error)
+
+// TenantOwner authorizes callers whose context holds a tenant ID under tenantKey
+// and the "owner" role under roleKey, as set by the services' auth middleware
+func TenantOwner(tenantKey, roleKey string) Authorizer {
+	return func(c echo.Context) (uint, error) {
+		tenantID, ok := c.Get(tenantKey).(uint)
+		if !ok || tenantID == 0 {
+			return 0, ErrForbidden
+		}
+		if role, _ := c.Get(roleKey).(string); role != "owner" {
+			return 0, ErrForbidden
+		}
+		return tenantID, nil
+	}
+}
+
+// Handler returns an Echo handler listing the caller's tenant history. It accepts the query
+// parameters action, resource_type, resource_id, actor_id, from and to (RFC 3339), page and page_size.
+func (r *Recorder) Handler(authorize Authorizer) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		log := logger.FromEcho(c)
+
+		tenantID, err := authorize(c)
+		if err != nil {
+			log.Warn("Audit log access denied", zap.Error(err))
+			return apperrors.Forbidden("only tenant owners can read the audit log")
+		}
+
+		filter := Filter{
+			TenantID:     tenantID,
+			Action:       c.QueryParam("action"),
+			ResourceType: c.QueryParam("resource_type"),
+			ResourceID:   c.QueryParam("resource_id"),
+			ActorID:      c.QueryParam("actor_id"),
+		}
+		if filter.From, err = parseTime(c.QueryParam("from")); err != nil {
+			return apperrors.Validation("from must be an RFC 3339 timestamp").WithField("from", "must be an RFC 3339 timestamp")
+		}
+		if filter.To, err = parseTime(c.QueryParam("to")); err != nil {
+			return apperrors.Validation("to must be an RFC 3339 timestamp").WithField("to", "must be an RFC 3339 timestamp")
+		}
+		if filter.Page, err = parseInt(c.QueryParam("page")); err != nil {
+			return apperrors.Validation("page must be a number").WithField("page", "must be a number")
+		}
+		if filter.PageSize, err = parseInt(c.QueryParam("page_size")); err != nil {
+			return apperrors.Validation("page_size must be a number").WithField("page_size", "must be a number")
+		}
+
+		page, err := r.Query(c.Request().Context(), filter)
+		if err != nil {
+			log.Error("Failed to query audit events", zap.Error(err))
+			return apperrors.Internal("failed to query audit events", err)
+		}
+		return c.JSON(http.StatusOK, page)
+	}
+}
+
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func parseInt(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(value)
+}
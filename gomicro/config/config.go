@@ -1,9 +1,10 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"os"
-	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -13,16 +14,24 @@ import (
 
 // DBConfig holds database configuration
 type DBConfig struct {
-	Host            string
-	Port            string
-	User            string
-	Password        string
-	DBName          string
-	SSLMode         string
-	MaxIdleConns    int
-	MaxOpenConns    int
-	ConnMaxLifetime time.Duration
-	LogLevel        logger.LogLevel
+	Host            string          `yaml:"host" env:"DB_HOST"`
+	Port            string          `yaml:"port" env:"DB_PORT"`
+	User            string          `yaml:"user" env:"DB_USER"`
+	Password        string          `yaml:"password" env:"DB_PASSWORD" secret:"true"`
+	DBName          string          `yaml:"name" env:"DB_NAME"`
+	SSLMode         string          `yaml:"ssl_mode" env:"DB_SSL_MODE"`
+	MaxIdleConns    int             `yaml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS"`
+	MaxOpenConns    int             `yaml:"max_open_conns" env:"DB_MAX_OPEN_CONNS"`
+	ConnMaxLifetime time.Duration   `yaml:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME"`
+	LogLevel        logger.LogLevel `yaml:"log_level" env:"DB_LOG_LEVEL"`
+	MigrateOnStart  bool            `yaml:"migrate_on_start" env:"DB_MIGRATE_ON_START"`
+	// ReadReplicas is a comma separated list of replica DSNs that serve reads
+	ReadReplicas      string        `yaml:"read_replicas" env:"DB_READ_REPLICAS" secret:"true"`
+	ConnectRetries    int           `yaml:"connect_retries" env:"DB_CONNECT_RETRIES"`
+	ConnectBackoff    time.Duration `yaml:"connect_backoff" env:"DB_CONNECT_BACKOFF"`
+	ConnectMaxBackoff time.Duration `yaml:"connect_max_backoff" env:"DB_CONNECT_MAX_BACKOFF"`
+	// TenantRLS runs tenant requests in transactions checked by row level security policies
+	TenantRLS bool `yaml:"tenant_rls" env:"DB_TENANT_RLS"`
 }
 
 // GetDSN returns the PostgreSQL connection string
@@ -31,80 +40,298 @@ func (c *DBConfig) GetDSN() string {
 		c.Host, c.Port, c.User, c.Password, c.DBName, c.SSLMode)
 }
 
+// ReplicaDSNs returns the read replica DSNs
+func (c *DBConfig) ReplicaDSNs() []string {
+	return SplitList(c.ReadReplicas)
+}
+
+// MaskedDSN returns the connection string with the password hidden, for logging
+func (c *DBConfig) MaskedDSN() string {
+	return maskDSN(c.GetDSN())
+}
+
 // ServerConfig holds server configuration
 type ServerConfig struct {
-	Port string
-	Env  string
+	Port string `yaml:"port" env:"SERVER_PORT"`
+	Env  string `yaml:"env" env:"APP_ENV"`
 }
 
 // JWTConfig holds JWT configuration
 type JWTConfig struct {
-	SigningKey      string
-	ExpirationHours int
+	SigningKey      string `yaml:"signing_key" env:"JWT_SIGNING_KEY" secret:"true"`
+	ExpirationHours int    `yaml:"expiration_hours" env:"JWT_EXPIRATION_HOURS"`
+	// JWKSURL verifies tokens against the issuer's published keys instead of SigningKey
+	JWKSURL string `yaml:"jwks_url" env:"JWT_JWKS_URL"`
+	// Denylist is where revoked tokens are looked up: memory, postgres or none
+	Denylist string `yaml:"denylist" env:"JWT_DENYLIST"`
+	// Algorithm is HS256 with SigningKey, or RS256, ES256 or EdDSA with rotating keys that
+	// the issuing service publishes at /.well-known/jwks.json
+	Algorithm        string        `yaml:"algorithm" env:"JWT_ALGORITHM"`
+	RotationInterval time.Duration `yaml:"rotation_interval" env:"JWT_KEY_ROTATION_INTERVAL"`
+	// KeyRetention keeps retired keys verifying tokens; it must exceed the token lifetime
+	KeyRetention time.Duration `yaml:"key_retention" env:"JWT_KEY_RETENTION"`
+}
+
+// OAuthConfig holds the token lifetimes of the OAuth server
+type OAuthConfig struct {
+	AccessTokenExpiration  time.Duration `yaml:"access_token_expiration" env:"OAUTH_ACCESS_TOKEN_EXPIRATION"`
+	RefreshTokenExpiration time.Duration `yaml:"refresh_token_expiration" env:"OAUTH_REFRESH_TOKEN_EXPIRATION"`
+}
+
+// OAuthClientConfig holds the client credentials a service uses to call other services
+type OAuthClientConfig struct {
+	Enabled      bool   `yaml:"enabled" env:"OAUTH_ENABLED"`
+	BaseURL      string `yaml:"base_url" env:"OAUTH_BASE_URL"`
+	ClientID     string `yaml:"client_id" env:"OAUTH_CLIENT_ID"`
+	ClientSecret string `yaml:"client_secret" env:"OAUTH_CLIENT_SECRET" secret:"true"`
 }
 
 // LogConfig holds logging configuration
 type LogConfig struct {
-	Level string
+	Level                     string `yaml:"level" env:"LOG_LEVEL"`
+	LevelFile                 string `yaml:"level_file" env:"LOG_LEVEL_FILE"`
+	AdminToken                string `yaml:"admin_token" env:"LOG_ADMIN_TOKEN" secret:"true"`
+	SamplingInitial           int    `yaml:"sampling_initial" env:"LOG_SAMPLING_INITIAL"`
+	SamplingThereafter        int    `yaml:"sampling_thereafter" env:"LOG_SAMPLING_THEREAFTER"`
+	RequestSamplingInitial    int    `yaml:"request_sampling_initial" env:"LOG_REQUEST_SAMPLING_INITIAL"`
+	RequestSamplingThereafter int    `yaml:"request_sampling_thereafter" env:"LOG_REQUEST_SAMPLING_THEREAFTER"`
 }
 
 // MetricsConfig holds metrics configuration
 type MetricsConfig struct {
-	Prefix string
+	Prefix        string `yaml:"prefix" env:"METRICS_PREFIX"`
+	Version       string `yaml:"version" env:"SERVICE_VERSION"`
+	Instance      string `yaml:"instance" env:"HOSTNAME"`
+	Region        string `yaml:"region" env:"REGION"`
+	SLOConfigPath string `yaml:"slo_config_path" env:"SLO_CONFIG_PATH"`
+}
+
+// TracingConfig holds distributed tracing configuration
+type TracingConfig struct {
+	Enabled     bool    `yaml:"enabled" env:"TRACING_ENABLED"`
+	Endpoint    string  `yaml:"endpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT"`
+	Insecure    bool    `yaml:"insecure" env:"OTEL_EXPORTER_OTLP_INSECURE"`
+	SampleRatio float64 `yaml:"sample_ratio" env:"TRACING_SAMPLE_RATIO"`
+}
+
+// AuthzConfig holds authorization configuration
+type AuthzConfig struct {
+	// PolicyPath is a YAML or JSON role to permission policy; empty uses the default policy
+	PolicyPath string `yaml:"policy_path" env:"AUTHZ_POLICY_PATH"`
+}
+
+// RateLimitConfig holds rate limiting configuration
+type RateLimitConfig struct {
+	// Store keeps the counters: memory, postgres or none
+	Store string `yaml:"store" env:"RATE_LIMIT_STORE"`
+	// Algorithm is token_bucket or sliding_window
+	Algorithm string `yaml:"algorithm" env:"RATE_LIMIT_ALGORITHM"`
+	// API limits the API requests of each tenant, e.g. 600/1m; empty disables the limit
+	API string `yaml:"api" env:"RATE_LIMIT_API"`
+	// Login limits login and token requests of each IP and client
+	Login string `yaml:"login" env:"RATE_LIMIT_LOGIN"`
+}
+
+// IdempotencyConfig holds Idempotency-Key configuration
+type IdempotencyConfig struct {
+	// Store keeps the keys and responses: memory, postgres or none
+	Store string `yaml:"store" env:"IDEMPOTENCY_STORE"`
+	// TTL is how long a response is replayed for its key
+	TTL time.Duration `yaml:"ttl" env:"IDEMPOTENCY_TTL"`
+}
+
+// OutboxConfig holds transactional outbox configuration
+type OutboxConfig struct {
+	// Publisher is "notify" for Postgres NOTIFY, "memory" for in-process delivery or "none"
+	Publisher    string        `yaml:"publisher" env:"OUTBOX_PUBLISHER"`
+	Channel      string        `yaml:"channel" env:"OUTBOX_CHANNEL"`
+	PollInterval time.Duration `yaml:"poll_interval" env:"OUTBOX_POLL_INTERVAL"`
 }
 
-// Config holds all configuration
+// Config holds all configuration. Each section field is named by its yaml tag in
+// configuration files and flags (e.g. db.max_open_conns, --db-max-open-conns)
+// and by its env tag in the environment.
 type Config struct {
 	ServiceName string
-	DB          DBConfig
-	Server      ServerConfig
-	JWT         JWTConfig
-	Log         LogConfig
-	Metrics     MetricsConfig
+	DB          DBConfig          `yaml:"db"`
+	Server      ServerConfig      `yaml:"server"`
+	JWT         JWTConfig         `yaml:"jwt"`
+	Log         LogConfig         `yaml:"log"`
+	Metrics     MetricsConfig     `yaml:"metrics"`
+	Tracing     TracingConfig     `yaml:"tracing"`
+	Authz       AuthzConfig       `yaml:"authz"`
+	RateLimit   RateLimitConfig   `yaml:"rate_limit"`
+	Idempotency IdempotencyConfig `yaml:"idempotency"`
+	OAuth       OAuthConfig       `yaml:"oauth"`
+	OAuthClient OAuthClientConfig `yaml:"oauth_client"`
+	Outbox      OutboxConfig      `yaml:"outbox"`
+
+	// sources records which layer set each setting, keyed by path
+	sources map[string]string
+	secrets *SecretResolver
+	// file and options are kept so that Reload can repeat the load
+	file    string
+	options []LoadOption
 }
 
-// Load loads configuration from environment variables without service name prefix
-func Load(serviceName string) (*Config, error) {
-	// Load .env file if it exists
-	if err := godotenv.Load(); err != nil {
-		// Not returning error as .env file is optional
-		fmt.Printf("Warning: .env file not found, using environment variables\n")
-	}
+// Insecure defaults that Validate rejects in production
+const (
+	defaultDBPassword    = "password"
+	defaultJWTSigningKey = "defaultsecretkey"
+)
 
-	// Initialize config struct with values from environment
-	config := &Config{
+// defaults returns the built-in configuration, the lowest layer
+func defaults(serviceName string) *Config {
+	return &Config{
 		ServiceName: serviceName,
 		DB: DBConfig{
-			Host:            getEnv("DB_HOST", "localhost"),
-			Port:            getEnv("DB_PORT", "5432"),
-			User:            getEnv("DB_USER", "postgres"),
-			Password:        getEnv("DB_PASSWORD", "password"),
-			DBName:          getEnv("DB_NAME", serviceName),
-			SSLMode:         getEnv("DB_SSL_MODE", "disable"),
-			MaxIdleConns:    getEnvAsInt("DB_MAX_IDLE_CONNS", 10),
-			MaxOpenConns:    getEnvAsInt("DB_MAX_OPEN_CONNS", 100),
-			ConnMaxLifetime: getEnvAsDuration("DB_CONN_MAX_LIFETIME", 1*time.Hour),
-			LogLevel:        getEnvAsLogLevel("DB_LOG_LEVEL", logger.Info),
+			Host:              "localhost",
+			Port:              "5432",
+			User:              "postgres",
+			Password:          defaultDBPassword,
+			DBName:            serviceName,
+			SSLMode:           "disable",
+			MaxIdleConns:      10,
+			MaxOpenConns:      100,
+			ConnMaxLifetime:   1 * time.Hour,
+			LogLevel:          logger.Info,
+			MigrateOnStart:    true,
+			ConnectRetries:    10,
+			ConnectBackoff:    500 * time.Millisecond,
+			ConnectMaxBackoff: 10 * time.Second,
 		},
 		Server: ServerConfig{
-			Port: getEnv("SERVER_PORT", "8080"),
-			Env:  getEnv("APP_ENV", "development"),
+			Port: "8080",
+			Env:  "development",
 		},
 		JWT: JWTConfig{
-			SigningKey:      getEnv("JWT_SIGNING_KEY", "defaultsecretkey"),
-			ExpirationHours: getEnvAsInt("JWT_EXPIRATION_HOURS", 24),
+			SigningKey:       defaultJWTSigningKey,
+			ExpirationHours:  24,
+			Denylist:         "none",
+			Algorithm:        "HS256",
+			RotationInterval: 30 * 24 * time.Hour,
+			KeyRetention:     7 * 24 * time.Hour,
 		},
 		Log: LogConfig{
-			Level: getEnv("LOG_LEVEL", "info"),
+			Level: "info",
 		},
 		Metrics: MetricsConfig{
-			Prefix: getEnv("METRICS_PREFIX", serviceName),
+			Prefix: serviceName,
+		},
+		Tracing: TracingConfig{
+			Endpoint:    "localhost:4318",
+			Insecure:    true,
+			SampleRatio: 1.0,
+		},
+		RateLimit: RateLimitConfig{
+			Store:     "memory",
+			Algorithm: "token_bucket",
+			API:       "600/1m",
+			Login:     "10/1m",
 		},
+		Idempotency: IdempotencyConfig{
+			Store: "memory",
+			TTL:   24 * time.Hour,
+		},
+		OAuth: OAuthConfig{
+			AccessTokenExpiration:  1 * time.Hour,
+			RefreshTokenExpiration: 7 * 24 * time.Hour,
+		},
+		OAuthClient: OAuthClientConfig{
+			BaseURL: "http://localhost:8084",
+		},
+		Outbox: OutboxConfig{
+			Publisher:    "notify",
+			Channel:      "outbox",
+			PollInterval: time.Second,
+		},
+	}
+}
+
+// Load builds the configuration from layers, each overriding the one before:
+// built-in defaults, those of WithDefaults, a YAML or JSON file, environment variables and
+// command-line flags.
+// Secret settings may hold references such as file:/run/secrets/db_password.
+// The file is taken from WithFile, the --config flag or CONFIG_FILE; flags are only
+// read when WithArgs is given. The result is validated before it is returned.
+func Load(serviceName string, opts ...LoadOption) (*Config, error) {
+	options := &loadOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	// Load .env file if it exists
+	if err := godotenv.Load(); err != nil {
+		// Not returning error as .env file is optional
+		fmt.Printf("Warning: .env file not found, using environment variables\n")
+	}
+
+	config := defaults(serviceName)
+	if options.defaults != nil {
+		options.defaults(config)
+	}
+	settings := config.settings()
+	config.sources = make(map[string]string, len(settings))
+	for _, s := range settings {
+		config.sources[s.path] = SourceDefault
+	}
+
+	// Flags are parsed first since --config selects the file layer
+	flagValues, configFile, err := parseFlags(serviceName, settings, options.args)
+	if err != nil {
+		return nil, err
+	}
+	if configFile == "" {
+		configFile = options.file
+	}
+	if configFile == "" {
+		configFile = getEnv("CONFIG_FILE", "")
+	}
+
+	var errs []error
+	if configFile != "" {
+		fileValues, err := readFile(configFile)
+		if err != nil {
+			return nil, err
+		}
+		errs = append(errs, config.apply(settings, SourceFile, fileValues)...)
 	}
+	errs = append(errs, config.apply(settings, SourceEnv, envValues(settings))...)
+	errs = append(errs, config.apply(settings, SourceFlag, flagValues)...)
 
+	config.file = configFile
+	config.options = opts
+	config.secrets = options.secrets
+	if config.secrets == nil {
+		if config.secrets, err = DefaultSecretResolver(); err != nil {
+			return nil, err
+		}
+	}
+	errs = append(errs, config.resolveSecrets(settings, config.secrets)...)
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
 	return config, nil
 }
 
+// Reload loads a new snapshot with the same options, file and secret resolver as c
+func (c *Config) Reload() (*Config, error) {
+	opts := append(append([]LoadOption{}, c.options...), WithSecretResolver(c.secrets))
+	if c.file != "" {
+		opts = append(opts, WithFile(c.file))
+	}
+	return Load(c.ServiceName, opts...)
+}
+
+// Secrets returns the resolver used for secret settings, e.g. to Watch for rotated secrets
+func (c *Config) Secrets() *SecretResolver {
+	return c.secrets
+}
+
 // LogConfig returns the configuration as a zap logger-friendly format
 func (c *Config) LogConfig() []zap.Field {
 	return []zap.Field{
@@ -118,12 +345,6 @@ func (c *Config) LogConfig() []zap.Field {
 	}
 }
 
-// Helper function to mask sensitive information in DSN
-func maskDSN(dsn string) string {
-	// A simple implementation that hides password details
-	return "***MASKED***"
-}
-
 // Helper function to get environment variables with defaults
 func getEnv(key, defaultValue string) string {
 	if value, exists := os.LookupEnv(key); exists {
@@ -132,37 +353,13 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
-// Helper function to get environment variables as integers
-func getEnvAsInt(key string, defaultValue int) int {
-	valueStr := getEnv(key, "")
-	if value, err := strconv.Atoi(valueStr); err == nil {
-		return value
-	}
-	return defaultValue
-}
-
-// Helper function to get environment variables as durations
-func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
-	valueStr := getEnv(key, "")
-	if value, err := time.ParseDuration(valueStr); err == nil {
-		return value
-	}
-	return defaultValue
-}
-
-// Helper function to get environment variables as log levels
-func getEnvAsLogLevel(key string, defaultValue logger.LogLevel) logger.LogLevel {
-	valueStr := getEnv(key, "")
-	switch valueStr {
-	case "silent":
-		return logger.Silent
-	case "error":
-		return logger.Error
-	case "warn":
-		return logger.Warn
-	case "info":
-		return logger.Info
-	default:
-		return defaultValue
+// SplitList splits a comma separated setting such as DB_READ_REPLICAS, dropping empty entries
+func SplitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
 	}
+	return items
 }
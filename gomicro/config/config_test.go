@@ -0,0 +1,390 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeFile writes a config file into a temporary directory and returns its path
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// dumped returns the dump entry of key
+func dumped(c *Config, key string) Setting {
+	for _, s := range c.Dump() {
+		if s.Key == key {
+			return s
+		}
+	}
+	return Setting{}
+}
+
+func TestLoadLayers(t *testing.T) {
+	file := writeFile(t, "config.yaml", `
+db:
+  host: file-host
+  port: 5433
+  max_open_conns: 50
+  conn_max_lifetime: 30m
+server:
+  port: 9000
+`)
+	t.Setenv("DB_PORT", "5434")
+	t.Setenv("DB_MAX_OPEN_CONNS", "60")
+	t.Setenv("DB_MAX_IDLE_CONNS", "") // unset compose variables keep the lower layer
+
+	c, err := Load("test-service", WithFile(file), WithArgs([]string{"--db-max-open-conns=70", "--tracing-enabled"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		key    string
+		got    interface{}
+		want   interface{}
+		source string
+	}{
+		{"db.user", c.DB.User, "postgres", SourceDefault},
+		{"db.name", c.DB.DBName, "test-service", SourceDefault},
+		{"db.max_idle_conns", c.DB.MaxIdleConns, 10, SourceDefault},
+		{"db.host", c.DB.Host, "file-host", SourceFile},
+		{"db.conn_max_lifetime", c.DB.ConnMaxLifetime, 30 * time.Minute, SourceFile},
+		{"server.port", c.Server.Port, "9000", SourceFile},
+		{"db.port", c.DB.Port, "5434", SourceEnv},
+		{"db.max_open_conns", c.DB.MaxOpenConns, 70, SourceFlag},
+		{"tracing.enabled", c.Tracing.Enabled, true, SourceFlag},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.key, tt.got, tt.want)
+		}
+		if source := dumped(c, tt.key).Source; source != tt.source {
+			t.Errorf("%s set by %s, want %s", tt.key, source, tt.source)
+		}
+	}
+}
+
+func TestLoadWithDefaults(t *testing.T) {
+	file := writeFile(t, "config.yaml", "server:\n  port: 9000\n")
+	t.Setenv("METRICS_PREFIX", "env-prefix")
+	serviceDefaults := WithDefaults(func(c *Config) {
+		c.Server.Port = "8081"
+		c.DB.DBName = "auth_service"
+		c.Metrics.Prefix = "auth"
+		c.JWT.Denylist = "postgres"
+	})
+
+	c, err := Load("test-service", WithFile(file), serviceDefaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Service defaults replace the built-in ones and stay below the other layers
+	for _, reload := range []bool{false, true} {
+		if reload {
+			if c, err = c.Reload(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if c.DB.DBName != "auth_service" || c.JWT.Denylist != "postgres" {
+			t.Errorf("reload %v: db.name %q, jwt.denylist %q", reload, c.DB.DBName, c.JWT.Denylist)
+		}
+		if c.Server.Port != "9000" || c.Metrics.Prefix != "env-prefix" {
+			t.Errorf("reload %v: server.port %q, metrics.prefix %q", reload, c.Server.Port, c.Metrics.Prefix)
+		}
+		if source := dumped(c, "db.name").Source; source != SourceDefault {
+			t.Errorf("db.name set by %s", source)
+		}
+	}
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	file := writeFile(t, "config.json", `{"db": {"host": "json-host", "migrate_on_start": false}}`)
+
+	t.Run("config flag", func(t *testing.T) {
+		c, err := Load("test-service", WithArgs([]string{"--config", file}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.DB.Host != "json-host" || c.DB.MigrateOnStart {
+			t.Errorf("db %+v", c.DB)
+		}
+	})
+
+	t.Run("CONFIG_FILE", func(t *testing.T) {
+		t.Setenv("CONFIG_FILE", file)
+		c, err := Load("test-service")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.DB.Host != "json-host" {
+			t.Errorf("db.host %q", c.DB.Host)
+		}
+	})
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		env     map[string]string
+		args    []string
+		wantErr []string
+	}{
+		{
+			name:    "malformed values are reported, not replaced by defaults",
+			env:     map[string]string{"DB_MAX_OPEN_CONNS": "many", "DB_CONN_MAX_LIFETIME": "1 hour"},
+			args:    []string{"--tracing-enabled=maybe"},
+			wantErr: []string{`env DB_MAX_OPEN_CONNS: invalid integer "many"`, `env DB_CONN_MAX_LIFETIME: invalid duration "1 hour"`, `flag --tracing-enabled: invalid boolean "maybe"`},
+		},
+		{
+			name:    "unknown key in the file",
+			file:    "db:\n  hots: postgres\n",
+			wantErr: []string{"unknown setting db.hots"},
+		},
+		{
+			name:    "nested value in the file",
+			file:    "db:\n  host: [a, b]\n",
+			wantErr: []string{"setting db.host", "must be a single value"},
+		},
+		{
+			name:    "unknown flag",
+			args:    []string{"--db-hots=postgres"},
+			wantErr: []string{"failed to parse flags"},
+		},
+		{
+			name:    "loaded values are validated",
+			env:     map[string]string{"APP_ENV": "production"},
+			wantErr: []string{"db.password must be set"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			var opts []LoadOption
+			if tt.file != "" {
+				opts = append(opts, WithFile(writeFile(t, "config.yaml", tt.file)))
+			}
+			if tt.args != nil {
+				opts = append(opts, WithArgs(tt.args))
+			}
+
+			_, err := Load("test-service", opts...)
+			if err == nil {
+				t.Fatal("loaded")
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not mention %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	strongKey := strings.Repeat("k", minProductionKeyLength)
+	tests := []struct {
+		name    string
+		change  func(c *Config)
+		wantErr string
+	}{
+		{
+			name:   "insecure defaults are accepted outside production",
+			change: func(c *Config) {},
+		},
+		{
+			name: "production with its own secrets",
+			change: func(c *Config) {
+				c.Server.Env = "production"
+				c.DB.Password = "db secret"
+				c.JWT.SigningKey = strongKey
+			},
+		},
+		{
+			name: "production with the default database password",
+			change: func(c *Config) {
+				c.Server.Env = "prod"
+				c.JWT.SigningKey = strongKey
+			},
+			wantErr: "db.password must be set to a non-default value in production",
+		},
+		{
+			name: "production with the default signing key",
+			change: func(c *Config) {
+				c.Server.Env = "production"
+				c.DB.Password = "db secret"
+			},
+			wantErr: "jwt.signing_key must be set to a non-default value in production",
+		},
+		{
+			name: "production with a short signing key",
+			change: func(c *Config) {
+				c.Server.Env = "production"
+				c.DB.Password = "db secret"
+				c.JWT.SigningKey = "short but not the default"
+			},
+			wantErr: "jwt.signing_key must be at least 32 characters in production",
+		},
+		{
+			name: "production signing with rotating keys needs no signing key",
+			change: func(c *Config) {
+				c.Server.Env = "production"
+				c.DB.Password = "db secret"
+				c.JWT.Algorithm = "ES256"
+			},
+		},
+		{
+			name:    "unknown signing algorithm",
+			change:  func(c *Config) { c.JWT.Algorithm = "none" },
+			wantErr: `jwt.algorithm "none" must be one of HS256, RS256, ES256 or EdDSA`,
+		},
+		{
+			name:    "oauth client without credentials",
+			change:  func(c *Config) { c.OAuthClient.Enabled = true },
+			wantErr: "oauth_client.base_url and oauth_client.client_id are required",
+		},
+		{
+			name:    "unknown outbox publisher",
+			change:  func(c *Config) { c.Outbox.Publisher = "kafka" },
+			wantErr: `outbox.publisher "kafka" must be one of notify, memory or none`,
+		},
+		{
+			name: "production verifying against a JWKS needs no signing key",
+			change: func(c *Config) {
+				c.Server.Env = "production"
+				c.DB.Password = "db secret"
+				c.JWT.JWKSURL = "http://authen-service:8080/.well-known/jwks.json"
+			},
+		},
+		{
+			name:    "malformed port",
+			change:  func(c *Config) { c.Server.Port = "80a" },
+			wantErr: `server.port "80a" is not a valid port`,
+		},
+		{
+			name:    "more idle than open connections",
+			change:  func(c *Config) { c.DB.MaxIdleConns = 200 },
+			wantErr: "db.max_idle_conns must be between 0 and db.max_open_conns",
+		},
+		{
+			name:    "unknown store",
+			change:  func(c *Config) { c.RateLimit.Store = "redis" },
+			wantErr: `rate_limit.store "redis" must be one of memory, postgres or none`,
+		},
+		{
+			name:    "sample ratio out of range",
+			change:  func(c *Config) { c.Tracing.SampleRatio = 1.5 },
+			wantErr: "tracing.sample_ratio must be between 0 and 1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := defaults("test-service")
+			tt.change(c)
+			err := c.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("rejected: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	// Every problem is reported at once
+	c := defaults("test-service")
+	c.Server.Env = "production"
+	c.DB.Port = "0"
+	err := c.Validate()
+	for _, want := range []string{"db.port", "db.password", "jwt.signing_key"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("error %v does not mention %s", err, want)
+		}
+	}
+}
+
+func TestDump(t *testing.T) {
+	t.Setenv("DB_PASSWORD", "s3cret")
+	t.Setenv("DB_READ_REPLICAS", "host=replica password=s3cret")
+	t.Setenv("LOG_ADMIN_TOKEN", "")
+	c, err := Load("test-service")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		key, value, source string
+	}{
+		{"db.password", maskedValue, SourceEnv},
+		{"db.read_replicas", maskedValue, SourceEnv},
+		// An empty secret is shown as empty, so a missing secret stands out
+		{"log.admin_token", "", SourceEnv},
+		{"db.host", "localhost", SourceDefault},
+		{"db.conn_max_lifetime", "1h0m0s", SourceDefault},
+		{"db.log_level", "info", SourceDefault},
+	}
+	for _, tt := range tests {
+		if s := dumped(c, tt.key); s.Value != tt.value || s.Source != tt.source {
+			t.Errorf("%s dumped as %q from %s, want %q from %s", tt.key, s.Value, s.Source, tt.value, tt.source)
+		}
+	}
+	if s := dumped(c, "db.password"); s.Env != "DB_PASSWORD" {
+		t.Errorf("db.password env %q", s.Env)
+	}
+	for _, s := range c.Dump() {
+		if strings.Contains(s.Value, "s3cret") {
+			t.Errorf("%s dumped the secret: %q", s.Key, s.Value)
+		}
+	}
+}
+
+func TestMaskDSN(t *testing.T) {
+	tests := []struct {
+		dsn, want string
+	}{
+		{
+			"host=db port=5432 user=app password=s3cret dbname=app sslmode=disable",
+			"host=db port=5432 user=app password=***MASKED*** dbname=app sslmode=disable",
+		},
+		{
+			"host=db password='with spaces' dbname=app",
+			"host=db password=***MASKED*** dbname=app",
+		},
+		{
+			"postgres://app:s3cret@db:5432/app?sslmode=disable",
+			"postgres://app:***MASKED***@db:5432/app?sslmode=disable",
+		},
+		{
+			"postgres://app@db:5432/app",
+			"postgres://app@db:5432/app",
+		},
+		{
+			"host=db dbname=app",
+			"host=db dbname=app",
+		},
+	}
+	for _, tt := range tests {
+		if got := maskDSN(tt.dsn); got != tt.want {
+			t.Errorf("maskDSN(%q) = %q, want %q", tt.dsn, got, tt.want)
+		}
+	}
+
+	db := DBConfig{Host: "db", Port: "5432", User: "app", Password: "s3cret", DBName: "app", SSLMode: "disable"}
+	if got := db.MaskedDSN(); strings.Contains(got, "s3cret") {
+		t.Errorf("MaskedDSN() = %q", got)
+	}
+}
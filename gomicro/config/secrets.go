@@ -0,0 +1,326 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SecretProvider resolves secret references of one scheme, e.g. file:/run/secrets/db_password
+type SecretProvider interface {
+	// Scheme is the reference prefix handled by the provider, without the colon
+	Scheme() string
+	// Get returns the current value of the secret named by the rest of the reference
+	Get(name string) (string, error)
+}
+
+// DefaultSecretsDir is where Docker and Kubernetes mount secrets
+const DefaultSecretsDir = "/run/secrets"
+
+// FileSecretProvider reads secrets from files such as Docker secrets. Relative names are
+// resolved under Dir, and a trailing newline is removed.
+type FileSecretProvider struct {
+	Dir string
+}
+
+// Scheme implements SecretProvider
+func (p *FileSecretProvider) Scheme() string { return "file" }
+
+// Get implements SecretProvider
+func (p *FileSecretProvider) Get(name string) (string, error) {
+	data, err := os.ReadFile(secretPath(p.Dir, name))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// EnvSecretProvider reads secrets from other environment variables
+type EnvSecretProvider struct{}
+
+// Scheme implements SecretProvider
+func (p *EnvSecretProvider) Scheme() string { return "env" }
+
+// Get implements SecretProvider
+func (p *EnvSecretProvider) Get(name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return value, nil
+}
+
+// EncryptedFileSecretProvider reads secrets encrypted with EncryptSecret from local files.
+// Relative names are resolved under Dir.
+type EncryptedFileSecretProvider struct {
+	Dir  string
+	aead cipher.AEAD
+}
+
+// NewEncryptedFileSecretProvider creates a provider decrypting with an AES-128, AES-192 or AES-256 key
+func NewEncryptedFileSecretProvider(key []byte, dir string) (*EncryptedFileSecretProvider, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return &EncryptedFileSecretProvider{Dir: dir, aead: aead}, nil
+}
+
+// Scheme implements SecretProvider
+func (p *EncryptedFileSecretProvider) Scheme() string { return "enc" }
+
+// Get implements SecretProvider
+func (p *EncryptedFileSecretProvider) Get(name string) (string, error) {
+	data, err := os.ReadFile(secretPath(p.Dir, name))
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return "", fmt.Errorf("secret is not base64 encoded: %w", err)
+	}
+	nonceSize := p.aead.NonceSize()
+	if len(sealed) < nonceSize {
+		return "", errors.New("secret is too short")
+	}
+	plaintext, err := p.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], nil)
+	if err != nil {
+		return "", errors.New("failed to decrypt secret, check the key")
+	}
+	return string(plaintext), nil
+}
+
+// EncryptSecret encrypts plaintext with AES-GCM and returns the base64 text to store in an enc: file
+func EncryptSecret(key []byte, plaintext string) (string, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, []byte(plaintext), nil)), nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid secrets key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+func secretPath(dir, name string) string {
+	if filepath.IsAbs(name) || dir == "" {
+		return name
+	}
+	return filepath.Join(dir, name)
+}
+
+// LoadSecretsKey reads the key of encrypted secrets from SECRETS_KEY (base64) or the file
+// named by SECRETS_KEY_FILE. It returns nil when neither is set.
+func LoadSecretsKey() ([]byte, error) {
+	encoded := getEnv("SECRETS_KEY", "")
+	if path := getEnv("SECRETS_KEY_FILE", ""); encoded == "" && path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read secrets key: %w", err)
+		}
+		encoded = strings.TrimSpace(string(data))
+	}
+	if encoded == "" {
+		return nil, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("secrets key is not base64 encoded: %w", err)
+	}
+	return key, nil
+}
+
+// Secret holds the latest value of a secret reference and follows rotations
+type Secret struct {
+	value atomic.Value
+}
+
+// Value returns the current value of the secret
+func (s *Secret) Value() string {
+	return s.value.Load().(string)
+}
+
+// SecretResolver resolves secret references through its providers and re-reads them on Refresh,
+// so rotated secrets are picked up without restarting the service
+type SecretResolver struct {
+	providers map[string]SecretProvider
+
+	mu          sync.Mutex
+	secrets     map[string]*Secret
+	subscribers []func(ref string)
+}
+
+// NewSecretResolver creates a resolver for the given providers
+func NewSecretResolver(providers ...SecretProvider) *SecretResolver {
+	r := &SecretResolver{
+		providers: make(map[string]SecretProvider, len(providers)),
+		secrets:   make(map[string]*Secret),
+	}
+	for _, p := range providers {
+		r.providers[p.Scheme()] = p
+	}
+	return r
+}
+
+// DefaultSecretResolver returns a resolver for file: and env: references, and for enc: references
+// when a secrets key is configured (see LoadSecretsKey). SECRETS_DIR overrides DefaultSecretsDir.
+func DefaultSecretResolver() (*SecretResolver, error) {
+	dir := getEnv("SECRETS_DIR", DefaultSecretsDir)
+	providers := []SecretProvider{&FileSecretProvider{Dir: dir}, &EnvSecretProvider{}}
+
+	key, err := LoadSecretsKey()
+	if err != nil {
+		return nil, err
+	}
+	if key != nil {
+		encrypted, err := NewEncryptedFileSecretProvider(key, dir)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, encrypted)
+	}
+	return NewSecretResolver(providers...), nil
+}
+
+// IsReference reports whether value is a reference handled by one of the providers
+func (r *SecretResolver) IsReference(value string) bool {
+	scheme, _, ok := strings.Cut(value, ":")
+	if !ok {
+		return false
+	}
+	_, ok = r.providers[scheme]
+	return ok
+}
+
+// Secret resolves a reference and returns a handle that follows its rotations
+func (r *SecretResolver) Secret(ref string) (*Secret, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if secret, ok := r.secrets[ref]; ok {
+		return secret, nil
+	}
+	value, err := r.get(ref)
+	if err != nil {
+		return nil, err
+	}
+	secret := &Secret{}
+	secret.value.Store(value)
+	r.secrets[ref] = secret
+	return secret, nil
+}
+
+// Resolve returns the value of a reference; values that are not references are returned unchanged
+func (r *SecretResolver) Resolve(value string) (string, error) {
+	if !r.IsReference(value) {
+		return value, nil
+	}
+	secret, err := r.Secret(value)
+	if err != nil {
+		return "", err
+	}
+	return secret.Value(), nil
+}
+
+// ResolveAll replaces every reference among values with its value
+func (r *SecretResolver) ResolveAll(values ...*string) error {
+	for _, value := range values {
+		resolved, err := r.Resolve(*value)
+		if err != nil {
+			return err
+		}
+		*value = resolved
+	}
+	return nil
+}
+
+func (r *SecretResolver) get(ref string) (string, error) {
+	scheme, name, _ := strings.Cut(ref, ":")
+	provider, ok := r.providers[scheme]
+	if !ok {
+		return "", fmt.Errorf("no secret provider for %s: references", scheme)
+	}
+	value, err := provider.Get(name)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve secret %s: %w", ref, err)
+	}
+	return value, nil
+}
+
+// OnRotate registers fn to be called with the reference of every secret whose value changes on Refresh
+func (r *SecretResolver) OnRotate(fn func(ref string)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.subscribers = append(r.subscribers, fn)
+}
+
+// Refresh re-reads every resolved secret and returns the references that changed.
+// A secret that cannot be read keeps its previous value.
+func (r *SecretResolver) Refresh() ([]string, error) {
+	r.mu.Lock()
+	var changed []string
+	var errs []error
+	for ref, secret := range r.secrets {
+		value, err := r.get(ref)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if value != secret.Value() {
+			secret.value.Store(value)
+			changed = append(changed, ref)
+		}
+	}
+	subscribers := append([]func(string){}, r.subscribers...)
+	r.mu.Unlock()
+
+	for _, ref := range changed {
+		for _, fn := range subscribers {
+			fn(ref)
+		}
+	}
+	return changed, errors.Join(errs...)
+}
+
+// Watch calls Refresh every interval until the returned function is called.
+// Refresh errors are passed to onError when it is not nil.
+func (r *SecretResolver) Watch(interval time.Duration, onError func(error)) func() {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := r.Refresh(); err != nil && onError != nil {
+					onError(err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
@@ -0,0 +1,136 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncryptedFileSecretProvider(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	sealed, err := EncryptSecret(key, "s3cret password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "db_password.enc"), []byte(sealed+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	provider, err := NewEncryptedFileSecretProvider(key, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, err := provider.Get("db_password.enc"); err != nil || value != "s3cret password" {
+		t.Errorf("Get = %q, %v", value, err)
+	}
+
+	// Every encryption uses a fresh nonce
+	if again, _ := EncryptSecret(key, "s3cret password"); again == sealed {
+		t.Error("the same plaintext encrypted twice gave the same text")
+	}
+
+	wrongKey, err := NewEncryptedFileSecretProvider(bytes.Repeat([]byte{8}, 32), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wrongKey.Get("db_password.enc"); err == nil || !strings.Contains(err.Error(), "check the key") {
+		t.Errorf("wrong key: %v", err)
+	}
+
+	if _, err := NewEncryptedFileSecretProvider([]byte("short"), dir); err == nil {
+		t.Error("accepted a 5 byte key")
+	}
+	if err := os.WriteFile(filepath.Join(dir, "plain"), []byte("not base64!"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := provider.Get("plain"); err == nil {
+		t.Error("decrypted a plaintext file")
+	}
+}
+
+func TestSecretResolverRefresh(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "db_password")
+	write := func(value string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(value+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("first")
+
+	resolver := NewSecretResolver(&FileSecretProvider{Dir: dir}, &EnvSecretProvider{})
+	var rotations []string
+	resolver.OnRotate(func(ref string) { rotations = append(rotations, ref) })
+
+	secret, err := resolver.Secret("file:db_password")
+	if err != nil || secret.Value() != "first" {
+		t.Fatalf("Secret = %v, %v", secret, err)
+	}
+	if value, err := resolver.Resolve("plain value"); err != nil || value != "plain value" {
+		t.Errorf("Resolve of a value = %q, %v", value, err)
+	}
+	if _, err := resolver.Resolve("vault:db"); err != nil {
+		t.Errorf("a value with an unknown scheme is not a reference: %v", err)
+	}
+
+	// Nothing changed
+	if changed, err := resolver.Refresh(); err != nil || len(changed) != 0 {
+		t.Errorf("Refresh = %v, %v", changed, err)
+	}
+
+	write("second")
+	changed, err := resolver.Refresh()
+	if err != nil || len(changed) != 1 || changed[0] != "file:db_password" {
+		t.Errorf("Refresh = %v, %v", changed, err)
+	}
+	if secret.Value() != "second" || len(rotations) != 1 {
+		t.Errorf("value %q after %d rotations", secret.Value(), len(rotations))
+	}
+
+	// A secret that cannot be read keeps its value
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := resolver.Refresh(); err == nil {
+		t.Error("Refresh of a missing file succeeded")
+	}
+	if secret.Value() != "second" {
+		t.Errorf("value %q after a failed refresh", secret.Value())
+	}
+}
+
+func TestSecretResolverWatch(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "signing_key")
+	if err := os.WriteFile(path, []byte("old"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	resolver := NewSecretResolver(&FileSecretProvider{Dir: dir})
+	secret, err := resolver.Secret("file:signing_key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated := make(chan string, 1)
+	resolver.OnRotate(func(ref string) { rotated <- ref })
+
+	stop := resolver.Watch(10*time.Millisecond, nil)
+	defer stop()
+	if err := os.WriteFile(path, []byte("new"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case ref := <-rotated:
+		if ref != "file:signing_key" || secret.Value() != "new" {
+			t.Errorf("rotated %s to %q", ref, secret.Value())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("rotation not picked up")
+	}
+}
@@ -0,0 +1,336 @@
+package config
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm/logger"
+)
+
+// Sources of a setting, from lowest to highest precedence
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+type loadOptions struct {
+	file     string
+	args     []string
+	secrets  *SecretResolver
+	defaults func(*Config)
+}
+
+// LoadOption configures Load
+type LoadOption func(*loadOptions)
+
+// WithFile reads the file layer from a YAML or JSON file
+func WithFile(path string) LoadOption {
+	return func(o *loadOptions) {
+		o.file = path
+	}
+}
+
+// WithArgs parses command-line flags, usually os.Args[1:], as the highest layer
+func WithArgs(args []string) LoadOption {
+	return func(o *loadOptions) {
+		o.args = args
+	}
+}
+
+// WithDefaults changes the built-in defaults of a service, e.g. its port or database name,
+// before the file, environment and flag layers are applied. Reload applies it again.
+func WithDefaults(apply func(*Config)) LoadOption {
+	return func(o *loadOptions) {
+		o.defaults = apply
+	}
+}
+
+// WithSecretResolver resolves secret settings with r instead of DefaultSecretResolver
+func WithSecretResolver(r *SecretResolver) LoadOption {
+	return func(o *loadOptions) {
+		o.secrets = r
+	}
+}
+
+// setting is one configurable field of Config
+type setting struct {
+	path   string // section.key as used in files, e.g. db.max_open_conns
+	env    string
+	secret bool
+	value  reflect.Value
+}
+
+// flag returns the command-line flag name of the setting, e.g. db-max-open-conns
+func (s setting) flag() string {
+	return strings.NewReplacer(".", "-", "_", "-").Replace(s.path)
+}
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	logLevelType = reflect.TypeOf(logger.LogLevel(0))
+)
+
+// settings lists the fields of every section of c, bound to c
+func (c *Config) settings() []setting {
+	var settings []setting
+	root := reflect.ValueOf(c).Elem()
+	for i := 0; i < root.NumField(); i++ {
+		section := root.Type().Field(i)
+		name := section.Tag.Get("yaml")
+		if name == "" || section.Type.Kind() != reflect.Struct {
+			continue
+		}
+		for j := 0; j < section.Type.NumField(); j++ {
+			field := section.Type.Field(j)
+			settings = append(settings, setting{
+				path:   name + "." + field.Tag.Get("yaml"),
+				env:    field.Tag.Get("env"),
+				secret: field.Tag.Get("secret") == "true",
+				value:  root.Field(i).Field(j),
+			})
+		}
+	}
+	return settings
+}
+
+// apply sets the values of one layer, keyed by path, and returns every value that could not be parsed
+func (c *Config) apply(settings []setting, source string, values map[string]string) []error {
+	var errs []error
+	for _, s := range settings {
+		raw, ok := values[s.path]
+		if !ok {
+			continue
+		}
+		if err := setValue(s.value, raw); err != nil {
+			errs = append(errs, fmt.Errorf("%s %s: %w", source, s.name(source), err))
+			continue
+		}
+		c.sources[s.path] = source
+	}
+	return errs
+}
+
+// name returns how the setting is spelled in source
+func (s setting) name(source string) string {
+	switch source {
+	case SourceEnv:
+		return s.env
+	case SourceFlag:
+		return "--" + s.flag()
+	default:
+		return s.path
+	}
+}
+
+// resolveSecrets replaces secret references in secret settings, e.g. DB_PASSWORD=file:/run/secrets/db_password
+func (c *Config) resolveSecrets(settings []setting, resolver *SecretResolver) []error {
+	var errs []error
+	for _, s := range settings {
+		if !s.secret || !resolver.IsReference(s.value.String()) {
+			continue
+		}
+		value, err := resolver.Resolve(s.value.String())
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.path, err))
+			continue
+		}
+		s.value.SetString(value)
+	}
+	return errs
+}
+
+// envValues reads the environment layer. Empty variables are ignored for non-string
+// settings so that an unset compose variable does not become a parse error.
+func envValues(settings []setting) map[string]string {
+	values := make(map[string]string)
+	for _, s := range settings {
+		if s.env == "" {
+			continue
+		}
+		value, ok := os.LookupEnv(s.env)
+		if !ok || (value == "" && s.value.Kind() != reflect.String) {
+			continue
+		}
+		values[s.path] = value
+	}
+	return values
+}
+
+// readFile reads the file layer; .json files are parsed as JSON and anything else as YAML
+func readFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var sections map[string]map[string]interface{}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.Unmarshal(data, &sections)
+	} else {
+		err = yaml.Unmarshal(data, &sections)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	known := make(map[string]struct{})
+	for _, s := range (&Config{}).settings() {
+		known[s.path] = struct{}{}
+	}
+
+	values := make(map[string]string)
+	for section, keys := range sections {
+		for key, value := range keys {
+			name := section + "." + key
+			if _, ok := known[name]; !ok {
+				return nil, fmt.Errorf("unknown setting %s in config file %s", name, path)
+			}
+			switch v := value.(type) {
+			case string:
+				values[name] = v
+			case float64:
+				values[name] = strconv.FormatFloat(v, 'f', -1, 64)
+			case nil:
+				continue
+			case map[string]interface{}, []interface{}:
+				return nil, fmt.Errorf("setting %s in config file %s must be a single value", name, path)
+			default:
+				values[name] = fmt.Sprint(v)
+			}
+		}
+	}
+	return values, nil
+}
+
+// flagValue holds the raw value of one setting's flag
+type flagValue struct {
+	path   string
+	value  string
+	isBool bool
+}
+
+func (f *flagValue) String() string     { return f.value }
+func (f *flagValue) Set(s string) error { f.value = s; return nil }
+func (f *flagValue) IsBoolFlag() bool   { return f.isBool }
+
+// parseFlags reads the flag layer and the --config flag from args
+func parseFlags(serviceName string, settings []setting, args []string) (map[string]string, string, error) {
+	if args == nil {
+		return nil, "", nil
+	}
+
+	flags := flag.NewFlagSet(serviceName, flag.ContinueOnError)
+	configFile := flags.String("config", "", "path to a YAML or JSON configuration file")
+	bound := make(map[string]*flagValue, len(settings))
+	for _, s := range settings {
+		value := &flagValue{path: s.path, isBool: s.value.Kind() == reflect.Bool}
+		usage := "sets " + s.path
+		if s.env != "" {
+			usage += " (env " + s.env + ")"
+		}
+		flags.Var(value, s.flag(), usage)
+		bound[s.flag()] = value
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, "", fmt.Errorf("failed to parse flags: %w", err)
+	}
+
+	values := make(map[string]string)
+	flags.Visit(func(f *flag.Flag) {
+		if value, ok := bound[f.Name]; ok {
+			values[value.path] = value.value
+		}
+	})
+	return values, *configFile, nil
+}
+
+// setValue parses raw into the field v
+func setValue(v reflect.Value, raw string) error {
+	switch v.Type() {
+	case durationType:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", raw)
+		}
+		v.SetInt(int64(d))
+		return nil
+	case logLevelType:
+		level, err := parseDBLogLevel(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(level))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", raw)
+		}
+		v.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", raw)
+		}
+		v.SetBool(b)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", raw)
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported setting type %s", v.Type())
+	}
+	return nil
+}
+
+// formatValue is the inverse of setValue
+func formatValue(v reflect.Value) string {
+	switch v.Type() {
+	case durationType:
+		return time.Duration(v.Int()).String()
+	case logLevelType:
+		return dbLogLevelName(logger.LogLevel(v.Int()))
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+var dbLogLevels = map[string]logger.LogLevel{
+	"silent": logger.Silent,
+	"error":  logger.Error,
+	"warn":   logger.Warn,
+	"info":   logger.Info,
+}
+
+// parseDBLogLevel parses one of silent, error, warn or info
+func parseDBLogLevel(level string) (logger.LogLevel, error) {
+	if parsed, ok := dbLogLevels[level]; ok {
+		return parsed, nil
+	}
+	return logger.Info, fmt.Errorf("unknown database log level %q", level)
+}
+
+func dbLogLevelName(level logger.LogLevel) string {
+	for name, value := range dbLogLevels {
+		if value == level {
+			return name
+		}
+	}
+	return strconv.Itoa(int(level))
+}
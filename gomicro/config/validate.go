@@ -0,0 +1,152 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// minProductionKeyLength is the shortest JWT signing key accepted in production
+const minProductionKeyLength = 32
+
+// IsProduction reports whether the service runs in the production environment
+func (c *Config) IsProduction() bool {
+	return c.Server.Env == "production" || c.Server.Env == "prod"
+}
+
+// Validate checks the configuration for malformed values and, in production,
+// for default or weak secrets. Every problem found is reported.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(validPort(c.Server.Port), "server.port %q is not a valid port", c.Server.Port)
+	check(validPort(c.DB.Port), "db.port %q is not a valid port", c.DB.Port)
+	check(c.DB.Host != "", "db.host is required")
+	check(c.DB.DBName != "", "db.name is required")
+	check(c.DB.MaxOpenConns > 0, "db.max_open_conns must be positive, got %d", c.DB.MaxOpenConns)
+	check(c.DB.MaxIdleConns >= 0 && c.DB.MaxIdleConns <= c.DB.MaxOpenConns,
+		"db.max_idle_conns must be between 0 and db.max_open_conns, got %d", c.DB.MaxIdleConns)
+	check(c.DB.ConnMaxLifetime >= 0, "db.conn_max_lifetime must not be negative")
+	check(c.DB.ConnectRetries >= 0, "db.connect_retries must not be negative, got %d", c.DB.ConnectRetries)
+	check(c.DB.ConnectBackoff >= 0 && c.DB.ConnectMaxBackoff >= c.DB.ConnectBackoff,
+		"db.connect_backoff must not be negative or exceed db.connect_max_backoff")
+	check(c.JWT.ExpirationHours > 0, "jwt.expiration_hours must be positive, got %d", c.JWT.ExpirationHours)
+	switch c.JWT.Algorithm {
+	case "HS256", "RS256", "ES256", "EdDSA":
+	default:
+		check(false, "jwt.algorithm %q must be one of HS256, RS256, ES256 or EdDSA", c.JWT.Algorithm)
+	}
+	check(c.JWT.RotationInterval > 0, "jwt.rotation_interval must be positive")
+	check(c.JWT.KeyRetention >= 0, "jwt.key_retention must not be negative")
+	switch c.JWT.Denylist {
+	case "memory", "postgres", "none":
+	default:
+		check(false, "jwt.denylist %q must be one of memory, postgres or none", c.JWT.Denylist)
+	}
+
+	switch c.RateLimit.Store {
+	case "memory", "postgres", "none":
+	default:
+		check(false, "rate_limit.store %q must be one of memory, postgres or none", c.RateLimit.Store)
+	}
+	switch c.RateLimit.Algorithm {
+	case "token_bucket", "sliding_window":
+	default:
+		check(false, "rate_limit.algorithm %q must be token_bucket or sliding_window", c.RateLimit.Algorithm)
+	}
+	switch c.Idempotency.Store {
+	case "memory", "postgres", "none":
+	default:
+		check(false, "idempotency.store %q must be one of memory, postgres or none", c.Idempotency.Store)
+	}
+	check(c.Idempotency.TTL > 0, "idempotency.ttl must be positive")
+	check(c.OAuth.AccessTokenExpiration > 0 && c.OAuth.RefreshTokenExpiration > 0, "oauth token expirations must be positive")
+	if c.OAuthClient.Enabled {
+		check(c.OAuthClient.BaseURL != "" && c.OAuthClient.ClientID != "",
+			"oauth_client.base_url and oauth_client.client_id are required when oauth_client.enabled is set")
+	}
+	switch c.Outbox.Publisher {
+	case "notify", "memory", "none":
+	default:
+		check(false, "outbox.publisher %q must be one of notify, memory or none", c.Outbox.Publisher)
+	}
+	check(c.Outbox.PollInterval > 0, "outbox.poll_interval must be positive")
+
+	switch c.Log.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		check(false, "log.level %q must be one of debug, info, warn or error", c.Log.Level)
+	}
+	check(c.Log.SamplingInitial >= 0 && c.Log.SamplingThereafter >= 0, "log sampling values must not be negative")
+	check(c.Log.RequestSamplingInitial >= 0 && c.Log.RequestSamplingThereafter >= 0, "log request sampling values must not be negative")
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1,
+		"tracing.sample_ratio must be between 0 and 1, got %g", c.Tracing.SampleRatio)
+
+	if c.IsProduction() {
+		check(c.DB.Password != "" && c.DB.Password != defaultDBPassword,
+			"db.password must be set to a non-default value in production")
+		// Services verifying against a JWKS, or signing with rotating keys, hold no signing key
+		if c.JWT.JWKSURL == "" && c.JWT.Algorithm == "HS256" {
+			check(c.JWT.SigningKey != defaultJWTSigningKey, "jwt.signing_key must be set to a non-default value in production")
+			check(len(c.JWT.SigningKey) >= minProductionKeyLength,
+				"jwt.signing_key must be at least %d characters in production", minProductionKeyLength)
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+func validPort(port string) bool {
+	n, err := strconv.Atoi(port)
+	return err == nil && n > 0 && n <= 65535
+}
+
+// Setting is one entry of the effective configuration
+type Setting struct {
+	Key    string `json:"key"`
+	Env    string `json:"env,omitempty"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+// maskedValue replaces secrets in Dump
+const maskedValue = "***MASKED***"
+
+// Dump returns the effective configuration and the layer that set each value, with secrets masked
+func (c *Config) Dump() []Setting {
+	settings := c.settings()
+	dump := make([]Setting, 0, len(settings))
+	for _, s := range settings {
+		value := formatValue(s.value)
+		if s.secret && value != "" {
+			value = maskedValue
+		}
+		source := c.sources[s.path]
+		if source == "" {
+			source = SourceDefault
+		}
+		dump = append(dump, Setting{Key: s.path, Env: s.env, Value: value, Source: source})
+	}
+	return dump
+}
+
+// dsnPasswords match the password of key=value and URL style connection strings
+var dsnPasswords = []*regexp.Regexp{
+	regexp.MustCompile(`(password=)('[^']*'|\S*)`),
+	regexp.MustCompile(`(://[^:/@\s]+:)([^@\s]*)(@)`),
+}
+
+// maskDSN hides the password in a connection string
+func maskDSN(dsn string) string {
+	dsn = dsnPasswords[0].ReplaceAllString(dsn, "${1}"+maskedValue)
+	return dsnPasswords[1].ReplaceAllString(dsn, "${1}"+maskedValue+"${3}")
+}
@@ -0,0 +1,166 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// DefaultWatchInterval is how often a Watcher checks the config file and secrets for changes
+const DefaultWatchInterval = 30 * time.Second
+
+// ApplyFunc applies a new configuration snapshot to a component. Returning an error rejects
+// the snapshot; subscribers that already applied it are called again with old and new swapped.
+type ApplyFunc func(old, new *Config) error
+
+type subscriber struct {
+	name  string
+	apply ApplyFunc
+}
+
+// Watcher reloads the configuration when its file or secrets change and hands validated
+// snapshots to subscribers
+type Watcher struct {
+	log *zap.Logger
+
+	mu          sync.Mutex
+	current     *Config
+	subscribers []subscriber
+	fileState   string
+}
+
+// NewWatcher creates a watcher starting from the configuration returned by Load
+func NewWatcher(initial *Config, log *zap.Logger) *Watcher {
+	w := &Watcher{log: log, current: initial}
+	w.fileState = fileState(initial.file)
+	return w
+}
+
+// Current returns the latest applied snapshot
+func (w *Watcher) Current() *Config {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.current
+}
+
+// Subscribe registers a component; subscribers are applied in registration order
+func (w *Watcher) Subscribe(name string, apply ApplyFunc) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.subscribers = append(w.subscribers, subscriber{name: name, apply: apply})
+}
+
+// Reload loads and validates a new snapshot and applies it to every subscriber. If loading
+// fails or a subscriber rejects the snapshot, the previous one stays in effect.
+func (w *Watcher) Reload() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	old := w.current
+	next, err := old.Reload()
+	if err != nil {
+		w.log.Error("Configuration reload rejected", zap.Error(err))
+		return err
+	}
+
+	changed := changedSettings(old, next)
+	if len(changed) == 0 {
+		return nil
+	}
+
+	for i, s := range w.subscribers {
+		if err := s.apply(old, next); err != nil {
+			err = fmt.Errorf("%s rejected the configuration: %w", s.name, err)
+			w.log.Error("Configuration reload rejected", zap.Strings("changed", changed), zap.Error(err))
+			w.rollback(w.subscribers[:i], next, old)
+			return err
+		}
+	}
+
+	w.current = next
+	w.log.Info("Configuration reloaded", zap.Strings("changed", changed))
+	return nil
+}
+
+// rollback restores the previous snapshot in subscribers that already applied the new one
+func (w *Watcher) rollback(applied []subscriber, next, old *Config) {
+	for i := len(applied) - 1; i >= 0; i-- {
+		if err := applied[i].apply(next, old); err != nil {
+			w.log.Error("Failed to restore previous configuration",
+				zap.String("subscriber", applied[i].name), zap.Error(err))
+		}
+	}
+}
+
+// Start checks for changes every interval until the returned function is called. A change of the
+// config file's size or modification time, or of any resolved secret, triggers a Reload.
+func (w *Watcher) Start(interval time.Duration) func() {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				if w.changed() {
+					_ = w.Reload()
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
+
+// changed reports whether the config file or a secret differs from the last check
+func (w *Watcher) changed() bool {
+	current := w.Current()
+
+	changed := false
+	if state := fileState(current.file); state != w.fileState {
+		w.fileState = state
+		changed = true
+	}
+	if current.secrets != nil {
+		rotated, err := current.secrets.Refresh()
+		if err != nil {
+			w.log.Warn("Failed to refresh secrets", zap.Error(err))
+		}
+		if len(rotated) > 0 {
+			changed = true
+		}
+	}
+	return changed
+}
+
+// fileState identifies the version of a file by its size and modification time
+func fileState(path string) string {
+	if path == "" {
+		return ""
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "missing"
+	}
+	return fmt.Sprintf("%d/%d", info.Size(), info.ModTime().UnixNano())
+}
+
+// changedSettings lists the paths of settings that differ between two snapshots
+func changedSettings(old, next *Config) []string {
+	var changed []string
+	oldSettings, nextSettings := old.settings(), next.settings()
+	for i, s := range oldSettings {
+		if formatValue(s.value) != formatValue(nextSettings[i].value) {
+			changed = append(changed, s.path)
+		}
+	}
+	return changed
+}
@@ -0,0 +1,136 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// applied records the snapshots a subscriber was called with
+type applied struct {
+	calls []string // old -> new log.level
+	err   error
+}
+
+func (a *applied) apply(old, new *Config) error {
+	a.calls = append(a.calls, old.Log.Level+" -> "+new.Log.Level)
+	return a.err
+}
+
+// newWatcher loads a config from a file setting log.level and watches it
+func newWatcher(t *testing.T) (*Watcher, func(content string)) {
+	t.Helper()
+	path := writeFile(t, "config.yaml", "log:\n  level: info\n")
+	initial, err := Load("test-service", WithFile(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return NewWatcher(initial, zap.NewNop()), write
+}
+
+func TestWatcherReload(t *testing.T) {
+	w, write := newWatcher(t)
+	logger, database := &applied{}, &applied{}
+	w.Subscribe("logger", logger.apply)
+	w.Subscribe("database", database.apply)
+
+	// Nothing changed, nothing applied
+	if err := w.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if len(logger.calls) != 0 {
+		t.Errorf("unchanged configuration applied: %q", logger.calls)
+	}
+
+	write("log:\n  level: debug\n")
+	if err := w.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	for name, s := range map[string]*applied{"logger": logger, "database": database} {
+		if len(s.calls) != 1 || s.calls[0] != "info -> debug" {
+			t.Errorf("%s called with %q", name, s.calls)
+		}
+	}
+	if got := w.Current().Log.Level; got != "debug" {
+		t.Errorf("current log.level %q", got)
+	}
+}
+
+func TestWatcherRejectedReloadRollsBack(t *testing.T) {
+	w, write := newWatcher(t)
+	logger, database, tokens := &applied{}, &applied{err: errors.New("pool busy")}, &applied{}
+	w.Subscribe("logger", logger.apply)
+	w.Subscribe("database", database.apply)
+	w.Subscribe("tokens", tokens.apply)
+
+	write("log:\n  level: debug\n")
+	err := w.Reload()
+	if err == nil || !strings.Contains(err.Error(), "database rejected the configuration: pool busy") {
+		t.Fatalf("Reload error %v", err)
+	}
+
+	// The logger applied the snapshot and is restored; later subscribers never saw it
+	if want := []string{"info -> debug", "debug -> info"}; strings.Join(logger.calls, ",") != strings.Join(want, ",") {
+		t.Errorf("logger called with %q, want %q", logger.calls, want)
+	}
+	if len(database.calls) != 1 || len(tokens.calls) != 0 {
+		t.Errorf("database called with %q, tokens with %q", database.calls, tokens.calls)
+	}
+	if got := w.Current().Log.Level; got != "info" {
+		t.Errorf("current log.level %q after a rejected reload", got)
+	}
+}
+
+func TestWatcherUnparsableFile(t *testing.T) {
+	w, write := newWatcher(t)
+	logger := &applied{}
+	w.Subscribe("logger", logger.apply)
+
+	for name, content := range map[string]string{
+		"syntax error":  "log:\n  level: [debug\n",
+		"invalid value": "log:\n  level: loud\n",
+	} {
+		write(content)
+		if err := w.Reload(); err == nil {
+			t.Errorf("%s: reloaded", name)
+		}
+	}
+	if len(logger.calls) != 0 {
+		t.Errorf("logger called with %q", logger.calls)
+	}
+	if got := w.Current().Log.Level; got != "info" {
+		t.Errorf("current log.level %q after a failed reload", got)
+	}
+}
+
+func TestWatcherStart(t *testing.T) {
+	w, write := newWatcher(t)
+	reloaded := make(chan string, 1)
+	w.Subscribe("logger", func(old, new *Config) error {
+		reloaded <- new.Log.Level
+		return nil
+	})
+
+	stop := w.Start(10 * time.Millisecond)
+	defer stop()
+	write("log:\n  level: warn\n")
+
+	select {
+	case level := <-reloaded:
+		if level != "warn" {
+			t.Errorf("reloaded log.level %q", level)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("file change not picked up")
+	}
+}
@@ -1,11 +1,12 @@
 package database
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"sync/atomic"
 
 	"github.com/suteetoe/gomicro/config"
-	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
@@ -13,20 +14,23 @@ import (
 // DB is the global database instance
 var DB *gorm.DB
 
-// InitDB initializes the database connection with configuration
-func InitDB(dbConfig *config.DBConfig) (*gorm.DB, error) {
-	var err error
+// replicaRouter is the ReplicaRouter registered by InitDB, if any
+var replicaRouter *ReplicaRouter
 
-	// Configure Postgres options
-	pgConfig := postgres.Config{
-		DSN:                  dbConfig.GetDSN(),
-		PreferSimpleProtocol: true, // Disables implicit prepared statement usage
-	}
+// password is the password of new connections to the primary, replaced by ApplyConfig when it rotates
+var password atomic.Pointer[string]
+
+// InitDB initializes the database connection with configuration and registers the given plugins,
+// such as NewMetricsPlugin and NewReplicaRouter. It waits for the database according to the
+// connect retry settings of dbConfig.
+func InitDB(dbConfig *config.DBConfig, plugins ...gorm.Plugin) (*gorm.DB, error) {
+	var err error
 
-	// Open connection
-	DB, err = gorm.Open(postgres.New(pgConfig), &gorm.Config{
+	// Open connection, retrying while the database is starting
+	password.Store(&dbConfig.Password)
+	DB, err = open(dbConfig.GetDSN(), func() string { return *password.Load() }, &gorm.Config{
 		Logger: logger.Default.LogMode(dbConfig.LogLevel),
-	})
+	}, RetryPolicyFor(dbConfig))
 	if err != nil {
 		log.Printf("Failed to connect to database: %v", err)
 		return nil, err
@@ -44,11 +48,60 @@ func InitDB(dbConfig *config.DBConfig) (*gorm.DB, error) {
 	sqlDB.SetMaxOpenConns(dbConfig.MaxOpenConns)
 	sqlDB.SetConnMaxLifetime(dbConfig.ConnMaxLifetime)
 
+	// Register plugins
+	for _, plugin := range plugins {
+		router, isRouter := plugin.(*ReplicaRouter)
+		if isRouter && router.Retry == (RetryPolicy{}) {
+			router.Retry = RetryPolicyFor(dbConfig)
+		}
+		if err := DB.Use(plugin); err != nil {
+			log.Printf("Failed to register database plugin %s: %v", plugin.Name(), err)
+			return nil, err
+		}
+		if isRouter {
+			router.SetPool(dbConfig.MaxIdleConns, dbConfig.MaxOpenConns, dbConfig.ConnMaxLifetime)
+			replicaRouter = router
+		}
+	}
+
 	fmt.Println("Database connected successfully")
 
 	return DB, nil
 }
 
+// ApplyConfig applies the pool settings and the password of a reloaded configuration, for use with
+// config.Watcher. Connections opened after a password rotation use the new password, and
+// db.conn_max_lifetime retires the others. The other connection settings, such as the host, and
+// the read replicas only take effect after a restart.
+func ApplyConfig(old, new *config.Config) error {
+	if DB == nil {
+		return fmt.Errorf("database is not initialized")
+	}
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+
+	sqlDB.SetMaxIdleConns(new.DB.MaxIdleConns)
+	sqlDB.SetMaxOpenConns(new.DB.MaxOpenConns)
+	sqlDB.SetConnMaxLifetime(new.DB.ConnMaxLifetime)
+	if replicaRouter != nil {
+		replicaRouter.SetPool(new.DB.MaxIdleConns, new.DB.MaxOpenConns, new.DB.ConnMaxLifetime)
+	}
+
+	if new.DB.Password != old.DB.Password {
+		password.Store(&new.DB.Password)
+		log.Printf("Database password rotated; new connections use it")
+	}
+
+	oldSettings, newSettings := old.DB, new.DB
+	oldSettings.Password, newSettings.Password = "", ""
+	if oldSettings.GetDSN() != newSettings.GetDSN() || old.DB.ReadReplicas != new.DB.ReadReplicas {
+		log.Printf("Database connection settings changed; restart the service to apply them")
+	}
+	return nil
+}
+
 // MigrateModels runs migrations for the provided models
 func MigrateModels(models ...interface{}) error {
 	if DB == nil {
@@ -62,6 +115,22 @@ func MigrateModels(models ...interface{}) error {
 	return nil
 }
 
+// Close closes the connection pool of db and those of the read replicas registered on it, once
+// the service no longer runs statements, e.g. on shutdown
+func Close(db *gorm.DB) error {
+	var errs []error
+	for _, plugin := range db.Config.Plugins {
+		if router, ok := plugin.(*ReplicaRouter); ok {
+			errs = append(errs, router.Close())
+		}
+	}
+	sqlDB, err := db.DB()
+	if err == nil {
+		err = sqlDB.Close()
+	}
+	return errors.Join(append(errs, err)...)
+}
+
 // GetDB returns the database instance
 func GetDB() *gorm.DB {
 	return DB
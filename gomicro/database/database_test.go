@@ -0,0 +1,46 @@
+package database
+
+import (
+	"database/sql/driver"
+	"testing"
+
+	"github.com/suteetoe/gomicro/config"
+	"github.com/suteetoe/gomicro/internal/dbtest"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestApplyConfigRotatesPassword(t *testing.T) {
+	DB = dbtest.Open(t, func(string, []driver.Value) (dbtest.Result, error) { return dbtest.Result{}, nil })
+	t.Cleanup(func() { DB = nil })
+
+	old := &config.Config{DB: config.DBConfig{Host: "postgres", Password: "old", MaxIdleConns: 1, MaxOpenConns: 2}}
+	password.Store(&old.DB.Password)
+
+	rotated := *old
+	rotated.DB.Password = "new"
+	rotated.DB.MaxOpenConns = 5
+	if err := ApplyConfig(old, &rotated); err != nil {
+		t.Fatal(err)
+	}
+	if got := *password.Load(); got != "new" {
+		t.Errorf("new connections use password %q", got)
+	}
+	sqlDB, _ := DB.DB()
+	if got := sqlDB.Stats().MaxOpenConnections; got != 5 {
+		t.Errorf("max open connections %d", got)
+	}
+}
+
+func TestOpenAsksForThePasswordOfEachConnection(t *testing.T) {
+	calls := 0
+	// Nothing listens on port 1, so every connection attempt fails after asking for the password
+	_, err := open("host=127.0.0.1 port=1 user=app password=stale dbname=app sslmode=disable connect_timeout=1",
+		func() string { calls++; return "current" }, &gorm.Config{Logger: logger.Discard}, RetryPolicy{Retries: 1})
+	if err == nil {
+		t.Fatal("connected to a closed port")
+	}
+	if calls != 2 {
+		t.Errorf("password asked %d times for 2 attempts", calls)
+	}
+}
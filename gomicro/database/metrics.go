@@ -0,0 +1,173 @@
+package database
+
+import (
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"gorm.io/gorm"
+)
+
+const (
+	// metricsStartKey stores the statement start time on the GORM instance
+	metricsStartKey = "gomicro:metrics_start"
+
+	// noTableLabel is recorded for statements such as raw SQL that GORM cannot attribute to a table
+	noTableLabel = "none"
+)
+
+// MetricsPlugin is a GORM plugin that records the duration, rows affected and errors of every
+// statement per table and operation, and exports the connection pool statistics
+type MetricsPlugin struct {
+	ServiceName string
+	ConstLabels prometheus.Labels
+
+	registerer prometheus.Registerer
+	buckets    []float64
+
+	// QueryDurationHistogram records statement duration in seconds
+	QueryDurationHistogram *prometheus.HistogramVec
+	// RowsAffectedCounter counts rows returned or changed by statements
+	RowsAffectedCounter *prometheus.CounterVec
+	// ErrorCounter counts failed statements; gorm.ErrRecordNotFound is not an error
+	ErrorCounter *prometheus.CounterVec
+}
+
+// MetricsOption configures a MetricsPlugin
+type MetricsOption func(*MetricsPlugin)
+
+// WithRegisterer registers the plugin metrics on registerer instead of the global registry
+func WithRegisterer(registerer prometheus.Registerer) MetricsOption {
+	return func(p *MetricsPlugin) {
+		p.registerer = registerer
+	}
+}
+
+// WithConstLabels attaches constant labels to every metric. Labels with empty values are skipped.
+func WithConstLabels(labels prometheus.Labels) MetricsOption {
+	return func(p *MetricsPlugin) {
+		if p.ConstLabels == nil {
+			p.ConstLabels = prometheus.Labels{}
+		}
+		for name, value := range labels {
+			if value != "" {
+				p.ConstLabels[name] = value
+			}
+		}
+	}
+}
+
+// WithBuckets sets the statement duration histogram buckets instead of prometheus.DefBuckets
+func WithBuckets(buckets []float64) MetricsOption {
+	return func(p *MetricsPlugin) {
+		p.buckets = buckets
+	}
+}
+
+// NewMetricsPlugin creates a metrics plugin for a specific service; register it with db.Use
+func NewMetricsPlugin(serviceName string, opts ...MetricsOption) *MetricsPlugin {
+	p := &MetricsPlugin{
+		ServiceName: serviceName,
+		registerer:  prometheus.DefaultRegisterer,
+		buckets:     prometheus.DefBuckets,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// Name implements gorm.Plugin
+func (p *MetricsPlugin) Name() string {
+	return "gomicro:metrics"
+}
+
+// Initialize implements gorm.Plugin by registering the metrics and the statement callbacks
+func (p *MetricsPlugin) Initialize(db *gorm.DB) error {
+	p.QueryDurationHistogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:        "db_query_duration_seconds",
+		Help:        "Duration of database statements in seconds",
+		Buckets:     p.buckets,
+		ConstLabels: p.ConstLabels,
+	}, []string{"service", "table", "operation"})
+	p.RowsAffectedCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        "db_rows_affected_total",
+		Help:        "Total number of rows returned or changed by database statements",
+		ConstLabels: p.ConstLabels,
+	}, []string{"service", "table", "operation"})
+	p.ErrorCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        "db_errors_total",
+		Help:        "Total number of failed database statements",
+		ConstLabels: p.ConstLabels,
+	}, []string{"service", "table", "operation"})
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+
+	for _, collector := range []prometheus.Collector{
+		p.QueryDurationHistogram,
+		p.RowsAffectedCounter,
+		p.ErrorCounter,
+		collectors.NewDBStatsCollector(sqlDB, p.ServiceName),
+	} {
+		if err := p.registerer.Register(collector); err != nil {
+			return err
+		}
+	}
+
+	return p.registerCallbacks(db)
+}
+
+// registerCallbacks wraps each GORM processor so every statement is timed
+func (p *MetricsPlugin) registerCallbacks(db *gorm.DB) error {
+	callbacks := db.Callback()
+	return errors.Join(
+		callbacks.Create().Before("gorm:create").Register("gomicro:metrics_before_create", p.before),
+		callbacks.Create().After("gorm:create").Register("gomicro:metrics_after_create", p.after("create")),
+		callbacks.Query().Before("gorm:query").Register("gomicro:metrics_before_query", p.before),
+		callbacks.Query().After("gorm:query").Register("gomicro:metrics_after_query", p.after("query")),
+		callbacks.Update().Before("gorm:update").Register("gomicro:metrics_before_update", p.before),
+		callbacks.Update().After("gorm:update").Register("gomicro:metrics_after_update", p.after("update")),
+		callbacks.Delete().Before("gorm:delete").Register("gomicro:metrics_before_delete", p.before),
+		callbacks.Delete().After("gorm:delete").Register("gomicro:metrics_after_delete", p.after("delete")),
+		callbacks.Row().Before("gorm:row").Register("gomicro:metrics_before_row", p.before),
+		callbacks.Row().After("gorm:row").Register("gomicro:metrics_after_row", p.after("row")),
+		callbacks.Raw().Before("gorm:raw").Register("gomicro:metrics_before_raw", p.before),
+		callbacks.Raw().After("gorm:raw").Register("gomicro:metrics_after_raw", p.after("raw")),
+	)
+}
+
+// before records the statement start time
+func (p *MetricsPlugin) before(db *gorm.DB) {
+	db.InstanceSet(metricsStartKey, time.Now())
+}
+
+// after returns a callback that records the statement metrics for operation
+func (p *MetricsPlugin) after(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		value, ok := db.InstanceGet(metricsStartKey)
+		if !ok {
+			return
+		}
+		start, ok := value.(time.Time)
+		if !ok {
+			return
+		}
+
+		table := db.Statement.Table
+		if table == "" {
+			table = noTableLabel
+		}
+
+		p.QueryDurationHistogram.WithLabelValues(p.ServiceName, table, operation).Observe(time.Since(start).Seconds())
+		if db.RowsAffected > 0 {
+			p.RowsAffectedCounter.WithLabelValues(p.ServiceName, table, operation).Add(float64(db.RowsAffected))
+		}
+		if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+			p.ErrorCounter.WithLabelValues(p.ServiceName, table, operation).Inc()
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package database
+
+import (
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/suteetoe/gomicro/internal/dbtest"
+)
+
+func TestMetricsPlugin(t *testing.T) {
+	db := dbtest.Open(t, func(query string, args []driver.Value) (dbtest.Result, error) {
+		switch {
+		case strings.HasPrefix(query, "UPDATE"):
+			return dbtest.Result{}, errors.New("deadlock detected")
+		case strings.Contains(query, `"plain_items"."id" = $1`):
+			return dbtest.Result{Columns: []string{"id", "name"}}, nil
+		case strings.HasPrefix(query, "SELECT"):
+			return dbtest.Result{Columns: []string{"id", "name"}, Rows: [][]driver.Value{{int64(1), "a"}, {int64(2), "b"}}}, nil
+		}
+		return dbtest.Result{RowsAffected: 3}, nil
+	})
+	registry := prometheus.NewRegistry()
+	plugin := NewMetricsPlugin("products", WithRegisterer(registry), WithConstLabels(prometheus.Labels{"region": "eu", "instance": ""}))
+	if err := db.Use(plugin); err != nil {
+		t.Fatal(err)
+	}
+
+	var items []plainItem
+	if err := db.Find(&items).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Model(&plainItem{}).Where("id = ?", 1).Update("name", "c").Error; err == nil {
+		t.Fatal("update succeeded")
+	}
+	// A missing record is an answer, not a failure
+	var missing plainItem
+	db.First(&missing, 7)
+	if err := db.Exec("DELETE FROM plain_items WHERE name = ?", "c").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if got := testutil.ToFloat64(plugin.RowsAffectedCounter.WithLabelValues("products", "plain_items", "query")); got != 2 {
+		t.Errorf("query rows %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(plugin.RowsAffectedCounter.WithLabelValues("products", noTableLabel, "raw")); got != 3 {
+		t.Errorf("raw rows %v, want 3", got)
+	}
+	if got := testutil.ToFloat64(plugin.ErrorCounter.WithLabelValues("products", "plain_items", "update")); got != 1 {
+		t.Errorf("update errors %v, want 1", got)
+	}
+	if got := testutil.CollectAndCount(plugin.ErrorCounter); got != 1 {
+		t.Errorf("%d error series, want only the failed update", got)
+	}
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	durations := map[string]uint64{}
+	for _, family := range families {
+		if family.GetName() != "db_query_duration_seconds" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := labelMap(metric.GetLabel())
+			if labels["service"] != "products" || labels["region"] != "eu" {
+				t.Errorf("duration labels %v", labels)
+			}
+			if _, ok := labels["instance"]; ok {
+				t.Error("empty constant label exported")
+			}
+			durations[labels["table"]+" "+labels["operation"]] = metric.GetHistogram().GetSampleCount()
+		}
+	}
+	want := map[string]uint64{"plain_items query": 2, "plain_items update": 1, "none raw": 1}
+	if len(durations) != len(want) {
+		t.Errorf("duration series %v, want %v", durations, want)
+	}
+	for series, count := range want {
+		if durations[series] != count {
+			t.Errorf("%s observed %d statements, want %d", series, durations[series], count)
+		}
+	}
+
+	// The pool statistics are exported next to the statement metrics
+	if got, err := testutil.GatherAndCount(registry, "go_sql_open_connections"); err != nil || got != 1 {
+		t.Errorf("pool statistics %d series: %v", got, err)
+	}
+}
+
+// labelMap returns the label pairs of a gathered metric by name
+func labelMap(pairs []*dto.LabelPair) map[string]string {
+	labels := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		labels[pair.GetName()] = pair.GetValue()
+	}
+	return labels
+}
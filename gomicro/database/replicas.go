@@ -0,0 +1,245 @@
+package database
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+// Routing targets recorded by ReplicaRouter
+const (
+	TargetPrimary     = "primary"
+	TargetReplica     = "replica"
+	TargetTransaction = "transaction"
+)
+
+// DefaultReplicaCooldown is how long reads avoid a replica after a connection error
+const DefaultReplicaCooldown = 30 * time.Second
+
+// ReplicaRouter is a GORM plugin that sends reads to read replicas and keeps writes, locking
+// reads and transactions on the primary. A replica that fails with a connection error is marked
+// unhealthy, and its reads go to another replica, or else the primary, until the cooldown ends.
+// Every routing decision is counted in db_routing_total. Without replica DSNs the plugin does
+// nothing.
+type ReplicaRouter struct {
+	ServiceName string
+	DSNs        []string
+	// Retry is used to connect to each replica; InitDB fills it from DBConfig when it is zero
+	Retry RetryPolicy
+	// Cooldown is how long a failed replica is skipped; it defaults to DefaultReplicaCooldown
+	Cooldown time.Duration
+
+	// Registerer receives the routing counter and the pool statistics of the replicas; it
+	// defaults to the global registry
+	Registerer prometheus.Registerer
+
+	// RoutingCounter counts statements per operation and target
+	RoutingCounter *prometheus.CounterVec
+
+	// replicas maps the connection pool of each replica to its number, starting at 1
+	replicas map[gorm.ConnPool]int
+	sqlDBs   []*sql.DB
+	primary  gorm.ConnPool
+
+	mu sync.Mutex
+	// unhealthy holds the replicas that failed and when they may be used again
+	unhealthy map[gorm.ConnPool]time.Time
+}
+
+// NewReplicaRouter creates a router for the given replica DSNs; register it with db.Use or InitDB
+func NewReplicaRouter(serviceName string, dsns ...string) *ReplicaRouter {
+	return &ReplicaRouter{
+		ServiceName: serviceName,
+		DSNs:        dsns,
+		Registerer:  prometheus.DefaultRegisterer,
+		Cooldown:    DefaultReplicaCooldown,
+		replicas:    make(map[gorm.ConnPool]int),
+		unhealthy:   make(map[gorm.ConnPool]time.Time),
+	}
+}
+
+// Name implements gorm.Plugin
+func (r *ReplicaRouter) Name() string {
+	return "gomicro:replicas"
+}
+
+// Initialize implements gorm.Plugin by connecting to the replicas and registering dbresolver
+func (r *ReplicaRouter) Initialize(db *gorm.DB) error {
+	if len(r.DSNs) == 0 {
+		return nil
+	}
+
+	replicas := make([]*gorm.DB, 0, len(r.DSNs))
+	for i, dsn := range r.DSNs {
+		replica, err := Open(dsn, &gorm.Config{Logger: db.Logger}, r.Retry)
+		if err != nil {
+			return fmt.Errorf("read replica %d: %w", i+1, err)
+		}
+		replicas = append(replicas, replica)
+	}
+	return r.register(db, replicas)
+}
+
+// register routes the reads of db to the connected replicas
+func (r *ReplicaRouter) register(db *gorm.DB, replicas []*gorm.DB) error {
+	dialectors := make([]gorm.Dialector, 0, len(replicas))
+	for i, replica := range replicas {
+		sqlDB, err := replica.DB()
+		if err != nil {
+			return err
+		}
+		if err := r.Registerer.Register(collectors.NewDBStatsCollector(sqlDB, fmt.Sprintf("%s_replica_%d", r.ServiceName, i+1))); err != nil {
+			return err
+		}
+		r.sqlDBs = append(r.sqlDBs, sqlDB)
+		r.replicas[sqlDB] = i + 1
+		// Reuse the connection so that routed statements can be matched to the replica
+		dialectors = append(dialectors, postgres.New(postgres.Config{Conn: sqlDB, PreferSimpleProtocol: true}))
+	}
+
+	r.primary = db.ConnPool
+	if prepared, ok := r.primary.(*gorm.PreparedStmtDB); ok {
+		r.primary = prepared.ConnPool
+	}
+	if err := db.Use(dbresolver.Register(dbresolver.Config{Replicas: dialectors})); err != nil {
+		return err
+	}
+
+	r.RoutingCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "db_routing_total",
+		Help: "Total number of database statements by the connection they were routed to",
+	}, []string{"service", "operation", "target"})
+	if err := r.Registerer.Register(r.RoutingCounter); err != nil {
+		return err
+	}
+
+	callbacks := db.Callback()
+	return errors.Join(
+		callbacks.Create().After("gorm:db_resolver").Before("gorm:create").Register("gomicro:routing_create", r.record("create")),
+		callbacks.Query().After("gorm:db_resolver").Before("gorm:query").Register("gomicro:routing_query", r.record("query")),
+		callbacks.Update().After("gorm:db_resolver").Before("gorm:update").Register("gomicro:routing_update", r.record("update")),
+		callbacks.Delete().After("gorm:db_resolver").Before("gorm:delete").Register("gomicro:routing_delete", r.record("delete")),
+		callbacks.Row().After("gorm:db_resolver").Before("gorm:row").Register("gomicro:routing_row", r.record("row")),
+		callbacks.Raw().After("gorm:db_resolver").Before("gorm:raw").Register("gomicro:routing_raw", r.record("raw")),
+		callbacks.Query().After("gorm:query").Register("gomicro:replica_health_query", r.checkHealth),
+		callbacks.Row().After("gorm:row").Register("gomicro:replica_health_row", r.checkHealth),
+		callbacks.Raw().After("gorm:raw").Register("gomicro:replica_health_raw", r.checkHealth),
+	)
+}
+
+// record returns a callback moving statements off unhealthy replicas and counting where they
+// were routed
+func (r *ReplicaRouter) record(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		db.Statement.ConnPool = r.healthy(db.Statement.ConnPool)
+		r.RoutingCounter.WithLabelValues(r.ServiceName, operation, r.target(db.Statement.ConnPool)).Inc()
+	}
+}
+
+// healthy returns pool, or in place of an unhealthy replica another replica or else the primary
+func (r *ReplicaRouter) healthy(pool gorm.ConnPool) gorm.ConnPool {
+	if _, ok := r.replicas[unwrapPool(pool)]; !ok {
+		return pool
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	if !r.failedLocked(unwrapPool(pool), now) {
+		return pool
+	}
+	for _, sqlDB := range r.sqlDBs {
+		if !r.failedLocked(sqlDB, now) {
+			return sqlDB
+		}
+	}
+	return r.primary
+}
+
+// failedLocked reports whether the replica is in its cooldown; r.mu must be held
+func (r *ReplicaRouter) failedLocked(pool gorm.ConnPool, now time.Time) bool {
+	until, ok := r.unhealthy[pool]
+	if ok && !now.Before(until) {
+		delete(r.unhealthy, pool)
+		return false
+	}
+	return ok
+}
+
+// checkHealth marks the replica of a statement that failed with a connection error unhealthy
+func (r *ReplicaRouter) checkHealth(db *gorm.DB) {
+	pool := unwrapPool(db.Statement.ConnPool)
+	number, ok := r.replicas[pool]
+	if !ok || db.Error == nil || !isConnectionError(db.Error) {
+		return
+	}
+	cooldown := r.Cooldown
+	if cooldown <= 0 {
+		cooldown = DefaultReplicaCooldown
+	}
+	r.mu.Lock()
+	r.unhealthy[pool] = time.Now().Add(cooldown)
+	r.mu.Unlock()
+	log.Printf("Read replica %d failed, routing its reads elsewhere for %s: %v", number, cooldown, db.Error)
+}
+
+// isConnectionError reports whether err means the database could not be reached, rather than
+// that it rejected the statement
+func isConnectionError(err error) bool {
+	var netErr net.Error
+	var connectErr *pgconn.ConnectError
+	return errors.Is(err, driver.ErrBadConn) || errors.As(err, &netErr) || errors.As(err, &connectErr)
+}
+
+// unwrapPool returns the connection pool behind a prepared statement pool
+func unwrapPool(pool gorm.ConnPool) gorm.ConnPool {
+	if prepared, ok := pool.(*gorm.PreparedStmtDB); ok {
+		return prepared.ConnPool
+	}
+	return pool
+}
+
+// target classifies the connection pool chosen for a statement
+func (r *ReplicaRouter) target(pool gorm.ConnPool) string {
+	if _, ok := pool.(gorm.TxCommitter); ok {
+		return TargetTransaction
+	}
+	if _, ok := r.replicas[unwrapPool(pool)]; ok {
+		return TargetReplica
+	}
+	return TargetPrimary
+}
+
+// SetPool applies connection pool settings to every replica
+func (r *ReplicaRouter) SetPool(maxIdleConns, maxOpenConns int, connMaxLifetime time.Duration) {
+	for _, sqlDB := range r.sqlDBs {
+		sqlDB.SetMaxIdleConns(maxIdleConns)
+		sqlDB.SetMaxOpenConns(maxOpenConns)
+		sqlDB.SetConnMaxLifetime(connMaxLifetime)
+	}
+}
+
+// Close closes the connection pools of the replicas
+func (r *ReplicaRouter) Close() error {
+	var errs []error
+	for _, sqlDB := range r.sqlDBs {
+		errs = append(errs, sqlDB.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// Primary forces the statement onto the primary, e.g. to read a row right after writing it
+func Primary(db *gorm.DB) *gorm.DB {
+	return db.Clauses(dbresolver.Write)
+}
@@ -0,0 +1,145 @@
+package database
+
+import (
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/suteetoe/gomicro/internal/dbtest"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// fakeDatabase records the statements it answers and fails them with err when set
+type fakeDatabase struct {
+	statements []string
+	err        error
+}
+
+func (f *fakeDatabase) open(t *testing.T) *gorm.DB {
+	return dbtest.Open(t, func(query string, _ []driver.Value) (dbtest.Result, error) {
+		f.statements = append(f.statements, strings.Fields(query)[0])
+		if f.err != nil {
+			return dbtest.Result{}, f.err
+		}
+		return dbtest.Result{Columns: []string{"id", "name"}, RowsAffected: 1}, nil
+	})
+}
+
+// take returns the statements answered since the last call
+func (f *fakeDatabase) take() string {
+	statements := strings.Join(f.statements, " ")
+	f.statements = nil
+	return statements
+}
+
+func TestReplicaRouter(t *testing.T) {
+	primary, replica := &fakeDatabase{}, &fakeDatabase{}
+	db := primary.open(t)
+	router := NewReplicaRouter("products")
+	router.Registerer = prometheus.NewRegistry()
+	router.Cooldown = time.Hour
+	if err := router.register(db, []*gorm.DB{replica.open(t)}); err != nil {
+		t.Fatal(err)
+	}
+
+	var items []plainItem
+	tests := []struct {
+		name        string
+		run         func() error
+		wantPrimary string
+		wantReplica string
+	}{
+		{"read", func() error { return db.Find(&items).Error }, "", "SELECT"},
+		{"raw read", func() error { return db.Raw("SELECT * FROM plain_items").Scan(&items).Error }, "", "SELECT"},
+		// Writes run in GORM's default transaction
+		{"write", func() error { return db.Model(&plainItem{}).Where("id = ?", 1).Update("name", "tea").Error }, "BEGIN UPDATE COMMIT", ""},
+		{"raw write", func() error { return db.Exec("DELETE FROM plain_items").Error }, "DELETE", ""},
+		{"locking read", func() error { return db.Clauses(clause.Locking{Strength: "UPDATE"}).Find(&items).Error }, "SELECT", ""},
+		{"forced primary", func() error { return Primary(db).Find(&items).Error }, "SELECT", ""},
+		{"transaction", func() error {
+			return db.Transaction(func(tx *gorm.DB) error { return tx.Find(&items).Error })
+		}, "BEGIN SELECT COMMIT", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.run(); err != nil {
+				t.Fatal(err)
+			}
+			if got := primary.take(); got != tt.wantPrimary {
+				t.Errorf("primary ran %q, want %q", got, tt.wantPrimary)
+			}
+			if got := replica.take(); got != tt.wantReplica {
+				t.Errorf("replica ran %q, want %q", got, tt.wantReplica)
+			}
+		})
+	}
+
+	for target, want := range map[string]float64{
+		"query " + TargetReplica:      1,
+		"row " + TargetReplica:        1,
+		"update " + TargetTransaction: 1,
+		"raw " + TargetPrimary:        1,
+		"query " + TargetPrimary:      2,
+		"query " + TargetTransaction:  1,
+	} {
+		operation, target, _ := strings.Cut(target, " ")
+		if got := testutil.ToFloat64(router.RoutingCounter.WithLabelValues("products", operation, target)); got != want {
+			t.Errorf("%s routed to %s %v times, want %v", operation, target, got, want)
+		}
+	}
+}
+
+func TestReplicaRouterSkipsFailedReplicas(t *testing.T) {
+	primary, replica := &fakeDatabase{}, &fakeDatabase{}
+	db := primary.open(t)
+	replicaDB := replica.open(t)
+	router := NewReplicaRouter("products")
+	router.Registerer = prometheus.NewRegistry()
+	router.Cooldown = time.Hour
+	if err := router.register(db, []*gorm.DB{replicaDB}); err != nil {
+		t.Fatal(err)
+	}
+	var items []plainItem
+
+	// A statement the replica rejects leaves it in use
+	replica.err = errors.New(`relation "plain_items" does not exist`)
+	if err := db.Find(&items).Error; err == nil {
+		t.Fatal("failed read succeeded")
+	}
+	replica.err = nil
+	db.Find(&items)
+	if replica.take() != "SELECT SELECT" || primary.take() != "" {
+		t.Fatal("replica skipped after a statement error")
+	}
+
+	// A replica that cannot be reached is skipped until the cooldown ends
+	replica.err = driver.ErrBadConn
+	if err := db.Find(&items).Error; err == nil {
+		t.Fatal("read from a lost replica succeeded")
+	}
+	replica.take()
+	if err := db.Find(&items).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got := primary.take(); got != "SELECT" {
+		t.Errorf("primary ran %q, want the read of the failed replica", got)
+	}
+	if got := replica.take(); got != "" {
+		t.Errorf("failed replica ran %q", got)
+	}
+
+	sqlDB, _ := replicaDB.DB()
+	router.mu.Lock()
+	router.unhealthy[sqlDB] = time.Now()
+	router.mu.Unlock()
+	replica.err = nil
+	db.Find(&items)
+	if got := replica.take(); got != "SELECT" {
+		t.Errorf("replica ran %q after the cooldown, want the read", got)
+	}
+}
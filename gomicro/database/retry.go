@@ -0,0 +1,119 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"math/rand"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/suteetoe/gomicro/config"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// RetryPolicy controls how Open waits for a database that is not accepting connections yet,
+// e.g. while Postgres is still starting next to the service
+type RetryPolicy struct {
+	// Retries is the number of attempts after the first one; 0 disables retrying
+	Retries int
+	// InitialBackoff is the wait before the first retry; it doubles after every attempt
+	InitialBackoff time.Duration
+	// MaxBackoff caps the wait between attempts
+	MaxBackoff time.Duration
+}
+
+// DefaultRetryPolicy waits up to about a minute for the database
+var DefaultRetryPolicy = RetryPolicy{
+	Retries:        10,
+	InitialBackoff: 500 * time.Millisecond,
+	MaxBackoff:     10 * time.Second,
+}
+
+// RetryPolicyFor returns the retry policy configured by DB_CONNECT_RETRIES, DB_CONNECT_BACKOFF
+// and DB_CONNECT_MAX_BACKOFF
+func RetryPolicyFor(dbConfig *config.DBConfig) RetryPolicy {
+	return RetryPolicy{
+		Retries:        dbConfig.ConnectRetries,
+		InitialBackoff: dbConfig.ConnectBackoff,
+		MaxBackoff:     dbConfig.ConnectMaxBackoff,
+	}
+}
+
+// backoff returns the wait before the given retry, starting at 1. The wait is chosen at random
+// between half and all of the exponential backoff so that replicas starting together spread out.
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	wait := p.InitialBackoff
+	for i := 1; i < retry && (p.MaxBackoff <= 0 || wait < p.MaxBackoff); i++ {
+		wait *= 2
+	}
+	if p.MaxBackoff > 0 && wait > p.MaxBackoff {
+		wait = p.MaxBackoff
+	}
+	if wait <= 0 {
+		return 0
+	}
+	half := int64(wait / 2)
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+// Open connects to Postgres, retrying with exponential backoff and jitter until the database
+// accepts connections or the retries run out
+func Open(dsn string, gormConfig *gorm.Config, retry RetryPolicy) (*gorm.DB, error) {
+	return open(dsn, nil, gormConfig, retry)
+}
+
+// open is Open with an optional password function, which replaces the password of dsn for every
+// new connection so that a rotated password is used without reopening the pool
+func open(dsn string, password func() string, gormConfig *gorm.Config, retry RetryPolicy) (*gorm.DB, error) {
+	for attempt := 0; ; attempt++ {
+		dialector := postgres.New(postgres.Config{
+			DSN:                  dsn,
+			PreferSimpleProtocol: true, // Disables implicit prepared statement usage
+		})
+		if password != nil {
+			pool, err := openPool(dsn, password)
+			if err != nil {
+				return nil, err
+			}
+			dialector = postgres.New(postgres.Config{Conn: pool})
+		}
+
+		// gorm.Open keeps state in its config, so every attempt starts from a copy
+		attemptConfig := *gormConfig
+		db, err := gorm.Open(dialector, &attemptConfig)
+		if err == nil {
+			return db, nil
+		}
+		if db != nil {
+			if sqlDB, dbErr := db.DB(); dbErr == nil {
+				sqlDB.Close()
+			}
+		}
+
+		if attempt >= retry.Retries {
+			return nil, fmt.Errorf("failed to connect to database after %d attempt(s): %w", attempt+1, err)
+		}
+		wait := retry.backoff(attempt + 1)
+		log.Printf("Database is not available (attempt %d of %d), retrying in %s: %v",
+			attempt+1, retry.Retries+1, wait.Round(time.Millisecond), err)
+		time.Sleep(wait)
+	}
+}
+
+// openPool opens a connection pool for dsn that asks password for the password of each new connection
+func openPool(dsn string, password func() string) (*sql.DB, error) {
+	connConfig, err := pgx.ParseConfig(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid database connection settings: %w", err)
+	}
+	// Disables implicit prepared statement usage, as PreferSimpleProtocol does for a DSN
+	connConfig.DefaultQueryExecMode = pgx.QueryExecModeSimpleProtocol
+	return stdlib.OpenDB(*connConfig, stdlib.OptionBeforeConnect(func(_ context.Context, c *pgx.ConnConfig) error {
+		c.Password = password()
+		return nil
+	})), nil
+}
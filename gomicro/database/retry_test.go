@@ -0,0 +1,40 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy RetryPolicy
+		retry  int
+		want   time.Duration // the wait before jitter; backoff returns between half and all of it
+	}{
+		{"first retry", RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}, 1, 100 * time.Millisecond},
+		{"doubled", RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}, 3, 400 * time.Millisecond},
+		{"capped", RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}, 5, time.Second},
+		{"capped late retry", RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}, 1000, time.Second},
+		{"initial above the cap", RetryPolicy{InitialBackoff: 5 * time.Second, MaxBackoff: time.Second}, 1, time.Second},
+		{"no cap", RetryPolicy{InitialBackoff: 100 * time.Millisecond}, 6, 3200 * time.Millisecond},
+		{"no backoff", RetryPolicy{MaxBackoff: time.Second}, 3, 0},
+		{"negative backoff", RetryPolicy{InitialBackoff: -time.Second}, 1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seen := make(map[time.Duration]bool)
+			for i := 0; i < 200; i++ {
+				got := tt.policy.backoff(tt.retry)
+				if got < tt.want/2 || got > tt.want {
+					t.Fatalf("backoff(%d) = %v, want between %v and %v", tt.retry, got, tt.want/2, tt.want)
+				}
+				seen[got] = true
+			}
+			// Replicas starting together must not retry in lockstep
+			if tt.want > 0 && len(seen) < 2 {
+				t.Errorf("backoff(%d) always waited %v", tt.retry, tt.want)
+			}
+		})
+	}
+}
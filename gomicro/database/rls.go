@@ -0,0 +1,166 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// Settings read by the row level security policies that migrate.TenantPolicies installs
+const (
+	// TenantSetting holds the tenant whose rows the transaction may see and write
+	TenantSetting = "app.tenant_id"
+	// BypassSetting set to "on" lets the transaction see every tenant, see WithoutTenantScope
+	BypassSetting = "app.bypass_rls"
+)
+
+type txContextKey struct{}
+
+// WithTx returns a context whose statements run in tx, see RLSPlugin
+func WithTx(ctx context.Context, tx *gorm.DB) context.Context {
+	return context.WithValue(ctx, txContextKey{}, tx)
+}
+
+// TxFromContext returns the transaction set by WithTx
+func TxFromContext(ctx context.Context) (*gorm.DB, bool) {
+	tx, ok := ctx.Value(txContextKey{}).(*gorm.DB)
+	return tx, ok && tx != nil
+}
+
+// Transaction runs fn in a savepoint of the request transaction of ctx, see WithTx, or else in a
+// new transaction, so that handlers keep their tenant setting in RLS mode
+func Transaction(ctx context.Context, db *gorm.DB, fn func(tx *gorm.DB) error) error {
+	if tx, ok := TxFromContext(ctx); ok {
+		return tx.WithContext(ctx).Transaction(fn)
+	}
+	return db.WithContext(ctx).Transaction(fn)
+}
+
+// BeginTenant starts a transaction on db for the tenant of ctx. The transaction runs
+// SET LOCAL app.tenant_id, or SET LOCAL app.bypass_rls for a context from WithoutTenantScope,
+// so that row level security only lets it see the rows of that tenant.
+func BeginTenant(ctx context.Context, db *gorm.DB) (*gorm.DB, error) {
+	scope, ok := ctx.Value(tenantContextKey{}).(tenantScope)
+	if !ok {
+		return nil, ErrMissingTenant
+	}
+
+	// SET takes no bind parameters; the tenant is a number, so formatting it is safe
+	setting := fmt.Sprintf("SET LOCAL %s = '%d'", TenantSetting, scope.tenantID)
+	if scope.unscoped {
+		setting = fmt.Sprintf("SET LOCAL %s = 'on'", BypassSetting)
+	}
+
+	tx := db.WithContext(ctx).Begin()
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	if err := tx.Exec(setting).Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to set tenant of transaction: %w", err)
+	}
+	return tx, nil
+}
+
+// TenantTransaction runs fn in a transaction started by BeginTenant and commits it unless fn
+// returns an error
+func TenantTransaction(ctx context.Context, db *gorm.DB, fn func(tx *gorm.DB) error) error {
+	tx, err := BeginTenant(ctx, db)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		return errors.Join(err, tx.Rollback().Error)
+	}
+	return tx.Commit().Error
+}
+
+// VerifyRLS checks that row level security is enforced for the connection of db: its role must
+// not be a superuser nor have BYPASSRLS, and the tables must enable and force row level
+// security, see migrate.WithTenantRLS. Services in RLS mode call it on startup, so that a
+// deployment that would silently enforce nothing fails instead.
+func VerifyRLS(ctx context.Context, db *gorm.DB, tables ...string) error {
+	conn := Primary(db.WithContext(WithoutTenantScope(ctx)))
+
+	var role struct {
+		Name     string
+		Bypasses bool
+	}
+	err := conn.Raw("SELECT rolname AS name, rolsuper OR rolbypassrls AS bypasses FROM pg_roles WHERE rolname = current_user").
+		Scan(&role).Error
+	if err != nil {
+		return fmt.Errorf("failed to read the database role: %w", err)
+	}
+	if role.Bypasses {
+		return fmt.Errorf("database role %s bypasses row level security; connect as a role without SUPERUSER or BYPASSRLS", role.Name)
+	}
+
+	for _, table := range tables {
+		var state struct {
+			Enabled bool
+			Forced  bool
+		}
+		err := conn.Raw("SELECT relrowsecurity AS enabled, relforcerowsecurity AS forced FROM pg_class WHERE oid = to_regclass(?)", table).
+			Scan(&state).Error
+		if err != nil {
+			return fmt.Errorf("failed to read row level security of %s: %w", table, err)
+		}
+		if !state.Enabled || !state.Forced {
+			return fmt.Errorf("row level security is not enforced on %s; run migrate up with DB_TENANT_RLS=true", table)
+		}
+	}
+	return nil
+}
+
+// RLSPlugin is a GORM plugin that runs statements in the transaction of their context (see
+// WithTx), so that statements made with a request context inherit the tenant setting of the
+// request transaction. It is the database side of RLS mode: together with the policies of
+// migrate.TenantPolicies, a statement that misses its tenant condition still only sees the rows
+// of the tenant. Transactions begun with the request context do not join the request
+// transaction; use Transaction instead. Register the plugin after NewReplicaRouter.
+type RLSPlugin struct{}
+
+// NewRLSPlugin creates the row level security plugin; register it with db.Use or InitDB
+func NewRLSPlugin() *RLSPlugin {
+	return &RLSPlugin{}
+}
+
+// Name implements gorm.Plugin
+func (p *RLSPlugin) Name() string {
+	return "gomicro:rls"
+}
+
+// Initialize implements gorm.Plugin by registering the routing callbacks
+func (p *RLSPlugin) Initialize(db *gorm.DB) error {
+	callbacks := db.Callback()
+	return errors.Join(
+		callbacks.Create().Before("*").Register("gomicro:rls_create", p.route),
+		callbacks.Query().Before("*").Register("gomicro:rls_query", p.route),
+		callbacks.Update().Before("*").Register("gomicro:rls_update", p.route),
+		callbacks.Delete().Before("*").Register("gomicro:rls_delete", p.route),
+		callbacks.Row().Before("*").Register("gomicro:rls_row", p.route),
+		callbacks.Raw().Before("*").Register("gomicro:rls_raw", p.route),
+	)
+}
+
+// route moves the statement onto the transaction of its context, unless it already runs in a
+// transaction
+func (p *RLSPlugin) route(db *gorm.DB) {
+	tx, ok := TxFromContext(db.Statement.Context)
+	if !ok {
+		return
+	}
+	if _, inTx := db.Statement.ConnPool.(gorm.TxCommitter); inTx {
+		return
+	}
+	db.Statement.ConnPool = tx.Statement.ConnPool
+}
@@ -0,0 +1,265 @@
+package database_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/suteetoe/gomicro/database"
+	"github.com/suteetoe/gomicro/internal/dbtest"
+	"github.com/suteetoe/gomicro/migrate"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testDSNEnv names a Postgres superuser DSN; the tests create and drop their own table and role
+const testDSNEnv = "GOMICRO_TEST_DATABASE_DSN"
+
+const (
+	rlsTestService = "gomicro-rls-test"
+	rlsTestRole    = "gomicro_rls_test_app"
+)
+
+type rlsItem struct {
+	ID       uint `gorm:"primaryKey"`
+	TenantID uint `gorm:"not null;index"`
+	Name     string
+}
+
+func (rlsItem) TableName() string {
+	return "gomicro_rls_test_items"
+}
+
+// openRLSTest migrates and seeds the table as a superuser and returns a connection acting as an
+// application role that owns the table, and a function switching RLS mode like migrate up does
+func openRLSTest(t *testing.T) (*gorm.DB, func(enabled bool)) {
+	dsn := os.Getenv(testDSNEnv)
+	if dsn == "" {
+		t.Skipf("set %s to a Postgres superuser DSN to run the row level security tests", testDSNEnv)
+	}
+	open := func() *gorm.DB {
+		db, err := database.Open(dsn, &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)}, database.RetryPolicy{})
+		if err != nil {
+			t.Fatalf("open database: %v", err)
+		}
+		sqlDB, err := db.DB()
+		if err != nil {
+			t.Fatalf("database object: %v", err)
+		}
+		t.Cleanup(func() { sqlDB.Close() })
+		return db
+	}
+
+	owner := open()
+	cleanup := func() {
+		owner.Exec("DROP TABLE IF EXISTS " + rlsItem{}.TableName())
+		owner.Exec("DELETE FROM schema_migrations WHERE service = ?", rlsTestService)
+		owner.Exec("DROP ROLE IF EXISTS " + rlsTestRole)
+	}
+	cleanup()
+	t.Cleanup(cleanup)
+
+	switchRLS := func(enabled bool) {
+		migrator, err := migrate.New(owner, rlsTestService, []migrate.Migration{
+			{
+				Version: 1,
+				Name:    "items",
+				Up:      func(tx *gorm.DB) error { return tx.AutoMigrate(&rlsItem{}) },
+			},
+			migrate.TenantPolicies(2, rlsItem{}.TableName()),
+		}, migrate.WithTenantRLS(enabled, rlsItem{}.TableName()))
+		if err != nil {
+			t.Fatalf("migrations: %v", err)
+		}
+		if _, err := migrator.Up(context.Background()); err != nil {
+			t.Fatalf("migrate up: %v", err)
+		}
+	}
+	switchRLS(true)
+
+	// The application role owns the table: forced row level security applies to it all the same
+	items := []rlsItem{{TenantID: 1, Name: "a1"}, {TenantID: 1, Name: "a2"}, {TenantID: 2, Name: "b1"}}
+	for _, statement := range []string{
+		"CREATE ROLE " + rlsTestRole + " NOLOGIN",
+		"ALTER TABLE " + rlsItem{}.TableName() + " OWNER TO " + rlsTestRole,
+	} {
+		if err := owner.Exec(statement).Error; err != nil {
+			t.Fatalf("%s: %v", statement, err)
+		}
+	}
+	if err := owner.Create(&items).Error; err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+
+	// A single connection keeps the session role for every statement
+	app := open()
+	sqlDB, _ := app.DB()
+	sqlDB.SetMaxOpenConns(1)
+	sqlDB.SetMaxIdleConns(1)
+	if err := app.Exec("SET ROLE " + rlsTestRole).Error; err != nil {
+		t.Fatalf("set role: %v", err)
+	}
+	if err := app.Use(database.NewRLSPlugin()); err != nil {
+		t.Fatalf("register plugin: %v", err)
+	}
+	return app, switchRLS
+}
+
+func TestRowLevelSecurity(t *testing.T) {
+	db, switchRLS := openRLSTest(t)
+
+	// Checks inside transactions use Errorf, so that the transaction is always finished
+	assertTenant := func(t *testing.T, items []rlsItem, tenantID uint, want int) {
+		t.Helper()
+		if len(items) != want {
+			t.Errorf("got %d rows, want %d: %+v", len(items), want, items)
+		}
+		for _, item := range items {
+			if item.TenantID != tenantID {
+				t.Errorf("got row %q of tenant %d, want only tenant %d", item.Name, item.TenantID, tenantID)
+			}
+		}
+	}
+
+	t.Run("query without tenant filter", func(t *testing.T) {
+		ctx := database.WithTenant(context.Background(), 1)
+		err := database.TenantTransaction(ctx, db, func(tx *gorm.DB) error {
+			var items []rlsItem
+			if err := tx.Find(&items).Error; err != nil {
+				return err
+			}
+			assertTenant(t, items, 1, 2)
+
+			var count int64
+			if err := tx.Raw("SELECT count(*) FROM " + rlsItem{}.TableName()).Scan(&count).Error; err != nil {
+				return err
+			}
+			if count != 2 {
+				t.Errorf("raw count = %d, want 2", count)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("request context joins the transaction", func(t *testing.T) {
+		ctx := database.WithTenant(context.Background(), 2)
+		tx, err := database.BeginTenant(ctx, db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tx.Rollback()
+
+		var items []rlsItem
+		if err := db.WithContext(database.WithTx(ctx, tx)).Find(&items).Error; err != nil {
+			t.Fatal(err)
+		}
+		assertTenant(t, items, 2, 1)
+	})
+
+	t.Run("no tenant sees no rows", func(t *testing.T) {
+		var items []rlsItem
+		if err := db.Find(&items).Error; err != nil {
+			t.Fatal(err)
+		}
+		if len(items) != 0 {
+			t.Fatalf("got %d rows without a tenant, want none", len(items))
+		}
+	})
+
+	t.Run("cannot write another tenant", func(t *testing.T) {
+		ctx := database.WithTenant(context.Background(), 1)
+		err := database.TenantTransaction(ctx, db, func(tx *gorm.DB) error {
+			return tx.Create(&rlsItem{TenantID: 2, Name: "intruder"}).Error
+		})
+		if err == nil {
+			t.Fatal("insert of another tenant's row succeeded")
+		}
+
+		err = database.TenantTransaction(ctx, db, func(tx *gorm.DB) error {
+			result := tx.Model(&rlsItem{}).Where("name = ?", "b1").Update("name", "changed")
+			if result.Error == nil && result.RowsAffected != 0 {
+				t.Errorf("updated %d rows of another tenant", result.RowsAffected)
+			}
+			return result.Error
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("RLS mode is verified", func(t *testing.T) {
+		if err := database.VerifyRLS(context.Background(), db, rlsItem{}.TableName()); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("unscoped context sees every tenant", func(t *testing.T) {
+		ctx := database.WithoutTenantScope(context.Background())
+		err := database.TenantTransaction(ctx, db, func(tx *gorm.DB) error {
+			var count int64
+			if err := tx.Model(&rlsItem{}).Count(&count).Error; err != nil {
+				return err
+			}
+			if count != 3 {
+				t.Errorf("count = %d, want 3", count)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("outside RLS mode the policies are off", func(t *testing.T) {
+		switchRLS(false)
+		defer switchRLS(true)
+
+		var items []rlsItem
+		if err := db.Find(&items).Error; err != nil {
+			t.Fatal(err)
+		}
+		if len(items) != 3 {
+			t.Errorf("got %d rows without a tenant, want all 3", len(items))
+		}
+		if err := database.VerifyRLS(context.Background(), db, rlsItem{}.TableName()); err == nil {
+			t.Error("VerifyRLS accepted a table without row level security")
+		}
+	})
+}
+
+func TestVerifyRLS(t *testing.T) {
+	cases := []struct {
+		name             string
+		bypasses         bool
+		enabled, forced  bool
+		wantErrSubstring string
+	}{
+		{"enforced", false, true, true, ""},
+		{"superuser", true, true, true, "bypasses row level security"},
+		{"not forced on the owner", false, true, false, "not enforced on items"},
+		{"disabled", false, false, false, "not enforced on items"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := dbtest.Open(t, func(query string, args []driver.Value) (dbtest.Result, error) {
+				switch {
+				case strings.Contains(query, "FROM pg_roles"):
+					return dbtest.Result{Columns: []string{"name", "bypasses"}, Rows: [][]driver.Value{{"app", tc.bypasses}}}, nil
+				case strings.Contains(query, "FROM pg_class"):
+					return dbtest.Result{Columns: []string{"enabled", "forced"}, Rows: [][]driver.Value{{tc.enabled, tc.forced}}}, nil
+				}
+				return dbtest.Result{}, fmt.Errorf("unexpected statement %s", query)
+			})
+			err := database.VerifyRLS(context.Background(), db, "items")
+			if tc.wantErrSubstring == "" && err != nil || tc.wantErrSubstring != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErrSubstring)) {
+				t.Errorf("VerifyRLS = %v, want %q", err, tc.wantErrSubstring)
+			}
+		})
+	}
+}
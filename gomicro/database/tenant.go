@@ -0,0 +1,240 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// TenantField is the model field that TenantPlugin scopes on
+const TenantField = "TenantID"
+
+var (
+	// ErrMissingTenant is returned for statements on tenant models without a tenant in the context
+	ErrMissingTenant = errors.New("tenant scope: no tenant in context")
+	// ErrCrossTenantWrite is returned when a statement would write a row of another tenant
+	ErrCrossTenantWrite = errors.New("tenant scope: cannot write a row of another tenant")
+)
+
+type tenantContextKey struct{}
+
+// tenantScope is the value stored in the context; unscoped marks the admin escape hatch
+type tenantScope struct {
+	tenantID uint
+	unscoped bool
+}
+
+// WithTenant returns a context whose statements are scoped to tenantID
+func WithTenant(ctx context.Context, tenantID uint) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, tenantScope{tenantID: tenantID})
+}
+
+// TenantFromContext returns the tenant set by WithTenant
+func TenantFromContext(ctx context.Context) (uint, bool) {
+	scope, ok := ctx.Value(tenantContextKey{}).(tenantScope)
+	if !ok || scope.unscoped {
+		return 0, false
+	}
+	return scope.tenantID, true
+}
+
+// WithoutTenantScope returns a context whose statements see every tenant. It is the explicit
+// escape hatch for admin jobs and cross-tenant maintenance; never derive it from request input.
+func WithoutTenantScope(ctx context.Context) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, tenantScope{unscoped: true})
+}
+
+// TenantPlugin is a GORM plugin that scopes statements on models with a TenantID field to the
+// tenant of the statement context (see WithTenant). Queries, updates and deletes get a
+// tenant_id condition and creates are stamped with the tenant. Statements without a tenant in
+// the context fail with ErrMissingTenant unless the context comes from WithoutTenantScope.
+// Raw SQL is not rewritten.
+type TenantPlugin struct{}
+
+// NewTenantPlugin creates the tenant scope plugin; register it with db.Use or InitDB
+func NewTenantPlugin() *TenantPlugin {
+	return &TenantPlugin{}
+}
+
+// Name implements gorm.Plugin
+func (p *TenantPlugin) Name() string {
+	return "gomicro:tenant_scope"
+}
+
+// Initialize implements gorm.Plugin by registering the scoping callbacks
+func (p *TenantPlugin) Initialize(db *gorm.DB) error {
+	callbacks := db.Callback()
+	return errors.Join(
+		callbacks.Create().Before("gorm:create").Register("gomicro:tenant_create", p.stampCreate),
+		callbacks.Query().Before("gorm:query").Register("gomicro:tenant_query", p.scope(false)),
+		callbacks.Row().Before("gorm:row").Register("gomicro:tenant_row", p.scope(false)),
+		callbacks.Update().Before("gorm:update").Register("gomicro:tenant_update", p.scope(true)),
+		callbacks.Delete().Before("gorm:delete").Register("gomicro:tenant_delete", p.scope(true)),
+	)
+}
+
+// tenant returns the tenant field of the statement model and the tenant of its context.
+// scoped is false when the model has no tenant field or the context is unscoped.
+func tenant(db *gorm.DB) (field *schema.Field, tenantID uint, scoped bool) {
+	stmt := db.Statement
+	if db.Error != nil || stmt.Schema == nil {
+		return nil, 0, false
+	}
+	if field = stmt.Schema.LookUpField(TenantField); field == nil {
+		return nil, 0, false
+	}
+
+	scope, ok := stmt.Context.Value(tenantContextKey{}).(tenantScope)
+	if ok && scope.unscoped {
+		return nil, 0, false
+	}
+	if !ok {
+		db.AddError(fmt.Errorf("%w for %s", ErrMissingTenant, stmt.Schema.Table))
+		return nil, 0, false
+	}
+	return field, scope.tenantID, true
+}
+
+// scope returns a callback adding the tenant condition. For updates and deletes, a statement
+// without other conditions is rejected like GORM does, since the tenant condition alone would
+// otherwise turn a forgotten WHERE into a change of every row of the tenant.
+func (p *TenantPlugin) scope(write bool) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		field, tenantID, ok := tenant(db)
+		if !ok {
+			return
+		}
+		stmt := db.Statement
+
+		if write {
+			if !db.AllowGlobalUpdate && !hasConditions(stmt) {
+				db.AddError(gorm.ErrMissingWhereClause)
+				return
+			}
+			if assigned, ok := assignedTenant(stmt, field); ok && assigned != tenantID {
+				db.AddError(ErrCrossTenantWrite)
+				return
+			}
+		}
+		stmt.AddClause(clause.Where{Exprs: []clause.Expression{tenantCondition(field, tenantID)}})
+	}
+}
+
+// stampCreate sets the tenant on created rows and keeps upserts from overwriting rows of
+// another tenant
+func (p *TenantPlugin) stampCreate(db *gorm.DB) {
+	field, tenantID, ok := tenant(db)
+	if !ok {
+		return
+	}
+	stmt := db.Statement
+
+	err := eachRow(stmt.ReflectValue, func(row reflect.Value) error {
+		value, zero := field.ValueOf(stmt.Context, row)
+		if zero {
+			return field.Set(stmt.Context, row, tenantID)
+		}
+		if id, ok := tenantValue(value); !ok || id != tenantID {
+			return ErrCrossTenantWrite
+		}
+		return nil
+	})
+	if err != nil {
+		db.AddError(err)
+		return
+	}
+
+	if c, ok := stmt.Clauses["ON CONFLICT"]; ok {
+		if onConflict, ok := c.Expression.(clause.OnConflict); ok && !onConflict.DoNothing {
+			onConflict.Where.Exprs = append(onConflict.Where.Exprs, tenantCondition(field, tenantID))
+			stmt.AddClause(onConflict)
+		}
+	}
+}
+
+func tenantCondition(field *schema.Field, tenantID uint) clause.Expression {
+	return clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: tenantID}
+}
+
+// hasConditions reports whether an update or delete has a WHERE clause or a primary key to
+// build one from
+func hasConditions(stmt *gorm.Statement) bool {
+	if where, ok := stmt.Clauses["WHERE"].Expression.(clause.Where); ok && len(where.Exprs) > 0 {
+		return true
+	}
+	if len(stmt.Schema.PrimaryFields) == 0 {
+		return false
+	}
+	found := false
+	eachRow(stmt.ReflectValue, func(row reflect.Value) error {
+		for _, pk := range stmt.Schema.PrimaryFields {
+			if _, zero := pk.ValueOf(stmt.Context, row); !zero {
+				found = true
+			}
+		}
+		return nil
+	})
+	return found
+}
+
+// assignedTenant returns the tenant an update sets, if it sets one
+func assignedTenant(stmt *gorm.Statement, field *schema.Field) (uint, bool) {
+	switch dest := stmt.Dest.(type) {
+	case map[string]interface{}:
+		for _, key := range []string{field.DBName, field.Name} {
+			if value, ok := dest[key]; ok {
+				id, _ := tenantValue(value)
+				return id, true
+			}
+		}
+		return 0, false
+	}
+
+	value := reflect.Indirect(reflect.ValueOf(stmt.Dest))
+	if value.Kind() != reflect.Struct || value.Type() != stmt.Schema.ModelType {
+		return 0, false
+	}
+	assigned, zero := field.ValueOf(stmt.Context, value)
+	if zero {
+		return 0, false
+	}
+	id, _ := tenantValue(assigned)
+	return id, true
+}
+
+// tenantValue converts a uint or *uint tenant value
+func tenantValue(value interface{}) (uint, bool) {
+	switch v := value.(type) {
+	case uint:
+		return v, true
+	case *uint:
+		if v != nil {
+			return *v, true
+		}
+	}
+	return 0, false
+}
+
+// eachRow calls fn for the struct or every struct of the slice held by value
+func eachRow(value reflect.Value, fn func(row reflect.Value) error) error {
+	switch value.Kind() {
+	case reflect.Struct:
+		return fn(value)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			row := reflect.Indirect(value.Index(i))
+			if row.Kind() != reflect.Struct {
+				continue
+			}
+			if err := fn(row); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/suteetoe/gomicro/internal/dbtest"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type tenantItem struct {
+	ID       uint
+	TenantID uint
+	Name     string
+}
+
+func (tenantItem) TableName() string { return "items" }
+
+type plainItem struct {
+	ID   uint
+	Name string
+}
+
+func (plainItem) TableName() string { return "plain_items" }
+
+// statement is one statement sent to the fake database
+type statement struct {
+	query string
+	args  []driver.Value
+}
+
+// openTenantTest returns a connection with the tenant plugin and the statements it sends
+func openTenantTest(t *testing.T) (*gorm.DB, *[]statement) {
+	t.Helper()
+	var statements []statement
+	db := dbtest.Open(t, func(query string, args []driver.Value) (dbtest.Result, error) {
+		if query == "BEGIN" || query == "COMMIT" || query == "ROLLBACK" {
+			return dbtest.Result{}, nil
+		}
+		statements = append(statements, statement{query, args})
+		if strings.HasPrefix(query, "INSERT") {
+			result := dbtest.Result{Columns: []string{"id"}}
+			for i := 0; i <= strings.Count(query, "),("); i++ {
+				result.Rows = append(result.Rows, []driver.Value{int64(i + 1)})
+			}
+			return result, nil
+		}
+		return dbtest.Result{Columns: []string{"id", "tenant_id", "name"}, RowsAffected: 1}, nil
+	})
+	if err := db.Use(NewTenantPlugin()); err != nil {
+		t.Fatal(err)
+	}
+	return db, &statements
+}
+
+func TestTenantPluginRequiresATenant(t *testing.T) {
+	db, statements := openTenantTest(t)
+	ctx := context.Background()
+
+	var items []tenantItem
+	tests := map[string]error{
+		"query":  db.WithContext(ctx).Find(&items).Error,
+		"count":  db.WithContext(ctx).Model(&tenantItem{}).Count(new(int64)).Error,
+		"create": db.WithContext(ctx).Create(&tenantItem{Name: "a"}).Error,
+		"update": db.WithContext(ctx).Model(&tenantItem{ID: 1}).Update("name", "b").Error,
+		"delete": db.WithContext(ctx).Delete(&tenantItem{ID: 1}).Error,
+	}
+	for name, err := range tests {
+		if !errors.Is(err, ErrMissingTenant) {
+			t.Errorf("%s without a tenant: %v", name, err)
+		}
+	}
+	if len(*statements) != 0 {
+		t.Errorf("statements reached the database: %v", *statements)
+	}
+
+	// Models without a tenant field are not scoped
+	var plain []plainItem
+	if err := db.WithContext(ctx).Find(&plain).Error; err != nil {
+		t.Errorf("query of a model without tenant: %v", err)
+	}
+}
+
+func TestTenantPluginScopesStatements(t *testing.T) {
+	db, statements := openTenantTest(t)
+	ctx := WithTenant(context.Background(), 7)
+
+	tests := []struct {
+		name string
+		run  func(db *gorm.DB) error
+		want string
+	}{
+		{
+			name: "query",
+			run:  func(db *gorm.DB) error { return db.Where("name = ?", "a").Find(&[]tenantItem{}).Error },
+			want: `SELECT * FROM "items" WHERE name = $1 AND "items"."tenant_id" = $2`,
+		},
+		{
+			name: "update of a row by its key",
+			run:  func(db *gorm.DB) error { return db.Model(&tenantItem{ID: 3}).Update("name", "b").Error },
+			want: `UPDATE "items" SET "name"=$1 WHERE "items"."tenant_id" = $2 AND "id" = $3`,
+		},
+		{
+			name: "delete",
+			run:  func(db *gorm.DB) error { return db.Where("name = ?", "a").Delete(&tenantItem{}).Error },
+			want: `DELETE FROM "items" WHERE name = $1 AND "items"."tenant_id" = $2`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			*statements = nil
+			if err := tt.run(db.WithContext(ctx)); err != nil {
+				t.Fatal(err)
+			}
+			if len(*statements) != 1 || (*statements)[0].query != tt.want {
+				t.Fatalf("statements %v, want %s", *statements, tt.want)
+			}
+			bound := false
+			for _, arg := range (*statements)[0].args {
+				bound = bound || arg == int64(7)
+			}
+			if !bound {
+				t.Errorf("arguments %v do not bind tenant 7", (*statements)[0].args)
+			}
+		})
+	}
+}
+
+func TestTenantPluginStampsCreates(t *testing.T) {
+	db, statements := openTenantTest(t)
+	ctx := WithTenant(context.Background(), 7)
+
+	item := tenantItem{Name: "a"}
+	if err := db.WithContext(ctx).Create(&item).Error; err != nil {
+		t.Fatal(err)
+	}
+	if item.TenantID != 7 {
+		t.Errorf("created row has tenant %d", item.TenantID)
+	}
+
+	batch := []tenantItem{{Name: "b"}, {Name: "c", TenantID: 7}}
+	if err := db.WithContext(ctx).Create(&batch).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range batch {
+		if row.TenantID != 7 {
+			t.Errorf("batch row %s has tenant %d", row.Name, row.TenantID)
+		}
+	}
+
+	// An upsert only overwrites rows of the tenant
+	*statements = nil
+	upsert := db.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(&tenantItem{ID: 9, Name: "d"})
+	if upsert.Error != nil {
+		t.Fatal(upsert.Error)
+	}
+	if query := (*statements)[0].query; !strings.Contains(query, `ON CONFLICT ("id") DO UPDATE SET`) || !strings.Contains(query, `WHERE "items"."tenant_id" = $4`) {
+		t.Errorf("upsert %s", query)
+	}
+}
+
+func TestTenantPluginRejectsWritesToOtherTenants(t *testing.T) {
+	db, statements := openTenantTest(t)
+	ctx := WithTenant(context.Background(), 7)
+
+	tests := map[string]func(db *gorm.DB) error{
+		"create for another tenant": func(db *gorm.DB) error {
+			return db.Create(&tenantItem{TenantID: 8, Name: "a"}).Error
+		},
+		"batch with a row of another tenant": func(db *gorm.DB) error {
+			return db.Create(&[]tenantItem{{Name: "a"}, {TenantID: 8, Name: "b"}}).Error
+		},
+		"update moving a row to another tenant": func(db *gorm.DB) error {
+			return db.Model(&tenantItem{ID: 3}).Updates(map[string]interface{}{"tenant_id": uint(8)}).Error
+		},
+		"save of a row of another tenant": func(db *gorm.DB) error {
+			return db.Model(&tenantItem{}).Where("id = ?", 3).Updates(&tenantItem{TenantID: 8, Name: "b"}).Error
+		},
+	}
+	for name, run := range tests {
+		if err := run(db.WithContext(ctx)); !errors.Is(err, ErrCrossTenantWrite) {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+
+	// Updates and deletes without conditions would change every row of the tenant
+	if err := db.WithContext(ctx).Model(&tenantItem{}).Update("name", "x").Error; !errors.Is(err, gorm.ErrMissingWhereClause) {
+		t.Errorf("update without conditions: %v", err)
+	}
+	if err := db.WithContext(ctx).Delete(&tenantItem{}).Error; !errors.Is(err, gorm.ErrMissingWhereClause) {
+		t.Errorf("delete without conditions: %v", err)
+	}
+	if len(*statements) != 0 {
+		t.Errorf("statements reached the database: %v", *statements)
+	}
+}
+
+func TestWithoutTenantScope(t *testing.T) {
+	db, statements := openTenantTest(t)
+	ctx := WithoutTenantScope(WithTenant(context.Background(), 7))
+
+	if _, ok := TenantFromContext(ctx); ok {
+		t.Error("an unscoped context has a tenant")
+	}
+	if err := db.WithContext(ctx).Find(&[]tenantItem{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	item := tenantItem{TenantID: 8, Name: "a"}
+	if err := db.WithContext(ctx).Create(&item).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.WithContext(ctx).Model(&tenantItem{ID: 3}).Update("tenant_id", uint(9)).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		`SELECT * FROM "items"`,
+		`INSERT INTO "items" ("tenant_id","name") VALUES ($1,$2) RETURNING "id"`,
+		`UPDATE "items" SET "tenant_id"=$1 WHERE "id" = $2`,
+	}
+	if len(*statements) != len(want) {
+		t.Fatalf("statements %v", *statements)
+	}
+	for i, s := range *statements {
+		if s.query != want[i] {
+			t.Errorf("statement %s, want %s", s.query, want[i])
+		}
+	}
+}
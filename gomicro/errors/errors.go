@@ -0,0 +1,192 @@
+// Package errors defines the errors handlers return to answer with an HTTP error status, and
+// an Echo HTTPErrorHandler that renders every error as RFC 7807 problem details
+// (application/problem+json). Import it under another name, e.g. apperrors, next to the
+// standard errors package.
+package errors
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// TypeValidation is the problem type of Validation errors
+const TypeValidation = "validation-error"
+
+// FieldError describes an invalid field of a request
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error is an error answered with an HTTP status. Detail is sent to the client; the cause in
+// Err is only logged.
+type Error struct {
+	// Status is the HTTP status code
+	Status int
+	// Type identifies the kind of problem; it is resolved against the type base URI of the
+	// error handler, and an empty type is rendered as about:blank
+	Type string
+	// Title is a short summary of the kind of problem
+	Title string
+	// Detail explains this occurrence of the problem
+	Detail string
+	// Fields lists the invalid fields of a validation error
+	Fields []FieldError
+	// Extensions are additional members of the problem, e.g. the permission a request lacked
+	Extensions map[string]interface{}
+	// Err is the cause of the error
+	Err error
+}
+
+// Error implements error
+func (e *Error) Error() string {
+	msg := e.Detail
+	if msg == "" {
+		msg = e.Title
+	}
+	if e.Err != nil {
+		return msg + ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// Unwrap returns the cause of the error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// WithCause sets the cause of the error, which is logged but not sent to the client
+func (e *Error) WithCause(err error) *Error {
+	e.Err = err
+	return e
+}
+
+// WithField adds an invalid field to the error
+func (e *Error) WithField(field, message string) *Error {
+	e.Fields = append(e.Fields, FieldError{Field: field, Message: message})
+	return e
+}
+
+// With adds the extension member key to the problem
+func (e *Error) With(key string, value interface{}) *Error {
+	if e.Extensions == nil {
+		e.Extensions = make(map[string]interface{})
+	}
+	e.Extensions[key] = value
+	return e
+}
+
+// New creates an error with status; its type and title follow from the status
+func New(status int, detail string) *Error {
+	return &Error{
+		Status: status,
+		Type:   typeOf(status),
+		Title:  http.StatusText(status),
+		Detail: detail,
+	}
+}
+
+// Newf creates an error with status and a formatted detail
+func Newf(status int, format string, args ...interface{}) *Error {
+	return New(status, fmt.Sprintf(format, args...))
+}
+
+// BadRequest reports a malformed request, e.g. a body that cannot be parsed
+func BadRequest(detail string) *Error {
+	return New(http.StatusBadRequest, detail)
+}
+
+// Validation reports a well-formed request with invalid fields
+func Validation(detail string, fields ...FieldError) *Error {
+	return &Error{
+		Status: http.StatusBadRequest,
+		Type:   TypeValidation,
+		Title:  "Validation Failed",
+		Detail: detail,
+		Fields: fields,
+	}
+}
+
+// Unauthorized reports a request without valid credentials
+func Unauthorized(detail string) *Error {
+	return New(http.StatusUnauthorized, detail)
+}
+
+// Forbidden reports a request the caller is not allowed to make
+func Forbidden(detail string) *Error {
+	return New(http.StatusForbidden, detail)
+}
+
+// NotFound reports a resource that does not exist or is hidden from the caller
+func NotFound(detail string) *Error {
+	return New(http.StatusNotFound, detail)
+}
+
+// Conflict reports a request that conflicts with the state of a resource, e.g. a duplicate
+func Conflict(detail string) *Error {
+	return New(http.StatusConflict, detail)
+}
+
+// TooManyRequests reports a request rejected by a rate limit
+func TooManyRequests(detail string) *Error {
+	return New(http.StatusTooManyRequests, detail)
+}
+
+// Internal reports a failure of the service caused by err
+func Internal(detail string, err error) *Error {
+	return New(http.StatusInternalServerError, detail).WithCause(err)
+}
+
+// Unavailable reports a dependency that is temporarily unavailable
+func Unavailable(detail string) *Error {
+	return New(http.StatusServiceUnavailable, detail)
+}
+
+// From returns err as an *Error: errors of this package are returned as they are, an
+// *echo.HTTPError keeps its status and message, and any other error is an internal error.
+func From(err error) *Error {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		detail, ok := httpErr.Message.(string)
+		if !ok || detail == http.StatusText(httpErr.Code) {
+			detail = ""
+		}
+		e := New(httpErr.Code, detail)
+		if httpErr.Internal != nil {
+			e.Err = httpErr.Internal
+		}
+		return e
+	}
+	return Internal("", err)
+}
+
+// StatusCode returns the HTTP status err is answered with
+func StatusCode(err error) int {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr.Status
+	}
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.Code
+	}
+	return http.StatusInternalServerError
+}
+
+// typeOf derives the problem type of status from its status text, e.g. not-found
+func typeOf(status int) string {
+	text := http.StatusText(status)
+	if text == "" {
+		return ""
+	}
+	text = strings.ReplaceAll(strings.ToLower(text), "'", "")
+	return strings.ReplaceAll(strings.ReplaceAll(text, "-", " "), " ", "-")
+}
@@ -0,0 +1,88 @@
+package errors
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestHTTPErrorHandler(t *testing.T) {
+	e := echo.New()
+	e.HTTPErrorHandler = NewHTTPErrorHandler(WithTypeBaseURI("https://api.example.com/problems/"))
+	e.POST("/products", func(c echo.Context) error {
+		c.Response().Header().Set(echo.HeaderXRequestID, "req-1")
+		return Validation("Invalid product").WithField("sku", "is required")
+	})
+	e.GET("/products/:id", func(c echo.Context) error {
+		return Forbidden("insufficient permissions").With("required_permission", "product:read")
+	})
+	e.GET("/fail", func(c echo.Context) error {
+		return errors.New("connection refused by 10.0.0.5")
+	})
+
+	serve := func(method, path string) (*httptest.ResponseRecorder, map[string]interface{}) {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		var body map[string]interface{}
+		if method != http.MethodHead {
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("%s %s: invalid body %q", method, path, rec.Body.String())
+			}
+		}
+		if got := rec.Header().Get(echo.HeaderContentType); method != http.MethodHead && got != MIMEProblemJSON {
+			t.Errorf("%s %s: content type %q", method, path, got)
+		}
+		return rec, body
+	}
+
+	rec, body := serve(http.MethodPost, "/products")
+	if rec.Code != http.StatusBadRequest || body["type"] != "https://api.example.com/problems/validation-error" ||
+		body["request_id"] != "req-1" || body["instance"] != "/products" || body["detail"] != "Invalid product" {
+		t.Errorf("validation error: %d %v", rec.Code, body)
+	}
+	fields, _ := body["errors"].([]interface{})
+	if len(fields) != 1 || fields[0].(map[string]interface{})["field"] != "sku" {
+		t.Errorf("validation error fields: %v", body["errors"])
+	}
+
+	if rec, body := serve(http.MethodGet, "/products/1"); rec.Code != http.StatusForbidden ||
+		body["required_permission"] != "product:read" || body["title"] != "Forbidden" {
+		t.Errorf("forbidden: %d %v", rec.Code, body)
+	}
+
+	// Errors of the router keep their status
+	if rec, body := serve(http.MethodGet, "/missing"); rec.Code != http.StatusNotFound ||
+		body["type"] != "https://api.example.com/problems/not-found" {
+		t.Errorf("unknown route: %d %v", rec.Code, body)
+	}
+
+	// Other errors are internal and their message is not sent
+	rec, body = serve(http.MethodGet, "/fail")
+	if rec.Code != http.StatusInternalServerError || strings.Contains(rec.Body.String(), "10.0.0.5") {
+		t.Errorf("internal error: %d %v", rec.Code, body)
+	}
+
+	if rec, _ := serve(http.MethodHead, "/missing"); rec.Code != http.StatusNotFound || rec.Body.Len() != 0 {
+		t.Errorf("HEAD: %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestStatusCode(t *testing.T) {
+	for err, want := range map[error]int{
+		NotFound("no product"):     http.StatusNotFound,
+		echo.ErrMethodNotAllowed:   http.StatusMethodNotAllowed,
+		errors.New("disk is full"): http.StatusInternalServerError,
+	} {
+		if got := StatusCode(err); got != want {
+			t.Errorf("StatusCode(%v) = %d, want %d", err, got, want)
+		}
+	}
+	if typeOf(http.StatusTooManyRequests) != "too-many-requests" || typeOf(http.StatusTeapot) != "im-a-teapot" {
+		t.Errorf("unexpected problem types %q, %q", typeOf(http.StatusTooManyRequests), typeOf(http.StatusTeapot))
+	}
+}
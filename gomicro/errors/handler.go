@@ -0,0 +1,152 @@
+package errors
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// MIMEProblemJSON is the media type of problem details
+const MIMEProblemJSON = "application/problem+json"
+
+// DefaultTypeBaseURI is the base problem types are resolved against, e.g. /problems/not-found
+const DefaultTypeBaseURI = "/problems/"
+
+// Problem is the RFC 7807 problem details document of an error
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+
+	// Extensions are rendered as additional members
+	Extensions map[string]interface{} `json:"-"`
+}
+
+// MarshalJSON renders the extensions next to the standard members
+func (p Problem) MarshalJSON() ([]byte, error) {
+	type problem Problem
+	body, err := json.Marshal(problem(p))
+	if err != nil || len(p.Extensions) == 0 {
+		return body, err
+	}
+
+	members := make(map[string]interface{}, len(p.Extensions)+7)
+	for key, value := range p.Extensions {
+		members[key] = value
+	}
+	// The standard members win over extensions of the same name
+	if err := json.Unmarshal(body, &members); err != nil {
+		return nil, err
+	}
+	return json.Marshal(members)
+}
+
+// HandlerOption configures the error handler
+type HandlerOption func(*handler)
+
+// WithTypeBaseURI sets the base problem types are resolved against, e.g.
+// https://api.example.com/problems/
+func WithTypeBaseURI(uri string) HandlerOption {
+	return func(h *handler) {
+		h.typeBaseURI = uri
+	}
+}
+
+// WithLogger sets the logger of requests that have no request logger in the echo context
+func WithLogger(log *zap.Logger) HandlerOption {
+	return func(h *handler) {
+		h.log = log
+	}
+}
+
+type handler struct {
+	typeBaseURI string
+	log         *zap.Logger
+}
+
+// NewHTTPErrorHandler returns an echo.HTTPErrorHandler that renders errors as problem details,
+// for e.HTTPErrorHandler. Errors of this package keep their status, detail and fields, an
+// *echo.HTTPError keeps its status and message, and any other error is answered with 500
+// without its message. Errors with a 5xx status are logged with their cause.
+func NewHTTPErrorHandler(opts ...HandlerOption) echo.HTTPErrorHandler {
+	h := &handler{typeBaseURI: DefaultTypeBaseURI, log: zap.NewNop()}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h.handle
+}
+
+func (h *handler) handle(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	appErr := From(err)
+	problem := h.problem(c, appErr)
+
+	log := h.log
+	if requestLog, ok := c.Get("logger").(*zap.Logger); ok {
+		log = requestLog
+	}
+	if problem.Status >= http.StatusInternalServerError {
+		log.Error("Request failed",
+			zap.Int("status", problem.Status),
+			zap.String("detail", problem.Detail),
+			zap.Error(appErr.Err))
+	}
+
+	if c.Request().Method == http.MethodHead {
+		err = c.NoContent(problem.Status)
+	} else {
+		var body []byte
+		body, err = json.Marshal(problem)
+		if err == nil {
+			err = c.Blob(problem.Status, MIMEProblemJSON, body)
+		}
+	}
+	if err != nil {
+		log.Error("Failed to write error response", zap.Error(err))
+	}
+}
+
+// problem returns the problem details of e for the request of c
+func (h *handler) problem(c echo.Context, e *Error) Problem {
+	problem := Problem{
+		Type:       "about:blank",
+		Title:      e.Title,
+		Status:     e.Status,
+		Detail:     e.Detail,
+		Instance:   c.Request().URL.Path,
+		RequestID:  requestID(c),
+		Errors:     e.Fields,
+		Extensions: e.Extensions,
+	}
+	if e.Type != "" {
+		problem.Type = e.Type
+		if !strings.Contains(e.Type, ":") {
+			problem.Type = h.typeBaseURI + e.Type
+		}
+	}
+	if problem.Title == "" {
+		problem.Title = http.StatusText(e.Status)
+	}
+	if problem.Status >= http.StatusInternalServerError && problem.Detail == "" {
+		problem.Detail = "The request could not be completed, retry later"
+	}
+	return problem
+}
+
+// requestID returns the ID set by the request ID middleware
+func requestID(c echo.Context) string {
+	if id := c.Response().Header().Get(echo.HeaderXRequestID); id != "" {
+		return id
+	}
+	return c.Request().Header.Get(echo.HeaderXRequestID)
+}
@@ -0,0 +1,61 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/suteetoe/gomicro/migrate"
+	"gorm.io/gorm"
+)
+
+// Database checks that the primary database of db answers a ping
+func Database(db *gorm.DB) Checker {
+	return func(ctx context.Context) error {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return err
+		}
+		return sqlDB.PingContext(ctx)
+	}
+}
+
+// HTTP checks that a GET of url answers 2xx, e.g. the /livez of a service this one calls. Use
+// the liveness endpoint of a dependency rather than its readiness, so that an outage of its own
+// dependencies does not cascade.
+func HTTP(url string) Checker {
+	client := &http.Client{}
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+		// Drain the body so that the connection is reused
+		_, _ = io.Copy(io.Discard, res.Body)
+		if res.StatusCode < 200 || res.StatusCode > 299 {
+			return fmt.Errorf("GET %s answered %d", url, res.StatusCode)
+		}
+		return nil
+	}
+}
+
+// Migrations checks that every migration of the service is applied, so that an instance deployed
+// ahead of `migrate up` receives no traffic until its schema is in place
+func Migrations(m *migrate.Migrator) Checker {
+	return func(ctx context.Context) error {
+		pending, err := m.Pending(ctx)
+		if err != nil {
+			return err
+		}
+		if len(pending) > 0 {
+			return fmt.Errorf("%d migrations pending, up to version %d", len(pending), pending[len(pending)-1].Version)
+		}
+		return nil
+	}
+}
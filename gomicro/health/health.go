@@ -0,0 +1,289 @@
+// Package health reports whether a service is alive and whether it is ready to serve traffic.
+// Liveness checks tell an orchestrator to restart a stuck process and should not depend on
+// anything outside of it; readiness checks tell it to stop routing requests to the service,
+// e.g. while its database is down, and probe its dependencies.
+//
+// Check results are cached for the cache TTL so that frequent probes do not load the
+// dependencies, reported per check in JSON, and exported as the health_check_status and
+// health_check_duration_seconds gauges.
+//
+//	h, err := health.New("supplier-service", health.WithLogger(log))
+//	h.AddReadiness("database", health.Database(db))
+//	h.AddReadiness("migrations", health.Migrations(migrator))
+package health
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// Statuses of a check and of a report
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// Probe names, used as the probe label of the metrics
+const (
+	ProbeLiveness  = "liveness"
+	ProbeReadiness = "readiness"
+)
+
+// Defaults of New
+const (
+	DefaultTimeout  = 2 * time.Second
+	DefaultCacheTTL = 5 * time.Second
+)
+
+// Checker checks one dependency and returns why it is unhealthy. The context is canceled at the
+// check timeout.
+type Checker func(ctx context.Context) error
+
+// Result is the outcome of one check
+type Result struct {
+	Status     string    `json:"status"`
+	DurationMS float64   `json:"duration_ms"`
+	CheckedAt  time.Time `json:"checked_at"`
+	// Err is why the check failed; it is logged rather than served, as it may describe the
+	// infrastructure
+	Err error `json:"-"`
+}
+
+// Report is the outcome of the checks of a probe; it fails if any check fails
+type Report struct {
+	Status  string            `json:"status"`
+	Service string            `json:"service"`
+	Checks  map[string]Result `json:"checks"`
+}
+
+// OK reports whether every check passed
+func (r Report) OK() bool {
+	return r.Status == StatusOK
+}
+
+// Option configures a Health
+type Option func(*Health)
+
+// WithTimeout bounds each check (DefaultTimeout)
+func WithTimeout(timeout time.Duration) Option {
+	return func(h *Health) {
+		h.timeout = timeout
+	}
+}
+
+// WithCacheTTL sets how long a check result is reused, and how often Run refreshes the checks
+// (DefaultCacheTTL)
+func WithCacheTTL(ttl time.Duration) Option {
+	return func(h *Health) {
+		h.ttl = ttl
+	}
+}
+
+// WithLogger logs the checks that start failing or recover
+func WithLogger(log *zap.Logger) Option {
+	return func(h *Health) {
+		h.log = log
+	}
+}
+
+// WithRegisterer registers the health metrics on registerer instead of the global registry
+func WithRegisterer(registerer prometheus.Registerer) Option {
+	return func(h *Health) {
+		h.registerer = registerer
+	}
+}
+
+// Health runs the liveness and readiness checks of a service
+type Health struct {
+	service    string
+	timeout    time.Duration
+	ttl        time.Duration
+	log        *zap.Logger
+	registerer prometheus.Registerer
+
+	liveness  []*check
+	readiness []*check
+
+	// StatusGauge is 1 while a check passes and 0 while it fails
+	StatusGauge *prometheus.GaugeVec
+	// DurationGauge is how long the last run of a check took
+	DurationGauge *prometheus.GaugeVec
+}
+
+// check is a checker with its cached result
+type check struct {
+	name    string
+	probe   string
+	checker Checker
+
+	mu     sync.Mutex
+	result Result
+}
+
+// New creates the health checks of service and registers their metrics. Without checks both
+// probes pass, as long as the process can answer.
+func New(service string, opts ...Option) (*Health, error) {
+	h := &Health{
+		service:    service,
+		timeout:    DefaultTimeout,
+		ttl:        DefaultCacheTTL,
+		log:        zap.NewNop(),
+		registerer: prometheus.DefaultRegisterer,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	h.StatusGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "health_check_status",
+		Help: "Whether a health check passes (1) or fails (0)",
+	}, []string{"service", "probe", "check"})
+	h.DurationGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "health_check_duration_seconds",
+		Help: "Duration of the last run of a health check",
+	}, []string{"service", "probe", "check"})
+
+	for _, collector := range []prometheus.Collector{h.StatusGauge, h.DurationGauge} {
+		if err := h.registerer.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+// AddLiveness adds a check that the process works. Add checks before serving the probes.
+func (h *Health) AddLiveness(name string, checker Checker) {
+	h.liveness = append(h.liveness, &check{name: name, probe: ProbeLiveness, checker: checker})
+}
+
+// AddReadiness adds a check that a dependency the service needs to serve requests is available.
+// Add checks before serving the probes.
+func (h *Health) AddReadiness(name string, checker Checker) {
+	h.readiness = append(h.readiness, &check{name: name, probe: ProbeReadiness, checker: checker})
+}
+
+// Liveness runs the liveness checks, or reuses their cached results
+func (h *Health) Liveness(ctx context.Context) Report {
+	return h.report(ctx, h.liveness)
+}
+
+// Readiness runs the readiness checks, or reuses their cached results
+func (h *Health) Readiness(ctx context.Context) Report {
+	return h.report(ctx, h.readiness)
+}
+
+// LivenessHandler serves the liveness report, with 503 if a check fails
+func (h *Health) LivenessHandler() echo.HandlerFunc {
+	return h.handler(h.Liveness)
+}
+
+// ReadinessHandler serves the readiness report, with 503 if a check fails
+func (h *Health) ReadinessHandler() echo.HandlerFunc {
+	return h.handler(h.Readiness)
+}
+
+// Run refreshes the checks every cache TTL until ctx is done, so that the metrics stay current
+// between probes
+func (h *Health) Run(ctx context.Context) {
+	ticker := time.NewTicker(h.ttl)
+	defer ticker.Stop()
+	for {
+		h.Liveness(ctx)
+		h.Readiness(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (h *Health) handler(probe func(ctx context.Context) Report) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		report := probe(c.Request().Context())
+		status := http.StatusOK
+		if !report.OK() {
+			status = http.StatusServiceUnavailable
+		}
+		// Probes must see the current state
+		c.Response().Header().Set("Cache-Control", "no-store")
+		return c.JSON(status, report)
+	}
+}
+
+// report runs checks in parallel
+func (h *Health) report(ctx context.Context, checks []*check) Report {
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, chk := range checks {
+		wg.Add(1)
+		go func(i int, chk *check) {
+			defer wg.Done()
+			results[i] = h.run(ctx, chk)
+		}(i, chk)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Service: h.service, Checks: make(map[string]Result, len(checks))}
+	for i, chk := range checks {
+		report.Checks[chk.name] = results[i]
+		if results[i].Status != StatusOK {
+			report.Status = StatusFail
+		}
+	}
+	return report
+}
+
+// run returns the cached result of chk, or runs it. Concurrent callers wait for a single run.
+func (h *Health) run(ctx context.Context, chk *check) Result {
+	chk.mu.Lock()
+	defer chk.mu.Unlock()
+	if !chk.result.CheckedAt.IsZero() && time.Since(chk.result.CheckedAt) < h.ttl {
+		return chk.result
+	}
+
+	// The result is shared, so a caller that goes away must not fail the check
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), h.timeout)
+	defer cancel()
+	start := time.Now()
+	err := safeCheck(ctx, chk.checker)
+	duration := time.Since(start)
+
+	result := Result{Status: StatusOK, DurationMS: float64(duration.Microseconds()) / 1000, CheckedAt: start, Err: err}
+	if err != nil {
+		result.Status = StatusFail
+	}
+
+	switch {
+	case err != nil && chk.result.Err == nil:
+		h.log.Warn("Health check failing", zap.String("probe", chk.probe), zap.String("check", chk.name), zap.Error(err))
+	case err == nil && chk.result.Err != nil:
+		h.log.Info("Health check recovered", zap.String("probe", chk.probe), zap.String("check", chk.name))
+	}
+	chk.result = result
+
+	up := 0.0
+	if err == nil {
+		up = 1
+	}
+	h.StatusGauge.WithLabelValues(h.service, chk.probe, chk.name).Set(up)
+	h.DurationGauge.WithLabelValues(h.service, chk.probe, chk.name).Set(duration.Seconds())
+	return result
+}
+
+// safeCheck runs checker, turning a panic into an error
+func safeCheck(ctx context.Context, checker Checker) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("check panicked: %v", r)
+		}
+	}()
+	return checker(ctx)
+}
@@ -0,0 +1,115 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestReadiness(t *testing.T) {
+	h, err := New("test-service", WithRegisterer(prometheus.NewRegistry()), WithCacheTTL(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var runs atomic.Int32
+	var down atomic.Bool
+	h.AddReadiness("database", func(context.Context) error {
+		runs.Add(1)
+		if down.Load() {
+			return errors.New("connection refused")
+		}
+		return nil
+	})
+	h.AddReadiness("cache", func(context.Context) error { return nil })
+
+	serve := func(handler echo.HandlerFunc) (int, Report) {
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/readyz", nil), rec)
+		if err := handler(c); err != nil {
+			t.Fatal(err)
+		}
+		var report Report
+		if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+			t.Fatal(err)
+		}
+		return rec.Code, report
+	}
+
+	code, report := serve(h.ReadinessHandler())
+	if code != http.StatusOK || report.Status != StatusOK || len(report.Checks) != 2 || report.Checks["database"].Status != StatusOK {
+		t.Errorf("ready: %d %+v", code, report)
+	}
+	if got := testutil.ToFloat64(h.StatusGauge.WithLabelValues("test-service", ProbeReadiness, "database")); got != 1 {
+		t.Errorf("status gauge = %v", got)
+	}
+
+	// The result is cached until the TTL expires
+	down.Store(true)
+	if report := h.Readiness(context.Background()); !report.OK() || runs.Load() != 1 {
+		t.Errorf("cached: %+v after %d runs", report, runs.Load())
+	}
+
+	h.ttl = 0
+	code, report = serve(h.ReadinessHandler())
+	if code != http.StatusServiceUnavailable || report.Status != StatusFail || report.Checks["database"].Status != StatusFail ||
+		report.Checks["cache"].Status != StatusOK {
+		t.Errorf("not ready: %d %+v", code, report)
+	}
+	if got := testutil.ToFloat64(h.StatusGauge.WithLabelValues("test-service", ProbeReadiness, "database")); got != 0 {
+		t.Errorf("status gauge = %v", got)
+	}
+
+	// Liveness does not depend on the readiness checks
+	if code, report := serve(h.LivenessHandler()); code != http.StatusOK || len(report.Checks) != 0 {
+		t.Errorf("liveness: %d %+v", code, report)
+	}
+}
+
+func TestCheckTimeoutAndPanic(t *testing.T) {
+	h, err := New("test-service", WithRegisterer(prometheus.NewRegistry()), WithTimeout(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.AddLiveness("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	h.AddLiveness("broken", func(context.Context) error {
+		panic("nil map")
+	})
+
+	report := h.Liveness(context.Background())
+	if report.OK() || !errors.Is(report.Checks["slow"].Err, context.DeadlineExceeded) || report.Checks["broken"].Err == nil {
+		t.Errorf("unexpected report %+v", report)
+	}
+}
+
+func TestHTTP(t *testing.T) {
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	check := HTTP(srv.URL + "/livez")
+	if err := check(context.Background()); err != nil {
+		t.Errorf("reachable: %v", err)
+	}
+	status = http.StatusServiceUnavailable
+	if err := check(context.Background()); err == nil {
+		t.Error("503 passed")
+	}
+	srv.Close()
+	if err := check(context.Background()); err == nil {
+		t.Error("unreachable passed")
+	}
+}
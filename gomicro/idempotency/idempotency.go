@@ -0,0 +1,332 @@
+// Package idempotency makes POST and PATCH requests safe to retry. A client sends a unique
+// Idempotency-Key header; the first request with a key runs and its response is stored,
+// and retries with the same key and payload get the stored response instead of running
+// again. Keys are scoped to the tenant, or else to the user, client or IP, of the request.
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/suteetoe/gomicro/config"
+	"github.com/suteetoe/gomicro/database"
+	apperrors "github.com/suteetoe/gomicro/errors"
+	"github.com/suteetoe/gomicro/jwtutil"
+	"github.com/suteetoe/gomicro/logger"
+	"go.uber.org/zap"
+)
+
+// Headers read and written by the middleware
+const (
+	HeaderKey      = "Idempotency-Key"
+	HeaderReplayed = "Idempotent-Replayed"
+)
+
+// Defaults
+const (
+	// DefaultTTL is how long a response is kept for replay
+	DefaultTTL = 24 * time.Hour
+	// DefaultLockTimeout is how long a request in progress holds its key, so that a key
+	// claimed by a crashed replica becomes usable again
+	DefaultLockTimeout = time.Minute
+)
+
+// MaxKeyLength is the longest accepted Idempotency-Key
+const MaxKeyLength = 255
+
+// maxResponseSize is the largest response body that is stored; larger responses release
+// their key instead
+const maxResponseSize = 1 << 20
+
+// replayedHeaders are the response headers stored with a response
+var replayedHeaders = []string{
+	echo.HeaderContentType,
+	echo.HeaderLocation,
+	"Content-Location",
+	"ETag",
+}
+
+// ScopeFunc returns the scope keys of a request are unique in
+type ScopeFunc func(c echo.Context) string
+
+// DefaultScope scopes keys to the tenant of the request, else to the authenticated user or
+// OAuth client, and else to the client IP
+func DefaultScope(c echo.Context) string {
+	if tenantID, ok := database.TenantFromContext(c.Request().Context()); ok {
+		return fmt.Sprintf("tenant:%d", tenantID)
+	}
+	if claims, ok := c.Get("user").(*jwtutil.UserClaims); ok && claims.UserID != 0 {
+		return fmt.Sprintf("user:%d", claims.UserID)
+	}
+	for _, key := range []string{"tenant_id", "user_id", "client_id"} {
+		if value := c.Get(key); value != nil {
+			return fmt.Sprintf("%s:%v", key, value)
+		}
+	}
+	return "ip:" + c.RealIP()
+}
+
+// Option configures an Idempotency
+type Option func(*Idempotency)
+
+// WithTTL sets how long responses are kept for replay
+func WithTTL(ttl time.Duration) Option {
+	return func(i *Idempotency) {
+		i.ttl.Store(int64(ttl))
+	}
+}
+
+// WithLockTimeout sets how long a request in progress holds its key
+func WithLockTimeout(timeout time.Duration) Option {
+	return func(i *Idempotency) {
+		i.lockTimeout = timeout
+	}
+}
+
+// WithScope sets how the scope of a key is found
+func WithScope(scope ScopeFunc) Option {
+	return func(i *Idempotency) {
+		i.scope = scope
+	}
+}
+
+// WithRegisterer registers the metrics on registerer instead of the global registry
+func WithRegisterer(registerer prometheus.Registerer) Option {
+	return func(i *Idempotency) {
+		i.registerer = registerer
+	}
+}
+
+// Idempotency handles the Idempotency-Key header for one service. Without a store it admits
+// every request as if it had no key.
+type Idempotency struct {
+	service     string
+	store       Store
+	ttl         atomic.Int64
+	lockTimeout time.Duration
+	scope       ScopeFunc
+	registerer  prometheus.Registerer
+
+	// RequestCounter counts requests with a key per route and outcome: stored, replayed,
+	// released, in_progress or mismatch
+	RequestCounter *prometheus.CounterVec
+}
+
+// New creates the idempotency middleware of service and registers its metrics
+func New(service string, store Store, opts ...Option) (*Idempotency, error) {
+	i := &Idempotency{
+		service:     service,
+		store:       store,
+		lockTimeout: DefaultLockTimeout,
+		scope:       DefaultScope,
+		registerer:  prometheus.DefaultRegisterer,
+	}
+	i.ttl.Store(int64(DefaultTTL))
+	for _, opt := range opts {
+		opt(i)
+	}
+	if i.TTL() <= 0 || i.lockTimeout <= 0 {
+		return nil, fmt.Errorf("idempotency needs a positive TTL and lock timeout")
+	}
+
+	i.RequestCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "idempotency_requests_total",
+		Help: "Total number of requests with an Idempotency-Key by outcome",
+	}, []string{"service", "method", "path", "outcome"})
+	if err := i.registerer.Register(i.RequestCounter); err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+// TTL returns how long responses are kept for replay
+func (i *Idempotency) TTL() time.Duration {
+	return time.Duration(i.ttl.Load())
+}
+
+// ApplyConfig uses the idempotency.ttl of a reloaded configuration, for use with config.Watcher.
+// Responses stored before keep their expiry. A changed idempotency.store takes a restart.
+func (i *Idempotency) ApplyConfig(old, new *config.Config) error {
+	if new.Idempotency.TTL <= 0 {
+		return fmt.Errorf("idempotency needs a positive TTL")
+	}
+	i.ttl.Store(int64(new.Idempotency.TTL))
+	return nil
+}
+
+// Middleware honours the Idempotency-Key header on POST and PATCH requests. The response of
+// the first request with a key is stored, errors rendered by the HTTP error handler included,
+// unless it fails with a 5xx status or is refused with 401, 403 or 429, in which case the key
+// is released for a retry: the request did not run and may succeed once the caller is
+// authorized or throttling ends. A retry with the same payload gets the stored response with
+// Idempotent-Replayed: true; a retry while the first request is in progress
+// gets 409, and a reused key with a different method, path or body gets 422.
+//
+// Put it after the auth middleware, so that keys are scoped to the caller, and before
+// TenantTransaction, so that a response is stored only after its transaction committed.
+func (i *Idempotency) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		if i.store == nil {
+			return next
+		}
+		return func(c echo.Context) error {
+			req := c.Request()
+			key := req.Header.Get(HeaderKey)
+			if key == "" || (req.Method != http.MethodPost && req.Method != http.MethodPatch) {
+				return next(c)
+			}
+			if len(key) > MaxKeyLength {
+				return apperrors.Newf(http.StatusBadRequest, "%s must be at most %d characters", HeaderKey, MaxKeyLength)
+			}
+
+			// Services with their own logger package may not have initialized the gomicro logger
+			log := logger.FromEcho(c)
+			if log == nil {
+				log = zap.NewNop()
+			}
+			log = log.With(zap.String("idempotency_key", key))
+
+			body, err := io.ReadAll(req.Body)
+			if err != nil {
+				return apperrors.BadRequest("failed to read request body")
+			}
+			req.Body = io.NopCloser(bytes.NewReader(body))
+
+			ctx := req.Context()
+			id := ID{Service: i.service, Scope: i.scope(c), Key: key}
+			fingerprint := fingerprint(req, body)
+
+			record, err := i.store.Begin(ctx, id, fingerprint, i.lockTimeout)
+			if err != nil {
+				// Running the request could create the duplicate the key is meant to prevent
+				log.Error("Failed to claim idempotency key", zap.Error(err))
+				return apperrors.Unavailable("idempotency keys are unavailable, retry later").WithCause(err)
+			}
+			if record != nil {
+				switch {
+				case record.Fingerprint != fingerprint:
+					i.count(c, "mismatch")
+					log.Warn("Idempotency key reused with a different request")
+					return apperrors.Newf(http.StatusUnprocessableEntity, "%s was already used with a different request", HeaderKey)
+				case record.Response == nil:
+					i.count(c, "in_progress")
+					c.Response().Header().Set("Retry-After", "1")
+					return apperrors.Newf(http.StatusConflict, "a request with this %s is still in progress", HeaderKey)
+				default:
+					i.count(c, "replayed")
+					return replay(c, record.Response)
+				}
+			}
+
+			// The client may have given up while the request ran; its retry needs the outcome
+			ctx = context.WithoutCancel(ctx)
+			res := c.Response()
+			recorder := &responseRecorder{ResponseWriter: res.Writer}
+			res.Writer = recorder
+			err = next(c)
+			if err != nil {
+				// Render the error now, so that a 4xx problem is stored like any other response
+				c.Error(err)
+			}
+			res.Writer = recorder.ResponseWriter
+
+			if !res.Committed || !storable(res.Status) || recorder.overflow {
+				i.count(c, "released")
+				if releaseErr := i.store.Release(ctx, id); releaseErr != nil {
+					log.Error("Failed to release idempotency key", zap.Error(releaseErr))
+				}
+				return err
+			}
+
+			response := Response{StatusCode: res.Status, Header: http.Header{}, Body: recorder.body.Bytes()}
+			for _, name := range replayedHeaders {
+				if values := res.Header().Values(name); len(values) > 0 {
+					response.Header[name] = values
+				}
+			}
+			if completeErr := i.store.Complete(ctx, id, response, i.TTL()); completeErr != nil {
+				// The response has been sent; a retry will find the key released or claimed
+				log.Error("Failed to store idempotent response", zap.Error(completeErr))
+				return err
+			}
+			i.count(c, "stored")
+			return err
+		}
+	}
+}
+
+// storable reports whether a response with status is kept for replay. Server errors and the
+// refusals of authentication, authorization and rate limiting are answers about this attempt,
+// not about the request, and a retry may get another.
+func storable(status int) bool {
+	switch status {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests:
+		return false
+	}
+	return status < http.StatusInternalServerError
+}
+
+// count records the outcome of a request with a key
+func (i *Idempotency) count(c echo.Context, outcome string) {
+	path := c.Path()
+	if path == "" {
+		path = "unmatched"
+	}
+	i.RequestCounter.WithLabelValues(i.service, c.Request().Method, path, outcome).Inc()
+}
+
+// fingerprint identifies a request by its method, URI and body
+func fingerprint(req *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(req.Method + " " + req.URL.RequestURI() + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// replay sends a stored response
+func replay(c echo.Context, response *Response) error {
+	header := c.Response().Header()
+	for name, values := range response.Header {
+		header[name] = values
+	}
+	header.Set(HeaderReplayed, "true")
+	c.Response().WriteHeader(response.StatusCode)
+	_, err := c.Response().Write(response.Body)
+	return err
+}
+
+// responseRecorder copies the response body while it is written
+type responseRecorder struct {
+	http.ResponseWriter
+	body     bytes.Buffer
+	overflow bool
+}
+
+// Write implements http.ResponseWriter
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if !r.overflow {
+		if r.body.Len()+len(b) > maxResponseSize {
+			r.overflow = true
+			r.body.Reset()
+		} else {
+			r.body.Write(b)
+		}
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher
+func (r *responseRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
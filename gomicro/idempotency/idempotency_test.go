@@ -0,0 +1,204 @@
+package idempotency
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/suteetoe/gomicro/config"
+	apperrors "github.com/suteetoe/gomicro/errors"
+	"go.uber.org/zap"
+)
+
+func TestMiddleware(t *testing.T) {
+	store := NewMemoryStore()
+	idem, err := New("test-service", store, WithRegisterer(prometheus.NewRegistry()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	created := 0
+	e := echo.New()
+	e.HTTPErrorHandler = apperrors.NewHTTPErrorHandler()
+	e.POST("/products", func(c echo.Context) error {
+		if strings.Contains(c.Request().Header.Get("X-Fail"), "yes") {
+			return c.JSON(http.StatusInternalServerError, echo.Map{"error": "database unavailable"})
+		}
+		created++
+		c.Response().Header().Set(echo.HeaderLocation, "/products/1")
+		return c.JSON(http.StatusCreated, echo.Map{"id": created})
+	}, idem.Middleware())
+
+	post := func(key, body string, fail bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/products", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(HeaderKey, key)
+		if fail {
+			req.Header.Set("X-Fail", "yes")
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := post("key-1", `{"name":"tea"}`, false)
+	if first.Code != http.StatusCreated || created != 1 {
+		t.Fatalf("first request: status %d, %d created", first.Code, created)
+	}
+	retry := post("key-1", `{"name":"tea"}`, false)
+	if retry.Code != http.StatusCreated || created != 1 {
+		t.Fatalf("retry: status %d, %d created; want the stored response", retry.Code, created)
+	}
+	if retry.Body.String() != first.Body.String() || retry.Header().Get(HeaderReplayed) != "true" ||
+		retry.Header().Get(echo.HeaderLocation) != "/products/1" {
+		t.Errorf("retry replayed %q with headers %v", retry.Body.String(), retry.Header())
+	}
+
+	if rec := post("key-1", `{"name":"coffee"}`, false); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("reused key with another payload: status %d, want 422", rec.Code)
+	}
+
+	// A failed request releases its key
+	if rec := post("key-2", `{"name":"coffee"}`, true); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("failing request: status %d", rec.Code)
+	}
+	if rec := post("key-2", `{"name":"coffee"}`, false); rec.Code != http.StatusCreated || created != 2 {
+		t.Errorf("retry after a failure: status %d, %d created", rec.Code, created)
+	}
+
+	// A key held by a request in progress
+	inProgress := fingerprint(httptest.NewRequest(http.MethodPost, "/products", nil), []byte(`{}`))
+	id := ID{Service: "test-service", Scope: "ip:192.0.2.1", Key: "key-3"}
+	if _, err := store.Begin(context.Background(), id, inProgress, DefaultLockTimeout); err != nil {
+		t.Fatal(err)
+	}
+	if rec := post("key-3", `{}`, false); rec.Code != http.StatusConflict {
+		t.Errorf("key in progress: status %d, want 409", rec.Code)
+	}
+
+	// Requests without a key are not tracked
+	if rec := post("", `{"name":"tea"}`, false); rec.Code != http.StatusCreated || created != 3 {
+		t.Errorf("request without a key: status %d, %d created", rec.Code, created)
+	}
+
+	replayed := testutil.ToFloat64(idem.RequestCounter.WithLabelValues("test-service", http.MethodPost, "/products", "replayed"))
+	if replayed != 1 {
+		t.Errorf("recorded %v replays, want 1", replayed)
+	}
+}
+
+func TestMiddlewareReleasesRefusedRequests(t *testing.T) {
+	refusals := map[string]error{
+		"unauthenticated": apperrors.Unauthorized("missing token"),
+		"forbidden":       apperrors.Forbidden("missing permission product:create"),
+		"throttled":       apperrors.TooManyRequests("rate limit exceeded"),
+		"invalid":         apperrors.BadRequest("name is required"),
+	}
+	for refusal, refused := range refusals {
+		t.Run(refusal, func(t *testing.T) {
+			idem, err := New("test-service", NewMemoryStore(), WithRegisterer(prometheus.NewRegistry()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			// authorize stands for the middleware after idempotency, e.g. RequirePermission
+			allowed := false
+			authorize := func(next echo.HandlerFunc) echo.HandlerFunc {
+				return func(c echo.Context) error {
+					if !allowed {
+						return refused
+					}
+					return next(c)
+				}
+			}
+			e := echo.New()
+			e.HTTPErrorHandler = apperrors.NewHTTPErrorHandler()
+			e.POST("/products", func(c echo.Context) error {
+				return c.NoContent(http.StatusCreated)
+			}, idem.Middleware(), authorize)
+			post := func() int {
+				req := httptest.NewRequest(http.MethodPost, "/products", strings.NewReader(`{}`))
+				req.Header.Set(HeaderKey, "key-1")
+				rec := httptest.NewRecorder()
+				e.ServeHTTP(rec, req)
+				return rec.Code
+			}
+
+			status := apperrors.StatusCode(refused)
+			if code := post(); code != status {
+				t.Fatalf("refused request: status %d, want %d", code, status)
+			}
+			allowed = true
+			want := http.StatusCreated
+			if status == http.StatusBadRequest {
+				// The request itself is invalid, so its answer is replayed
+				want = status
+			}
+			if code := post(); code != want {
+				t.Errorf("retry once allowed: status %d, want %d", code, want)
+			}
+		})
+	}
+}
+
+func TestApplyConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("idempotency:\n  ttl: 1h\n")
+	conf, err := config.Load("test-service", config.WithFile(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := NewMemoryStore()
+	idem, err := New("test-service", store, WithTTL(conf.Idempotency.TTL), WithRegisterer(prometheus.NewRegistry()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	watcher := config.NewWatcher(conf, zap.NewNop())
+	watcher.Subscribe("idempotency", idem.ApplyConfig)
+
+	e := echo.New()
+	e.POST("/products", func(c echo.Context) error {
+		return c.NoContent(http.StatusCreated)
+	}, idem.Middleware())
+	// post stores a response under key and returns how long it is kept
+	post := func(key string) time.Duration {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/products", strings.NewReader(`{}`))
+		req.Header.Set(HeaderKey, key)
+		e.ServeHTTP(httptest.NewRecorder(), req)
+		record, ok := store.records[ID{Service: "test-service", Scope: "ip:192.0.2.1", Key: key}]
+		if !ok || record.Response == nil {
+			t.Fatalf("no response stored for %s", key)
+		}
+		return time.Until(record.expiresAt).Round(time.Hour)
+	}
+
+	if kept := post("key-1"); kept != time.Hour {
+		t.Fatalf("kept %v, want 1h", kept)
+	}
+
+	write("idempotency:\n  ttl: 48h\n")
+	if err := watcher.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if kept := post("key-2"); kept != 48*time.Hour {
+		t.Errorf("kept %v after the reload, want 48h", kept)
+	}
+	if idem.TTL() != 48*time.Hour {
+		t.Errorf("TTL %v, want 48h", idem.TTL())
+	}
+}
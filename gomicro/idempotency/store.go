@@ -0,0 +1,280 @@
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/suteetoe/gomicro/database"
+	"gorm.io/gorm"
+)
+
+// sweepInterval is how often stores delete expired records
+const sweepInterval = time.Minute
+
+// ID identifies a key: keys are unique per service and scope, e.g. per tenant
+type ID struct {
+	Service string
+	Scope   string
+	Key     string
+}
+
+// Response is a stored response
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// Record is what a Store holds for a key
+type Record struct {
+	// Fingerprint identifies the request that claimed the key
+	Fingerprint string
+	// Response is nil while that request is in progress
+	Response *Response
+}
+
+// Store keeps the records of idempotency keys
+type Store interface {
+	// Begin claims id for a request with fingerprint, for at most lockTimeout. It returns nil
+	// when the claim succeeded, else the live record of the request that claimed id before.
+	Begin(ctx context.Context, id ID, fingerprint string, lockTimeout time.Duration) (*Record, error)
+	// Complete stores the response of the request holding the claim for ttl
+	Complete(ctx context.Context, id ID, response Response, ttl time.Duration) error
+	// Release drops the claim without a response, so that the request may be retried
+	Release(ctx context.Context, id ID) error
+}
+
+// Store names accepted by NewStore
+const (
+	StoreMemory   = "memory"
+	StorePostgres = "postgres"
+	// StoreNone disables idempotency keys
+	StoreNone = "none"
+)
+
+// NewStore returns the store named by kind, e.g. from IDEMPOTENCY_STORE. It returns nil for
+// StoreNone.
+func NewStore(kind string, db *gorm.DB) (Store, error) {
+	switch kind {
+	case StoreMemory:
+		return NewMemoryStore(), nil
+	case StorePostgres:
+		return NewDBStore(db), nil
+	case StoreNone, "":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown idempotency store %q", kind)
+	}
+}
+
+// MemoryStore keeps records in the process, for a single replica and for tests
+type MemoryStore struct {
+	mu        sync.Mutex
+	records   map[ID]memoryRecord
+	lastSweep time.Time
+}
+
+type memoryRecord struct {
+	Record
+	expiresAt time.Time
+}
+
+// NewMemoryStore creates an in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make(map[ID]memoryRecord)}
+}
+
+// Begin implements Store
+func (s *MemoryStore) Begin(_ context.Context, id ID, fingerprint string, lockTimeout time.Duration) (*Record, error) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.lastSweep) >= sweepInterval {
+		for k, record := range s.records {
+			if !record.expiresAt.After(now) {
+				delete(s.records, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	if record, ok := s.records[id]; ok && record.expiresAt.After(now) {
+		existing := record.Record
+		return &existing, nil
+	}
+	s.records[id] = memoryRecord{Record: Record{Fingerprint: fingerprint}, expiresAt: now.Add(lockTimeout)}
+	return nil, nil
+}
+
+// Complete implements Store
+func (s *MemoryStore) Complete(_ context.Context, id ID, response Response, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.records[id]
+	if !ok || record.Response != nil {
+		return nil
+	}
+	record.Response = &response
+	record.expiresAt = time.Now().Add(ttl)
+	s.records[id] = record
+	return nil
+}
+
+// Release implements Store
+func (s *MemoryStore) Release(_ context.Context, id ID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if record, ok := s.records[id]; ok && record.Response == nil {
+		delete(s.records, id)
+	}
+	return nil
+}
+
+// Entry is a row of the idempotency_keys table. StatusCode is 0 while the request is in
+// progress.
+type Entry struct {
+	Service     string    `gorm:"primaryKey;size:64"`
+	Scope       string    `gorm:"primaryKey;size:128"`
+	Key         string    `gorm:"primaryKey;size:255"`
+	Fingerprint string    `gorm:"size:64;not null"`
+	StatusCode  int       `gorm:"not null;default:0"`
+	Header      string    `gorm:"type:text"`
+	Body        []byte    `gorm:"type:bytea"`
+	CreatedAt   time.Time `gorm:"not null"`
+	ExpiresAt   time.Time `gorm:"not null;index"`
+}
+
+// TableName overrides the table name used by Entry
+func (Entry) TableName() string {
+	return "idempotency_keys"
+}
+
+// Migrate creates or updates the idempotency_keys table, e.g. from a migration
+func Migrate(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&Entry{}); err != nil {
+		return fmt.Errorf("failed to migrate idempotency keys: %w", err)
+	}
+	return nil
+}
+
+// DBStore keeps records in Postgres, so that a retry reaching another replica is recognized.
+// Responses are stored as they were sent, so access to the table must be restricted like
+// access to the resources themselves.
+type DBStore struct {
+	db *gorm.DB
+
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+// NewDBStore creates a store kept through db
+func NewDBStore(db *gorm.DB) *DBStore {
+	return &DBStore{db: db}
+}
+
+// where selects the row of id
+func where(tx *gorm.DB, id ID) *gorm.DB {
+	return tx.Where("service = ? AND scope = ? AND key = ?", id.Service, id.Scope, id.Key)
+}
+
+// Begin implements Store
+func (s *DBStore) Begin(ctx context.Context, id ID, fingerprint string, lockTimeout time.Duration) (*Record, error) {
+	// Keys carry their scope explicitly
+	ctx = database.WithoutTenantScope(ctx)
+	db := database.Primary(s.db.WithContext(ctx))
+	now := time.Now().UTC()
+
+	if s.sweepDue(now) {
+		if err := db.Where("expires_at < ?", now).Delete(&Entry{}).Error; err != nil {
+			return nil, fmt.Errorf("failed to delete expired idempotency keys: %w", err)
+		}
+	}
+
+	// A row that was deleted between the claim and the lookup is claimed again
+	for attempt := 0; attempt < 2; attempt++ {
+		// Claim the key unless a live row holds it; an expired row is taken over
+		result := db.Exec(`INSERT INTO idempotency_keys (service, scope, key, fingerprint, status_code, created_at, expires_at)
+			VALUES (?, ?, ?, ?, 0, ?, ?)
+			ON CONFLICT (service, scope, key) DO UPDATE
+			SET fingerprint = excluded.fingerprint, status_code = 0, header = NULL, body = NULL,
+				created_at = excluded.created_at, expires_at = excluded.expires_at
+			WHERE idempotency_keys.expires_at <= excluded.created_at`,
+			id.Service, id.Scope, id.Key, fingerprint, now, now.Add(lockTimeout))
+		if result.Error != nil {
+			return nil, fmt.Errorf("failed to claim idempotency key: %w", result.Error)
+		}
+		if result.RowsAffected == 1 {
+			return nil, nil
+		}
+
+		var entry Entry
+		err := where(db, id).Take(&entry).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read idempotency key: %w", err)
+		}
+
+		record := &Record{Fingerprint: entry.Fingerprint}
+		if entry.StatusCode != 0 {
+			response := Response{StatusCode: entry.StatusCode, Body: entry.Body}
+			if entry.Header != "" {
+				if err := json.Unmarshal([]byte(entry.Header), &response.Header); err != nil {
+					return nil, fmt.Errorf("failed to decode stored response headers: %w", err)
+				}
+			}
+			record.Response = &response
+		}
+		return record, nil
+	}
+	return nil, fmt.Errorf("failed to claim idempotency key %q", id.Key)
+}
+
+// Complete implements Store
+func (s *DBStore) Complete(ctx context.Context, id ID, response Response, ttl time.Duration) error {
+	header, err := json.Marshal(response.Header)
+	if err != nil {
+		return fmt.Errorf("failed to encode response headers: %w", err)
+	}
+	err = where(s.db.WithContext(database.WithoutTenantScope(ctx)).Model(&Entry{}), id).
+		Where("status_code = 0").
+		Updates(map[string]interface{}{
+			"status_code": response.StatusCode,
+			"header":      string(header),
+			"body":        response.Body,
+			"expires_at":  time.Now().UTC().Add(ttl),
+		}).Error
+	if err != nil {
+		return fmt.Errorf("failed to store idempotent response: %w", err)
+	}
+	return nil
+}
+
+// Release implements Store
+func (s *DBStore) Release(ctx context.Context, id ID) error {
+	err := where(s.db.WithContext(database.WithoutTenantScope(ctx)), id).
+		Where("status_code = 0").
+		Delete(&Entry{}).Error
+	if err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
+
+// sweepDue reports whether expired records should be deleted, at most once per sweepInterval
+func (s *DBStore) sweepDue(now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return false
+	}
+	s.lastSweep = now
+	return true
+}
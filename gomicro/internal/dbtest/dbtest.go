@@ -0,0 +1,145 @@
+// Package dbtest opens GORM with the Postgres dialect on a fake connection whose statements are
+// answered by a Handler, so that packages talking to Postgres can be tested without a server.
+// Handlers see the SQL GORM generates, with $n placeholders, and BEGIN, COMMIT and ROLLBACK for
+// transactions.
+package dbtest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Result answers a statement: the rows of a query, or the rows affected by an exec
+type Result struct {
+	Columns      []string
+	Rows         [][]driver.Value
+	RowsAffected int64
+}
+
+// Handler answers one statement. Statements are serialized, so handlers need no locking.
+type Handler func(query string, args []driver.Value) (Result, error)
+
+// Open returns a GORM connection whose statements are answered by handler
+func Open(t testing.TB, handler Handler) *gorm.DB {
+	t.Helper()
+	sqlDB := sql.OpenDB(&connector{handler: handler})
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	return db
+}
+
+type connector struct {
+	mu      sync.Mutex
+	handler Handler
+}
+
+func (c *connector) Connect(context.Context) (driver.Conn, error) {
+	return &conn{connector: c}, nil
+}
+
+func (c *connector) Driver() driver.Driver {
+	return fakeDriver{}
+}
+
+func (c *connector) handle(query string, args []driver.NamedValue) (Result, error) {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.handler(query, values)
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("dbtest: use Open")
+}
+
+type conn struct {
+	connector *connector
+}
+
+func (c *conn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("dbtest: prepared statements are not supported")
+}
+
+func (c *conn) Close() error {
+	return nil
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *conn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	if _, err := c.connector.handle("BEGIN", nil); err != nil {
+		return nil, err
+	}
+	return tx{conn: c}, nil
+}
+
+func (c *conn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	result, err := c.connector.handle(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(result.RowsAffected), nil
+}
+
+func (c *conn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	result, err := c.connector.handle(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &rows{columns: result.Columns, rows: result.Rows}, nil
+}
+
+type tx struct {
+	conn *conn
+}
+
+func (t tx) Commit() error {
+	_, err := t.conn.connector.handle("COMMIT", nil)
+	return err
+}
+
+func (t tx) Rollback() error {
+	_, err := t.conn.connector.handle("ROLLBACK", nil)
+	return err
+}
+
+type rows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *rows) Columns() []string {
+	return r.columns
+}
+
+func (r *rows) Close() error {
+	return nil
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
@@ -0,0 +1,194 @@
+package jwtutil
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/suteetoe/gomicro/database"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Denylist records revoked tokens. A token is revoked when its jti was revoked, or when it
+// was issued at or before the revocation time of its user. Issue times (iat) have a precision
+// of one second, so user revocations are compared by the second, see RevocationSecond.
+type Denylist interface {
+	// Revoke revokes the token with jti; the entry is dropped once the token has expired
+	Revoke(ctx context.Context, jti string, expiresAt time.Time) error
+	// RevokeUser revokes every token of the user issued in the second of before or earlier
+	RevokeUser(ctx context.Context, userID uint, before time.Time) error
+	// Revoked reports whether the token is revoked
+	Revoked(ctx context.Context, jti string, userID uint, issuedAt time.Time) (bool, error)
+}
+
+// RevocationSecond returns the boundary of a user revocation or token issue time: the whole
+// second, in UTC, that contains t. A token is revoked when the second of its iat is at or before
+// the second of the revocation, so that tokens issued earlier in the second of the revocation,
+// whose iat cannot tell them apart from later ones, are revoked as well. Tokens issued later
+// in that second are revoked too; their holders have to sign in again.
+func RevocationSecond(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Second)
+}
+
+// Denylist names accepted by NewDenylist
+const (
+	DenylistMemory   = "memory"
+	DenylistPostgres = "postgres"
+	// DenylistNone disables revocation checks
+	DenylistNone = "none"
+)
+
+// NewDenylist returns the denylist named by kind, e.g. from JWT_DENYLIST. It returns nil
+// for DenylistNone.
+func NewDenylist(kind string, db *gorm.DB) (Denylist, error) {
+	switch kind {
+	case DenylistMemory:
+		return NewMemoryDenylist(), nil
+	case DenylistPostgres:
+		return NewDBDenylist(db), nil
+	case DenylistNone, "":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown JWT denylist %q", kind)
+	}
+}
+
+// MemoryDenylist keeps revocations in the process, for a single replica and for tests.
+// Revoked jtis are dropped once their tokens have expired.
+type MemoryDenylist struct {
+	mu     sync.RWMutex
+	tokens map[string]time.Time
+	users  map[uint]time.Time
+}
+
+// NewMemoryDenylist creates an in-memory denylist
+func NewMemoryDenylist() *MemoryDenylist {
+	return &MemoryDenylist{tokens: make(map[string]time.Time), users: make(map[uint]time.Time)}
+}
+
+// Revoke implements Denylist
+func (d *MemoryDenylist) Revoke(_ context.Context, jti string, expiresAt time.Time) error {
+	now := time.Now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for id, expiry := range d.tokens {
+		if expiry.Before(now) {
+			delete(d.tokens, id)
+		}
+	}
+	d.tokens[jti] = expiresAt
+	return nil
+}
+
+// RevokeUser implements Denylist
+func (d *MemoryDenylist) RevokeUser(_ context.Context, userID uint, before time.Time) error {
+	before = RevocationSecond(before)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if before.After(d.users[userID]) {
+		d.users[userID] = before
+	}
+	return nil
+}
+
+// Revoked implements Denylist
+func (d *MemoryDenylist) Revoked(_ context.Context, jti string, userID uint, issuedAt time.Time) (bool, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if expiry, ok := d.tokens[jti]; ok && jti != "" && expiry.After(time.Now()) {
+		return true, nil
+	}
+	if before, ok := d.users[userID]; ok && !RevocationSecond(issuedAt).After(before) {
+		return true, nil
+	}
+	return false, nil
+}
+
+// RevokedToken is a row of the jwt_revoked_tokens table
+type RevokedToken struct {
+	JTI       string    `gorm:"primaryKey;size:64"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+}
+
+// TableName overrides the table name used by RevokedToken
+func (RevokedToken) TableName() string {
+	return "jwt_revoked_tokens"
+}
+
+// UserRevocation is a row of the jwt_user_revocations table
+type UserRevocation struct {
+	UserID        uint      `gorm:"primaryKey;autoIncrement:false"`
+	RevokedBefore time.Time `gorm:"not null"`
+}
+
+// TableName overrides the table name used by UserRevocation
+func (UserRevocation) TableName() string {
+	return "jwt_user_revocations"
+}
+
+// MigrateDenylist creates or updates the denylist tables, e.g. from a migration
+func MigrateDenylist(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&RevokedToken{}, &UserRevocation{}); err != nil {
+		return fmt.Errorf("failed to migrate JWT denylist: %w", err)
+	}
+	return nil
+}
+
+// DBDenylist keeps revocations in Postgres, so that every service sharing the database sees
+// them. Lookups go to the primary so that a revocation applies at once.
+type DBDenylist struct {
+	db *gorm.DB
+}
+
+// NewDBDenylist creates a denylist stored through db
+func NewDBDenylist(db *gorm.DB) *DBDenylist {
+	return &DBDenylist{db: db}
+}
+
+// Revoke implements Denylist
+func (d *DBDenylist) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	db := d.db.WithContext(database.WithoutTenantScope(ctx))
+	err := db.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&RevokedToken{JTI: jti, ExpiresAt: expiresAt.UTC()}).Error
+	if err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+	// Expired tokens are rejected anyway, so their entries can go
+	if err := db.Where("expires_at < ?", time.Now().UTC()).Delete(&RevokedToken{}).Error; err != nil {
+		return fmt.Errorf("failed to purge revoked tokens: %w", err)
+	}
+	return nil
+}
+
+// RevokeUser implements Denylist
+func (d *DBDenylist) RevokeUser(ctx context.Context, userID uint, before time.Time) error {
+	err := d.db.WithContext(database.WithoutTenantScope(ctx)).
+		Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "user_id"}},
+			DoUpdates: clause.Set{{
+				Column: clause.Column{Name: "revoked_before"},
+				Value:  gorm.Expr("GREATEST(jwt_user_revocations.revoked_before, excluded.revoked_before)"),
+			}},
+		}).
+		Create(&UserRevocation{UserID: userID, RevokedBefore: RevocationSecond(before)}).Error
+	if err != nil {
+		return fmt.Errorf("failed to revoke tokens of user %d: %w", userID, err)
+	}
+	return nil
+}
+
+// Revoked implements Denylist
+func (d *DBDenylist) Revoked(ctx context.Context, jti string, userID uint, issuedAt time.Time) (bool, error) {
+	var revoked bool
+	err := database.Primary(d.db.WithContext(database.WithoutTenantScope(ctx))).
+		Raw(`SELECT EXISTS (SELECT 1 FROM jwt_revoked_tokens WHERE jti = ? AND jti <> '')
+			OR EXISTS (SELECT 1 FROM jwt_user_revocations WHERE user_id = ? AND revoked_before >= ?)`,
+			jti, userID, RevocationSecond(issuedAt)).
+		Scan(&revoked).Error
+	if err != nil {
+		return false, fmt.Errorf("failed to check token revocation: %w", err)
+	}
+	return revoked, nil
+}
@@ -0,0 +1,88 @@
+package jwtutil
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/suteetoe/gomicro/internal/dbtest"
+)
+
+func TestMemoryDenylistRevocationBoundary(t *testing.T) {
+	ctx := context.Background()
+	revokedAt := time.Date(2026, 1, 2, 12, 0, 0, 700*int(time.Millisecond), time.UTC)
+	denylist := NewMemoryDenylist()
+	if err := denylist.RevokeUser(ctx, 1, revokedAt); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		issuedAt time.Time
+		want     bool
+	}{
+		{"second before", revokedAt.Add(-time.Second), true},
+		{"start of the second", revokedAt.Truncate(time.Second), true},
+		{"earlier in the second", revokedAt.Add(-100 * time.Millisecond), true},
+		// iat cannot tell tokens issued later in the second apart from earlier ones
+		{"later in the second", revokedAt.Add(200 * time.Millisecond), true},
+		{"next second", revokedAt.Truncate(time.Second).Add(time.Second), false},
+		{"other time zone", revokedAt.In(time.FixedZone("ICT", 7*60*60)), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := denylist.Revoked(ctx, "", 1, tt.issuedAt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Revoked(iat %v) = %v, want %v", tt.issuedAt, got, tt.want)
+			}
+		})
+	}
+
+	// An earlier revocation does not move the cutoff back
+	if err := denylist.RevokeUser(ctx, 1, revokedAt.Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if revoked, _ := denylist.Revoked(ctx, "", 1, revokedAt); !revoked {
+		t.Error("earlier revocation moved the cutoff back")
+	}
+}
+
+func TestDBDenylistRevocationBoundary(t *testing.T) {
+	ctx := context.Background()
+	revokedAt := time.Date(2026, 1, 2, 19, 0, 0, 700*int(time.Millisecond), time.FixedZone("ICT", 7*60*60))
+	want := time.Date(2026, 1, 2, 12, 0, 0, 0, time.UTC)
+
+	var times []time.Time
+	db := dbtest.Open(t, func(query string, args []driver.Value) (dbtest.Result, error) {
+		for _, arg := range args {
+			if at, ok := arg.(time.Time); ok {
+				times = append(times, at)
+			}
+		}
+		if strings.HasPrefix(query, "SELECT") {
+			return dbtest.Result{Columns: []string{"exists"}, Rows: [][]driver.Value{{true}}}, nil
+		}
+		return dbtest.Result{RowsAffected: 1}, nil
+	})
+	denylist := NewDBDenylist(db)
+
+	if err := denylist.RevokeUser(ctx, 1, revokedAt); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := denylist.Revoked(ctx, "jti", 1, revokedAt.Add(200*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	if len(times) != 2 {
+		t.Fatalf("got times %v, want the cutoff and the issue time", times)
+	}
+	for i, got := range times {
+		if !got.Equal(want) || got.Location() != time.UTC {
+			t.Errorf("time %d = %v, want %v", i, got, want)
+		}
+	}
+}
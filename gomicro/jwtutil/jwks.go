@@ -0,0 +1,194 @@
+package jwtutil
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	apperrors "github.com/suteetoe/gomicro/errors"
+)
+
+// JWKSPath is where issuers serve their key set
+const JWKSPath = "/.well-known/jwks.json"
+
+// JWKS client defaults
+const (
+	DefaultJWKSCacheTTL = 5 * time.Minute
+	// DefaultJWKSMinRefreshInterval limits refetches caused by tokens with unknown kids
+	DefaultJWKSMinRefreshInterval = 10 * time.Second
+)
+
+// maxJWKSSize caps the size of a fetched key set
+const maxJWKSSize = 1 << 20
+
+// JWKS is a JSON Web Key Set
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKSHandler serves the public keys of keys, active and retired, as a JWKS document
+func JWKSHandler(keys *KeySet) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		set, err := keys.JWKS()
+		if err != nil {
+			return apperrors.Internal("Failed to load signing keys", err)
+		}
+		c.Response().Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(DefaultJWKSCacheTTL.Seconds())))
+		return c.JSON(http.StatusOK, set)
+	}
+}
+
+// JWKSClientOption configures a JWKSClient
+type JWKSClientOption func(*JWKSClient)
+
+// WithHTTPClient sets the client used to fetch the key set
+func WithHTTPClient(client *http.Client) JWKSClientOption {
+	return func(c *JWKSClient) {
+		c.httpClient = client
+	}
+}
+
+// WithCacheTTL sets how long a fetched key set is used before it is fetched again
+func WithCacheTTL(ttl time.Duration) JWKSClientOption {
+	return func(c *JWKSClient) {
+		c.ttl = ttl
+	}
+}
+
+// WithMinRefreshInterval sets the minimum time between two fetches of the key set
+func WithMinRefreshInterval(interval time.Duration) JWKSClientOption {
+	return func(c *JWKSClient) {
+		c.minRefreshInterval = interval
+	}
+}
+
+// JWKSClient resolves kids against the key set served by an issuer, so that verifiers need
+// no secret. The key set is cached and fetched again when it expires or a token names a kid
+// that is not cached, e.g. right after a rotation. While the issuer is unreachable the last
+// fetched keys keep working.
+type JWKSClient struct {
+	url                string
+	httpClient         *http.Client
+	ttl                time.Duration
+	minRefreshInterval time.Duration
+
+	// refreshMu serializes fetches
+	refreshMu   sync.Mutex
+	mu          sync.RWMutex
+	keys        map[string]*Key
+	fetchedAt   time.Time
+	lastAttempt time.Time
+}
+
+// NewJWKSClient creates a client for the key set at url, e.g. from JWT_JWKS_URL
+func NewJWKSClient(url string, opts ...JWKSClientOption) *JWKSClient {
+	c := &JWKSClient{
+		url:                url,
+		httpClient:         &http.Client{Timeout: 10 * time.Second},
+		ttl:                DefaultJWKSCacheTTL,
+		minRefreshInterval: DefaultJWKSMinRefreshInterval,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Key implements KeyResolver
+func (c *JWKSClient) Key(ctx context.Context, kid string) (*Key, error) {
+	key, fresh := c.cached(kid)
+	if key != nil && fresh {
+		return key, nil
+	}
+
+	if err := c.refresh(ctx); err != nil {
+		// Keep verifying with the keys we have while the issuer is unavailable
+		if key != nil {
+			return key, nil
+		}
+		return nil, err
+	}
+
+	if key, _ := c.cached(kid); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w %q", ErrUnknownKey, kid)
+}
+
+// cached returns the cached key with kid and whether the cache is within its TTL
+func (c *JWKSClient) cached(kid string) (*Key, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.keys[kid], time.Since(c.fetchedAt) < c.ttl
+}
+
+// refresh fetches the key set unless it was fetched or attempted within the minimum
+// refresh interval
+func (c *JWKSClient) refresh(ctx context.Context) error {
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+
+	c.mu.RLock()
+	recent := time.Since(c.lastAttempt) < c.minRefreshInterval
+	c.mu.RUnlock()
+	if recent {
+		return nil
+	}
+
+	keys, err := c.fetch(ctx)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastAttempt = time.Now()
+	if err != nil {
+		return err
+	}
+	c.keys = keys
+	c.fetchedAt = c.lastAttempt
+	return nil
+}
+
+// fetch downloads and decodes the key set. Keys of unsupported types are skipped.
+func (c *JWKSClient) fetch(ctx context.Context) (map[string]*Key, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch JWKS: status %d", resp.StatusCode)
+	}
+
+	var set JWKS
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxJWKSSize)).Decode(&set); err != nil {
+		return nil, fmt.Errorf("failed to decode JWKS: %w", err)
+	}
+
+	keys := make(map[string]*Key, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.KeyID == "" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+		public, err := jwk.PublicKey()
+		if err != nil {
+			continue
+		}
+		algorithm, err := algorithmFor(public)
+		if err != nil || (jwk.Algorithm != "" && jwk.Algorithm != algorithm) {
+			continue
+		}
+		keys[jwk.KeyID] = &Key{ID: jwk.KeyID, Algorithm: algorithm, Public: public}
+	}
+	return keys, nil
+}
@@ -1,17 +1,32 @@
 package jwtutil
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"sync/atomic"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/suteetoe/gomicro/config"
 )
 
+// ErrTokenRevoked is returned for tokens on the denylist
+var ErrTokenRevoked = errors.New("token has been revoked")
+
 // JWTConfig holds JWT configuration
 type JWTConfig struct {
+	// SigningKey is the HS256 secret; leave it empty to reject HS256 tokens
 	SigningKey      string
 	ExpirationHours int
+	// Keys signs tokens with its active key and a kid header instead of SigningKey
+	Keys *KeySet
+	// Resolver finds the keys verifying tokens with a kid header, e.g. a JWKSClient.
+	// It defaults to Keys.
+	Resolver KeyResolver
+	// Denylist rejects revoked tokens during validation
+	Denylist Denylist
 }
 
 // UserClaims represents the JWT claims for user authentication
@@ -27,13 +42,44 @@ type UserClaims struct {
 // JWTUtil is a utility for JWT token operations
 type JWTUtil struct {
 	config *JWTConfig
+	// secret is the HS256 secret, replaced by ApplyConfig when it rotates
+	secret atomic.Pointer[string]
 }
 
 // NewJWTUtil creates a new JWT utility with the given configuration
 func NewJWTUtil(config *JWTConfig) *JWTUtil {
-	return &JWTUtil{
+	j := &JWTUtil{
 		config: config,
 	}
+	if config != nil {
+		secret := config.SigningKey
+		j.secret.Store(&secret)
+	}
+	return j
+}
+
+// ApplyConfig replaces the HS256 secret with the jwt.signing_key of a reloaded configuration, for
+// use with config.Watcher, so that a rotated JWT_SIGNING_KEY takes effect without a restart.
+// Tokens signed with the previous secret are rejected from then on. A utility without a secret,
+// which signs and verifies with Keys or a Resolver, is left unchanged.
+func (j *JWTUtil) ApplyConfig(old, new *config.Config) error {
+	if j.signingKey() == "" || new.JWT.SigningKey == old.JWT.SigningKey {
+		return nil
+	}
+	if new.JWT.SigningKey == "" {
+		return errors.New("jwt.signing_key must not be empty")
+	}
+	secret := new.JWT.SigningKey
+	j.secret.Store(&secret)
+	return nil
+}
+
+// signingKey returns the current HS256 secret
+func (j *JWTUtil) signingKey() string {
+	if secret := j.secret.Load(); secret != nil {
+		return *secret
+	}
+	return ""
 }
 
 // GenerateToken creates a JWT token with user information
@@ -47,8 +93,7 @@ func (j *JWTUtil) GenerateTokenWithTenant(email string, userID uint, tenantID *u
 		return "", errors.New("JWT configuration not provided")
 	}
 
-	// Get signing key and expiration from configuration
-	signingKey := j.config.SigningKey
+	// Get expiration from configuration
 	expirationHours := j.config.ExpirationHours
 
 	claims := UserClaims{
@@ -58,33 +103,58 @@ func (j *JWTUtil) GenerateTokenWithTenant(email string, userID uint, tenantID *u
 		TenantName: tenantName,
 		Role:       role,
 		RegisteredClaims: jwt.RegisteredClaims{
+			// The jti identifies the token for revocation
+			ID:        uuid.NewString(),
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Duration(expirationHours) * time.Hour)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
 
+	return j.Sign(claims)
+}
+
+// Sign signs claims with the active key of Keys, or with SigningKey when no key set is
+// configured
+func (j *JWTUtil) Sign(claims jwt.Claims) (string, error) {
+	if j.config == nil {
+		return "", errors.New("JWT configuration not provided")
+	}
+
+	if j.config.Keys != nil {
+		key, err := j.config.Keys.SigningKey()
+		if err != nil {
+			return "", err
+		}
+		token := jwt.NewWithClaims(key.signingMethod(), claims)
+		token.Header["kid"] = key.ID
+		return token.SignedString(key.Private)
+	}
+
+	secret := j.signingKey()
+	if secret == "" {
+		return "", errors.New("no JWT signing key configured")
+	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(signingKey))
+	return token.SignedString([]byte(secret))
 }
 
 // ValidateToken validates and parses the JWT token
 func (j *JWTUtil) ValidateToken(tokenString string) (*UserClaims, error) {
+	return j.ValidateTokenContext(context.Background(), tokenString)
+}
+
+// ValidateTokenContext validates and parses the JWT token; ctx bounds fetching an unknown
+// key from the resolver
+func (j *JWTUtil) ValidateTokenContext(ctx context.Context, tokenString string) (*UserClaims, error) {
 	if j.config == nil {
 		return nil, errors.New("JWT configuration not provided")
 	}
 
-	// Get signing key from configuration
-	signingKey := j.config.SigningKey
-
 	token, err := jwt.ParseWithClaims(
 		tokenString,
 		&UserClaims{},
 		func(token *jwt.Token) (interface{}, error) {
-			// Validate the signing method
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return []byte(signingKey), nil
+			return j.verificationKey(ctx, token)
 		},
 	)
 
@@ -92,9 +162,74 @@ func (j *JWTUtil) ValidateToken(tokenString string) (*UserClaims, error) {
 		return nil, err
 	}
 
-	if claims, ok := token.Claims.(*UserClaims); ok && token.Valid {
-		return claims, nil
+	claims, ok := token.Claims.(*UserClaims)
+	if !ok || !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+
+	if j.config.Denylist != nil {
+		var issuedAt time.Time
+		if claims.IssuedAt != nil {
+			issuedAt = claims.IssuedAt.Time
+		}
+		revoked, err := j.config.Denylist.Revoked(ctx, claims.ID, claims.UserID, issuedAt)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, ErrTokenRevoked
+		}
 	}
 
-	return nil, errors.New("invalid token")
+	return claims, nil
+}
+
+// Revoke revokes the token of claims, e.g. on logout
+func (j *JWTUtil) Revoke(ctx context.Context, claims *UserClaims) error {
+	if j.config == nil || j.config.Denylist == nil {
+		return errors.New("no JWT denylist configured")
+	}
+	if claims.ID == "" || claims.ExpiresAt == nil {
+		return errors.New("token has no jti or expiry to revoke")
+	}
+	return j.config.Denylist.Revoke(ctx, claims.ID, claims.ExpiresAt.Time)
+}
+
+// RevokeUser revokes every token of the user issued at or before the given time, e.g. after
+// a password change or during an incident. Token issue times have a precision of one second,
+// so every token issued in the second of before is revoked too, see RevocationSecond.
+func (j *JWTUtil) RevokeUser(ctx context.Context, userID uint, before time.Time) error {
+	if j.config == nil || j.config.Denylist == nil {
+		return errors.New("no JWT denylist configured")
+	}
+	return j.config.Denylist.RevokeUser(ctx, userID, before)
+}
+
+// verificationKey returns the key verifying token. Tokens with a kid are verified with the
+// resolved key and must use its algorithm; tokens without one fall back to the HS256 secret.
+func (j *JWTUtil) verificationKey(ctx context.Context, token *jwt.Token) (interface{}, error) {
+	if kid, ok := token.Header["kid"].(string); ok && kid != "" {
+		resolver := j.config.Resolver
+		if resolver == nil && j.config.Keys != nil {
+			resolver = j.config.Keys
+		}
+		if resolver == nil {
+			return nil, errors.New("no key resolver configured")
+		}
+		key, err := resolver.Key(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		if token.Method.Alg() != key.Algorithm {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return key.Public, nil
+	}
+
+	// Validate the signing method
+	secret := j.signingKey()
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok || secret == "" {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return []byte(secret), nil
 }
@@ -0,0 +1,235 @@
+package jwtutil
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/labstack/echo/v4"
+	"github.com/suteetoe/gomicro/config"
+)
+
+func TestSignAndVerifyWithKeySet(t *testing.T) {
+	for _, algorithm := range []string{AlgorithmRS256, AlgorithmES256, AlgorithmEdDSA} {
+		t.Run(algorithm, func(t *testing.T) {
+			key, err := GenerateKey(algorithm)
+			if err != nil {
+				t.Fatal(err)
+			}
+			issuer := NewJWTUtil(&JWTConfig{ExpirationHours: 1, Keys: NewKeySet(key)})
+			token, err := issuer.GenerateToken("user@example.com", 7)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Round trip through PEM and JWK as the store and the JWKS do
+			pemKey, err := key.PrivateKeyPEM()
+			if err != nil {
+				t.Fatal(err)
+			}
+			parsed, err := ParsePrivateKeyPEM(pemKey)
+			if err != nil || parsed.ID != key.ID {
+				t.Fatalf("parsed key %v, err %v; want kid %s", parsed, err, key.ID)
+			}
+			jwk, err := key.JWK()
+			if err != nil {
+				t.Fatal(err)
+			}
+			public, err := jwk.PublicKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+			verifier := NewJWTUtil(&JWTConfig{Keys: NewKeySet(&Key{ID: key.ID, Algorithm: algorithm, Public: public})})
+
+			claims, err := verifier.ValidateToken(token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims.UserID != 7 || claims.Email != "user@example.com" {
+				t.Errorf("unexpected claims %+v", claims)
+			}
+		})
+	}
+}
+
+func TestValidateTokenRejectsHMACWithoutSecret(t *testing.T) {
+	key, err := GenerateKey(AlgorithmES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier := NewJWTUtil(&JWTConfig{Keys: NewKeySet(key)})
+
+	// An HS256 token signed with an empty secret
+	forged, err := jwt.NewWithClaims(jwt.SigningMethodHS256, UserClaims{UserID: 1}).SignedString([]byte(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifier.ValidateToken(forged); err == nil {
+		t.Error("accepted an HS256 token without a configured secret")
+	}
+
+	// An HS256 token naming the kid of the asymmetric key
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, UserClaims{UserID: 1})
+	token.Header["kid"] = key.ID
+	confused, err := token.SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifier.ValidateToken(confused); err == nil {
+		t.Error("accepted an HS256 token for an ES256 key")
+	}
+}
+
+func TestApplyConfigRotatesTheSecret(t *testing.T) {
+	old, new := &config.Config{}, &config.Config{}
+	old.JWT.SigningKey, new.JWT.SigningKey = "first secret", "second secret"
+	util := NewJWTUtil(&JWTConfig{SigningKey: old.JWT.SigningKey, ExpirationHours: 1})
+	before, err := util.GenerateToken("user@example.com", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := util.ApplyConfig(old, new); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := util.ValidateToken(before); err == nil {
+		t.Error("token signed with the previous secret accepted")
+	}
+	after, err := util.GenerateToken("user@example.com", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewJWTUtil(&JWTConfig{SigningKey: "second secret"}).ValidateToken(after); err != nil {
+		t.Errorf("token not signed with the new secret: %v", err)
+	}
+
+	// An empty secret is rejected, and a utility without a secret keeps rejecting HS256 tokens
+	empty := &config.Config{}
+	if err := util.ApplyConfig(new, empty); err == nil {
+		t.Error("empty secret applied")
+	}
+	verifier := NewJWTUtil(&JWTConfig{Resolver: NewKeySet()})
+	if err := verifier.ApplyConfig(old, new); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifier.ValidateToken(after); err == nil {
+		t.Error("verifier without a secret accepted an HS256 token")
+	}
+}
+
+func TestJWKSClientFollowsRotation(t *testing.T) {
+	oldKey, err := GenerateKey(AlgorithmES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := NewKeySet(oldKey)
+
+	var fetches atomic.Int32
+	e := echo.New()
+	e.GET(JWKSPath, func(c echo.Context) error {
+		fetches.Add(1)
+		return JWKSHandler(keys)(c)
+	})
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	issuer := NewJWTUtil(&JWTConfig{ExpirationHours: 1, Keys: keys})
+	verifier := NewJWTUtil(&JWTConfig{Resolver: NewJWKSClient(server.URL+JWKSPath, WithMinRefreshInterval(0))})
+
+	oldToken, err := issuer.GenerateToken("user@example.com", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifier.ValidateToken(oldToken); err != nil {
+		t.Fatal(err)
+	}
+
+	// Rotate: the old key is retired but still published
+	newKey, err := GenerateKey(AlgorithmES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newKey.CreatedAt = oldKey.CreatedAt.Add(time.Second)
+	retiredAt := time.Now()
+	oldKey.RetiredAt = &retiredAt
+	keys.Replace([]*Key{oldKey, newKey})
+
+	newToken, err := issuer.GenerateToken("user@example.com", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifier.ValidateToken(newToken); err != nil {
+		t.Fatalf("new key not picked up: %v", err)
+	}
+	if _, err := verifier.ValidateToken(oldToken); err != nil {
+		t.Fatalf("retired key rejected: %v", err)
+	}
+	if got := fetches.Load(); got != 2 {
+		t.Errorf("fetched the JWKS %d times, want 2", got)
+	}
+
+	// The cached keys keep working while the issuer is down
+	server.Close()
+	if _, err := verifier.ValidateToken(newToken); err != nil {
+		t.Fatalf("cached key rejected: %v", err)
+	}
+
+	unknown, err := GenerateKey(AlgorithmES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := NewJWTUtil(&JWTConfig{ExpirationHours: 1, Keys: NewKeySet(unknown)})
+	otherToken, err := other.GenerateToken("user@example.com", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifier.ValidateToken(otherToken); err == nil {
+		t.Error("accepted a token signed by an unknown key")
+	}
+}
+
+func TestValidateTokenChecksDenylist(t *testing.T) {
+	ctx := context.Background()
+	jwtUtil := NewJWTUtil(&JWTConfig{SigningKey: "secret", ExpirationHours: 1, Denylist: NewMemoryDenylist()})
+
+	first, err := jwtUtil.GenerateToken("user@example.com", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := jwtUtil.GenerateToken("user@example.com", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := jwtUtil.GenerateToken("other@example.com", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := jwtUtil.ValidateToken(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := jwtUtil.Revoke(ctx, claims); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jwtUtil.ValidateToken(first); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("revoked token: got %v, want ErrTokenRevoked", err)
+	}
+	if _, err := jwtUtil.ValidateToken(second); err != nil {
+		t.Errorf("token with another jti rejected: %v", err)
+	}
+
+	if err := jwtUtil.RevokeUser(ctx, 1, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jwtUtil.ValidateToken(second); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("token issued before the user revocation: got %v, want ErrTokenRevoked", err)
+	}
+	if _, err := jwtUtil.ValidateToken(other); err != nil {
+		t.Errorf("token of another user rejected: %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+package jwtutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ErrUnknownKey is returned when no key matches the kid of a token
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// KeyResolver looks up the key that verifies tokens with a kid header
+type KeyResolver interface {
+	Key(ctx context.Context, kid string) (*Key, error)
+}
+
+// KeySet holds the active and retired keys of an issuer. The newest active key with a
+// private part signs new tokens; retired keys only verify tokens signed before the rotation.
+// A KeySet is safe for concurrent use.
+type KeySet struct {
+	mu   sync.RWMutex
+	keys []*Key
+}
+
+// NewKeySet creates a key set holding keys
+func NewKeySet(keys ...*Key) *KeySet {
+	s := &KeySet{}
+	s.Replace(keys)
+	return s
+}
+
+// Replace swaps the keys of the set, e.g. after reloading them from a KeyStore
+func (s *KeySet) Replace(keys []*Key) {
+	sorted := append([]*Key{}, keys...)
+	// Newest first
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].CreatedAt.After(sorted[j].CreatedAt)
+	})
+
+	s.mu.Lock()
+	s.keys = sorted
+	s.mu.Unlock()
+}
+
+// SigningKey returns the key that signs new tokens
+func (s *KeySet) SigningKey() (*Key, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, key := range s.keys {
+		if key.RetiredAt == nil && key.Private != nil {
+			return key, nil
+		}
+	}
+	return nil, errors.New("no active signing key")
+}
+
+// Lookup returns the key with the given kid
+func (s *KeySet) Lookup(kid string) (*Key, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, key := range s.keys {
+		if key.ID == kid {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+// Key implements KeyResolver
+func (s *KeySet) Key(_ context.Context, kid string) (*Key, error) {
+	key, ok := s.Lookup(kid)
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, kid)
+	}
+	return key, nil
+}
+
+// Keys returns the keys of the set, newest first
+func (s *KeySet) Keys() []*Key {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]*Key{}, s.keys...)
+}
+
+// JWKS returns the public keys of the set, active and retired
+func (s *KeySet) JWKS() (JWKS, error) {
+	set := JWKS{Keys: []JWK{}}
+	for _, key := range s.Keys() {
+		jwk, err := key.JWK()
+		if err != nil {
+			return JWKS{}, fmt.Errorf("failed to encode key %s: %w", key.ID, err)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set, nil
+}
@@ -0,0 +1,195 @@
+package jwtutil
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Rotation defaults
+const (
+	DefaultRotationInterval = 30 * 24 * time.Hour
+	DefaultKeyRetention     = 7 * 24 * time.Hour
+	DefaultSyncInterval     = time.Minute
+)
+
+// SigningKeyRecord is a row of the jwt_signing_keys table. Private keys are stored as PKCS#8
+// PEM, so access to the table must be restricted like any other secret.
+type SigningKeyRecord struct {
+	ID         string     `gorm:"primaryKey;size:64"`
+	Algorithm  string     `gorm:"size:16;not null"`
+	PrivateKey string     `gorm:"type:text;not null"`
+	CreatedAt  time.Time  `gorm:"not null"`
+	RetiredAt  *time.Time `gorm:"index"`
+}
+
+// TableName overrides the table name used by SigningKeyRecord
+func (SigningKeyRecord) TableName() string {
+	return "jwt_signing_keys"
+}
+
+// MigrateKeys creates or updates the jwt_signing_keys table, e.g. from a migration
+func MigrateKeys(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&SigningKeyRecord{}); err != nil {
+		return fmt.Errorf("failed to migrate signing keys: %w", err)
+	}
+	return nil
+}
+
+// RotatorOption configures a Rotator
+type RotatorOption func(*Rotator)
+
+// WithRotationInterval sets how long a key signs before it is replaced
+func WithRotationInterval(interval time.Duration) RotatorOption {
+	return func(r *Rotator) {
+		r.interval = interval
+	}
+}
+
+// WithKeyRetention sets how long a retired key is kept for verification. It must exceed the
+// lifetime of issued tokens.
+func WithKeyRetention(retention time.Duration) RotatorOption {
+	return func(r *Rotator) {
+		r.retention = retention
+	}
+}
+
+// WithRotatorLogger logs rotations and failed syncs
+func WithRotatorLogger(log *zap.Logger) RotatorOption {
+	return func(r *Rotator) {
+		r.log = log
+	}
+}
+
+// Rotator keeps the signing keys in jwt_signing_keys and a KeySet in sync. The first sync
+// creates a key; later syncs replace the active key once it is older than the rotation
+// interval, retire the previous one and delete retired keys past their retention. Replicas
+// of a service share the table and take an advisory lock while changing it.
+type Rotator struct {
+	db        *gorm.DB
+	keys      *KeySet
+	algorithm string
+	interval  time.Duration
+	retention time.Duration
+	log       *zap.Logger
+}
+
+// NewRotator creates a rotator signing with algorithm, one of RS256, ES256 and EdDSA
+func NewRotator(db *gorm.DB, keys *KeySet, algorithm string, opts ...RotatorOption) (*Rotator, error) {
+	switch algorithm {
+	case AlgorithmRS256, AlgorithmES256, AlgorithmEdDSA:
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+	}
+
+	r := &Rotator{
+		db:        db,
+		keys:      keys,
+		algorithm: algorithm,
+		interval:  DefaultRotationInterval,
+		retention: DefaultKeyRetention,
+		log:       zap.NewNop(),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if r.interval <= 0 {
+		return nil, fmt.Errorf("key rotation needs a positive interval")
+	}
+	return r, nil
+}
+
+// lockKey is the advisory lock taken while changing the keys
+func (r *Rotator) lockKey() int64 {
+	h := fnv.New64a()
+	h.Write([]byte("gomicro/jwtutil:jwt_signing_keys"))
+	return int64(h.Sum64())
+}
+
+// Sync rotates the keys when due and loads them into the key set
+func (r *Rotator) Sync(ctx context.Context) error {
+	var records []SigningKeyRecord
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", r.lockKey()).Error; err != nil {
+			return fmt.Errorf("failed to lock signing keys: %w", err)
+		}
+
+		now := time.Now().UTC()
+		if r.retention > 0 {
+			if err := tx.Where("retired_at < ?", now.Add(-r.retention)).Delete(&SigningKeyRecord{}).Error; err != nil {
+				return fmt.Errorf("failed to delete expired signing keys: %w", err)
+			}
+		}
+
+		var active SigningKeyRecord
+		err := tx.Where("retired_at IS NULL AND algorithm = ?", r.algorithm).Order("created_at DESC").Limit(1).Find(&active).Error
+		if err != nil {
+			return fmt.Errorf("failed to read signing keys: %w", err)
+		}
+
+		if active.ID == "" || now.Sub(active.CreatedAt) >= r.interval {
+			key, err := GenerateKey(r.algorithm)
+			if err != nil {
+				return err
+			}
+			pemKey, err := key.PrivateKeyPEM()
+			if err != nil {
+				return err
+			}
+			active = SigningKeyRecord{ID: key.ID, Algorithm: key.Algorithm, PrivateKey: string(pemKey), CreatedAt: key.CreatedAt}
+			if err := tx.Create(&active).Error; err != nil {
+				return fmt.Errorf("failed to save signing key: %w", err)
+			}
+			r.log.Info("Created JWT signing key", zap.String("kid", key.ID), zap.String("algorithm", key.Algorithm))
+		}
+
+		// Only the newest key signs; the others stay published until their retention ends
+		err = tx.Model(&SigningKeyRecord{}).
+			Where("retired_at IS NULL AND id <> ?", active.ID).
+			Update("retired_at", now).Error
+		if err != nil {
+			return fmt.Errorf("failed to retire signing keys: %w", err)
+		}
+
+		return tx.Find(&records).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	keys := make([]*Key, 0, len(records))
+	for _, record := range records {
+		key, err := ParsePrivateKeyPEM([]byte(record.PrivateKey))
+		if err != nil {
+			return fmt.Errorf("failed to load signing key %s: %w", record.ID, err)
+		}
+		key.ID = record.ID
+		key.CreatedAt = record.CreatedAt
+		key.RetiredAt = record.RetiredAt
+		keys = append(keys, key)
+	}
+	r.keys.Replace(keys)
+	return nil
+}
+
+// Run syncs the keys every interval until ctx is done, so that replicas pick up rotations
+// made by each other. Errors are logged and the key set keeps its keys.
+func (r *Rotator) Run(ctx context.Context, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.Sync(ctx); err != nil && ctx.Err() == nil {
+				r.log.Error("Failed to sync JWT signing keys", zap.Error(err))
+			}
+		}
+	}
+}
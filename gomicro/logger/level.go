@@ -0,0 +1,264 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/labstack/echo/v4"
+	"github.com/suteetoe/gomicro/config"
+	apperrors "github.com/suteetoe/gomicro/errors"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Levels is the runtime log level state: a global level and per-component overrides
+type Levels struct {
+	Level      string            `json:"level"`
+	Components map[string]string `json:"components,omitempty"`
+}
+
+// LevelRequest is the body accepted by LevelHandler. An empty Component changes the global
+// level; an empty Level with a Component removes that component's override.
+type LevelRequest struct {
+	Component string `json:"component,omitempty"`
+	Level     string `json:"level"`
+}
+
+// levelRegistry holds the global level and the overrides of named components
+type levelRegistry struct {
+	global zap.AtomicLevel
+
+	mu         sync.RWMutex
+	components map[string]zapcore.Level
+}
+
+var levels = &levelRegistry{
+	global:     zap.NewAtomicLevelAt(zapcore.InfoLevel),
+	components: make(map[string]zapcore.Level),
+}
+
+// enabler returns a level enabler for component that follows the global level unless overridden
+func (r *levelRegistry) enabler(component string) zapcore.LevelEnabler {
+	if component == "" {
+		return r.global
+	}
+	return zap.LevelEnablerFunc(func(level zapcore.Level) bool {
+		r.mu.RLock()
+		override, ok := r.components[component]
+		r.mu.RUnlock()
+		if ok {
+			return level >= override
+		}
+		return r.global.Enabled(level)
+	})
+}
+
+// levelCore filters entries with a level enabler that can change at runtime
+type levelCore struct {
+	zapcore.Core
+	enabler zapcore.LevelEnabler
+}
+
+// Enabled implements zapcore.Core
+func (c *levelCore) Enabled(level zapcore.Level) bool {
+	return c.enabler.Enabled(level)
+}
+
+// With implements zapcore.Core
+func (c *levelCore) With(fields []zapcore.Field) zapcore.Core {
+	return &levelCore{Core: c.Core.With(fields), enabler: c.enabler}
+}
+
+// Check implements zapcore.Core
+func (c *levelCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.Enabled(entry.Level) {
+		return checked
+	}
+	return c.Core.Check(entry, checked)
+}
+
+// withLevelEnabler replaces the enabler of a levelCore, leaving other cores unchanged
+func withLevelEnabler(enabler zapcore.LevelEnabler) zap.Option {
+	return zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		if lc, ok := core.(*levelCore); ok {
+			return &levelCore{Core: lc.Core, enabler: enabler}
+		}
+		return &levelCore{Core: core, enabler: enabler}
+	})
+}
+
+// parseLevel parses one of debug, info, warn or error
+func parseLevel(level string) (zapcore.Level, error) {
+	switch level {
+	case "debug":
+		return zapcore.DebugLevel, nil
+	case "info":
+		return zapcore.InfoLevel, nil
+	case "warn":
+		return zapcore.WarnLevel, nil
+	case "error":
+		return zapcore.ErrorLevel, nil
+	default:
+		return zapcore.InfoLevel, fmt.Errorf("unknown log level %q", level)
+	}
+}
+
+// Component returns a named logger whose level can be changed independently of the global level
+func Component(name string) *zap.Logger {
+	return GetLogger().Named(name).WithOptions(withLevelEnabler(levels.enabler(name)))
+}
+
+// SetLevel changes the global log level
+func SetLevel(level string) error {
+	parsed, err := parseLevel(level)
+	if err != nil {
+		return err
+	}
+	levels.global.SetLevel(parsed)
+	return nil
+}
+
+// SetComponentLevel overrides the log level of a named component; an empty level removes the override
+func SetComponentLevel(component, level string) error {
+	if level == "" {
+		levels.mu.Lock()
+		delete(levels.components, component)
+		levels.mu.Unlock()
+		return nil
+	}
+
+	parsed, err := parseLevel(level)
+	if err != nil {
+		return err
+	}
+	levels.mu.Lock()
+	levels.components[component] = parsed
+	levels.mu.Unlock()
+	return nil
+}
+
+// GetLevels returns the current global level and component overrides
+func GetLevels() Levels {
+	levels.mu.RLock()
+	defer levels.mu.RUnlock()
+
+	current := Levels{Level: levels.global.Level().String()}
+	if len(levels.components) > 0 {
+		current.Components = make(map[string]string, len(levels.components))
+		for component, level := range levels.components {
+			current.Components[component] = level.String()
+		}
+	}
+	return current
+}
+
+// ApplyLevels sets the global level and replaces every component override
+func ApplyLevels(next Levels) error {
+	global, err := parseLevel(next.Level)
+	if err != nil {
+		return err
+	}
+	components := make(map[string]zapcore.Level, len(next.Components))
+	for component, level := range next.Components {
+		parsed, err := parseLevel(level)
+		if err != nil {
+			return fmt.Errorf("component %s: %w", component, err)
+		}
+		components[component] = parsed
+	}
+
+	levels.mu.Lock()
+	levels.components = components
+	levels.mu.Unlock()
+	levels.global.SetLevel(global)
+	return nil
+}
+
+// ApplyConfig applies the log level of a reloaded configuration, for use with config.Watcher.
+// Component overrides are kept.
+func ApplyConfig(old, new *config.Config) error {
+	if old.Log.Level == new.Log.Level {
+		return nil
+	}
+	return SetLevel(new.Log.Level)
+}
+
+// LevelHandler returns an Echo handler that reports the log levels on GET and changes them on PUT.
+// It must be mounted behind authentication, e.g. middleware.AdminTokenMiddleware.
+func LevelHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if c.Request().Method == http.MethodGet {
+			return c.JSON(http.StatusOK, GetLevels())
+		}
+
+		var req LevelRequest
+		if err := c.Bind(&req); err != nil {
+			return apperrors.BadRequest("Invalid request body")
+		}
+
+		var err error
+		if req.Component == "" {
+			err = SetLevel(req.Level)
+		} else {
+			err = SetComponentLevel(req.Component, req.Level)
+		}
+		if err != nil {
+			return apperrors.Validation(err.Error())
+		}
+
+		FromEcho(c).Info("Log level changed",
+			zap.String("component", req.Component),
+			zap.String("level", req.Level))
+		return c.JSON(http.StatusOK, GetLevels())
+	}
+}
+
+// LoadLevels reads log levels from a JSON file in the format returned by GetLevels
+func LoadLevels(path string) (Levels, error) {
+	var next Levels
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return next, fmt.Errorf("failed to read log level file: %w", err)
+	}
+	if err := json.Unmarshal(data, &next); err != nil {
+		return next, fmt.Errorf("failed to parse log level file %s: %w", path, err)
+	}
+	return next, nil
+}
+
+// ReloadOnSIGHUP re-reads the log level file at path and applies it whenever the process receives SIGHUP.
+// The returned function stops watching for the signal.
+func ReloadOnSIGHUP(path string) func() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-signals:
+				next, err := LoadLevels(path)
+				if err == nil {
+					err = ApplyLevels(next)
+				}
+				if err != nil {
+					GetLogger().Error("Failed to reload log levels", zap.String("path", path), zap.Error(err))
+					continue
+				}
+				GetLogger().Info("Log levels reloaded", zap.String("path", path), zap.String("level", next.Level))
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
@@ -0,0 +1,169 @@
+package logger
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	apperrors "github.com/suteetoe/gomicro/errors"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// observeLevels replaces the global logger with one recording its entries, filtered by the
+// runtime levels, and restores the logger and levels when the test ends
+func observeLevels(t *testing.T) *observer.ObservedLogs {
+	t.Helper()
+	core, logs := observer.New(zapcore.DebugLevel)
+	previous := log
+	log = zap.New(core, withLevelEnabler(levels.enabler("")))
+	t.Cleanup(func() {
+		log = previous
+		_ = ApplyLevels(Levels{Level: "info"})
+	})
+	if err := ApplyLevels(Levels{Level: "info"}); err != nil {
+		t.Fatal(err)
+	}
+	return logs
+}
+
+func TestComponentLevels(t *testing.T) {
+	logs := observeLevels(t)
+	database := Component("database")
+
+	database.Debug("query")
+	if logs.Len() != 0 {
+		t.Fatal("component logged below the global level")
+	}
+
+	if err := SetComponentLevel("database", "debug"); err != nil {
+		t.Fatal(err)
+	}
+	database.Debug("query")
+	GetLogger().Debug("request")
+	Component("oauth_client").Debug("token")
+	if entries := logs.TakeAll(); len(entries) != 1 || entries[0].LoggerName != "database" {
+		t.Errorf("entries %v, want only the database query", entries)
+	}
+
+	// Overrides outlive changes of the global level until they are removed
+	if err := SetLevel("error"); err != nil {
+		t.Fatal(err)
+	}
+	database.With(zap.String("table", "items")).Debug("query")
+	Component("oauth_client").Warn("token expired")
+	if entries := logs.TakeAll(); len(entries) != 1 || entries[0].Message != "query" {
+		t.Errorf("entries %v, want only the database query", entries)
+	}
+	if err := SetComponentLevel("database", ""); err != nil {
+		t.Fatal(err)
+	}
+	database.Warn("slow query")
+	if logs.Len() != 0 {
+		t.Error("removed override still applies")
+	}
+
+	if err := SetLevel("loud"); err == nil {
+		t.Error("unknown level accepted")
+	}
+	if err := SetComponentLevel("database", "loud"); err == nil {
+		t.Error("unknown component level accepted")
+	}
+}
+
+func TestLevelHandler(t *testing.T) {
+	observeLevels(t)
+	handler := LevelHandler()
+
+	tests := []struct {
+		name       string
+		method     string
+		body       string
+		wantStatus int
+		want       Levels
+	}{
+		{"get", http.MethodGet, "", http.StatusOK, Levels{Level: "info"}},
+		{"global level", http.MethodPut, `{"level":"warn"}`, http.StatusOK, Levels{Level: "warn"}},
+		{"component level", http.MethodPut, `{"component":"database","level":"debug"}`, http.StatusOK,
+			Levels{Level: "warn", Components: map[string]string{"database": "debug"}}},
+		{"unknown level", http.MethodPut, `{"level":"loud"}`, http.StatusBadRequest, Levels{}},
+		{"malformed body", http.MethodPut, `{"level":`, http.StatusBadRequest, Levels{}},
+		{"remove component level", http.MethodPut, `{"component":"database"}`, http.StatusOK, Levels{Level: "warn"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/admin/log-level", strings.NewReader(tt.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(req, rec)
+
+			if err := handler(c); err != nil {
+				if status := apperrors.StatusCode(err); status != tt.wantStatus {
+					t.Errorf("status %d, want %d: %v", status, tt.wantStatus, err)
+				}
+				return
+			}
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := GetLevels(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("levels %+v, want %+v", got, tt.want)
+			}
+			if !strings.Contains(rec.Body.String(), `"level":"`+tt.want.Level+`"`) {
+				t.Errorf("body %s", rec.Body)
+			}
+		})
+	}
+}
+
+func TestReloadOnSIGHUP(t *testing.T) {
+	logs := observeLevels(t)
+	path := filepath.Join(t.TempDir(), "levels.json")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// reload sends SIGHUP and waits until done reports the reload handled
+	reload := func(done func() bool) {
+		t.Helper()
+		if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+			t.Fatal(err)
+		}
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			if done() {
+				return
+			}
+		}
+		t.Fatal("SIGHUP not handled")
+	}
+
+	stop := ReloadOnSIGHUP(path)
+	defer stop()
+
+	write(`{"level":"warn","components":{"oauth_client":"debug"}}`)
+	reload(func() bool { return GetLevels().Level == "warn" })
+	want := Levels{Level: "warn", Components: map[string]string{"oauth_client": "debug"}}
+	if got := GetLevels(); !reflect.DeepEqual(got, want) {
+		t.Errorf("levels %+v, want %+v", got, want)
+	}
+
+	// A broken file keeps the current levels
+	for _, content := range []string{`{"level":`, `{"level":"info","components":{"database":"loud"}}`} {
+		write(content)
+		logs.TakeAll()
+		reload(func() bool { return logs.FilterMessage("Failed to reload log levels").Len() > 0 })
+		if got := GetLevels(); !reflect.DeepEqual(got, want) {
+			t.Errorf("levels %+v after reloading %s", got, content)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/labstack/echo/v4"
+	apperrors "github.com/suteetoe/gomicro/errors"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
@@ -13,56 +14,107 @@ type LogConfig struct {
 	Level       string
 	Environment string
 	ServiceName string
+
+	// Sampling replaces the default sampling of all log entries; nil keeps the defaults
+	Sampling *SamplingConfig
+	// RequestSampling samples the per-request "HTTP Request" line written by Middleware; nil logs every request
+	RequestSampling *SamplingConfig
+
+	// Redact masks PII and credentials before they are written; nil uses DefaultRedactConfig in production
+	// and disables redaction elsewhere
+	Redact *RedactConfig
+}
+
+// SamplingConfig logs the first Initial entries with the same level and message in each Tick,
+// then every Thereafter-th entry. Thereafter set to zero drops the rest.
+type SamplingConfig struct {
+	Tick       time.Duration
+	Initial    int
+	Thereafter int
+}
+
+// NewSamplingConfig returns a one-second sampling configuration, or nil when initial is not positive
+func NewSamplingConfig(initial, thereafter int) *SamplingConfig {
+	if initial <= 0 {
+		return nil
+	}
+	return &SamplingConfig{Tick: time.Second, Initial: initial, Thereafter: thereafter}
 }
 
-var log *zap.Logger
+// sampler wraps a core with the sampling configuration
+func (s *SamplingConfig) sampler(core zapcore.Core) zapcore.Core {
+	tick := s.Tick
+	if tick <= 0 {
+		tick = time.Second
+	}
+	return zapcore.NewSamplerWithOptions(core, tick, s.Initial, s.Thereafter)
+}
+
+var (
+	log *zap.Logger
+
+	// requestLog writes the per-request line of Middleware; its sampler is shared across requests
+	requestLog *zap.Logger
+)
 
 // InitLogger initializes the logger with configuration
 func InitLogger(config *LogConfig) error {
 	// Configure logger based on configured log level
-	var level zapcore.Level
-	switch config.Level {
-	case "debug":
-		level = zapcore.DebugLevel
-	case "info":
-		level = zapcore.InfoLevel
-	case "warn":
-		level = zapcore.WarnLevel
-	case "error":
-		level = zapcore.ErrorLevel
-	default:
+	level, err := parseLevel(config.Level)
+	if err != nil {
 		level = zapcore.InfoLevel
 	}
+	levels.global.SetLevel(level)
 
-	var err error
+	var zapConfig zap.Config
 	if config.Environment == "production" {
 		// Production logger configuration
-		prodConfig := zap.NewProductionConfig()
-		prodConfig.Level = zap.NewAtomicLevelAt(level)
-		prodConfig.EncoderConfig.TimeKey = "timestamp"
-		prodConfig.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
-
-		log, err = prodConfig.Build(zap.Fields(
-			zap.String("service", config.ServiceName),
-			zap.String("environment", config.Environment),
-		))
+		zapConfig = zap.NewProductionConfig()
+		zapConfig.EncoderConfig.TimeKey = "timestamp"
+		zapConfig.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
 	} else {
 		// Development logger configuration with colors and human-friendly output
-		devConfig := zap.NewDevelopmentConfig()
-		devConfig.Level = zap.NewAtomicLevelAt(level)
-		devConfig.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+		zapConfig = zap.NewDevelopmentConfig()
+		zapConfig.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+	}
+
+	redact := config.Redact
+	if redact == nil && config.Environment == "production" {
+		redact = DefaultRedactConfig()
+	}
+	if redact != nil {
+		zapConfig.Encoding = RedactingEncoding(zapConfig.Encoding, redact)
+	}
 
-		log, err = devConfig.Build(zap.Fields(
+	// Levels are filtered by the runtime-adjustable levelCore instead of the encoder core
+	zapConfig.Level = zap.NewAtomicLevelAt(zapcore.DebugLevel)
+
+	options := []zap.Option{
+		zap.Fields(
 			zap.String("service", config.ServiceName),
 			zap.String("environment", config.Environment),
-		))
+		),
+	}
+	if config.Sampling != nil {
+		zapConfig.Sampling = nil
+		options = append(options, zap.WrapCore(config.Sampling.sampler))
 	}
+	options = append(options, withLevelEnabler(levels.enabler("")))
 
+	log, err = zapConfig.Build(options...)
 	if err != nil {
 		// Can't use the logger here, so using a panic
 		return err
 	}
 
+	requestLog = log
+	if config.RequestSampling != nil {
+		requestLog = log.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+			lc := core.(*levelCore)
+			return &levelCore{Core: config.RequestSampling.sampler(lc.Core), enabler: lc.enabler}
+		}))
+	}
+
 	// Replace the global logger
 	zap.ReplaceGlobals(log)
 	return nil
@@ -73,10 +125,15 @@ func GetLogger() *zap.Logger {
 	return log
 }
 
-// Middleware returns an Echo middleware that logs HTTP requests
+// Middleware returns an Echo middleware that logs HTTP requests. A logger already stored under
+// "logger" in the echo context, e.g. by the request ID middleware of package server, is kept.
+// Requests are not logged before InitLogger.
 func Middleware() echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
+			if log == nil {
+				return next(c)
+			}
 			start := time.Now()
 
 			// Add request ID to context if available
@@ -86,20 +143,26 @@ func Middleware() echo.MiddlewareFunc {
 			}
 
 			// Set logger in context
-			ctxLogger := log.With(zap.String("request_id", requestID))
-			c.Set("logger", ctxLogger)
+			if _, ok := c.Get("logger").(*zap.Logger); !ok {
+				c.Set("logger", log.With(zap.String("request_id", requestID)))
+			}
 
 			// Process the request
 			err := next(c)
 
 			// Log after request is processed
 			latency := time.Since(start)
+			status := c.Response().Status
+			if err != nil && !c.Response().Committed {
+				// The error handler has not written the response yet
+				status = apperrors.StatusCode(err)
+			}
 
-			// Create structured log entry
-			ctxLogger.Info("HTTP Request",
+			// Create structured log entry, sampled when RequestSampling is configured
+			requestLog.With(zap.String("request_id", requestID)).Info("HTTP Request",
 				zap.String("method", c.Request().Method),
 				zap.String("path", c.Request().URL.Path),
-				zap.Int("status", c.Response().Status),
+				zap.Int("status", status),
 				zap.Duration("latency", latency),
 				zap.String("ip", c.RealIP()),
 			)
@@ -0,0 +1,68 @@
+package logger
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestMiddleware(t *testing.T) {
+	previous, previousRequests := log, requestLog
+	t.Cleanup(func() { log, requestLog = previous, previousRequests })
+
+	e := echo.New()
+	var handlerLogger *zap.Logger
+	e.GET("/items/:id", func(c echo.Context) error {
+		handlerLogger, _ = c.Get("logger").(*zap.Logger)
+		return echo.ErrNotFound
+	}, Middleware())
+	get := func(set *zap.Logger) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/items/7", nil)
+		req.Header.Set(echo.HeaderXRequestID, "req-1")
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		if set != nil {
+			c.Set("logger", set)
+		}
+		e.Router().Find(http.MethodGet, "/items/7", c)
+		_ = c.Handler()(c)
+	}
+
+	// Requests are passed on before InitLogger
+	log, requestLog = nil, nil
+	get(nil)
+
+	core, logs := observer.New(zapcore.DebugLevel)
+	requests, requestLogs := observer.New(zapcore.DebugLevel)
+	log, requestLog = zap.New(core), zap.New(requests)
+
+	get(nil)
+	entries := requestLogs.TakeAll()
+	if len(entries) != 1 || entries[0].Message != "HTTP Request" {
+		t.Fatalf("request log %v, want one line", entries)
+	}
+	fields := entries[0].ContextMap()
+	if fields["status"] != int64(http.StatusNotFound) || fields["request_id"] != "req-1" || fields["path"] != "/items/7" {
+		t.Errorf("request log fields %v", fields)
+	}
+	handlerLogger.Info("handled")
+	if entries := logs.TakeAll(); len(entries) != 1 || entries[0].ContextMap()["request_id"] != "req-1" {
+		t.Errorf("handler log %v, want it tagged with the request ID", entries)
+	}
+
+	// A logger set by an earlier middleware is kept
+	earlier := zap.NewNop()
+	get(earlier)
+	if handlerLogger != earlier {
+		t.Error("replaced the logger of an earlier middleware")
+	}
+	if requestLogs.Len() != 1 {
+		t.Errorf("%d request log lines, want 1", requestLogs.Len())
+	}
+}
@@ -0,0 +1,267 @@
+package logger
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+// RedactedValue replaces masked values
+const RedactedValue = "[REDACTED]"
+
+// DefaultRedactKeys are the field keys whose values are always redacted
+var DefaultRedactKeys = []string{
+	"email", "phone", "phone_number", "mobile", "tax_id", "username",
+	"password", "token", "access_token", "refresh_token", "id_token",
+	"client_secret", "secret", "authorization",
+}
+
+// DefaultRedactPatterns match PII and credentials inside messages and other values
+var DefaultRedactPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`), // email
+	regexp.MustCompile(`\+[1-9]\d{7,14}\b`),                              // E.164 phone
+	regexp.MustCompile(`\beyJ[\w-]*\.[\w-]+\.[\w-]+`),                    // JWT
+	regexp.MustCompile(`(?i)\bbearer\s+[\w.~+/=-]+`),                     // bearer token
+}
+
+// RedactConfig selects the fields and values removed from log output
+type RedactConfig struct {
+	// Keys are field keys, matched case-insensitively, whose whole value is redacted
+	Keys []string
+	// Patterns are replaced wherever they match in messages and string values
+	Patterns []*regexp.Regexp
+	// Hash replaces values with a salted SHA-256 prefix instead of RedactedValue,
+	// so the same value can still be correlated across entries
+	Hash     bool
+	HashSalt string
+}
+
+// DefaultRedactConfig returns a mask configuration using DefaultRedactKeys and DefaultRedactPatterns
+func DefaultRedactConfig() *RedactConfig {
+	return &RedactConfig{
+		Keys:     DefaultRedactKeys,
+		Patterns: DefaultRedactPatterns,
+	}
+}
+
+// redactor applies a RedactConfig to fields and strings
+type redactor struct {
+	config *RedactConfig
+	keys   map[string]struct{}
+}
+
+func newRedactor(config *RedactConfig) *redactor {
+	r := &redactor{config: config, keys: make(map[string]struct{}, len(config.Keys))}
+	for _, key := range config.Keys {
+		r.keys[strings.ToLower(key)] = struct{}{}
+	}
+	return r
+}
+
+// replacement returns the value written in place of a redacted value
+func (r *redactor) replacement(value string) string {
+	if !r.config.Hash {
+		return RedactedValue
+	}
+	sum := sha256.Sum256([]byte(r.config.HashSalt + value))
+	return "sha256:" + hex.EncodeToString(sum[:6])
+}
+
+// sensitive reports whether values under key are always redacted
+func (r *redactor) sensitive(key string) bool {
+	_, ok := r.keys[strings.ToLower(key)]
+	return ok
+}
+
+// redactString replaces every pattern match in value
+func (r *redactor) redactString(value string) string {
+	for _, pattern := range r.config.Patterns {
+		value = pattern.ReplaceAllStringFunc(value, r.replacement)
+	}
+	return value
+}
+
+// redactValue walks decoded values, redacting sensitive keys and pattern matches
+func (r *redactor) redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return r.redactString(v)
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			if r.sensitive(key) {
+				redacted[key] = r.replacement(toString(item))
+				continue
+			}
+			redacted[key] = r.redactValue(item)
+		}
+		return redacted
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		for i, item := range v {
+			redacted[i] = r.redactValue(item)
+		}
+		return redacted
+	case nil, bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return v
+	default:
+		// Structs and other reflected values are normalised through JSON so their fields can be inspected
+		data, err := json.Marshal(v)
+		if err != nil {
+			return r.redactString(toString(v))
+		}
+		var decoded interface{}
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			return r.redactString(string(data))
+		}
+		return r.redactValue(decoded)
+	}
+}
+
+// field returns a copy of f that is safe to encode
+func (r *redactor) field(f zapcore.Field) zapcore.Field {
+	switch f.Type {
+	case zapcore.SkipType, zapcore.NamespaceType:
+		return f
+	}
+
+	if r.sensitive(f.Key) {
+		encoder := zapcore.NewMapObjectEncoder()
+		f.AddTo(encoder)
+		return zap.String(f.Key, r.replacement(toString(encoder.Fields[f.Key])))
+	}
+
+	switch f.Type {
+	case zapcore.StringType:
+		return zap.String(f.Key, r.redactString(f.String))
+	case zapcore.ByteStringType, zapcore.StringerType, zapcore.ErrorType,
+		zapcore.ReflectType, zapcore.ObjectMarshalerType, zapcore.ArrayMarshalerType,
+		zapcore.InlineMarshalerType:
+		encoder := zapcore.NewMapObjectEncoder()
+		f.AddTo(encoder)
+		if f.Type == zapcore.InlineMarshalerType {
+			return zap.Inline(redactedObject(r.redactValue(encoder.Fields).(map[string]interface{})))
+		}
+		return zap.Any(f.Key, r.redactValue(encoder.Fields[f.Key]))
+	default:
+		return f
+	}
+}
+
+// redactedObject marshals already redacted values inline
+type redactedObject map[string]interface{}
+
+// MarshalLogObject implements zapcore.ObjectMarshaler
+func (o redactedObject) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	for key, value := range o {
+		zap.Any(key, value).AddTo(enc)
+	}
+	return nil
+}
+
+// toString formats a decoded value for hashing or masking
+func toString(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// redactingEncoder redacts fields and messages before handing them to the wrapped encoder
+type redactingEncoder struct {
+	zapcore.Encoder
+	redactor *redactor
+}
+
+// NewRedactingEncoder wraps an encoder so configured keys and patterns never reach the output
+func NewRedactingEncoder(encoder zapcore.Encoder, config *RedactConfig) zapcore.Encoder {
+	return &redactingEncoder{Encoder: encoder, redactor: newRedactor(config)}
+}
+
+// Clone implements zapcore.Encoder
+func (e *redactingEncoder) Clone() zapcore.Encoder {
+	return &redactingEncoder{Encoder: e.Encoder.Clone(), redactor: e.redactor}
+}
+
+// EncodeEntry implements zapcore.Encoder
+func (e *redactingEncoder) EncodeEntry(entry zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	entry.Message = e.redactor.redactString(entry.Message)
+	redacted := make([]zapcore.Field, len(fields))
+	for i, f := range fields {
+		redacted[i] = e.redactor.field(f)
+	}
+	return e.Encoder.EncodeEntry(entry, redacted)
+}
+
+// The Add methods below receive the fields attached with logger.With
+
+// AddString implements zapcore.ObjectEncoder
+func (e *redactingEncoder) AddString(key, value string) {
+	e.redactor.field(zap.String(key, value)).AddTo(e.Encoder)
+}
+
+// AddByteString implements zapcore.ObjectEncoder
+func (e *redactingEncoder) AddByteString(key string, value []byte) {
+	e.redactor.field(zap.ByteString(key, value)).AddTo(e.Encoder)
+}
+
+// AddInt64 implements zapcore.ObjectEncoder
+func (e *redactingEncoder) AddInt64(key string, value int64) {
+	e.redactor.field(zap.Int64(key, value)).AddTo(e.Encoder)
+}
+
+// AddUint64 implements zapcore.ObjectEncoder
+func (e *redactingEncoder) AddUint64(key string, value uint64) {
+	e.redactor.field(zap.Uint64(key, value)).AddTo(e.Encoder)
+}
+
+// AddReflected implements zapcore.ObjectEncoder
+func (e *redactingEncoder) AddReflected(key string, value interface{}) error {
+	e.redactor.field(zap.Reflect(key, value)).AddTo(e.Encoder)
+	return nil
+}
+
+// AddObject implements zapcore.ObjectEncoder
+func (e *redactingEncoder) AddObject(key string, marshaler zapcore.ObjectMarshaler) error {
+	e.redactor.field(zap.Object(key, marshaler)).AddTo(e.Encoder)
+	return nil
+}
+
+// AddArray implements zapcore.ObjectEncoder
+func (e *redactingEncoder) AddArray(key string, marshaler zapcore.ArrayMarshaler) error {
+	e.redactor.field(zap.Array(key, marshaler)).AddTo(e.Encoder)
+	return nil
+}
+
+// redactingEncodings numbers the encodings registered by RedactingEncoding
+var redactingEncodings atomic.Int64
+
+// RedactingEncoding registers a redacting variant of the json or console encoding bound to config
+// and returns the name to set as zap.Config.Encoding. Every call registers its own encoding, so
+// loggers built with different configurations each redact with their own.
+func RedactingEncoding(encoding string, config *RedactConfig) string {
+	name := fmt.Sprintf("redact-%s-%d", encoding, redactingEncodings.Add(1))
+	_ = zap.RegisterEncoder(name, func(cfg zapcore.EncoderConfig) (zapcore.Encoder, error) {
+		switch encoding {
+		case "json":
+			return NewRedactingEncoder(zapcore.NewJSONEncoder(cfg), config), nil
+		case "console":
+			return NewRedactingEncoder(zapcore.NewConsoleEncoder(cfg), config), nil
+		default:
+			return nil, fmt.Errorf("no redacting variant of the %q encoding", encoding)
+		}
+	})
+	return name
+}
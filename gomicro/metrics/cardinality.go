@@ -0,0 +1,93 @@
+package metrics
+
+import "sync"
+
+const (
+	// UnmatchedRouteLabel replaces the path label of requests that matched no route
+	UnmatchedRouteLabel = "unmatched"
+
+	// OverflowLabelValue replaces label values rejected by an allow-list or cap
+	OverflowLabelValue = "other"
+
+	// DefaultMaxPathLabels is the default cap on distinct path label values
+	DefaultMaxPathLabels = 1000
+)
+
+// standardMethods is the default allow-list for the method label
+var standardMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "CONNECT", "OPTIONS", "TRACE"}
+
+// labelLimiter bounds the distinct values recorded for a single label
+type labelLimiter struct {
+	mu      sync.Mutex
+	allowed map[string]struct{}
+	seen    map[string]struct{}
+	max     int
+}
+
+// newLabelLimiter creates a limiter; an empty allow-list accepts any value and max <= 0 disables the cap
+func newLabelLimiter(allowed []string, max int) *labelLimiter {
+	l := &labelLimiter{
+		seen: make(map[string]struct{}),
+		max:  max,
+	}
+	if len(allowed) > 0 {
+		l.allowed = make(map[string]struct{}, len(allowed))
+		for _, value := range allowed {
+			l.allowed[value] = struct{}{}
+		}
+	}
+	return l
+}
+
+// value returns the label value to record and whether the original value was dropped
+func (l *labelLimiter) value(v string) (string, bool) {
+	if l.allowed != nil {
+		if _, ok := l.allowed[v]; !ok {
+			return OverflowLabelValue, true
+		}
+	}
+
+	if l.max <= 0 {
+		return v, false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.seen[v]; ok {
+		return v, false
+	}
+	if len(l.seen) >= l.max {
+		return OverflowLabelValue, true
+	}
+	l.seen[v] = struct{}{}
+	return v, false
+}
+
+// labelLimits holds the allow-list and cap configured for each label
+type labelLimits struct {
+	allowed map[string][]string
+	max     map[string]int
+}
+
+// WithAllowedLabelValues restricts a label ("method", "path" or "status") to the given values.
+// Other values are recorded as OverflowLabelValue.
+func WithAllowedLabelValues(label string, values ...string) Option {
+	return func(m *HTTPMetrics) {
+		m.limits.allowed[label] = values
+	}
+}
+
+// WithMaxLabelValues caps the distinct values recorded for a label; zero disables the cap
+func WithMaxLabelValues(label string, max int) Option {
+	return func(m *HTTPMetrics) {
+		m.limits.max[label] = max
+	}
+}
+
+// WithBuckets sets the request duration histogram buckets instead of prometheus.DefBuckets
+func WithBuckets(buckets []float64) Option {
+	return func(m *HTTPMetrics) {
+		m.buckets = buckets
+	}
+}
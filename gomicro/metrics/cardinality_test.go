@@ -0,0 +1,172 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestLabelLimiter(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		max     int
+		values  []string
+		want    []string
+		dropped int
+	}{
+		{
+			name:   "no limits",
+			values: []string{"a", "b", "c"},
+			want:   []string{"a", "b", "c"},
+		},
+		{
+			name:    "allow-list",
+			allowed: []string{"GET", "POST"},
+			values:  []string{"GET", "PROPFIND", "POST"},
+			want:    []string{"GET", OverflowLabelValue, "POST"},
+			dropped: 1,
+		},
+		{
+			name:    "cap",
+			max:     2,
+			values:  []string{"/a", "/b", "/c", "/d"},
+			want:    []string{"/a", "/b", OverflowLabelValue, OverflowLabelValue},
+			dropped: 2,
+		},
+		{
+			name:   "values seen before the cap is reached are kept",
+			max:    2,
+			values: []string{"/a", "/b", "/a", "/b"},
+			want:   []string{"/a", "/b", "/a", "/b"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newLabelLimiter(tt.allowed, tt.max)
+			dropped := 0
+			for i, v := range tt.values {
+				got, drop := l.value(v)
+				if got != tt.want[i] {
+					t.Errorf("value(%q) = %q, want %q", v, got, tt.want[i])
+				}
+				if drop {
+					dropped++
+				}
+			}
+			if dropped != tt.dropped {
+				t.Errorf("dropped %d values, want %d", dropped, tt.dropped)
+			}
+		})
+	}
+}
+
+func TestCardinalityGuard(t *testing.T) {
+	type request struct{ method, path string }
+	tests := []struct {
+		name     string
+		opts     []Option
+		requests []request
+		// want maps "method path status" to the http_requests_total count
+		want    map[string]float64
+		dropped map[string]float64
+	}{
+		{
+			name:     "routes are recorded by their pattern",
+			requests: []request{{"GET", "/items/1"}, {"GET", "/items/2"}},
+			want:     map[string]float64{"GET /items/:id 200": 2},
+		},
+		{
+			name:     "unmatched routes collapse into one label",
+			requests: []request{{"GET", "/scan/1"}, {"GET", "/scan/2"}, {"DELETE", "/a"}},
+			want:     map[string]float64{"GET unmatched 404": 2, "DELETE unmatched 405": 1},
+		},
+		{
+			name:     "methods outside the standard set overflow",
+			requests: []request{{"PROPFIND", "/a"}, {"GET", "/a"}},
+			want:     map[string]float64{"other /a 200": 1, "GET /a 200": 1},
+			dropped:  map[string]float64{"method": 1},
+		},
+		{
+			name:     "paths over the cap overflow",
+			opts:     []Option{WithMaxLabelValues("path", 2)},
+			requests: []request{{"GET", "/a"}, {"GET", "/b"}, {"GET", "/c"}, {"GET", "/items/1"}, {"GET", "/a"}},
+			want:     map[string]float64{"GET /a 200": 2, "GET /b 200": 1, "GET other 200": 2},
+			dropped:  map[string]float64{"path": 2},
+		},
+		{
+			name:     "allowed label values",
+			opts:     []Option{WithAllowedLabelValues("status", "200", "404")},
+			requests: []request{{"GET", "/a"}, {"GET", "/missing"}, {"GET", "/fail"}},
+			want:     map[string]float64{"GET /a 200": 1, "GET unmatched 404": 1, "GET /fail other": 1},
+			dropped:  map[string]float64{"status": 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			m, err := NewHTTPMetrics("test-service", append([]Option{WithRegistry(reg)}, tt.opts...)...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			e := echo.New()
+			e.Use(m.Middleware())
+			ok := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+			for _, path := range []string{"/a", "/b", "/c", "/items/:id"} {
+				e.GET(path, ok)
+			}
+			e.Add("PROPFIND", "/a", ok)
+			e.GET("/fail", func(c echo.Context) error { return echo.NewHTTPError(http.StatusServiceUnavailable) })
+			for _, r := range tt.requests {
+				e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(r.method, r.path, nil))
+			}
+
+			assertSeries(t, reg, "http_requests_total", tt.want)
+			dropped := tt.dropped
+			if dropped == nil {
+				dropped = map[string]float64{}
+			}
+			assertSeries(t, reg, "http_metrics_dropped_series_total", dropped)
+		})
+	}
+}
+
+// assertSeries compares the series of the counter name, keyed by their label values without the
+// service label, to want
+func assertSeries(t *testing.T, reg *prometheus.Registry, name string, want map[string]float64) {
+	t.Helper()
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]float64{}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			var values []string
+			for _, label := range metric.GetLabel() {
+				if label.GetName() != "service" {
+					values = append(values, label.GetValue())
+				}
+			}
+			got[strings.Join(values, " ")] = metric.GetCounter().GetValue()
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("%s series %v, want %v", name, got, want)
+		return
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("%s series %v, want %v", name, got, want)
+			return
+		}
+	}
+}
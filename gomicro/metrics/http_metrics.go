@@ -1,96 +1,211 @@
 package metrics
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	apperrors "github.com/suteetoe/gomicro/errors"
 )
 
-var (
-	// RequestCounter counts all HTTP requests with labels
-	RequestCounter = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "http_requests_total",
-			Help: "Total number of HTTP requests",
-		},
-		[]string{"service", "method", "path", "status"},
-	)
+// HTTPMetrics holds configuration and state for HTTP metrics collection
+type HTTPMetrics struct {
+	ServiceName string
+	ConstLabels prometheus.Labels
 
+	registerer prometheus.Registerer
+	gatherer   prometheus.Gatherer
+
+	buckets  []float64
+	limits   labelLimits
+	limiters map[string]*labelLimiter
+
+	// RequestCounter counts all HTTP requests with labels
+	RequestCounter *prometheus.CounterVec
 	// RequestDurationHistogram records request duration in seconds
-	RequestDurationHistogram = prometheus.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Name:    "http_request_duration_seconds",
-			Help:    "Duration of HTTP requests in seconds",
-			Buckets: prometheus.DefBuckets,
-		},
-		[]string{"service", "method", "path", "status"},
-	)
+	RequestDurationHistogram *prometheus.HistogramVec
 
 	// Status code category counters
-	StatusOkCounter = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "http_status_2xx_total",
-			Help: "Total number of 2xx (success) responses",
-		},
-		[]string{"service"},
-	)
+	StatusOkCounter          *prometheus.CounterVec
+	StatusClientErrorCounter *prometheus.CounterVec
+	StatusServerErrorCounter *prometheus.CounterVec
 
-	StatusClientErrorCounter = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "http_status_4xx_total",
-			Help: "Total number of 4xx (client error) responses",
-		},
-		[]string{"service"},
-	)
+	// StatusCodeCategoryCounter with detailed labels
+	StatusCodeCategoryCounter *prometheus.CounterVec
 
-	StatusServerErrorCounter = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "http_status_5xx_total",
-			Help: "Total number of 5xx (server error) responses",
-		},
-		[]string{"service"},
-	)
+	// DroppedSeriesCounter counts label values collapsed by the cardinality guard
+	DroppedSeriesCounter *prometheus.CounterVec
 
-	// StatusCodeCategoryCounter with detailed labels
-	StatusCodeCategoryCounter = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "http_status_category_total",
-			Help: "Total number of responses by status category (2xx, 4xx, 5xx)",
-		},
-		[]string{"service", "category", "method", "path"},
-	)
-)
+	// SLOTracker records requests against the configured objectives; nil when none are configured
+	SLOTracker *SLOTracker
+	sloConfig  *SLOConfig
+}
 
-// HTTPMetrics holds configuration and state for HTTP metrics collection
-type HTTPMetrics struct {
-	ServiceName string
-	initialized bool
+// Option configures an HTTPMetrics instance
+type Option func(*HTTPMetrics)
+
+// WithRegistry registers metrics on reg and serves them from it instead of the global registry
+func WithRegistry(reg *prometheus.Registry) Option {
+	return func(m *HTTPMetrics) {
+		m.registerer = reg
+		m.gatherer = reg
+	}
+}
+
+// WithRegisterer sets the registerer and gatherer used by the metrics instance
+func WithRegisterer(registerer prometheus.Registerer, gatherer prometheus.Gatherer) Option {
+	return func(m *HTTPMetrics) {
+		m.registerer = registerer
+		m.gatherer = gatherer
+	}
+}
+
+// WithConstLabels attaches constant labels such as version, instance or region to every metric.
+// Labels with empty values are skipped.
+func WithConstLabels(labels prometheus.Labels) Option {
+	return func(m *HTTPMetrics) {
+		if m.ConstLabels == nil {
+			m.ConstLabels = prometheus.Labels{}
+		}
+		for name, value := range labels {
+			if value != "" {
+				m.ConstLabels[name] = value
+			}
+		}
+	}
+}
+
+// WithSLOs tracks the objectives in config and registers their event counters and burn-rate gauges
+func WithSLOs(config *SLOConfig) Option {
+	return func(m *HTTPMetrics) {
+		m.sloConfig = config
+	}
+}
+
+// NewRegistry returns a registry for the metrics of one service, with the Go runtime and process
+// collectors that the global registry has. Pass it to WithRegistry.
+func NewRegistry() *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	return reg
 }
 
-// NewHTTPMetrics creates a new HTTP metrics collector for a specific service
-func NewHTTPMetrics(serviceName string) *HTTPMetrics {
+// NewHTTPMetrics creates a new HTTP metrics collector for a specific service. It fails when the
+// registerer already has metrics of the same name, e.g. those of a second instance.
+func NewHTTPMetrics(serviceName string, opts ...Option) (*HTTPMetrics, error) {
 	m := &HTTPMetrics{
 		ServiceName: serviceName,
+		registerer:  prometheus.DefaultRegisterer,
+		gatherer:    prometheus.DefaultGatherer,
+		buckets:     prometheus.DefBuckets,
+		limits: labelLimits{
+			allowed: map[string][]string{"method": standardMethods},
+			max:     map[string]int{"path": DefaultMaxPathLabels},
+		},
+	}
+	for _, opt := range opts {
+		opt(m)
 	}
-	m.register()
-	return m
+
+	m.limiters = make(map[string]*labelLimiter)
+	for _, label := range []string{"method", "path", "status"} {
+		m.limiters[label] = newLabelLimiter(m.limits.allowed[label], m.limits.max[label])
+	}
+
+	if err := m.register(); err != nil {
+		return nil, err
+	}
+	return m, nil
 }
 
-// register registers the prometheus metrics if they haven't been registered already
-func (m *HTTPMetrics) register() {
-	if !m.initialized {
-		prometheus.MustRegister(RequestCounter)
-		prometheus.MustRegister(RequestDurationHistogram)
-		prometheus.MustRegister(StatusOkCounter)
-		prometheus.MustRegister(StatusClientErrorCounter)
-		prometheus.MustRegister(StatusServerErrorCounter)
-		prometheus.MustRegister(StatusCodeCategoryCounter)
-		m.initialized = true
+// register creates the metric vectors and registers them with the configured registerer
+func (m *HTTPMetrics) register() error {
+	m.RequestCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        "http_requests_total",
+		Help:        "Total number of HTTP requests",
+		ConstLabels: m.ConstLabels,
+	}, []string{"service", "method", "path", "status"})
+
+	m.RequestDurationHistogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:        "http_request_duration_seconds",
+		Help:        "Duration of HTTP requests in seconds",
+		Buckets:     m.buckets,
+		ConstLabels: m.ConstLabels,
+	}, []string{"service", "method", "path", "status"})
+
+	m.StatusOkCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        "http_status_2xx_total",
+		Help:        "Total number of 2xx (success) responses",
+		ConstLabels: m.ConstLabels,
+	}, []string{"service"})
+
+	m.StatusClientErrorCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        "http_status_4xx_total",
+		Help:        "Total number of 4xx (client error) responses",
+		ConstLabels: m.ConstLabels,
+	}, []string{"service"})
+
+	m.StatusServerErrorCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        "http_status_5xx_total",
+		Help:        "Total number of 5xx (server error) responses",
+		ConstLabels: m.ConstLabels,
+	}, []string{"service"})
+
+	m.StatusCodeCategoryCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        "http_status_category_total",
+		Help:        "Total number of responses by status category (2xx, 4xx, 5xx)",
+		ConstLabels: m.ConstLabels,
+	}, []string{"service", "category", "method", "path"})
+
+	m.DroppedSeriesCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        "http_metrics_dropped_series_total",
+		Help:        "Total number of label values collapsed by the metrics cardinality guard",
+		ConstLabels: m.ConstLabels,
+	}, []string{"service", "label"})
+
+	all := []prometheus.Collector{
+		m.RequestCounter,
+		m.RequestDurationHistogram,
+		m.StatusOkCounter,
+		m.StatusClientErrorCounter,
+		m.StatusServerErrorCounter,
+		m.StatusCodeCategoryCounter,
+		m.DroppedSeriesCounter,
+	}
+	if m.sloConfig != nil && len(m.sloConfig.Objectives) > 0 {
+		m.SLOTracker = NewSLOTracker(m.ServiceName, m.sloConfig, m.ConstLabels)
+		all = append(all, m.SLOTracker)
 	}
+	for _, collector := range all {
+		if err := m.registerer.Register(collector); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// limitLabel applies the allow-list and cap configured for label and records drops
+func (m *HTTPMetrics) limitLabel(label, value string) string {
+	limited, dropped := m.limiters[label].value(value)
+	if dropped {
+		m.DroppedSeriesCounter.WithLabelValues(m.ServiceName, label).Inc()
+	}
+	return limited
+}
+
+// routeLabel returns the registered route for the request, or UnmatchedRouteLabel
+// when the router found no handler so raw request paths never become label values
+func routeLabel(c echo.Context, err error) string {
+	path := c.Path()
+	if path == "" || errors.Is(err, echo.ErrNotFound) || errors.Is(err, echo.ErrMethodNotAllowed) {
+		return UnmatchedRouteLabel
+	}
+	return path
 }
 
 // incrementStatusCounter increments the appropriate status counter based on the HTTP status code
@@ -98,18 +213,18 @@ func (m *HTTPMetrics) incrementStatusCounter(status int, method, path string) {
 	category := ""
 
 	if status >= 200 && status < 300 {
-		StatusOkCounter.WithLabelValues(m.ServiceName).Inc()
+		m.StatusOkCounter.WithLabelValues(m.ServiceName).Inc()
 		category = "2xx"
 	} else if status >= 400 && status < 500 {
-		StatusClientErrorCounter.WithLabelValues(m.ServiceName).Inc()
+		m.StatusClientErrorCounter.WithLabelValues(m.ServiceName).Inc()
 		category = "4xx"
 	} else if status >= 500 && status < 600 {
-		StatusServerErrorCounter.WithLabelValues(m.ServiceName).Inc()
+		m.StatusServerErrorCounter.WithLabelValues(m.ServiceName).Inc()
 		category = "5xx"
 	}
 
 	if category != "" {
-		StatusCodeCategoryCounter.WithLabelValues(m.ServiceName, category, method, path).Inc()
+		m.StatusCodeCategoryCounter.WithLabelValues(m.ServiceName, category, method, path).Inc()
 	}
 }
 
@@ -123,25 +238,60 @@ func (m *HTTPMetrics) Middleware() echo.MiddlewareFunc {
 
 			// Record metrics after the request is processed
 			status := c.Response().Status
-			method := c.Request().Method
-			path := c.Path()
-			statusStr := strconv.Itoa(status)
+			if err != nil && !c.Response().Committed {
+				// The error handler has not written the response yet
+				status = apperrors.StatusCode(err)
+			}
+			method := m.limitLabel("method", c.Request().Method)
+			path := m.limitLabel("path", routeLabel(c, err))
+			statusStr := m.limitLabel("status", strconv.Itoa(status))
 
 			// Increment the request counter
-			RequestCounter.WithLabelValues(m.ServiceName, method, path, statusStr).Inc()
+			m.RequestCounter.WithLabelValues(m.ServiceName, method, path, statusStr).Inc()
 
 			// Increment status category counters
 			m.incrementStatusCounter(status, method, path)
 
 			// Record the request duration
-			duration := time.Since(start).Seconds()
-			RequestDurationHistogram.WithLabelValues(m.ServiceName, method, path, statusStr).Observe(duration)
+			duration := time.Since(start)
+			m.RequestDurationHistogram.WithLabelValues(m.ServiceName, method, path, statusStr).Observe(duration.Seconds())
+
+			// Record the request against the service level objectives
+			if m.SLOTracker != nil {
+				m.SLOTracker.Observe(c.Request().Method, routeLabel(c, err), status, duration)
+			}
 
 			return err
 		}
 	}
 }
 
+// Registerer returns the registerer the metrics are registered with, so services
+// can add their own collectors to the same registry
+func (m *HTTPMetrics) Registerer() prometheus.Registerer {
+	return m.registerer
+}
+
+// Gatherer returns the gatherer backing Handler
+func (m *HTTPMetrics) Gatherer() prometheus.Gatherer {
+	return m.gatherer
+}
+
+// Handler returns an HTTP handler exposing the metrics of this instance's registry
+func (m *HTTPMetrics) Handler() http.Handler {
+	return promhttp.InstrumentMetricHandler(m.registerer, promhttp.HandlerFor(m.gatherer, promhttp.HandlerOpts{}))
+}
+
+// SLOHandler returns an Echo handler serving the current SLO report as JSON
+func (m *HTTPMetrics) SLOHandler() echo.HandlerFunc {
+	if m.SLOTracker == nil {
+		return func(c echo.Context) error {
+			return c.JSON(http.StatusOK, SLOReport{Service: m.ServiceName, Objectives: []SLOStatus{}})
+		}
+	}
+	return m.SLOTracker.Handler()
+}
+
 // GetPrometheusHandler returns an HTTP handler for exposing Prometheus metrics
 func GetPrometheusHandler() http.Handler {
 	return promhttp.Handler()
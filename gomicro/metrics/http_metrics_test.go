@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// serve sends one GET request for path through an Echo app instrumented by m
+func serve(t *testing.T, m *HTTPMetrics, path string) {
+	t.Helper()
+	e := echo.New()
+	e.Use(m.Middleware())
+	e.GET("/items/:id", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+}
+
+func TestRegistryIsolation(t *testing.T) {
+	first, err := NewHTTPMetrics("test-service", WithRegistry(prometheus.NewRegistry()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := NewHTTPMetrics("test-service", WithRegistry(prometheus.NewRegistry()))
+	if err != nil {
+		t.Fatalf("a second instance on its own registry: %v", err)
+	}
+
+	serve(t, first, "/items/1")
+	serve(t, first, "/items/2")
+
+	if got := testutil.ToFloat64(first.RequestCounter.WithLabelValues("test-service", "GET", "/items/:id", "200")); got != 2 {
+		t.Errorf("first instance counted %v requests", got)
+	}
+	if got, err := testutil.GatherAndCount(second.Gatherer(), "http_requests_total"); err != nil || got != 0 {
+		t.Errorf("second instance has %d request series: %v", got, err)
+	}
+	if got, err := testutil.GatherAndCount(prometheus.DefaultGatherer, "http_requests_total"); err != nil || got != 0 {
+		t.Errorf("global registry has %d request series: %v", got, err)
+	}
+
+	// Collectors of the service itself go to the same registry
+	operations := prometheus.NewCounter(prometheus.CounterOpts{Name: "test_operations_total", Help: "Operations"})
+	if err := first.Registerer().Register(operations); err != nil {
+		t.Fatal(err)
+	}
+	operations.Inc()
+	if got, err := testutil.GatherAndCount(first.Gatherer(), "test_operations_total"); err != nil || got != 1 {
+		t.Errorf("service collector gathered %d times: %v", got, err)
+	}
+}
+
+func TestDuplicateRegistrationFails(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	if _, err := NewHTTPMetrics("test-service", WithRegistry(reg)); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := NewHTTPMetrics("test-service", WithRegistry(reg))
+	var are prometheus.AlreadyRegisteredError
+	if !errors.As(err, &are) {
+		t.Errorf("second instance on the same registry: %v", err)
+	}
+}
+
+func TestNewRegistry(t *testing.T) {
+	reg := NewRegistry()
+	for _, name := range []string{"go_goroutines", "process_start_time_seconds"} {
+		if got, err := testutil.GatherAndCount(reg, name); err != nil || got != 1 {
+			t.Errorf("%s gathered %d times: %v", name, got, err)
+		}
+	}
+}
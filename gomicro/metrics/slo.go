@@ -0,0 +1,355 @@
+package metrics
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultBurnRateWindows are the windows used for burn-rate gauges when none are configured
+var DefaultBurnRateWindows = []Duration{
+	Duration(5 * time.Minute),
+	Duration(30 * time.Minute),
+	Duration(1 * time.Hour),
+	Duration(6 * time.Hour),
+}
+
+// Duration is a time.Duration that reads from strings such as "300ms" in YAML and JSON
+type Duration time.Duration
+
+// UnmarshalJSON parses a duration string
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	return d.parse(value)
+}
+
+// MarshalJSON formats the duration as a string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalYAML parses a duration string
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	return d.parse(node.Value)
+}
+
+func (d *Duration) parse(value string) error {
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %w", value, err)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// SLO defines a service level objective for one route.
+// A request is a good event when it did not fail with a 5xx status and,
+// if LatencyThreshold is set, completed within it.
+type SLO struct {
+	Name             string   `json:"name" yaml:"name"`
+	Method           string   `json:"method,omitempty" yaml:"method"` // empty matches any method
+	Path             string   `json:"path" yaml:"path"`               // Echo route pattern, "*" matches every route
+	Target           float64  `json:"target" yaml:"target"`           // fraction of good events, e.g. 0.999
+	LatencyThreshold Duration `json:"latency_threshold,omitempty" yaml:"latency_threshold"`
+}
+
+// SLOConfig holds the objectives declared by a service
+type SLOConfig struct {
+	Service    string     `json:"service" yaml:"service"`
+	Windows    []Duration `json:"windows,omitempty" yaml:"windows"`
+	Objectives []SLO      `json:"objectives" yaml:"objectives"`
+}
+
+// LoadSLOConfig reads SLO definitions from a YAML or JSON file. A missing file declares no objectives.
+func LoadSLOConfig(path string) (*SLOConfig, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &SLOConfig{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SLO config: %w", err)
+	}
+
+	config := &SLOConfig{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(data, config)
+	default:
+		err = yaml.Unmarshal(data, config)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse SLO config %s: %w", path, err)
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// Validate checks that every objective is well formed
+func (c *SLOConfig) Validate() error {
+	seen := make(map[string]struct{}, len(c.Objectives))
+	for _, objective := range c.Objectives {
+		if objective.Name == "" {
+			return fmt.Errorf("SLO for path %q has no name", objective.Path)
+		}
+		if _, ok := seen[objective.Name]; ok {
+			return fmt.Errorf("duplicate SLO name %q", objective.Name)
+		}
+		seen[objective.Name] = struct{}{}
+
+		if objective.Path == "" {
+			return fmt.Errorf("SLO %q has no path", objective.Name)
+		}
+		if objective.Target <= 0 || objective.Target >= 1 {
+			return fmt.Errorf("SLO %q target must be between 0 and 1, got %v", objective.Name, objective.Target)
+		}
+	}
+	for _, window := range c.Windows {
+		if time.Duration(window) < time.Minute {
+			return fmt.Errorf("SLO window %s is shorter than one minute", time.Duration(window))
+		}
+	}
+	return nil
+}
+
+// sloBucket counts events observed during one minute
+type sloBucket struct {
+	minute int64
+	good   uint64
+	total  uint64
+}
+
+// sloState tracks the events of one objective in per-minute buckets
+type sloState struct {
+	objective SLO
+	buckets   []sloBucket
+	good      uint64
+	total     uint64
+}
+
+// add records an event in the bucket for the given minute
+func (s *sloState) add(minute int64, good bool) {
+	bucket := &s.buckets[minute%int64(len(s.buckets))]
+	if bucket.minute != minute {
+		*bucket = sloBucket{minute: minute}
+	}
+	bucket.total++
+	s.total++
+	if good {
+		bucket.good++
+		s.good++
+	}
+}
+
+// sum returns the events observed during the last window ending at minute
+func (s *sloState) sum(minute int64, window time.Duration) (good, total uint64) {
+	minutes := int64(window / time.Minute)
+	for i := int64(0); i < minutes && i < int64(len(s.buckets)); i++ {
+		bucket := s.buckets[(minute-i)%int64(len(s.buckets))]
+		if bucket.minute == minute-i {
+			good += bucket.good
+			total += bucket.total
+		}
+	}
+	return good, total
+}
+
+// SLOTracker computes good/total event counts and burn rates for a set of objectives
+type SLOTracker struct {
+	serviceName string
+	windows     []time.Duration
+	now         func() time.Time
+
+	mu     sync.Mutex
+	states []*sloState
+
+	goodEvents  *prometheus.CounterVec
+	totalEvents *prometheus.CounterVec
+
+	burnRateDesc        *prometheus.Desc
+	budgetRemainingDesc *prometheus.Desc
+}
+
+// NewSLOTracker creates a tracker for the objectives in config
+func NewSLOTracker(serviceName string, config *SLOConfig, constLabels prometheus.Labels) *SLOTracker {
+	t := &SLOTracker{
+		serviceName: serviceName,
+		now:         time.Now,
+	}
+
+	windows := config.Windows
+	if len(windows) == 0 {
+		windows = DefaultBurnRateWindows
+	}
+	longest := time.Duration(0)
+	for _, window := range windows {
+		t.windows = append(t.windows, time.Duration(window))
+		if time.Duration(window) > longest {
+			longest = time.Duration(window)
+		}
+	}
+
+	for _, objective := range config.Objectives {
+		t.states = append(t.states, &sloState{
+			objective: objective,
+			buckets:   make([]sloBucket, int(longest/time.Minute)),
+		})
+	}
+
+	t.goodEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        "slo_good_events_total",
+		Help:        "Total number of requests that met their service level objective",
+		ConstLabels: constLabels,
+	}, []string{"service", "slo"})
+	t.totalEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        "slo_events_total",
+		Help:        "Total number of requests covered by a service level objective",
+		ConstLabels: constLabels,
+	}, []string{"service", "slo"})
+	t.burnRateDesc = prometheus.NewDesc("slo_burn_rate",
+		"Error budget burn rate over the window (1 means the budget lasts exactly the window)",
+		[]string{"service", "slo", "window"}, constLabels)
+	t.budgetRemainingDesc = prometheus.NewDesc("slo_error_budget_remaining_ratio",
+		"Fraction of the error budget left over the longest window",
+		[]string{"service", "slo"}, constLabels)
+
+	return t
+}
+
+// matches reports whether the objective covers the request
+func (o SLO) matches(method, path string) bool {
+	if o.Method != "" && !strings.EqualFold(o.Method, method) {
+		return false
+	}
+	return o.Path == "*" || o.Path == path
+}
+
+// Observe records a request against every matching objective
+func (t *SLOTracker) Observe(method, path string, status int, duration time.Duration) {
+	if path == UnmatchedRouteLabel {
+		return
+	}
+
+	minute := t.now().Unix() / 60
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, state := range t.states {
+		objective := state.objective
+		if !objective.matches(method, path) {
+			continue
+		}
+
+		good := status < http.StatusInternalServerError
+		if objective.LatencyThreshold > 0 && duration > time.Duration(objective.LatencyThreshold) {
+			good = false
+		}
+
+		state.add(minute, good)
+		t.totalEvents.WithLabelValues(t.serviceName, objective.Name).Inc()
+		if good {
+			t.goodEvents.WithLabelValues(t.serviceName, objective.Name).Inc()
+		}
+	}
+}
+
+// SLOStatus reports the current budget consumption of one objective
+type SLOStatus struct {
+	SLO
+	GoodEvents           uint64             `json:"good_events"`
+	TotalEvents          uint64             `json:"total_events"`
+	ErrorBudgetRemaining float64            `json:"error_budget_remaining"`
+	BurnRates            map[string]float64 `json:"burn_rates"`
+}
+
+// SLOReport is the body served by the /slo endpoint
+type SLOReport struct {
+	Service    string      `json:"service"`
+	Objectives []SLOStatus `json:"objectives"`
+}
+
+// burnRate returns the ratio of the observed error rate to the rate allowed by target
+func burnRate(good, total uint64, target float64) float64 {
+	if total == 0 {
+		return 0
+	}
+	errorRate := float64(total-good) / float64(total)
+	return errorRate / (1 - target)
+}
+
+// Report returns the status of every objective
+func (t *SLOTracker) Report() SLOReport {
+	minute := t.now().Unix() / 60
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	report := SLOReport{Service: t.serviceName, Objectives: make([]SLOStatus, 0, len(t.states))}
+	for _, state := range t.states {
+		status := SLOStatus{
+			SLO:                  state.objective,
+			GoodEvents:           state.good,
+			TotalEvents:          state.total,
+			ErrorBudgetRemaining: 1,
+			BurnRates:            make(map[string]float64, len(t.windows)),
+		}
+
+		longest := time.Duration(0)
+		for _, window := range t.windows {
+			good, total := state.sum(minute, window)
+			status.BurnRates[window.String()] = burnRate(good, total, state.objective.Target)
+			if window > longest {
+				longest = window
+				status.ErrorBudgetRemaining = 1 - burnRate(good, total, state.objective.Target)
+			}
+		}
+
+		report.Objectives = append(report.Objectives, status)
+	}
+	return report
+}
+
+// Describe implements prometheus.Collector
+func (t *SLOTracker) Describe(ch chan<- *prometheus.Desc) {
+	t.goodEvents.Describe(ch)
+	t.totalEvents.Describe(ch)
+	ch <- t.burnRateDesc
+	ch <- t.budgetRemainingDesc
+}
+
+// Collect implements prometheus.Collector; burn rates are computed at scrape time
+func (t *SLOTracker) Collect(ch chan<- prometheus.Metric) {
+	t.goodEvents.Collect(ch)
+	t.totalEvents.Collect(ch)
+
+	for _, status := range t.Report().Objectives {
+		for window, rate := range status.BurnRates {
+			ch <- prometheus.MustNewConstMetric(t.burnRateDesc, prometheus.GaugeValue, rate, t.serviceName, status.Name, window)
+		}
+		ch <- prometheus.MustNewConstMetric(t.budgetRemainingDesc, prometheus.GaugeValue, status.ErrorBudgetRemaining, t.serviceName, status.Name)
+	}
+}
+
+// Handler returns an Echo handler serving the current SLO report as JSON
+func (t *SLOTracker) Handler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.JSON(http.StatusOK, t.Report())
+	}
+}
@@ -0,0 +1,299 @@
+package metrics
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// fakeClock is a time source for an SLOTracker that only moves when told to
+type fakeClock struct{ now time.Time }
+
+func (c *fakeClock) Now() time.Time          { return c.now }
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+// minutes returns durations of the given numbers of minutes
+func minutes(values ...int) []Duration {
+	var ds []Duration
+	for _, v := range values {
+		ds = append(ds, Duration(time.Duration(v)*time.Minute))
+	}
+	return ds
+}
+
+func approx(got, want float64) bool {
+	return math.Abs(got-want) < 1e-9
+}
+
+func TestSLOStateBuckets(t *testing.T) {
+	state := &sloState{buckets: make([]sloBucket, 3)}
+	state.add(10, true)
+	state.add(11, false)
+	state.add(12, true)
+	state.add(12, true)
+
+	if good, total := state.sum(12, 3*time.Minute); good != 3 || total != 4 {
+		t.Errorf("sum over 3 minutes = %d/%d, want 3/4", good, total)
+	}
+	if good, total := state.sum(12, time.Minute); good != 2 || total != 2 {
+		t.Errorf("sum over the last minute = %d/%d, want 2/2", good, total)
+	}
+
+	// Minute 13 reuses the bucket of minute 10
+	state.add(13, false)
+	if good, total := state.sum(13, 3*time.Minute); good != 2 || total != 4 {
+		t.Errorf("sum after the ring wrapped = %d/%d, want 2/4", good, total)
+	}
+	// Windows longer than the ring only see the ring
+	if good, total := state.sum(13, time.Hour); good != 2 || total != 4 {
+		t.Errorf("sum over an hour = %d/%d, want 2/4", good, total)
+	}
+	// Buckets of minutes that have passed out of the window are skipped
+	if good, total := state.sum(20, 3*time.Minute); good != 0 || total != 0 {
+		t.Errorf("sum of stale buckets = %d/%d, want 0/0", good, total)
+	}
+	if state.good != 3 || state.total != 5 {
+		t.Errorf("lifetime counts %d/%d, want 3/5", state.good, state.total)
+	}
+}
+
+func TestBurnRate(t *testing.T) {
+	tests := []struct {
+		name        string
+		good, total uint64
+		target      float64
+		want        float64
+	}{
+		{"no events", 0, 0, 0.999, 0},
+		{"no errors", 100, 100, 0.99, 0},
+		{"errors at the allowed rate", 99, 100, 0.99, 1},
+		{"ten times the allowed rate", 990, 1000, 0.999, 10},
+		{"every request failed", 0, 10, 0.9, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := burnRate(tt.good, tt.total, tt.target); !approx(got, tt.want) {
+				t.Errorf("burnRate(%d, %d, %v) = %v, want %v", tt.good, tt.total, tt.target, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSLOTracker(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1_700_000_000, 0)}
+	tracker := NewSLOTracker("test-service", &SLOConfig{
+		Windows: minutes(5, 60),
+		Objectives: []SLO{
+			{Name: "create", Method: "POST", Path: "/items", Target: 0.99, LatencyThreshold: Duration(100 * time.Millisecond)},
+			{Name: "all", Path: "*", Target: 0.9},
+		},
+	}, nil)
+	tracker.now = clock.Now
+
+	// Half an hour ago: 196 good requests, 2 server errors and 2 slow requests
+	for i := 0; i < 196; i++ {
+		tracker.Observe("POST", "/items", http.StatusCreated, 10*time.Millisecond)
+	}
+	tracker.Observe("POST", "/items", http.StatusInternalServerError, 10*time.Millisecond)
+	tracker.Observe("POST", "/items", http.StatusServiceUnavailable, 10*time.Millisecond)
+	tracker.Observe("POST", "/items", http.StatusCreated, time.Second)
+	tracker.Observe("POST", "/items", http.StatusCreated, time.Second)
+
+	// Now: only good requests; client errors do not burn the budget
+	clock.Advance(30 * time.Minute)
+	for i := 0; i < 100; i++ {
+		tracker.Observe("POST", "/items", http.StatusBadRequest, 10*time.Millisecond)
+	}
+	// Other methods, routes and unmatched requests are not covered by "create"
+	tracker.Observe("GET", "/items", http.StatusInternalServerError, 0)
+	tracker.Observe("POST", UnmatchedRouteLabel, http.StatusInternalServerError, 0)
+
+	report := tracker.Report()
+	if report.Service != "test-service" || len(report.Objectives) != 2 {
+		t.Fatalf("report %+v", report)
+	}
+	create, all := report.Objectives[0], report.Objectives[1]
+
+	if create.GoodEvents != 296 || create.TotalEvents != 300 {
+		t.Errorf("create counted %d/%d, want 296/300", create.GoodEvents, create.TotalEvents)
+	}
+	// No errors in the last 5 minutes; 4 of 300 over the hour against a 1% budget
+	if got := create.BurnRates["5m0s"]; !approx(got, 0) {
+		t.Errorf("5m burn rate %v, want 0", got)
+	}
+	if got, want := create.BurnRates["1h0m0s"], (4.0/300)/0.01; !approx(got, want) {
+		t.Errorf("1h burn rate %v, want %v", got, want)
+	}
+	if got, want := create.ErrorBudgetRemaining, 1-(4.0/300)/0.01; !approx(got, want) {
+		t.Errorf("error budget remaining %v, want %v", got, want)
+	}
+
+	// The catch-all objective ignores latency and sees the GET, but not the unmatched request
+	if all.GoodEvents != 298 || all.TotalEvents != 301 {
+		t.Errorf("all counted %d/%d, want 298/301", all.GoodEvents, all.TotalEvents)
+	}
+
+	// An hour later the events have left every window
+	clock.Advance(time.Hour)
+	for _, status := range tracker.Report().Objectives {
+		if status.ErrorBudgetRemaining != 1 || status.BurnRates["1h0m0s"] != 0 {
+			t.Errorf("%s an hour later: %+v", status.Name, status)
+		}
+	}
+
+	if got := testutil.ToFloat64(tracker.goodEvents.WithLabelValues("test-service", "create")); got != 296 {
+		t.Errorf("slo_good_events_total %v", got)
+	}
+	if got := testutil.ToFloat64(tracker.totalEvents.WithLabelValues("test-service", "create")); got != 300 {
+		t.Errorf("slo_events_total %v", got)
+	}
+	if got := testutil.CollectAndCount(tracker, "slo_burn_rate"); got != 4 {
+		t.Errorf("%d burn rate gauges, want 2 objectives x 2 windows", got)
+	}
+}
+
+func TestLoadSLOConfig(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		want    *SLOConfig
+		wantErr string
+	}{
+		{
+			name: "yaml",
+			path: write("slo.yaml", "service: svc\nwindows: [5m, 1h]\nobjectives:\n  - name: login\n    method: POST\n    path: /login\n    target: 0.999\n    latency_threshold: 300ms\n"),
+			want: &SLOConfig{Service: "svc", Windows: minutes(5, 60), Objectives: []SLO{
+				{Name: "login", Method: "POST", Path: "/login", Target: 0.999, LatencyThreshold: Duration(300 * time.Millisecond)},
+			}},
+		},
+		{
+			name: "json",
+			path: write("slo.json", `{"service": "svc", "objectives": [{"name": "all", "path": "*", "target": 0.99, "latency_threshold": "1s"}]}`),
+			want: &SLOConfig{Service: "svc", Objectives: []SLO{{Name: "all", Path: "*", Target: 0.99, LatencyThreshold: Duration(time.Second)}}},
+		},
+		{
+			name: "a missing file declares no objectives",
+			path: filepath.Join(dir, "missing.yaml"),
+			want: &SLOConfig{},
+		},
+		{
+			name:    "unparsable file",
+			path:    write("broken.yaml", "objectives: [name: login"),
+			wantErr: "failed to parse SLO config",
+		},
+		{
+			name:    "invalid duration",
+			path:    write("duration.yaml", "objectives:\n  - name: login\n    path: /login\n    target: 0.9\n    latency_threshold: fast\n"),
+			wantErr: `invalid duration "fast"`,
+		},
+		{
+			name:    "target out of range",
+			path:    write("target.yaml", "objectives:\n  - name: login\n    path: /login\n    target: 1\n"),
+			wantErr: "target must be between 0 and 1",
+		},
+		{
+			name:    "duplicate name",
+			path:    write("duplicate.yaml", "objectives:\n  - {name: a, path: /a, target: 0.9}\n  - {name: a, path: /b, target: 0.9}\n"),
+			wantErr: `duplicate SLO name "a"`,
+		},
+		{
+			name:    "window under a minute",
+			path:    write("window.yaml", "windows: [30s]\n"),
+			wantErr: "shorter than one minute",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LoadSLOConfig(tt.path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			gotJSON, _ := json.Marshal(got)
+			wantJSON, _ := json.Marshal(tt.want)
+			if string(gotJSON) != string(wantJSON) {
+				t.Errorf("config %s, want %s", gotJSON, wantJSON)
+			}
+		})
+	}
+}
+
+func TestSLOHandler(t *testing.T) {
+	get := func(t *testing.T, m *HTTPMetrics) SLOReport {
+		t.Helper()
+		e := echo.New()
+		e.Use(m.Middleware())
+		e.POST("/items", func(c echo.Context) error { return c.NoContent(http.StatusCreated) })
+		e.GET("/slo", m.SLOHandler())
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/items", nil))
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/slo", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status %d", rec.Code)
+		}
+		var report SLOReport
+		if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+			t.Fatalf("%v: %s", err, rec.Body)
+		}
+		return report
+	}
+
+	t.Run("objectives", func(t *testing.T) {
+		m, err := NewHTTPMetrics("test-service", WithRegistry(prometheus.NewRegistry()), WithSLOs(&SLOConfig{
+			Objectives: []SLO{{Name: "create", Method: "POST", Path: "/items", Target: 0.99}},
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		report := get(t, m)
+		if report.Service != "test-service" || len(report.Objectives) != 1 {
+			t.Fatalf("report %+v", report)
+		}
+		create := report.Objectives[0]
+		if create.Name != "create" || create.GoodEvents != 1 || create.TotalEvents != 1 || create.ErrorBudgetRemaining != 1 {
+			t.Errorf("objective %+v", create)
+		}
+		if len(create.BurnRates) != len(DefaultBurnRateWindows) {
+			t.Errorf("burn rates %v for the default windows", create.BurnRates)
+		}
+	})
+
+	t.Run("no objectives", func(t *testing.T) {
+		m, err := NewHTTPMetrics("test-service", WithRegistry(prometheus.NewRegistry()), WithSLOs(&SLOConfig{}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.SLOTracker != nil {
+			t.Error("tracker created without objectives")
+		}
+		if report := get(t, m); report.Service != "test-service" || report.Objectives == nil || len(report.Objectives) != 0 {
+			t.Errorf("report %+v", report)
+		}
+	})
+}
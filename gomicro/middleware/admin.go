@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	apperrors "github.com/suteetoe/gomicro/errors"
+	"github.com/suteetoe/gomicro/logger"
+)
+
+// AdminTokenMiddleware creates a middleware that only admits requests bearing the shared admin token.
+// Every request is rejected when token is empty, so admin endpoints stay closed unless configured.
+func AdminTokenMiddleware(token string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			log := logger.FromEcho(c)
+
+			if token == "" {
+				log.Warn("Admin endpoint called but no admin token is configured")
+				return apperrors.Forbidden("Admin endpoints are disabled")
+			}
+
+			provided, ok := strings.CutPrefix(c.Request().Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+				log.Warn("Invalid admin token")
+				return apperrors.Unauthorized("Invalid admin token")
+			}
+
+			return next(c)
+		}
+	}
+}
@@ -1,10 +1,11 @@
 package middleware
 
 import (
-	"net/http"
 	"strings"
 
 	"github.com/labstack/echo/v4"
+	"github.com/suteetoe/gomicro/database"
+	apperrors "github.com/suteetoe/gomicro/errors"
 	"github.com/suteetoe/gomicro/jwtutil"
 	"github.com/suteetoe/gomicro/logger"
 	"go.uber.org/zap"
@@ -20,27 +21,32 @@ func JWTAuthMiddleware(jwtUtil *jwtutil.JWTUtil) echo.MiddlewareFunc {
 			authHeader := c.Request().Header.Get("Authorization")
 			if authHeader == "" {
 				log.Warn("Missing authorization header")
-				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Missing authorization header"})
+				return apperrors.Unauthorized("Missing authorization header")
 			}
 
 			// Check if the header format is valid
 			parts := strings.Split(authHeader, " ")
 			if len(parts) != 2 || parts[0] != "Bearer" {
 				log.Warn("Invalid authorization header format")
-				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid authorization header format"})
+				return apperrors.Unauthorized("Invalid authorization header format")
 			}
 
 			tokenString := parts[1]
 
 			// Validate the token
-			claims, err := jwtUtil.ValidateToken(tokenString)
+			claims, err := jwtUtil.ValidateTokenContext(c.Request().Context(), tokenString)
 			if err != nil {
 				log.Warn("Invalid or expired token", zap.Error(err))
-				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid or expired token"})
+				return apperrors.Unauthorized("Invalid or expired token")
 			}
 
 			// Store the claims in the context for later use
 			c.Set("user", claims)
+
+			// Scope database statements of the request to the tenant of the token
+			if claims.TenantID != nil {
+				c.SetRequest(c.Request().WithContext(database.WithTenant(c.Request().Context(), *claims.TenantID)))
+			}
 			log.Debug("JWT token validated successfully",
 				zap.Uint("user_id", claims.UserID),
 				zap.String("email", claims.Email))
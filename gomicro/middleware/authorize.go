@@ -0,0 +1,338 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	apperrors "github.com/suteetoe/gomicro/errors"
+	"github.com/suteetoe/gomicro/jwtutil"
+	"github.com/suteetoe/gomicro/logger"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// Policy maps tenant roles, and the OAuth scopes of tokens, to the permissions they grant.
+// Permissions have the form "resource:action"; "resource:*" grants every action on a resource
+// and "*" grants everything.
+type Policy struct {
+	Roles map[string][]string `json:"roles" yaml:"roles"`
+	// Scopes maps OAuth scopes to permissions, for callers authenticated by an OAuth token
+	Scopes map[string][]string `json:"scopes" yaml:"scopes"`
+}
+
+// DefaultPolicy is used when no policy file is configured. Owners may do everything, admins
+// everything on tenant resources, and members everything but deleting. OAuth tokens may read
+// with the read scope, create and update with the write scope, and delete only with the admin
+// scope.
+func DefaultPolicy() *Policy {
+	return &Policy{Roles: map[string][]string{
+		"owner": {"*"},
+		"admin": {"product:*", "category:*", "supplier:*", "merchant:*", "tenant_user:manage"},
+		"member": {
+			"product:read", "product:create", "product:update",
+			"category:read", "category:create", "category:update",
+			"supplier:read", "supplier:create", "supplier:update",
+			"merchant:read", "merchant:create",
+		},
+	}, Scopes: map[string][]string{
+		"read": {"product:read", "category:read", "supplier:read", "merchant:read"},
+		"write": {
+			"product:create", "product:update",
+			"category:create", "category:update",
+			"supplier:create", "supplier:update",
+			"merchant:create",
+		},
+		"product:read":  {"product:read", "category:read"},
+		"product:write": {"product:create", "product:update", "category:create", "category:update"},
+		"admin":         {"product:*", "category:*", "supplier:*", "merchant:*"},
+	}}
+}
+
+// LoadPolicy reads a policy from a YAML or JSON file, e.g. from AUTHZ_POLICY_PATH. An empty
+// path returns DefaultPolicy.
+func LoadPolicy(path string) (*Policy, error) {
+	if path == "" {
+		return DefaultPolicy(), nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read authorization policy: %w", err)
+	}
+
+	policy := &Policy{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(data, policy)
+	default:
+		err = yaml.Unmarshal(data, policy)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse authorization policy %s: %w", path, err)
+	}
+
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// Validate checks that every permission is well formed
+func (p *Policy) Validate() error {
+	if err := validateGrants("role", p.Roles); err != nil {
+		return err
+	}
+	return validateGrants("scope", p.Scopes)
+}
+
+// validateGrants checks the permissions granted by each role or scope
+func validateGrants(kind string, grants map[string][]string) error {
+	for name, permissions := range grants {
+		if name == "" {
+			return fmt.Errorf("authorization policy has a %s without a name", kind)
+		}
+		for _, permission := range permissions {
+			if permission == "*" {
+				continue
+			}
+			resource, action, ok := strings.Cut(permission, ":")
+			if !ok || resource == "" || action == "" || strings.Contains(action, ":") {
+				return fmt.Errorf("%s %q has malformed permission %q, want resource:action", kind, name, permission)
+			}
+		}
+	}
+	return nil
+}
+
+// Allows reports whether role grants permission
+func (p *Policy) Allows(role, permission string) bool {
+	return grants(p.Roles[role], permission)
+}
+
+// CanGrant reports whether a caller with role granter may give role to another user: role must
+// be in the policy and every permission of role must be granted to granter as well, so that no
+// one can hand out more than they hold.
+func (p *Policy) CanGrant(granter, role string) bool {
+	permissions, ok := p.Roles[role]
+	if !ok {
+		return false
+	}
+	for _, permission := range permissions {
+		if !grants(p.Roles[granter], permission) {
+			return false
+		}
+	}
+	return true
+}
+
+// ScopesAllow reports whether one of scopes grants permission
+func (p *Policy) ScopesAllow(scopes []string, permission string) bool {
+	for _, scope := range scopes {
+		if grants(p.Scopes[scope], permission) {
+			return true
+		}
+	}
+	return false
+}
+
+// grants reports whether one of granted covers permission
+func grants(granted []string, permission string) bool {
+	resource, _, _ := strings.Cut(permission, ":")
+	for _, g := range granted {
+		if g == "*" || g == permission || g == resource+":*" {
+			return true
+		}
+	}
+	return false
+}
+
+// RoleFunc returns the tenant role of the caller, if any
+type RoleFunc func(c echo.Context) (string, bool)
+
+// RoleFromContext reads the role stored under key by a service's auth middleware
+func RoleFromContext(key string) RoleFunc {
+	return func(c echo.Context) (string, bool) {
+		role, ok := c.Get(key).(string)
+		return role, ok && role != ""
+	}
+}
+
+// RoleFromClaims reads the role of the claims stored by JWTAuthMiddleware
+func RoleFromClaims() RoleFunc {
+	return func(c echo.Context) (string, bool) {
+		claims, ok := c.Get("user").(*jwtutil.UserClaims)
+		if !ok || claims.Role == "" {
+			return "", false
+		}
+		return claims.Role, true
+	}
+}
+
+// ScopesFunc returns the OAuth scopes of the caller, if it authenticated with an OAuth token
+type ScopesFunc func(c echo.Context) []string
+
+// ScopesFromContext reads the space separated scopes stored under key by a service's OAuth
+// middleware
+func ScopesFromContext(key string) ScopesFunc {
+	return func(c echo.Context) []string {
+		switch scopes := c.Get(key).(type) {
+		case string:
+			return strings.Fields(scopes)
+		case []string:
+			return scopes
+		}
+		return nil
+	}
+}
+
+// AuthorizerOption configures an Authorizer
+type AuthorizerOption func(*Authorizer)
+
+// WithAuthorizerRegisterer registers the denial counter on registerer instead of the global registry
+func WithAuthorizerRegisterer(registerer prometheus.Registerer) AuthorizerOption {
+	return func(a *Authorizer) {
+		a.registerer = registerer
+	}
+}
+
+// WithScopes also authorizes callers by their OAuth scopes, mapped to permissions by the Scopes
+// of the policy
+func WithScopes(scopes ScopesFunc) AuthorizerOption {
+	return func(a *Authorizer) {
+		a.scopes = scopes
+	}
+}
+
+// Authorizer checks the tenant role of callers, and with WithScopes the scopes of their OAuth
+// token, against a Policy. It runs after the auth middleware that stores them.
+type Authorizer struct {
+	service    string
+	policy     *Policy
+	role       RoleFunc
+	scopes     ScopesFunc
+	registerer prometheus.Registerer
+
+	// DenialCounter counts denied requests per route and requirement
+	DenialCounter *prometheus.CounterVec
+}
+
+// NewAuthorizer creates an authorizer for service and registers its metrics
+func NewAuthorizer(service string, policy *Policy, role RoleFunc, opts ...AuthorizerOption) (*Authorizer, error) {
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	a := &Authorizer{
+		service:    service,
+		policy:     policy,
+		role:       role,
+		registerer: prometheus.DefaultRegisterer,
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	a.DenialCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "authorization_denials_total",
+		Help: "Total number of requests denied by role or permission checks",
+	}, []string{"service", "method", "path", "requirement"})
+	if err := a.registerer.Register(a.DenialCounter); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Allows reports whether role grants permission under the policy
+func (a *Authorizer) Allows(role, permission string) bool {
+	return a.policy.Allows(role, permission)
+}
+
+// CanGrant reports whether granter may give role to another user under the policy
+func (a *Authorizer) CanGrant(granter, role string) bool {
+	return a.policy.CanGrant(granter, role)
+}
+
+// RequireRole admits callers having one of roles
+func (a *Authorizer) RequireRole(roles ...string) echo.MiddlewareFunc {
+	requirement := "role:" + strings.Join(roles, "|")
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			role, _ := a.role(c)
+			for _, allowed := range roles {
+				if role == allowed {
+					return next(c)
+				}
+			}
+			return a.deny(c, requirement, "required_roles", roles)
+		}
+	}
+}
+
+// RequirePermission admits callers granted every one of permissions. A caller with a role needs
+// it to grant them, a caller with OAuth scopes needs one of its scopes to grant them, and a
+// caller with both needs both.
+func (a *Authorizer) RequirePermission(permissions ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			for _, permission := range permissions {
+				if !a.permitted(c, permission) {
+					return a.Deny(c, permission)
+				}
+			}
+			return next(c)
+		}
+	}
+}
+
+// permitted reports whether the role and scopes of the caller grant permission
+func (a *Authorizer) permitted(c echo.Context, permission string) bool {
+	role, hasRole := a.role(c)
+	var scopes []string
+	if a.scopes != nil {
+		scopes = a.scopes(c)
+	}
+	if !hasRole && len(scopes) == 0 {
+		return false
+	}
+	if hasRole && !a.policy.Allows(role, permission) {
+		return false
+	}
+	return len(scopes) == 0 || a.policy.ScopesAllow(scopes, permission)
+}
+
+// Deny returns the 403 error of a caller lacking permission and counts the denial. Handlers use it
+// for checks that depend on the request, e.g. the caller's role in another tenant.
+func (a *Authorizer) Deny(c echo.Context, permission string) error {
+	return a.deny(c, "permission:"+permission, "required_permission", permission)
+}
+
+// DenyGrant returns the 403 error of a caller giving a role they may not grant, see CanGrant,
+// and counts the denial
+func (a *Authorizer) DenyGrant(c echo.Context, role string) error {
+	return a.deny(c, "grant:"+role, "role", role)
+}
+
+// deny returns the 403 error shared by every denial, naming what was required under key
+func (a *Authorizer) deny(c echo.Context, requirement, key string, required interface{}) error {
+	role, _ := a.role(c)
+	// Services with their own logger package may not have initialized the gomicro logger
+	if log := logger.FromEcho(c); log != nil {
+		log.Warn("Request denied by authorization policy",
+			zap.String("role", role),
+			zap.String("requirement", requirement))
+	}
+	a.DenialCounter.WithLabelValues(a.service, c.Request().Method, routePath(c), requirement).Inc()
+
+	return apperrors.Forbidden("insufficient permissions").With(key, required)
+}
+
+// routePath returns the route pattern, so that the path label stays bounded
+func routePath(c echo.Context) string {
+	if path := c.Path(); path != "" {
+		return path
+	}
+	return "unmatched"
+}
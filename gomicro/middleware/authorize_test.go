@@ -0,0 +1,198 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	apperrors "github.com/suteetoe/gomicro/errors"
+)
+
+func TestPolicyAllows(t *testing.T) {
+	policy := DefaultPolicy()
+	cases := []struct {
+		role, permission string
+		want             bool
+	}{
+		{"owner", "supplier:delete", true},
+		{"admin", "supplier:delete", true},
+		{"admin", "audit:read", false},
+		{"member", "supplier:read", true},
+		{"member", "supplier:delete", false},
+		{"", "supplier:read", false},
+	}
+	for _, tc := range cases {
+		if got := policy.Allows(tc.role, tc.permission); got != tc.want {
+			t.Errorf("Allows(%q, %q) = %v, want %v", tc.role, tc.permission, got, tc.want)
+		}
+	}
+
+	if err := (&Policy{Roles: map[string][]string{"member": {"supplier"}}}).Validate(); err == nil {
+		t.Error("accepted a permission without an action")
+	}
+}
+
+func TestPolicyCanGrant(t *testing.T) {
+	policy := DefaultPolicy()
+	policy.Roles["auditor"] = []string{"audit:read"}
+	cases := []struct {
+		granter, role string
+		want          bool
+	}{
+		{"owner", "owner", true},
+		{"owner", "auditor", true},
+		{"admin", "admin", true},
+		{"admin", "member", true},
+		// Admins hold neither "*" nor audit:read
+		{"admin", "owner", false},
+		{"admin", "auditor", false},
+		// Whether members may add users at all is up to tenant_user:manage
+		{"member", "member", true},
+		{"member", "admin", false},
+		{"owner", "superuser", false},
+		{"owner", "", false},
+		{"", "member", false},
+	}
+	for _, tc := range cases {
+		if got := policy.CanGrant(tc.granter, tc.role); got != tc.want {
+			t.Errorf("CanGrant(%q, %q) = %v, want %v", tc.granter, tc.role, got, tc.want)
+		}
+	}
+}
+
+func TestDenyGrant(t *testing.T) {
+	authz, err := NewAuthorizer("test-service", DefaultPolicy(), RoleFromContext("role"),
+		WithAuthorizerRegisterer(prometheus.NewRegistry()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := echo.New()
+	e.HTTPErrorHandler = apperrors.NewHTTPErrorHandler()
+	e.POST("/tenant-users", func(c echo.Context) error {
+		role := c.Request().Header.Get("X-Grant")
+		if !authz.CanGrant(c.Request().Header.Get("X-Role"), role) {
+			return authz.DenyGrant(c, role)
+		}
+		return c.NoContent(http.StatusCreated)
+	})
+
+	for _, tc := range []struct {
+		role, grant string
+		want        int
+	}{
+		{"owner", "admin", http.StatusCreated},
+		{"admin", "member", http.StatusCreated},
+		{"admin", "owner", http.StatusForbidden},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/tenant-users", nil)
+		req.Header.Set("X-Role", tc.role)
+		req.Header.Set("X-Grant", tc.grant)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("%s granting %s: status %d, want %d", tc.role, tc.grant, rec.Code, tc.want)
+		}
+		if rec.Code == http.StatusForbidden {
+			var body map[string]interface{}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body["role"] != tc.grant {
+				t.Errorf("%s granting %s: unexpected denial body %s", tc.role, tc.grant, rec.Body.String())
+			}
+		}
+	}
+
+	denials := testutil.ToFloat64(authz.DenialCounter.WithLabelValues("test-service", http.MethodPost, "/tenant-users", "grant:owner"))
+	if denials != 1 {
+		t.Errorf("recorded %v denials, want 1", denials)
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	authz, err := NewAuthorizer("test-service", DefaultPolicy(), RoleFromContext("role"),
+		WithAuthorizerRegisterer(prometheus.NewRegistry()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := echo.New()
+	e.HTTPErrorHandler = apperrors.NewHTTPErrorHandler()
+	e.DELETE("/suppliers/:id", func(c echo.Context) error {
+		return c.NoContent(http.StatusNoContent)
+	}, func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set("role", c.Request().Header.Get("X-Role"))
+			return next(c)
+		}
+	}, authz.RequirePermission("supplier:delete"))
+
+	for role, want := range map[string]int{"admin": http.StatusNoContent, "member": http.StatusForbidden, "": http.StatusForbidden} {
+		req := httptest.NewRequest(http.MethodDelete, "/suppliers/1", nil)
+		req.Header.Set("X-Role", role)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("role %q: status %d, want %d", role, rec.Code, want)
+		}
+		if rec.Code == http.StatusForbidden {
+			var body map[string]interface{}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body["required_permission"] != "supplier:delete" {
+				t.Errorf("role %q: unexpected denial body %s", role, rec.Body.String())
+			}
+		}
+	}
+
+	denials := testutil.ToFloat64(authz.DenialCounter.WithLabelValues("test-service", http.MethodDelete, "/suppliers/:id", "permission:supplier:delete"))
+	if denials != 2 {
+		t.Errorf("recorded %v denials, want 2", denials)
+	}
+}
+
+func TestRequirePermissionByScope(t *testing.T) {
+	authz, err := NewAuthorizer("test-service", DefaultPolicy(), RoleFromContext("role"),
+		WithScopes(ScopesFromContext("token_scopes")), WithAuthorizerRegisterer(prometheus.NewRegistry()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := echo.New()
+	e.HTTPErrorHandler = apperrors.NewHTTPErrorHandler()
+	e.DELETE("/products/:id", func(c echo.Context) error {
+		return c.NoContent(http.StatusNoContent)
+	}, func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if role := c.Request().Header.Get("X-Role"); role != "" {
+				c.Set("role", role)
+			}
+			c.Set("token_scopes", c.Request().Header.Get("X-Scopes"))
+			return next(c)
+		}
+	}, authz.RequirePermission("product:delete"))
+
+	cases := []struct {
+		role, scopes string
+		want         int
+	}{
+		{"", "read write", http.StatusForbidden},
+		{"", "read admin", http.StatusNoContent},
+		{"", "", http.StatusForbidden},
+		// A token acting for a user is limited by both its role and its scopes
+		{"member", "admin", http.StatusForbidden},
+		{"owner", "write", http.StatusForbidden},
+		{"owner", "admin", http.StatusNoContent},
+		{"owner", "", http.StatusNoContent},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodDelete, "/products/1", nil)
+		req.Header.Set("X-Role", tc.role)
+		req.Header.Set("X-Scopes", tc.scopes)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("role %q, scopes %q: status %d, want %d", tc.role, tc.scopes, rec.Code, tc.want)
+		}
+	}
+}
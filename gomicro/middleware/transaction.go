@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/suteetoe/gomicro/database"
+	apperrors "github.com/suteetoe/gomicro/errors"
+	"github.com/suteetoe/gomicro/logger"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// TenantTransaction runs every request with a tenant in a transaction started by
+// database.BeginTenant, which runs SET LOCAL app.tenant_id for the row level security policies.
+// Statements made with the request context join the transaction through database.RLSPlugin.
+// The transaction commits when the handler succeeds and rolls back on an error or a 4xx/5xx
+// response. The response is held back until the commit, so that a failed commit is not
+// reported as a success. Requests without a tenant pass through unchanged; the policies hide
+// every row from them. Use it after the authentication middleware.
+func TenantTransaction(db *gorm.DB) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			ctx := c.Request().Context()
+			if _, ok := database.TenantFromContext(ctx); !ok {
+				return next(c)
+			}
+
+			log := logger.FromEcho(c)
+			tx, err := database.BeginTenant(ctx, db)
+			if err != nil {
+				log.Error("Failed to begin tenant transaction", zap.Error(err))
+				return apperrors.Internal("Database unavailable", err)
+			}
+
+			res := c.Response()
+			buffered := &bufferedWriter{ResponseWriter: res.Writer}
+			res.Writer = buffered
+			c.SetRequest(c.Request().WithContext(database.WithTx(ctx, tx)))
+			defer func() {
+				if r := recover(); r != nil {
+					res.Writer = buffered.ResponseWriter
+					tx.Rollback()
+					panic(r)
+				}
+			}()
+
+			err = next(c)
+			res.Writer = buffered.ResponseWriter
+
+			if err != nil || res.Status >= http.StatusBadRequest {
+				if rbErr := tx.Rollback().Error; rbErr != nil {
+					log.Warn("Failed to roll back tenant transaction", zap.Error(rbErr))
+				}
+				buffered.flush()
+				return err
+			}
+
+			if err := tx.Commit().Error; err != nil {
+				log.Error("Failed to commit tenant transaction", zap.Error(err))
+				// Drop the held back response; the error handler answers instead
+				res.Committed = false
+				res.Size = 0
+				res.Header().Del(echo.HeaderContentLength)
+				return apperrors.Internal("Failed to save changes", err)
+			}
+			buffered.flush()
+			return nil
+		}
+	}
+}
+
+// bufferedWriter holds back the status and body of a response; headers go to the underlying
+// writer, which does not send them before WriteHeader
+type bufferedWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferedWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *bufferedWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(b)
+}
+
+// Flush keeps http.Flusher from reaching the underlying writer before the commit
+func (w *bufferedWriter) Flush() {}
+
+// flush sends the held back response, if the handler wrote one
+func (w *bufferedWriter) flush() {
+	if w.status == 0 {
+		return
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	w.ResponseWriter.Write(w.body.Bytes())
+}
@@ -0,0 +1,90 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// Usage describes the subcommands accepted by Run
+const Usage = `usage: migrate <command>
+
+commands:
+  up          apply all pending migrations
+  down [n]    roll back the latest n applied migrations (default 1)
+  status      list migrations and when they were applied
+  redo        roll back and re-apply the latest applied migration`
+
+// Run executes a migrate subcommand, e.g. the arguments after `product-service migrate`
+func Run(ctx context.Context, m *Migrator, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing migrate command\n%s", Usage)
+	}
+
+	switch args[0] {
+	case "up":
+		count, err := m.Up(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "applied %d migration(s)\n", count)
+		return nil
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("down expects a positive number of steps, got %q", args[1])
+			}
+			steps = n
+		}
+		count, err := m.Down(ctx, steps)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "rolled back %d migration(s)\n", count)
+		return nil
+
+	case "redo":
+		if err := m.Redo(ctx); err != nil {
+			return err
+		}
+		fmt.Fprintln(out, "redid the latest migration")
+		return nil
+
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format(time.RFC3339)
+			}
+			if s.Missing {
+				applied += " (missing from code)"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		return w.Flush()
+
+	default:
+		return fmt.Errorf("unknown migrate command %q\n%s", args[0], Usage)
+	}
+}
+
+// Command runs `migrate <command>` when args, usually os.Args[1:], start with "migrate".
+// It reports whether it ran so that the service can exit instead of starting its server.
+func Command(ctx context.Context, m *Migrator, args []string, out io.Writer) (bool, error) {
+	if len(args) == 0 || args[0] != "migrate" {
+		return false, nil
+	}
+	return true, Run(ctx, m, args[1:], out)
+}
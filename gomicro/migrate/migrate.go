@@ -0,0 +1,376 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/suteetoe/gomicro/database"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Migration is one versioned schema change. Up and Down run in a transaction.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// SQL returns a migration running the given up and down statements
+func SQL(version int64, name, up, down string) Migration {
+	m := Migration{Version: version, Name: name, Up: execSQL(up)}
+	if down != "" {
+		m.Down = execSQL(down)
+	}
+	return m
+}
+
+func execSQL(statements string) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		return tx.Exec(statements).Error
+	}
+}
+
+// FromFS loads SQL migrations named <version>_<name>.up.sql and <version>_<name>.down.sql from dir
+func FromFS(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		file := entry.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(file, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(file, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+
+		base := strings.TrimSuffix(file, "."+direction+".sql")
+		versionText, name, _ := strings.Cut(base, "_")
+		version, err := strconv.ParseInt(versionText, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s does not start with a version number", file)
+		}
+		data, err := fs.ReadFile(fsys, path.Join(dir, file))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", file, err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.Up = execSQL(string(data))
+		} else {
+			m.Down = execSQL(string(data))
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == nil {
+			return nil, fmt.Errorf("migration %d_%s has no up file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	return migrations, nil
+}
+
+// Record is a row of the schema_migrations table
+type Record struct {
+	Service   string    `gorm:"primaryKey;size:64"`
+	Version   int64     `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"size:255"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+// TableName overrides the table name used by Record
+func (Record) TableName() string {
+	return "schema_migrations"
+}
+
+// Status describes one migration known to the code or recorded in the database
+type Status struct {
+	Version   int64
+	Name      string
+	AppliedAt *time.Time
+	// Missing is set for versions recorded in the database but not known to the code
+	Missing bool
+}
+
+// Option configures a Migrator
+type Option func(*Migrator)
+
+// WithLogger logs every applied and rolled back migration
+func WithLogger(log *zap.Logger) Option {
+	return func(m *Migrator) {
+		m.log = log
+	}
+}
+
+// WithTenantRLS makes Up enable and force row level security on tables when enabled is set, e.g.
+// by DB_TENANT_RLS, and disable it otherwise, so that the TenantPolicies of the tables only apply
+// in RLS mode
+func WithTenantRLS(enabled bool, tables ...string) Option {
+	return func(m *Migrator) {
+		m.rls = enabled
+		m.rlsTables = tables
+	}
+}
+
+// Migrator applies the migrations of one service. Services sharing a database keep separate
+// histories in schema_migrations and take separate advisory locks.
+type Migrator struct {
+	db         *gorm.DB
+	service    string
+	migrations []Migration
+	log        *zap.Logger
+	rls        bool
+	rlsTables  []string
+}
+
+// New creates a migrator for service
+func New(db *gorm.DB, service string, migrations []Migration, opts ...Option) (*Migrator, error) {
+	sorted := append([]Migration{}, migrations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+	for i, m := range sorted {
+		if m.Version <= 0 || m.Up == nil {
+			return nil, fmt.Errorf("migration %d_%s needs a positive version and an up step", m.Version, m.Name)
+		}
+		if i > 0 && sorted[i-1].Version == m.Version {
+			return nil, fmt.Errorf("duplicate migration version %d", m.Version)
+		}
+	}
+
+	m := &Migrator{db: db, service: service, migrations: sorted, log: zap.NewNop()}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m, nil
+}
+
+// lockKey is the advisory lock of the service
+func (m *Migrator) lockKey() int64 {
+	h := fnv.New64a()
+	h.Write([]byte("gomicro/migrate:" + m.service))
+	return int64(h.Sum64())
+}
+
+// locked runs fn on a single connection holding the service's advisory lock, so that only one
+// replica migrates at a time; the others wait and then find nothing pending
+func (m *Migrator) locked(ctx context.Context, fn func(conn *gorm.DB) error) error {
+	// Migrations maintain every tenant's rows, so they run outside the tenant scope
+	ctx = database.WithoutTenantScope(ctx)
+	return m.db.WithContext(ctx).Connection(func(conn *gorm.DB) error {
+		// Every statement on the connection starts without the conditions of the previous one
+		conn = conn.Session(&gorm.Session{NewDB: true})
+		if err := conn.Exec("SELECT pg_advisory_lock(?)", m.lockKey()).Error; err != nil {
+			return fmt.Errorf("failed to acquire migration lock: %w", err)
+		}
+		defer conn.Exec("SELECT pg_advisory_unlock(?)", m.lockKey())
+
+		if err := conn.AutoMigrate(&Record{}); err != nil {
+			return fmt.Errorf("failed to create schema_migrations: %w", err)
+		}
+		return fn(conn)
+	})
+}
+
+// applied returns the recorded migrations of the service by version
+func (m *Migrator) applied(conn *gorm.DB) (map[int64]Record, error) {
+	var records []Record
+	if err := conn.Where("service = ?", m.service).Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	applied := make(map[int64]Record, len(records))
+	for _, r := range records {
+		applied[r.Version] = r
+	}
+	return applied, nil
+}
+
+// Pending returns the migrations that are not applied yet, in version order. Unlike Status it
+// does not wait for the migration lock, so that readiness checks stay fast during a migration.
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	conn := m.db.WithContext(database.WithoutTenantScope(ctx))
+	applied, err := m.applied(conn)
+	if err != nil {
+		return nil, err
+	}
+	var pending []Migration
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; !ok {
+			pending = append(pending, migration)
+		}
+	}
+	return pending, nil
+}
+
+// Up applies every pending migration in version order and returns how many were applied. With
+// WithTenantRLS it then switches row level security to the configured mode.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	count := 0
+	err := m.locked(ctx, func(conn *gorm.DB) error {
+		applied, err := m.applied(conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range m.migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+			if err := m.up(conn, migration); err != nil {
+				return err
+			}
+			count++
+		}
+		return m.syncTenantRLS(conn)
+	})
+	return count, err
+}
+
+// Down rolls back the latest steps applied migrations and returns how many were rolled back
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	count := 0
+	err := m.locked(ctx, func(conn *gorm.DB) error {
+		applied, err := m.applied(conn)
+		if err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0 && count < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+			if err := m.down(conn, migration); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Redo rolls back and re-applies the latest applied migration
+func (m *Migrator) Redo(ctx context.Context) error {
+	return m.locked(ctx, func(conn *gorm.DB) error {
+		applied, err := m.applied(conn)
+		if err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			migration := m.migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+			if err := m.down(conn, migration); err != nil {
+				return err
+			}
+			return m.up(conn, migration)
+		}
+		return errors.New("no applied migration to redo")
+	})
+}
+
+// Status lists every migration with the time it was applied, in version order. It waits for the
+// migration lock like Up and Down, so that an operator sees the outcome of a running migration
+// rather than a half applied history; probes use Pending, which does not wait.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var statuses []Status
+	err := m.locked(ctx, func(conn *gorm.DB) error {
+		applied, err := m.applied(conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range m.migrations {
+			status := Status{Version: migration.Version, Name: migration.Name}
+			if r, ok := applied[migration.Version]; ok {
+				status.AppliedAt = &r.AppliedAt
+				delete(applied, migration.Version)
+			}
+			statuses = append(statuses, status)
+		}
+		for _, r := range applied {
+			appliedAt := r.AppliedAt
+			statuses = append(statuses, Status{Version: r.Version, Name: r.Name, AppliedAt: &appliedAt, Missing: true})
+		}
+		sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+		return nil
+	})
+	return statuses, err
+}
+
+func (m *Migrator) up(conn *gorm.DB, migration Migration) error {
+	start := time.Now()
+	err := conn.Transaction(func(tx *gorm.DB) error {
+		if err := bypassRLS(tx); err != nil {
+			return err
+		}
+		if err := migration.Up(tx); err != nil {
+			return err
+		}
+		return tx.Create(&Record{
+			Service:   m.service,
+			Version:   migration.Version,
+			Name:      migration.Name,
+			AppliedAt: time.Now().UTC(),
+		}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("migration %d_%s failed: %w", migration.Version, migration.Name, err)
+	}
+	m.log.Info("Applied migration",
+		zap.Int64("version", migration.Version),
+		zap.String("name", migration.Name),
+		zap.Duration("duration", time.Since(start)))
+	return nil
+}
+
+func (m *Migrator) down(conn *gorm.DB, migration Migration) error {
+	if migration.Down == nil {
+		return fmt.Errorf("migration %d_%s cannot be rolled back", migration.Version, migration.Name)
+	}
+	err := conn.Transaction(func(tx *gorm.DB) error {
+		if err := bypassRLS(tx); err != nil {
+			return err
+		}
+		if err := migration.Down(tx); err != nil {
+			return err
+		}
+		return tx.Where("service = ? AND version = ?", m.service, migration.Version).Delete(&Record{}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("rollback of migration %d_%s failed: %w", migration.Version, migration.Name, err)
+	}
+	m.log.Info("Rolled back migration",
+		zap.Int64("version", migration.Version),
+		zap.String("name", migration.Name))
+	return nil
+}
+
+// bypassRLS lets a migration transaction see the rows of every tenant, including on tables
+// that force row level security on their owner
+func bypassRLS(tx *gorm.DB) error {
+	if err := tx.Exec(fmt.Sprintf("SET LOCAL %s = 'on'", database.BypassSetting)).Error; err != nil {
+		return fmt.Errorf("failed to bypass row level security: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,390 @@
+package migrate
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/suteetoe/gomicro/internal/dbtest"
+	"gorm.io/gorm"
+)
+
+// fakeDB answers the statements of a Migrator: the advisory lock, schema_migrations and the row
+// level security state of tables. Other statements are only recorded.
+type fakeDB struct {
+	records    map[int64]Record
+	rls        map[string][2]bool
+	locked     bool
+	statements []string
+}
+
+func newFakeDB() *fakeDB {
+	return &fakeDB{records: map[int64]Record{}, rls: map[string][2]bool{}}
+}
+
+func (f *fakeDB) handle(query string, args []driver.Value) (dbtest.Result, error) {
+	switch {
+	case strings.HasPrefix(query, "SELECT pg_advisory_lock"):
+		if f.locked {
+			return dbtest.Result{}, errors.New("lock already held")
+		}
+		f.locked = true
+		return dbtest.Result{}, nil
+
+	case strings.HasPrefix(query, "SELECT pg_advisory_unlock"):
+		f.locked = false
+		return dbtest.Result{}, nil
+
+	case strings.Contains(query, "information_schema.tables"):
+		return dbtest.Result{Columns: []string{"count"}, Rows: [][]driver.Value{{int64(0)}}}, nil
+
+	case strings.HasPrefix(query, `SELECT * FROM "schema_migrations"`):
+		result := dbtest.Result{Columns: []string{"service", "version", "name", "applied_at"}}
+		for _, r := range f.records {
+			if r.Service == args[0] {
+				result.Rows = append(result.Rows, []driver.Value{r.Service, r.Version, r.Name, r.AppliedAt})
+			}
+		}
+		return result, nil
+
+	case strings.HasPrefix(query, `INSERT INTO "schema_migrations"`):
+		f.records[args[1].(int64)] = Record{Service: args[0].(string), Version: args[1].(int64), Name: args[2].(string), AppliedAt: args[3].(time.Time)}
+		return dbtest.Result{RowsAffected: 1}, nil
+
+	case strings.HasPrefix(query, `DELETE FROM "schema_migrations"`):
+		delete(f.records, args[1].(int64))
+		return dbtest.Result{RowsAffected: 1}, nil
+
+	case strings.HasPrefix(query, "SELECT relrowsecurity"):
+		state := f.rls[strings.Trim(args[0].(string), `"`)]
+		return dbtest.Result{Columns: []string{"enabled", "forced"}, Rows: [][]driver.Value{{state[0], state[1]}}}, nil
+	}
+
+	f.statements = append(f.statements, query)
+	if table, ok := strings.CutPrefix(query, "ALTER TABLE "); ok {
+		name := strings.Trim(strings.Fields(table)[0], `"`)
+		f.rls[name] = [2]bool{strings.Contains(query, " ENABLE "), strings.Contains(query, " FORCE ") && !strings.Contains(query, "NO FORCE")}
+	}
+	return dbtest.Result{}, nil
+}
+
+// executed returns the recorded statements containing substr
+func (f *fakeDB) executed(substr string) []string {
+	var matches []string
+	for _, statement := range f.statements {
+		if strings.Contains(statement, substr) {
+			matches = append(matches, statement)
+		}
+	}
+	return matches
+}
+
+// table returns a migration creating a table, which its down step drops
+func table(version int64, name string) Migration {
+	return SQL(version, name, "CREATE TABLE "+name+" ()", "DROP TABLE "+name)
+}
+
+func TestTenantPolicies(t *testing.T) {
+	fake := newFakeDB()
+	m, err := New(dbtest.Open(t, fake.handle), "test-service", []Migration{
+		table(1, "items"),
+		TenantPolicies(2, "items"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The policy is installed, but without WithTenantRLS row level security stays off
+	if len(fake.executed("CREATE POLICY tenant_isolation ON \"items\"")) != 1 {
+		t.Errorf("policy not installed: %q", fake.statements)
+	}
+	if alters := fake.executed("ALTER TABLE"); len(alters) != 0 {
+		t.Errorf("row level security switched without WithTenantRLS: %q", alters)
+	}
+	// Data migrations see every tenant, even on tables forcing row level security
+	if got := len(fake.executed("SET LOCAL app.bypass_rls = 'on'")); got != 2 {
+		t.Errorf("%d migrations bypassed row level security, want 2", got)
+	}
+}
+
+func TestWithTenantRLS(t *testing.T) {
+	fake := newFakeDB()
+	db := dbtest.Open(t, fake.handle)
+	migrations := []Migration{table(1, "items"), TenantPolicies(2, "items")}
+	up := func(enabled bool) {
+		t.Helper()
+		m, err := New(db, "test-service", migrations, WithTenantRLS(enabled, "items"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := m.Up(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// RLS mode enables the policies and subjects the table owner to them
+	up(true)
+	if fake.rls["items"] != [2]bool{true, true} {
+		t.Errorf("RLS mode left the table at %v: %q", fake.rls["items"], fake.executed("ALTER TABLE"))
+	}
+
+	// A table already in the wanted state is not altered
+	fake.statements = nil
+	up(true)
+	if alters := fake.executed("ALTER TABLE"); len(alters) != 0 {
+		t.Errorf("altered a table in the wanted state: %q", alters)
+	}
+
+	// Leaving RLS mode, or a table enabled by an earlier release, turns the policies off
+	fake.rls["items"] = [2]bool{true, false}
+	up(false)
+	if fake.rls["items"] != [2]bool{false, false} {
+		t.Errorf("RLS mode off left the table at %v: %q", fake.rls["items"], fake.executed("ALTER TABLE"))
+	}
+}
+
+// failing returns a migration whose up step fails
+func failing(version int64) Migration {
+	return Migration{Version: version, Name: "failing", Up: func(tx *gorm.DB) error { return errors.New("boom") }}
+}
+
+// versions returns the recorded versions in order
+func (f *fakeDB) versions() []int64 {
+	var versions []int64
+	for version := range f.records {
+		versions = append(versions, version)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+	return versions
+}
+
+func TestNew(t *testing.T) {
+	tests := map[string][]Migration{
+		"version zero":      {table(0, "items")},
+		"no up step":        {{Version: 1, Name: "items"}},
+		"duplicate version": {table(1, "items"), table(1, "orders")},
+	}
+	for name, migrations := range tests {
+		if _, err := New(nil, "test-service", migrations); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
+
+func TestUpAndDown(t *testing.T) {
+	fake := newFakeDB()
+	ctx := context.Background()
+	// Migrations run in version order whatever order they are declared in
+	m, err := New(dbtest.Open(t, fake.handle), "test-service", []Migration{
+		table(3, "payments"),
+		table(1, "items"),
+		SQL(2, "orders", "CREATE TABLE orders ()", ""),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	applied, err := m.Up(ctx)
+	if err != nil || applied != 3 {
+		t.Fatalf("Up applied %d: %v", applied, err)
+	}
+	if got := fake.executed(" ()"); strings.Join(got, ",") != "CREATE TABLE items (),CREATE TABLE orders (),CREATE TABLE payments ()" {
+		t.Errorf("created %q", got)
+	}
+	if r := fake.records[1]; r.Service != "test-service" || r.Name != "items" || r.AppliedAt.IsZero() {
+		t.Errorf("record %+v", r)
+	}
+
+	// Applied migrations are not applied again
+	if applied, err := m.Up(ctx); err != nil || applied != 0 {
+		t.Errorf("second Up applied %d: %v", applied, err)
+	}
+
+	rolledBack, err := m.Down(ctx, 1)
+	if err != nil || rolledBack != 1 {
+		t.Fatalf("Down rolled back %d: %v", rolledBack, err)
+	}
+	if got := fake.versions(); len(got) != 2 || got[1] != 2 {
+		t.Errorf("versions %v after rolling back one step", got)
+	}
+	if len(fake.executed("DROP TABLE payments")) != 1 {
+		t.Errorf("payments not dropped: %q", fake.statements)
+	}
+
+	// A migration without a down step stops the rollback and stays recorded
+	rolledBack, err = m.Down(ctx, 2)
+	if err == nil || !strings.Contains(err.Error(), "migration 2_orders cannot be rolled back") || rolledBack != 0 {
+		t.Errorf("Down rolled back %d: %v", rolledBack, err)
+	}
+	if got := fake.versions(); len(got) != 2 {
+		t.Errorf("versions %v after a refused rollback", got)
+	}
+}
+
+func TestUpStopsAtAFailingMigration(t *testing.T) {
+	fake := newFakeDB()
+	m, err := New(dbtest.Open(t, fake.handle), "test-service", []Migration{table(1, "items"), failing(2), table(3, "orders")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	applied, err := m.Up(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "migration 2_failing failed: boom") {
+		t.Fatalf("Up error %v", err)
+	}
+	if applied != 1 {
+		t.Errorf("Up applied %d, want 1", applied)
+	}
+	if got := fake.versions(); len(got) != 1 || got[0] != 1 {
+		t.Errorf("versions %v", got)
+	}
+	if len(fake.executed("ROLLBACK")) != 1 || len(fake.executed("CREATE TABLE orders")) != 0 {
+		t.Errorf("statements %q", fake.statements)
+	}
+	if fake.locked {
+		t.Error("lock held after a failed migration")
+	}
+}
+
+func TestRedo(t *testing.T) {
+	fake := newFakeDB()
+	ctx := context.Background()
+	m, err := New(dbtest.Open(t, fake.handle), "test-service", []Migration{table(1, "items"), table(2, "orders")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Redo(ctx); err == nil || err.Error() != "no applied migration to redo" {
+		t.Errorf("Redo without applied migrations: %v", err)
+	}
+
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	fake.statements = nil
+	if err := m.Redo(ctx); err != nil {
+		t.Fatal(err)
+	}
+	var schema []string
+	for _, statement := range fake.statements {
+		if strings.Contains(statement, "TABLE orders") {
+			schema = append(schema, statement)
+		} else if strings.Contains(statement, "TABLE items") {
+			t.Errorf("redo touched an earlier migration: %s", statement)
+		}
+	}
+	if strings.Join(schema, ",") != "DROP TABLE orders,CREATE TABLE orders ()" {
+		t.Errorf("redo ran %q", schema)
+	}
+	if got := fake.versions(); len(got) != 2 {
+		t.Errorf("versions %v after redo", got)
+	}
+}
+
+func TestStatusAndPending(t *testing.T) {
+	fake := newFakeDB()
+	ctx := context.Background()
+	db := dbtest.Open(t, fake.handle)
+	appliedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	fake.records[1] = Record{Service: "test-service", Version: 1, Name: "items", AppliedAt: appliedAt}
+	// A version that was rolled out by a newer release and a version of another service
+	fake.records[5] = Record{Service: "test-service", Version: 5, Name: "newer", AppliedAt: appliedAt}
+	fake.records[7] = Record{Service: "other-service", Version: 7, Name: "other", AppliedAt: appliedAt}
+
+	m, err := New(db, "test-service", []Migration{table(1, "items"), table(2, "orders")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 3 {
+		t.Fatalf("statuses %+v", statuses)
+	}
+	tests := []struct {
+		version int64
+		name    string
+		applied bool
+		missing bool
+	}{
+		{1, "items", true, false},
+		{2, "orders", false, false},
+		{5, "newer", true, true},
+	}
+	for i, tt := range tests {
+		s := statuses[i]
+		if s.Version != tt.version || s.Name != tt.name || (s.AppliedAt != nil) != tt.applied || s.Missing != tt.missing {
+			t.Errorf("status %d = %+v, want %+v", i, s, tt)
+		}
+		if tt.applied && !s.AppliedAt.Equal(appliedAt) {
+			t.Errorf("version %d applied at %v", s.Version, s.AppliedAt)
+		}
+	}
+
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0].Version != 2 {
+		t.Errorf("pending %+v", pending)
+	}
+}
+
+func TestMigrationLock(t *testing.T) {
+	fake := newFakeDB()
+	ctx := context.Background()
+	db := dbtest.Open(t, fake.handle)
+	m, err := New(db, "test-service", []Migration{table(1, "items")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := New(db, "other-service", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.lockKey() == other.lockKey() {
+		t.Error("services share a migration lock")
+	}
+
+	// While another replica migrates, commands that change or report the history fail to lock
+	fake.locked = true
+	for name, run := range map[string]func() error{
+		"up":     func() error { _, err := m.Up(ctx); return err },
+		"down":   func() error { _, err := m.Down(ctx, 1); return err },
+		"redo":   func() error { return m.Redo(ctx) },
+		"status": func() error { _, err := m.Status(ctx); return err },
+	} {
+		if err := run(); err == nil || !strings.Contains(err.Error(), "failed to acquire migration lock") {
+			t.Errorf("%s while locked: %v", name, err)
+		}
+	}
+	if len(fake.executed("CREATE TABLE items")) != 0 || len(fake.records) != 0 {
+		t.Errorf("migrated without the lock: %q", fake.statements)
+	}
+	// Readiness checks do not wait for the lock
+	if pending, err := m.Pending(ctx); err != nil || len(pending) != 1 {
+		t.Errorf("Pending while locked = %v, %v", pending, err)
+	}
+
+	// The lock is released after each command
+	fake.locked = false
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if fake.locked {
+		t.Error("lock held after Up")
+	}
+	if _, err := m.Status(ctx); err != nil {
+		t.Errorf("Status after Up: %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package migrate
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/suteetoe/gomicro/database"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// TenantPolicy is the name of the row level security policy installed by TenantPolicies
+const TenantPolicy = "tenant_isolation"
+
+// TenantPolicies returns a migration that installs a row level security policy on the tenant_id
+// column of the given tables. A row is visible and writable when its tenant_id matches the
+// app.tenant_id setting of the transaction, or when app.bypass_rls is on; see
+// database.BeginTenant. Without either setting no row is visible.
+//
+// The policies only take effect once row level security is enabled on the tables, which
+// WithTenantRLS does in RLS mode, so that services outside RLS mode keep seeing every row.
+func TenantPolicies(version int64, tables ...string) Migration {
+	return Migration{
+		Version: version,
+		Name:    "tenant_policies",
+		Up: func(tx *gorm.DB) error {
+			for _, table := range tables {
+				if err := tx.Exec(tenantPolicyUp(table)).Error; err != nil {
+					return fmt.Errorf("failed to install tenant policy on %s: %w", table, err)
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			for _, table := range tables {
+				if err := tx.Exec(tenantPolicyDown(table)).Error; err != nil {
+					return fmt.Errorf("failed to drop tenant policy on %s: %w", table, err)
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func tenantPolicyUp(table string) string {
+	condition := fmt.Sprintf(
+		"tenant_id = NULLIF(current_setting('%s', true), '')::bigint OR current_setting('%s', true) = 'on'",
+		database.TenantSetting, database.BypassSetting)
+	return fmt.Sprintf(`DROP POLICY IF EXISTS %[2]s ON %[1]s;
+CREATE POLICY %[2]s ON %[1]s USING (%[3]s) WITH CHECK (%[3]s);`,
+		quoteIdentifier(table), TenantPolicy, condition)
+}
+
+func tenantPolicyDown(table string) string {
+	return fmt.Sprintf(`DROP POLICY IF EXISTS %[2]s ON %[1]s;
+ALTER TABLE %[1]s NO FORCE ROW LEVEL SECURITY, DISABLE ROW LEVEL SECURITY;`,
+		quoteIdentifier(table), TenantPolicy)
+}
+
+// syncTenantRLS enables and forces row level security on the tables in RLS mode, so that even
+// the table owner is subject to the policies, and disables it otherwise. Tables already in the
+// wanted state are left alone, so that a role which does not own them can run Up.
+func (m *Migrator) syncTenantRLS(conn *gorm.DB) error {
+	for _, table := range m.rlsTables {
+		var state struct {
+			Enabled bool
+			Forced  bool
+		}
+		err := conn.Raw("SELECT relrowsecurity AS enabled, relforcerowsecurity AS forced FROM pg_class WHERE oid = to_regclass(?)",
+			quoteIdentifier(table)).Scan(&state).Error
+		if err != nil {
+			return fmt.Errorf("failed to read row level security of %s: %w", table, err)
+		}
+		if state.Enabled == m.rls && state.Forced == m.rls {
+			continue
+		}
+
+		statement := "ALTER TABLE %s NO FORCE ROW LEVEL SECURITY, DISABLE ROW LEVEL SECURITY"
+		if m.rls {
+			statement = "ALTER TABLE %s ENABLE ROW LEVEL SECURITY, FORCE ROW LEVEL SECURITY"
+		}
+		if err := conn.Exec(fmt.Sprintf(statement, quoteIdentifier(table))).Error; err != nil {
+			return fmt.Errorf("failed to switch row level security of %s: %w", table, err)
+		}
+		m.log.Info("Switched row level security", zap.String("table", table), zap.Bool("enabled", m.rls))
+	}
+	return nil
+}
+
+// quoteIdentifier quotes a table name, keeping a schema prefix apart
+func quoteIdentifier(name string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = `"` + strings.ReplaceAll(part, `"`, `""`) + `"`
+	}
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,81 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/suteetoe/gomicro/database"
+	"gorm.io/gorm"
+)
+
+// DefaultChannel is the notification channel used by NewNotifyPublisher without a channel
+const DefaultChannel = "outbox"
+
+// maxNotifyPayload is the limit Postgres puts on NOTIFY payloads
+const maxNotifyPayload = 8000
+
+// NotifyPublisher publishes messages as JSON with Postgres NOTIFY. Notifications reach the
+// connections listening at that moment and are not stored, so a consumer that is down misses
+// them; the outbox row stays the durable record of the event.
+type NotifyPublisher struct {
+	db      *gorm.DB
+	channel string
+}
+
+// NewNotifyPublisher creates a publisher notifying channel through db
+func NewNotifyPublisher(db *gorm.DB, channel string) *NotifyPublisher {
+	if channel == "" {
+		channel = DefaultChannel
+	}
+	return &NotifyPublisher{db: db, channel: channel}
+}
+
+// Publish implements Publisher
+func (p *NotifyPublisher) Publish(ctx context.Context, msg Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to encode message %d: %w", msg.ID, err)
+	}
+	if len(data) >= maxNotifyPayload {
+		return fmt.Errorf("message %d is too large for NOTIFY (%d bytes)", msg.ID, len(data))
+	}
+	// Notifications are not replicated, so they must be sent on the primary
+	return database.Primary(p.db.WithContext(ctx)).Exec("SELECT pg_notify(?, ?)", p.channel, string(data)).Error
+}
+
+// Listen calls handle for every message published on channel until ctx is done or handle
+// returns an error. LISTEN needs a connection of its own, so it connects to dsn directly
+// instead of using the GORM pool.
+func Listen(ctx context.Context, dsn, channel string, handle func(context.Context, Message) error) error {
+	if channel == "" {
+		channel = DefaultChannel
+	}
+	conn, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		return fmt.Errorf("failed to connect listener: %w", err)
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", channel, err)
+	}
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to receive notification: %w", err)
+		}
+		var msg Message
+		if err := json.Unmarshal([]byte(notification.Payload), &msg); err != nil {
+			return fmt.Errorf("failed to decode notification: %w", err)
+		}
+		if err := handle(ctx, msg); err != nil {
+			return err
+		}
+	}
+}
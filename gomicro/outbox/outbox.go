@@ -0,0 +1,150 @@
+// Package outbox implements the transactional outbox: domain events are written to the
+// outbox_messages table in the same transaction as the change they describe, and a Relay
+// delivers them to a Publisher afterwards. Delivery is at least once, so consumers must
+// tolerate duplicates, e.g. by remembering the message ID.
+package outbox
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/suteetoe/gomicro/database"
+	"gorm.io/gorm"
+)
+
+// JSON is a raw JSON document stored as JSONB
+type JSON json.RawMessage
+
+// Value implements driver.Valuer
+func (j JSON) Value() (driver.Value, error) {
+	if len(j) == 0 {
+		return nil, nil
+	}
+	return string(j), nil
+}
+
+// Scan implements sql.Scanner
+func (j *JSON) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*j = nil
+	case []byte:
+		*j = append((*j)[:0], v...)
+	case string:
+		*j = JSON(v)
+	default:
+		return fmt.Errorf("cannot scan %T into outbox.JSON", value)
+	}
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler
+func (j JSON) MarshalJSON() ([]byte, error) {
+	if len(j) == 0 {
+		return []byte("null"), nil
+	}
+	return j, nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (j *JSON) UnmarshalJSON(data []byte) error {
+	*j = append((*j)[:0], data...)
+	return nil
+}
+
+// Message is a row of the outbox_messages table
+type Message struct {
+	ID        uint64    `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `gorm:"not null" json:"created_at"`
+	Service   string    `gorm:"size:64;not null;index:idx_outbox_messages_pending,priority:1" json:"service"`
+	Topic     string    `gorm:"size:128;not null" json:"topic"`
+	// Key identifies the aggregate the event is about, e.g. the supplier ID
+	Key      string `gorm:"size:128" json:"key,omitempty"`
+	TenantID *uint  `gorm:"index" json:"tenant_id,omitempty"`
+	Payload  JSON   `gorm:"type:jsonb" json:"payload"`
+
+	// Delivery state, maintained by the relay
+	PublishedAt   *time.Time `gorm:"index;index:idx_outbox_messages_pending,priority:2" json:"published_at,omitempty"`
+	NextAttemptAt time.Time  `gorm:"not null;index:idx_outbox_messages_pending,priority:3" json:"-"`
+	Attempts      int        `gorm:"not null;default:0" json:"-"`
+	LastError     string     `gorm:"size:1024" json:"-"`
+}
+
+// TableName overrides the table name used by Message
+func (Message) TableName() string {
+	return "outbox_messages"
+}
+
+// Migrate creates or updates the outbox_messages table, e.g. from a migration
+func Migrate(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&Message{}); err != nil {
+		return fmt.Errorf("failed to migrate outbox messages: %w", err)
+	}
+	return nil
+}
+
+// Event is a domain event to publish
+type Event struct {
+	Topic string
+	Key   string
+	// TenantID defaults to the tenant of the transaction context
+	TenantID *uint
+	// Payload is encoded as JSON
+	Payload interface{}
+}
+
+// Writer adds the events of one service to the outbox
+type Writer struct {
+	service string
+}
+
+// NewWriter creates a writer for service
+func NewWriter(service string) *Writer {
+	return &Writer{service: service}
+}
+
+// Write adds events to the outbox in tx, the transaction of the change they describe, so that
+// they are published if and only if the change commits
+func (w *Writer) Write(tx *gorm.DB, events ...Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	ctx := tx.Statement.Context
+	_, inTx := tx.Statement.ConnPool.(gorm.TxCommitter)
+	if _, inRequestTx := database.TxFromContext(ctx); !inTx && !inRequestTx {
+		return errors.New("outbox: events must be written in a transaction")
+	}
+
+	now := time.Now().UTC()
+	messages := make([]Message, 0, len(events))
+	for _, event := range events {
+		payload, err := json.Marshal(event.Payload)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s event: %w", event.Topic, err)
+		}
+		tenantID := event.TenantID
+		if tenantID == nil {
+			if id, ok := database.TenantFromContext(ctx); ok {
+				tenantID = &id
+			}
+		}
+		messages = append(messages, Message{
+			CreatedAt:     now,
+			Service:       w.service,
+			Topic:         event.Topic,
+			Key:           event.Key,
+			TenantID:      tenantID,
+			Payload:       payload,
+			NextAttemptAt: now,
+		})
+	}
+
+	// Messages carry their tenant explicitly and may have none, so they bypass the tenant scope
+	if err := tx.WithContext(database.WithoutTenantScope(ctx)).Create(&messages).Error; err != nil {
+		return fmt.Errorf("failed to write outbox messages: %w", err)
+	}
+	return nil
+}
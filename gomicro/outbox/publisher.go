@@ -0,0 +1,101 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// Publisher delivers outbox messages to consumers. Publish may be called again for a message
+// that was already delivered, e.g. when the relay stops before recording the delivery.
+type Publisher interface {
+	Publish(ctx context.Context, msg Message) error
+}
+
+// PublisherFunc adapts a function to Publisher
+type PublisherFunc func(ctx context.Context, msg Message) error
+
+// Publish implements Publisher
+func (f PublisherFunc) Publish(ctx context.Context, msg Message) error {
+	return f(ctx, msg)
+}
+
+// memoryHistory is how many published messages a MemoryPublisher keeps
+const memoryHistory = 1000
+
+// MemoryPublisher delivers messages to handlers in the same process, for tests and for
+// services that consume their own events. It keeps the last 1000 messages for Messages.
+type MemoryPublisher struct {
+	mu       sync.RWMutex
+	handlers map[string][]func(context.Context, Message) error
+	messages []Message
+}
+
+// NewMemoryPublisher creates an in-memory publisher
+func NewMemoryPublisher() *MemoryPublisher {
+	return &MemoryPublisher{handlers: make(map[string][]func(context.Context, Message) error)}
+}
+
+// Subscribe calls handler for every message of topic; an error fails the delivery so that
+// the relay retries it. An empty topic subscribes to every message.
+func (p *MemoryPublisher) Subscribe(topic string, handler func(context.Context, Message) error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.handlers[topic] = append(p.handlers[topic], handler)
+}
+
+// Publish implements Publisher
+func (p *MemoryPublisher) Publish(ctx context.Context, msg Message) error {
+	p.mu.RLock()
+	handlers := append(append([]func(context.Context, Message) error{}, p.handlers[msg.Topic]...), p.handlers[""]...)
+	p.mu.RUnlock()
+
+	for _, handler := range handlers {
+		if err := handler(ctx, msg); err != nil {
+			return err
+		}
+	}
+
+	p.mu.Lock()
+	p.messages = append(p.messages, msg)
+	// Trim in bulk rather than on every message past the limit
+	if len(p.messages) >= 2*memoryHistory {
+		p.messages = append([]Message(nil), p.messages[len(p.messages)-memoryHistory:]...)
+	}
+	p.mu.Unlock()
+	return nil
+}
+
+// Messages returns the last messages published, up to 1000
+func (p *MemoryPublisher) Messages() []Message {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	messages := p.messages
+	if len(messages) > memoryHistory {
+		messages = messages[len(messages)-memoryHistory:]
+	}
+	return append([]Message{}, messages...)
+}
+
+// Publisher names accepted by NewPublisher
+const (
+	PublisherNotify = "notify"
+	PublisherMemory = "memory"
+	// PublisherNone runs no relay and leaves delivery to another process
+	PublisherNone = "none"
+)
+
+// NewPublisher returns the publisher named by kind, e.g. from OUTBOX_PUBLISHER. The notify
+// publisher sends on channel through db.
+func NewPublisher(kind string, db *gorm.DB, channel string) (Publisher, error) {
+	switch kind {
+	case PublisherNotify:
+		return NewNotifyPublisher(db, channel), nil
+	case PublisherMemory:
+		return NewMemoryPublisher(), nil
+	default:
+		return nil, fmt.Errorf("unknown outbox publisher %q", kind)
+	}
+}
@@ -0,0 +1,314 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/suteetoe/gomicro/database"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Relay defaults
+const (
+	DefaultBatchSize      = 100
+	DefaultPollInterval   = time.Second
+	DefaultInitialBackoff = time.Second
+	DefaultMaxBackoff     = 5 * time.Minute
+	DefaultRetention      = 7 * 24 * time.Hour
+)
+
+// purgeInterval is how often the relay deletes published messages older than the retention
+const purgeInterval = time.Hour
+
+// maxErrorLength is the size of the last_error column
+const maxErrorLength = 1024
+
+// RelayOption configures a Relay
+type RelayOption func(*Relay)
+
+// WithBatchSize sets how many messages are locked and published per transaction
+func WithBatchSize(size int) RelayOption {
+	return func(r *Relay) {
+		r.batchSize = size
+	}
+}
+
+// WithPollInterval sets how often the relay looks for due messages
+func WithPollInterval(interval time.Duration) RelayOption {
+	return func(r *Relay) {
+		r.pollInterval = interval
+	}
+}
+
+// WithBackoff sets the wait before retrying a failed message; it doubles with every attempt
+// up to max
+func WithBackoff(initial, max time.Duration) RelayOption {
+	return func(r *Relay) {
+		r.initialBackoff = initial
+		r.maxBackoff = max
+	}
+}
+
+// WithRetention sets how long published messages are kept; 0 keeps them forever
+func WithRetention(retention time.Duration) RelayOption {
+	return func(r *Relay) {
+		r.retention = retention
+	}
+}
+
+// WithRegisterer registers the relay metrics on registerer instead of the global registry
+func WithRegisterer(registerer prometheus.Registerer) RelayOption {
+	return func(r *Relay) {
+		r.registerer = registerer
+	}
+}
+
+// WithLogger logs failed deliveries and polls
+func WithLogger(log *zap.Logger) RelayOption {
+	return func(r *Relay) {
+		r.log = log
+	}
+}
+
+// Relay delivers the outbox messages of one service to a Publisher. Due messages are locked
+// with FOR UPDATE SKIP LOCKED, so replicas of the service can run relays side by side. A
+// message is marked as published only after Publish succeeds; failed messages are retried
+// with exponential backoff and never dropped. Messages are published in ID order, but a
+// message being retried does not hold back the messages after it.
+type Relay struct {
+	db        *gorm.DB
+	service   string
+	publisher Publisher
+
+	batchSize      int
+	pollInterval   time.Duration
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	retention      time.Duration
+	registerer     prometheus.Registerer
+	log            *zap.Logger
+	lastPurge      time.Time
+
+	// PublishedCounter counts delivered messages per topic
+	PublishedCounter *prometheus.CounterVec
+	// FailureCounter counts failed deliveries per topic
+	FailureCounter *prometheus.CounterVec
+	// LagHistogram records the time from writing a message to delivering it
+	LagHistogram *prometheus.HistogramVec
+	// PendingGauge is the number of messages waiting for delivery
+	PendingGauge *prometheus.GaugeVec
+	// OldestPendingGauge is the age in seconds of the oldest message waiting for delivery
+	OldestPendingGauge *prometheus.GaugeVec
+}
+
+// NewRelay creates a relay for the messages of service and registers its metrics
+func NewRelay(db *gorm.DB, service string, publisher Publisher, opts ...RelayOption) (*Relay, error) {
+	r := &Relay{
+		db:             db,
+		service:        service,
+		publisher:      publisher,
+		batchSize:      DefaultBatchSize,
+		pollInterval:   DefaultPollInterval,
+		initialBackoff: DefaultInitialBackoff,
+		maxBackoff:     DefaultMaxBackoff,
+		retention:      DefaultRetention,
+		registerer:     prometheus.DefaultRegisterer,
+		log:            zap.NewNop(),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if r.batchSize <= 0 || r.pollInterval <= 0 {
+		return nil, fmt.Errorf("outbox relay needs a positive batch size and poll interval")
+	}
+
+	r.PublishedCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "outbox_published_total",
+		Help: "Total number of outbox messages delivered to the publisher",
+	}, []string{"service", "topic"})
+	r.FailureCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "outbox_publish_failures_total",
+		Help: "Total number of failed outbox message deliveries",
+	}, []string{"service", "topic"})
+	r.LagHistogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "outbox_lag_seconds",
+		Help:    "Time from writing an outbox message to delivering it in seconds",
+		Buckets: []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300, 900, 3600},
+	}, []string{"service", "topic"})
+	r.PendingGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "outbox_pending_messages",
+		Help: "Number of outbox messages waiting for delivery",
+	}, []string{"service"})
+	r.OldestPendingGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "outbox_oldest_pending_age_seconds",
+		Help: "Age of the oldest outbox message waiting for delivery in seconds",
+	}, []string{"service"})
+
+	for _, collector := range []prometheus.Collector{
+		r.PublishedCounter,
+		r.FailureCounter,
+		r.LagHistogram,
+		r.PendingGauge,
+		r.OldestPendingGauge,
+	} {
+		if err := r.registerer.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Run relays due messages every poll interval until ctx is done. Errors are logged and the
+// next poll tries again.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		r.poll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll relays the due messages and updates the pending metrics
+func (r *Relay) poll(ctx context.Context) {
+	if _, err := r.RelayPending(ctx); err != nil && ctx.Err() == nil {
+		r.log.Error("Failed to relay outbox messages", zap.Error(err))
+	}
+	if err := r.updatePending(ctx); err != nil && ctx.Err() == nil {
+		r.log.Warn("Failed to measure the outbox backlog", zap.Error(err))
+	}
+	if r.retention > 0 && time.Since(r.lastPurge) >= purgeInterval {
+		if err := r.purge(ctx); err != nil && ctx.Err() == nil {
+			r.log.Warn("Failed to purge published outbox messages", zap.Error(err))
+		}
+		r.lastPurge = time.Now()
+	}
+}
+
+// RelayPending publishes due messages batch by batch until none are left and returns how
+// many were delivered
+func (r *Relay) RelayPending(ctx context.Context) (int, error) {
+	total := 0
+	for {
+		fetched, published, err := r.relayBatch(ctx)
+		total += published
+		if err != nil || fetched < r.batchSize {
+			return total, err
+		}
+	}
+}
+
+// relayBatch locks a batch of due messages, publishes them and records the outcome. It
+// returns how many messages were locked and how many of them were delivered.
+func (r *Relay) relayBatch(ctx context.Context) (fetched, published int, err error) {
+	// The outbox spans every tenant of the service
+	ctx = database.WithoutTenantScope(ctx)
+
+	err = r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var messages []Message
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("service = ? AND published_at IS NULL AND next_attempt_at <= ?", r.service, time.Now().UTC()).
+			Order("id").
+			Limit(r.batchSize).
+			Find(&messages).Error
+		if err != nil {
+			return fmt.Errorf("failed to read outbox messages: %w", err)
+		}
+		fetched = len(messages)
+
+		for i := range messages {
+			msg := &messages[i]
+			attempts := msg.Attempts + 1
+			if publishErr := r.publisher.Publish(ctx, *msg); publishErr != nil {
+				r.FailureCounter.WithLabelValues(r.service, msg.Topic).Inc()
+				wait := r.backoff(attempts)
+				r.log.Warn("Failed to publish outbox message",
+					zap.Uint64("message_id", msg.ID),
+					zap.String("topic", msg.Topic),
+					zap.Int("attempts", attempts),
+					zap.Duration("retry_in", wait),
+					zap.Error(publishErr))
+
+				lastError := publishErr.Error()
+				if len(lastError) > maxErrorLength {
+					lastError = lastError[:maxErrorLength]
+				}
+				if err := tx.Model(msg).Updates(map[string]interface{}{
+					"attempts":        attempts,
+					"last_error":      lastError,
+					"next_attempt_at": time.Now().UTC().Add(wait),
+				}).Error; err != nil {
+					return fmt.Errorf("failed to record outbox delivery failure: %w", err)
+				}
+				continue
+			}
+
+			now := time.Now().UTC()
+			if err := tx.Model(msg).Updates(map[string]interface{}{
+				"attempts":     attempts,
+				"last_error":   "",
+				"published_at": now,
+			}).Error; err != nil {
+				return fmt.Errorf("failed to record outbox delivery: %w", err)
+			}
+			r.PublishedCounter.WithLabelValues(r.service, msg.Topic).Inc()
+			r.LagHistogram.WithLabelValues(r.service, msg.Topic).Observe(now.Sub(msg.CreatedAt).Seconds())
+			published++
+		}
+		return nil
+	})
+	return fetched, published, err
+}
+
+// backoff returns the wait before the next attempt after the given number of attempts
+func (r *Relay) backoff(attempts int) time.Duration {
+	wait := r.initialBackoff
+	for i := 1; i < attempts && wait < r.maxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > r.maxBackoff {
+		wait = r.maxBackoff
+	}
+	return wait
+}
+
+// updatePending measures the backlog of undelivered messages
+func (r *Relay) updatePending(ctx context.Context) error {
+	var backlog struct {
+		Count  int64
+		Oldest *time.Time
+	}
+	err := database.Primary(r.db.WithContext(database.WithoutTenantScope(ctx))).
+		Model(&Message{}).
+		Select("count(*) AS count, min(created_at) AS oldest").
+		Where("service = ? AND published_at IS NULL", r.service).
+		Scan(&backlog).Error
+	if err != nil {
+		return err
+	}
+
+	r.PendingGauge.WithLabelValues(r.service).Set(float64(backlog.Count))
+	age := 0.0
+	if backlog.Oldest != nil {
+		age = time.Since(*backlog.Oldest).Seconds()
+	}
+	r.OldestPendingGauge.WithLabelValues(r.service).Set(age)
+	return nil
+}
+
+// purge deletes published messages older than the retention
+func (r *Relay) purge(ctx context.Context) error {
+	cutoff := time.Now().UTC().Add(-r.retention)
+	return r.db.WithContext(database.WithoutTenantScope(ctx)).
+		Where("service = ? AND published_at < ?", r.service, cutoff).
+		Delete(&Message{}).Error
+}
@@ -0,0 +1,283 @@
+package outbox
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/suteetoe/gomicro/internal/dbtest"
+	"gorm.io/gorm"
+)
+
+// table is an in-memory outbox_messages table answering the statements of the writer and the relay
+type table struct {
+	rows    []*Message
+	batches []int
+}
+
+var (
+	insertColumns = regexp.MustCompile(`INSERT INTO "outbox_messages" \(([^)]*)\)`)
+	setColumn     = regexp.MustCompile(`"(\w+)"=\$(\d+)`)
+	whereID       = regexp.MustCompile(`WHERE "id" = \$(\d+)`)
+)
+
+func (tb *table) handle(query string, args []driver.Value) (dbtest.Result, error) {
+	switch {
+	case query == "BEGIN" || query == "COMMIT" || query == "ROLLBACK":
+		return dbtest.Result{}, nil
+
+	case strings.HasPrefix(query, `INSERT INTO "outbox_messages"`):
+		columns := strings.Split(insertColumns.FindStringSubmatch(query)[1], ",")
+		result := dbtest.Result{Columns: []string{"id"}}
+		for i := 0; i < len(args); i += len(columns) {
+			msg := &Message{ID: uint64(len(tb.rows) + 1)}
+			for j, column := range columns {
+				tb.set(msg, strings.Trim(column, `"`), args[i+j])
+			}
+			tb.rows = append(tb.rows, msg)
+			result.Rows = append(result.Rows, []driver.Value{int64(msg.ID)})
+		}
+		return result, nil
+
+	case strings.Contains(query, "FOR UPDATE SKIP LOCKED"):
+		now, limit := args[1].(time.Time), int(args[2].(int64))
+		result := dbtest.Result{Columns: []string{"id", "created_at", "service", "topic", "key", "payload", "published_at", "next_attempt_at", "attempts", "last_error"}}
+		for _, msg := range tb.rows {
+			if msg.Service == args[0] && msg.PublishedAt == nil && !msg.NextAttemptAt.After(now) && len(result.Rows) < limit {
+				result.Rows = append(result.Rows, []driver.Value{
+					int64(msg.ID), msg.CreatedAt, msg.Service, msg.Topic, msg.Key, []byte(msg.Payload),
+					nil, msg.NextAttemptAt, int64(msg.Attempts), msg.LastError,
+				})
+			}
+		}
+		tb.batches = append(tb.batches, len(result.Rows))
+		return result, nil
+
+	case strings.HasPrefix(query, `UPDATE "outbox_messages"`):
+		id := args[atoi(whereID.FindStringSubmatch(query)[1])-1].(int64)
+		msg := tb.rows[id-1]
+		for _, match := range setColumn.FindAllStringSubmatch(query, -1) {
+			tb.set(msg, match[1], args[atoi(match[2])-1])
+		}
+		return dbtest.Result{RowsAffected: 1}, nil
+
+	case strings.HasPrefix(query, "SELECT count(*)"):
+		var count int64
+		var oldest interface{}
+		for _, msg := range tb.rows {
+			if msg.Service == args[0] && msg.PublishedAt == nil {
+				count++
+				if oldest == nil || msg.CreatedAt.Before(oldest.(time.Time)) {
+					oldest = msg.CreatedAt
+				}
+			}
+		}
+		return dbtest.Result{Columns: []string{"count", "oldest"}, Rows: [][]driver.Value{{count, oldest}}}, nil
+	}
+	return dbtest.Result{}, fmt.Errorf("unexpected statement %s", query)
+}
+
+// set assigns a column of msg
+func (tb *table) set(msg *Message, column string, value driver.Value) {
+	switch column {
+	case "created_at":
+		msg.CreatedAt = value.(time.Time)
+	case "service":
+		msg.Service = value.(string)
+	case "topic":
+		msg.Topic = value.(string)
+	case "key":
+		msg.Key = value.(string)
+	case "payload":
+		msg.Payload = JSON(value.(string))
+	case "published_at":
+		if t, ok := value.(time.Time); ok {
+			msg.PublishedAt = &t
+		}
+	case "next_attempt_at":
+		msg.NextAttemptAt = value.(time.Time)
+	case "attempts":
+		msg.Attempts = int(value.(int64))
+	case "last_error":
+		msg.LastError = value.(string)
+	}
+}
+
+func atoi(s string) int {
+	var n int
+	fmt.Sscan(s, &n)
+	return n
+}
+
+// setup writes one event per topic to the outbox and returns a relay publishing to publisher
+func setup(t *testing.T, publisher Publisher, topics ...string) (*table, *Relay) {
+	tb := &table{}
+	db := dbtest.Open(t, tb.handle)
+
+	writer := NewWriter("test-service")
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for i, topic := range topics {
+			if err := writer.Write(tx, Event{Topic: topic, Key: fmt.Sprint(i + 1), Payload: map[string]int{"n": i + 1}}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	relay, err := NewRelay(db, "test-service", publisher,
+		WithBatchSize(2), WithBackoff(time.Minute, 4*time.Minute), WithRetention(0),
+		WithRegisterer(prometheus.NewRegistry()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tb, relay
+}
+
+func TestRelayPublishesInBatches(t *testing.T) {
+	publisher := NewMemoryPublisher()
+	tb, relay := setup(t, publisher, "a", "b", "c", "d", "e")
+	// The messages were written ten seconds ago
+	for _, msg := range tb.rows {
+		msg.CreatedAt = msg.CreatedAt.Add(-10 * time.Second)
+	}
+
+	published, err := relay.RelayPending(context.Background())
+	if err != nil || published != 5 {
+		t.Fatalf("RelayPending = %d, %v", published, err)
+	}
+	// Batches of two until a short batch shows that nothing is left
+	if fmt.Sprint(tb.batches) != "[2 2 1]" {
+		t.Errorf("batches %v", tb.batches)
+	}
+
+	var topics []string
+	for _, msg := range publisher.Messages() {
+		topics = append(topics, msg.Topic)
+		if string(msg.Payload) != fmt.Sprintf(`{"n":%d}`, msg.ID) {
+			t.Errorf("message %d has payload %s", msg.ID, msg.Payload)
+		}
+	}
+	if strings.Join(topics, "") != "abcde" {
+		t.Errorf("published %v", topics)
+	}
+	for _, msg := range tb.rows {
+		if msg.PublishedAt == nil || msg.Attempts != 1 {
+			t.Errorf("message %d not marked as published: %+v", msg.ID, msg)
+		}
+	}
+
+	if got := testutil.ToFloat64(relay.PublishedCounter.WithLabelValues("test-service", "c")); got != 1 {
+		t.Errorf("published counter = %v", got)
+	}
+	lag := histogram(t, relay.LagHistogram, "a")
+	if lag.GetSampleCount() != 1 || lag.GetSampleSum() < 10 {
+		t.Errorf("lag: %d samples summing to %v", lag.GetSampleCount(), lag.GetSampleSum())
+	}
+
+	// Nothing is published twice
+	if published, err := relay.RelayPending(context.Background()); err != nil || published != 0 {
+		t.Errorf("second RelayPending = %d, %v", published, err)
+	}
+}
+
+func TestRelayRetriesFailedMessages(t *testing.T) {
+	publisher := NewMemoryPublisher()
+	down := true
+	publisher.Subscribe("flaky", func(context.Context, Message) error {
+		if down {
+			return errors.New("broker unavailable")
+		}
+		return nil
+	})
+	tb, relay := setup(t, publisher, "flaky", "ok")
+
+	start := time.Now()
+	relay.poll(context.Background())
+
+	// The failure does not hold back the next message
+	flaky, ok := tb.rows[0], tb.rows[1]
+	if ok.PublishedAt == nil || flaky.PublishedAt != nil {
+		t.Fatalf("published: flaky %v, ok %v", flaky.PublishedAt, ok.PublishedAt)
+	}
+	if flaky.Attempts != 1 || flaky.LastError != "broker unavailable" {
+		t.Errorf("failure not recorded: %+v", flaky)
+	}
+	if wait := flaky.NextAttemptAt.Sub(start); wait < time.Minute || wait > time.Minute+5*time.Second {
+		t.Errorf("retry in %v, want the initial backoff", wait)
+	}
+	if got := testutil.ToFloat64(relay.FailureCounter.WithLabelValues("test-service", "flaky")); got != 1 {
+		t.Errorf("failure counter = %v", got)
+	}
+	if got := testutil.ToFloat64(relay.PendingGauge.WithLabelValues("test-service")); got != 1 {
+		t.Errorf("pending gauge = %v", got)
+	}
+	if got := testutil.ToFloat64(relay.OldestPendingGauge.WithLabelValues("test-service")); got < 0 || got > 5 {
+		t.Errorf("oldest pending age = %v", got)
+	}
+
+	// The message is not retried before its backoff elapses
+	if published, _ := relay.RelayPending(context.Background()); published != 0 {
+		t.Errorf("retried %d messages early", published)
+	}
+
+	flaky.NextAttemptAt = time.Now().Add(-time.Second)
+	down = false
+	relay.poll(context.Background())
+	if flaky.PublishedAt == nil || flaky.Attempts != 2 || flaky.LastError != "" {
+		t.Errorf("retry not recorded: %+v", flaky)
+	}
+	if got := testutil.ToFloat64(relay.PendingGauge.WithLabelValues("test-service")); got != 0 {
+		t.Errorf("pending gauge = %v", got)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	relay := &Relay{initialBackoff: time.Second, maxBackoff: 5 * time.Second}
+	var waits []time.Duration
+	for attempts := 1; attempts <= 5; attempts++ {
+		waits = append(waits, relay.backoff(attempts))
+	}
+	if fmt.Sprint(waits) != "[1s 2s 4s 5s 5s]" {
+		t.Errorf("backoff %v", waits)
+	}
+}
+
+func TestMemoryPublisherKeepsRecentMessages(t *testing.T) {
+	publisher := NewMemoryPublisher()
+	for i := 1; i <= 3*memoryHistory; i++ {
+		if err := publisher.Publish(context.Background(), Message{ID: uint64(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	messages := publisher.Messages()
+	if len(messages) != memoryHistory || messages[0].ID != 2*memoryHistory+1 || messages[len(messages)-1].ID != 3*memoryHistory {
+		t.Errorf("kept %d messages from %d", len(messages), messages[0].ID)
+	}
+	if len(publisher.messages) >= 2*memoryHistory {
+		t.Errorf("holds %d messages", len(publisher.messages))
+	}
+	if !sort.SliceIsSorted(messages, func(i, j int) bool { return messages[i].ID < messages[j].ID }) {
+		t.Error("messages out of order")
+	}
+}
+
+// histogram returns the state of the histogram of topic
+func histogram(t *testing.T, vec *prometheus.HistogramVec, topic string) *dto.Histogram {
+	var metric dto.Metric
+	if err := vec.WithLabelValues("test-service", topic).(prometheus.Histogram).Write(&metric); err != nil {
+		t.Fatal(err)
+	}
+	return metric.GetHistogram()
+}
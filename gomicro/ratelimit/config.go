@@ -0,0 +1,43 @@
+package ratelimit
+
+import (
+	"github.com/suteetoe/gomicro/config"
+)
+
+// RuleFunc returns the rule of a limit in a configuration snapshot
+type RuleFunc func(conf *config.Config) (Rule, error)
+
+// APIRule returns the rule set by RATE_LIMIT_API and RATE_LIMIT_ALGORITHM
+func APIRule(conf *config.Config) (Rule, error) {
+	return ParseRule(conf.RateLimit.Algorithm, conf.RateLimit.API)
+}
+
+// LoginRule returns the rule set by RATE_LIMIT_LOGIN and RATE_LIMIT_ALGORITHM
+func LoginRule(conf *config.Config) (Rule, error) {
+	return ParseRule(conf.RateLimit.Algorithm, conf.RateLimit.Login)
+}
+
+// Limits maps the names of a limiter's limits to the setting of their rule
+type Limits map[string]RuleFunc
+
+// ApplyConfig returns a config.Watcher subscriber that replaces the rules of limits with those
+// of a reloaded configuration, so that changed rate_limit rules take effect without a restart.
+// An invalid rule rejects the configuration. A changed rate_limit.store takes a restart.
+func (l *Limiter) ApplyConfig(limits Limits) config.ApplyFunc {
+	return func(old, new *config.Config) error {
+		rules := make(map[string]Rule, len(limits))
+		for name, rule := range limits {
+			parsed, err := rule(new)
+			if err != nil {
+				return err
+			}
+			rules[name] = parsed
+		}
+		for name, rule := range rules {
+			if err := l.SetRule(name, rule); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,269 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	apperrors "github.com/suteetoe/gomicro/errors"
+	"github.com/suteetoe/gomicro/jwtutil"
+	"github.com/suteetoe/gomicro/logger"
+	"go.uber.org/zap"
+)
+
+// maxKeyLength is the size of the key column; longer keys are hashed
+const maxKeyLength = 255
+
+// KeyFunc returns the key a request is counted under. Requests without a key are not limited.
+type KeyFunc func(c echo.Context) (string, bool)
+
+// KeyByIP counts requests per client IP as returned by c.RealIP. Behind a proxy, set
+// echo's IPExtractor so that clients cannot pick their IP with X-Forwarded-For.
+func KeyByIP() KeyFunc {
+	return func(c echo.Context) (string, bool) {
+		ip := c.RealIP()
+		return "ip:" + ip, ip != ""
+	}
+}
+
+// KeyByUser counts requests per authenticated user, read from the claims stored by
+// gomicro's JWTAuthMiddleware or from the user_id set by a service's own auth middleware
+func KeyByUser() KeyFunc {
+	return func(c echo.Context) (string, bool) {
+		if claims, ok := c.Get("user").(*jwtutil.UserClaims); ok && claims.UserID != 0 {
+			return fmt.Sprintf("user:%d", claims.UserID), true
+		}
+		return KeyFromContext("user_id")(c)
+	}
+}
+
+// KeyByTenant counts requests per tenant, read like KeyByUser
+func KeyByTenant() KeyFunc {
+	return func(c echo.Context) (string, bool) {
+		if claims, ok := c.Get("user").(*jwtutil.UserClaims); ok && claims.TenantID != nil {
+			return fmt.Sprintf("tenant:%d", *claims.TenantID), true
+		}
+		return KeyFromContext("tenant_id")(c)
+	}
+}
+
+// KeyByClientID counts requests per OAuth client: the client_id set by the client auth
+// middleware, else the user of Basic authentication or the client_id form value. Put it
+// before client authentication to throttle attempts at guessing a client's secret.
+func KeyByClientID() KeyFunc {
+	return func(c echo.Context) (string, bool) {
+		if key, ok := KeyFromContext("client_id")(c); ok {
+			return key, true
+		}
+		if clientID, _, ok := c.Request().BasicAuth(); ok && clientID != "" {
+			return "client_id:" + clientID, true
+		}
+		if clientID := c.FormValue("client_id"); clientID != "" {
+			return "client_id:" + clientID, true
+		}
+		return "", false
+	}
+}
+
+// KeyFromContext counts requests per value stored under key in the echo context
+func KeyFromContext(key string) KeyFunc {
+	return func(c echo.Context) (string, bool) {
+		value := c.Get(key)
+		if value == nil {
+			return "", false
+		}
+		s := fmt.Sprint(value)
+		return key + ":" + s, s != ""
+	}
+}
+
+// FirstKey uses the first of keys that finds a key, e.g. the tenant and else the IP
+func FirstKey(keys ...KeyFunc) KeyFunc {
+	return func(c echo.Context) (string, bool) {
+		for _, key := range keys {
+			if k, ok := key(c); ok {
+				return k, true
+			}
+		}
+		return "", false
+	}
+}
+
+// Option configures a Limiter
+type Option func(*Limiter)
+
+// WithRegisterer registers the limiter metrics on registerer instead of the global registry
+func WithRegisterer(registerer prometheus.Registerer) Option {
+	return func(l *Limiter) {
+		l.registerer = registerer
+	}
+}
+
+// Limiter enforces rules for one service. A limiter without a store admits every request, so
+// that services can disable rate limiting with RATE_LIMIT_STORE=none.
+type Limiter struct {
+	service    string
+	store      Store
+	registerer prometheus.Registerer
+
+	mu    sync.RWMutex
+	rules map[string]Rule
+
+	// ThrottledCounter counts rejected requests per limit and route
+	ThrottledCounter *prometheus.CounterVec
+	// ErrorCounter counts requests admitted because the store failed
+	ErrorCounter *prometheus.CounterVec
+}
+
+// NewLimiter creates a limiter for service and registers its metrics
+func NewLimiter(service string, store Store, opts ...Option) (*Limiter, error) {
+	l := &Limiter{
+		service:    service,
+		store:      store,
+		registerer: prometheus.DefaultRegisterer,
+		rules:      make(map[string]Rule),
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	l.ThrottledCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "rate_limit_throttled_total",
+		Help: "Total number of requests rejected by a rate limit",
+	}, []string{"service", "limit", "method", "path"})
+	l.ErrorCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "rate_limit_store_errors_total",
+		Help: "Total number of requests admitted without a rate limit check because the store failed",
+	}, []string{"service", "limit"})
+
+	for _, collector := range []prometheus.Collector{l.ThrottledCounter, l.ErrorCounter} {
+		if err := l.registerer.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// Allow counts a request of key against the limit called name
+func (l *Limiter) Allow(ctx context.Context, name string, rule Rule, key string) (Result, error) {
+	storeKey := l.service + ":" + name + ":" + key
+	if len(storeKey) > maxKeyLength {
+		sum := sha256.Sum256([]byte(storeKey))
+		storeKey = l.service + ":" + name + ":" + hex.EncodeToString(sum[:])
+	}
+
+	var result Result
+	now := time.Now()
+	err := l.store.Update(ctx, storeKey, rule.ttl(), func(state *State) {
+		result = rule.take(state, now)
+	})
+	return result, err
+}
+
+// SetRule replaces the rule of the limit called name, e.g. when the configuration is reloaded.
+// Counters kept under the previous rule carry over. A zero rule disables the limit; an invalid
+// one is rejected.
+func (l *Limiter) SetRule(name string, rule Rule) error {
+	if rule.Enabled() {
+		if err := rule.Validate(); err != nil {
+			return fmt.Errorf("limit %s: %w", name, err)
+		}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rules[name] = rule
+	return nil
+}
+
+// Rule returns the current rule of the limit called name
+func (l *Limiter) Rule(name string) Rule {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.rules[name]
+}
+
+// Middleware limits the requests of each key to rule. Limits are told apart by name, so
+// several may apply to one request, e.g. per client and per IP. Responses carry the
+// RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset and RateLimit-Policy headers, and
+// rejected requests get 429 with Retry-After. When the store fails the request is admitted.
+// A zero rule admits every request until SetRule enables the limit; an invalid one panics.
+func (l *Limiter) Middleware(name string, rule Rule, key KeyFunc) echo.MiddlewareFunc {
+	if l.store == nil {
+		return func(next echo.HandlerFunc) echo.HandlerFunc {
+			return next
+		}
+	}
+	if err := l.SetRule(name, rule); err != nil {
+		panic(fmt.Sprintf("ratelimit: %v", err))
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			rule := l.Rule(name)
+			if !rule.Enabled() {
+				return next(c)
+			}
+			k, ok := key(c)
+			if !ok {
+				return next(c)
+			}
+			// Services with their own logger package may not have initialized the gomicro logger
+			log := logger.FromEcho(c)
+
+			result, err := l.Allow(c.Request().Context(), name, rule, k)
+			if err != nil {
+				l.ErrorCounter.WithLabelValues(l.service, name).Inc()
+				if log != nil {
+					log.Error("Rate limit check failed, admitting request", zap.String("limit", name), zap.Error(err))
+				}
+				return next(c)
+			}
+
+			header := c.Response().Header()
+			header.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+			header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			header.Set("RateLimit-Reset", strconv.FormatInt(ceilSeconds(result.Reset), 10))
+			header.Set("RateLimit-Policy", rule.String())
+			if result.Allowed {
+				return next(c)
+			}
+
+			retryAfter := ceilSeconds(result.RetryAfter)
+			if retryAfter < 1 {
+				retryAfter = 1
+			}
+			header.Set("Retry-After", strconv.FormatInt(retryAfter, 10))
+			l.ThrottledCounter.WithLabelValues(l.service, name, c.Request().Method, routePath(c)).Inc()
+			if log != nil {
+				log.Warn("Request throttled by rate limit",
+					zap.String("limit", name),
+					zap.String("key", k),
+					zap.Int64("retry_after_seconds", retryAfter))
+			}
+			return apperrors.TooManyRequests("rate limit exceeded")
+		}
+	}
+}
+
+// ceilSeconds rounds d up to whole seconds
+func ceilSeconds(d time.Duration) int64 {
+	if d <= 0 {
+		return 0
+	}
+	return int64(math.Ceil(d.Seconds()))
+}
+
+// routePath returns the route pattern, so that the path label stays bounded
+func routePath(c echo.Context) string {
+	if path := c.Path(); path != "" {
+		return path
+	}
+	return "unmatched"
+}
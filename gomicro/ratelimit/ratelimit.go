@@ -0,0 +1,216 @@
+// Package ratelimit throttles requests per client. A Limiter counts the requests of each key,
+// e.g. an IP address, a user or a tenant, in a Store with one of two algorithms: a token
+// bucket, which allows bursts up to its capacity, or a sliding window, which estimates the
+// requests of the last window from the current and previous fixed windows.
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Algorithm names accepted by Rule
+const (
+	TokenBucket   = "token_bucket"
+	SlidingWindow = "sliding_window"
+)
+
+// Rule limits a key to Requests per Window
+type Rule struct {
+	// Algorithm is TokenBucket or SlidingWindow; empty means TokenBucket
+	Algorithm string
+	Requests  int
+	Window    time.Duration
+	// Burst is the capacity of a token bucket; it defaults to Requests
+	Burst int
+}
+
+// ParseRule parses a limit of the form REQUESTS/WINDOW, e.g. "300/1m" or "10/s", as set by
+// RATE_LIMIT_API. An empty spec returns the zero Rule, which disables the limit.
+func ParseRule(algorithm, spec string) (Rule, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return Rule{}, nil
+	}
+
+	requests, window, ok := strings.Cut(spec, "/")
+	if !ok {
+		return Rule{}, fmt.Errorf("rate limit %q must have the form REQUESTS/WINDOW", spec)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(requests))
+	if err != nil {
+		return Rule{}, fmt.Errorf("rate limit %q has an invalid request count: %w", spec, err)
+	}
+	window = strings.TrimSpace(window)
+	// "10/s" is read as "10/1s"
+	if window != "" && (window[0] < '0' || window[0] > '9') {
+		window = "1" + window
+	}
+	d, err := time.ParseDuration(window)
+	if err != nil {
+		return Rule{}, fmt.Errorf("rate limit %q has an invalid window: %w", spec, err)
+	}
+
+	rule := Rule{Algorithm: algorithm, Requests: n, Window: d}
+	if err := rule.Validate(); err != nil {
+		return Rule{}, err
+	}
+	return rule, nil
+}
+
+// Enabled reports whether the rule limits anything
+func (r Rule) Enabled() bool {
+	return r != (Rule{})
+}
+
+// Validate checks that the rule can be enforced
+func (r Rule) Validate() error {
+	switch r.Algorithm {
+	case "", TokenBucket, SlidingWindow:
+	default:
+		return fmt.Errorf("unknown rate limit algorithm %q", r.Algorithm)
+	}
+	if r.Requests <= 0 || r.Window <= 0 {
+		return fmt.Errorf("rate limit needs a positive request count and window")
+	}
+	if r.Burst < 0 {
+		return fmt.Errorf("rate limit burst must not be negative")
+	}
+	return nil
+}
+
+// String formats the rule like the RateLimit-Policy header
+func (r Rule) String() string {
+	return fmt.Sprintf("%d;w=%d", r.limit(), int64(math.Ceil(r.Window.Seconds())))
+}
+
+// limit is the number of requests a key may make at once
+func (r Rule) limit() int {
+	if r.Algorithm != SlidingWindow && r.Burst > 0 {
+		return r.Burst
+	}
+	return r.Requests
+}
+
+// ttl is how long a state must be kept; a state dropped afterwards reads as a fresh one
+func (r Rule) ttl() time.Duration {
+	if r.Algorithm == SlidingWindow {
+		return 2 * r.Window
+	}
+	return time.Duration(float64(r.limit()) / r.rate() * float64(time.Second))
+}
+
+// rate is how many tokens a bucket regains per second
+func (r Rule) rate() float64 {
+	return float64(r.Requests) / r.Window.Seconds()
+}
+
+// State is what a Store keeps for a key; its meaning depends on the algorithm. The zero
+// State is a key without requests.
+type State struct {
+	// Value is the tokens left in a bucket or the requests of the current window
+	Value float64
+	// Previous is the requests of the previous window
+	Previous float64
+	// Stamp is when a bucket was last refilled or when the current window started
+	Stamp time.Time
+}
+
+// Result is the outcome of counting a request
+type Result struct {
+	Allowed bool
+	// Limit is the number of requests a key may make at once
+	Limit     int
+	Remaining int
+	// Reset is the time until the quota is restored
+	Reset time.Duration
+	// RetryAfter is the time until a denied request would be allowed
+	RetryAfter time.Duration
+}
+
+// take counts a request made at now against state
+func (r Rule) take(state *State, now time.Time) Result {
+	if r.Algorithm == SlidingWindow {
+		return r.takeWindow(state, now)
+	}
+	return r.takeToken(state, now)
+}
+
+// takeToken spends a token of the bucket, refilled at rate since it was last used
+func (r Rule) takeToken(state *State, now time.Time) Result {
+	capacity := float64(r.limit())
+	rate := r.rate()
+
+	if state.Stamp.IsZero() {
+		state.Value = capacity
+		state.Stamp = now
+	} else if elapsed := now.Sub(state.Stamp); elapsed > 0 {
+		// Replicas with a clock behind the stamp add nothing rather than move it back
+		state.Value = math.Min(capacity, state.Value+elapsed.Seconds()*rate)
+		state.Stamp = now
+	}
+
+	result := Result{Limit: r.limit()}
+	if state.Value >= 1 {
+		state.Value--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = seconds((1 - state.Value) / rate)
+	}
+	result.Remaining = int(state.Value)
+	result.Reset = seconds((capacity - state.Value) / rate)
+	return result
+}
+
+// takeWindow counts a request in the current fixed window and weighs the previous window by
+// how much of it still overlaps the sliding window ending at now
+func (r Rule) takeWindow(state *State, now time.Time) Result {
+	window := r.Window
+	start := now.Truncate(window)
+	switch {
+	case !state.Stamp.Before(start):
+		// The current window, possibly started by a replica with a clock ahead
+		start = state.Stamp
+	case state.Stamp.Equal(start.Add(-window)):
+		state.Previous = state.Value
+		state.Value = 0
+		state.Stamp = start
+	default:
+		state.Previous = 0
+		state.Value = 0
+		state.Stamp = start
+	}
+
+	elapsed := now.Sub(start)
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	weight := 1 - elapsed.Seconds()/window.Seconds()
+	limit := float64(r.Requests)
+	count := state.Previous*weight + state.Value
+
+	result := Result{Limit: r.Requests, Reset: window - elapsed}
+	if count+1 <= limit {
+		state.Value++
+		count++
+		result.Allowed = true
+	} else if state.Value <= limit-1 && state.Previous > 0 {
+		// Wait until enough of the previous window has slid out
+		overlap := (limit - 1 - state.Value) / state.Previous
+		result.RetryAfter = seconds((1-overlap)*window.Seconds() - elapsed.Seconds())
+	} else {
+		// The current window alone is full; wait until it has slid out far enough
+		overlap := (limit - 1) / state.Value
+		result.RetryAfter = window - elapsed + seconds((1-overlap)*window.Seconds())
+	}
+	result.Remaining = int(math.Max(0, limit-count))
+	return result
+}
+
+// seconds converts fractional seconds to a duration
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,216 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/suteetoe/gomicro/config"
+	apperrors "github.com/suteetoe/gomicro/errors"
+	"go.uber.org/zap"
+)
+
+func TestParseRule(t *testing.T) {
+	rule, err := ParseRule(SlidingWindow, "300/1m")
+	if err != nil || rule != (Rule{Algorithm: SlidingWindow, Requests: 300, Window: time.Minute}) {
+		t.Errorf("ParseRule(300/1m) = %+v, %v", rule, err)
+	}
+	if rule, err := ParseRule(TokenBucket, "10/s"); err != nil || rule.Window != time.Second {
+		t.Errorf("ParseRule(10/s) = %+v, %v", rule, err)
+	}
+	if rule, err := ParseRule(TokenBucket, ""); err != nil || rule.Enabled() {
+		t.Errorf("ParseRule(\"\") = %+v, %v; want a disabled rule", rule, err)
+	}
+	for _, spec := range []string{"300", "0/1m", "10/forever"} {
+		if _, err := ParseRule(TokenBucket, spec); err == nil {
+			t.Errorf("ParseRule(%q) succeeded", spec)
+		}
+	}
+	if _, err := ParseRule("leaky_bucket", "10/s"); err == nil {
+		t.Error("accepted an unknown algorithm")
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	rule := Rule{Algorithm: TokenBucket, Requests: 2, Window: time.Second, Burst: 3}
+	var state State
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 3; i++ {
+		if result := rule.take(&state, now); !result.Allowed || result.Remaining != 2-i {
+			t.Fatalf("request %d: %+v, want allowed with %d remaining", i, result, 2-i)
+		}
+	}
+	result := rule.take(&state, now)
+	if result.Allowed || result.RetryAfter != 500*time.Millisecond {
+		t.Fatalf("burst exceeded: %+v, want denied with retry after 500ms", result)
+	}
+
+	// Two tokens per second come back
+	if result := rule.take(&state, now.Add(500*time.Millisecond)); !result.Allowed || result.Remaining != 0 {
+		t.Errorf("after refill: %+v, want allowed with none remaining", result)
+	}
+	if result := rule.take(&state, now.Add(time.Hour)); !result.Allowed || result.Remaining != 2 {
+		t.Errorf("after idling: %+v, want a full bucket", result)
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	rule := Rule{Algorithm: SlidingWindow, Requests: 4, Window: time.Minute}
+	var state State
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 4; i++ {
+		if result := rule.take(&state, start.Add(30*time.Second)); !result.Allowed {
+			t.Fatalf("request %d denied: %+v", i, result)
+		}
+	}
+	result := rule.take(&state, start.Add(30*time.Second))
+	if result.Allowed || result.Reset != 30*time.Second {
+		t.Fatalf("window full: %+v, want denied until the window ends", result)
+	}
+	// The full window counts 3 when a quarter of it has slid out
+	if result.RetryAfter != 45*time.Second {
+		t.Errorf("retry after %v, want 45s", result.RetryAfter)
+	}
+
+	// A quarter into the next window the previous one still counts 3 of its 4 requests
+	if result := rule.take(&state, start.Add(75*time.Second)); !result.Allowed || result.Remaining != 0 {
+		t.Errorf("next window: %+v, want allowed with none remaining", result)
+	}
+	if result := rule.take(&state, start.Add(75*time.Second)); result.Allowed {
+		t.Errorf("next window over the limit: %+v, want denied", result)
+	}
+	if result := rule.take(&state, start.Add(10*time.Minute)); !result.Allowed || result.Remaining != 3 {
+		t.Errorf("after idling: %+v, want a fresh window", result)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	limiter, err := NewLimiter("test-service", NewMemoryStore(), WithRegisterer(prometheus.NewRegistry()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := echo.New()
+	e.HTTPErrorHandler = apperrors.NewHTTPErrorHandler()
+	e.POST("/auth/login", func(c echo.Context) error {
+		return c.NoContent(http.StatusNoContent)
+	}, limiter.Middleware("login", Rule{Requests: 2, Window: time.Minute}, KeyByIP()))
+
+	login := func(ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/auth/login", nil)
+		req.RemoteAddr = ip + ":1234"
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for i := 0; i < 2; i++ {
+		if rec := login("10.0.0.1"); rec.Code != http.StatusNoContent {
+			t.Fatalf("request %d: status %d", i, rec.Code)
+		}
+	}
+	rec := login("10.0.0.1")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status %d, want 429", rec.Code)
+	}
+	for header, want := range map[string]string{
+		"RateLimit-Limit":     "2",
+		"RateLimit-Remaining": "0",
+		"RateLimit-Policy":    "2;w=60",
+		"Retry-After":         "30",
+	} {
+		if got := rec.Header().Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+	if rec := login("10.0.0.2"); rec.Code != http.StatusNoContent {
+		t.Errorf("another IP: status %d", rec.Code)
+	}
+
+	throttled := testutil.ToFloat64(limiter.ThrottledCounter.WithLabelValues("test-service", "login", http.MethodPost, "/auth/login"))
+	if throttled != 1 {
+		t.Errorf("recorded %v throttled requests, want 1", throttled)
+	}
+}
+
+func TestApplyConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("rate_limit:\n  algorithm: sliding_window\n  api: 1/1m\n")
+	conf, err := config.Load("test-service", config.WithFile(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	limiter, err := NewLimiter("test-service", NewMemoryStore(), WithRegisterer(prometheus.NewRegistry()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rule, err := APIRule(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	watcher := config.NewWatcher(conf, zap.NewNop())
+	watcher.Subscribe("rate_limit", limiter.ApplyConfig(Limits{"api": APIRule}))
+
+	e := echo.New()
+	e.HTTPErrorHandler = apperrors.NewHTTPErrorHandler()
+	e.GET("/items", func(c echo.Context) error {
+		return c.NoContent(http.StatusNoContent)
+	}, limiter.Middleware("api", rule, KeyByIP()))
+	get := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/items", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	get()
+	if rec := get(); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status %d, want 429 under 1/1m", rec.Code)
+	}
+
+	// The raised limit applies to the next request, with the requests counted so far
+	write("rate_limit:\n  algorithm: sliding_window\n  api: 3/1m\n")
+	if err := watcher.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	rec := get()
+	if rec.Code != http.StatusNoContent || rec.Header().Get("RateLimit-Limit") != "3" {
+		t.Fatalf("status %d with limit %q, want the request admitted under 3/1m", rec.Code, rec.Header().Get("RateLimit-Limit"))
+	}
+
+	// An invalid rule is rejected and the current one stays
+	write("rate_limit:\n  algorithm: sliding_window\n  api: 0/1m\n")
+	if err := watcher.Reload(); err == nil {
+		t.Error("invalid rule accepted")
+	}
+	if got := limiter.Rule("api"); got.Requests != 3 {
+		t.Errorf("rule %+v after a rejected reload, want 3/1m", got)
+	}
+
+	// An empty rule disables the limit
+	write("rate_limit:\n  algorithm: sliding_window\n  api: \"\"\n")
+	if err := watcher.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if rec := get(); rec.Code != http.StatusNoContent || rec.Header().Get("RateLimit-Limit") != "" {
+			t.Fatalf("request %d: status %d with limit %q, want no limit", i, rec.Code, rec.Header().Get("RateLimit-Limit"))
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/suteetoe/gomicro/database"
+	"gorm.io/gorm"
+)
+
+// sweepInterval is how often stores delete expired states
+const sweepInterval = time.Minute
+
+// Store keeps the state of every key
+type Store interface {
+	// Update passes the state of key to fn, the zero State if there is none or it has expired,
+	// and keeps the changed state for ttl. Updates of one key are serialized, also across
+	// replicas sharing the store.
+	Update(ctx context.Context, key string, ttl time.Duration, fn func(state *State)) error
+}
+
+// Store names accepted by NewStore
+const (
+	StoreMemory   = "memory"
+	StorePostgres = "postgres"
+	// StoreNone disables rate limiting
+	StoreNone = "none"
+)
+
+// NewStore returns the store named by kind, e.g. from RATE_LIMIT_STORE. It returns nil for
+// StoreNone.
+func NewStore(kind string, db *gorm.DB) (Store, error) {
+	switch kind {
+	case StoreMemory:
+		return NewMemoryStore(), nil
+	case StorePostgres:
+		return NewDBStore(db), nil
+	case StoreNone, "":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit store %q", kind)
+	}
+}
+
+// MemoryStore keeps states in the process, so each replica enforces its own limits
+type MemoryStore struct {
+	mu        sync.Mutex
+	entries   map[string]memoryEntry
+	lastSweep time.Time
+}
+
+type memoryEntry struct {
+	state     State
+	expiresAt time.Time
+}
+
+// NewMemoryStore creates an in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]memoryEntry)}
+}
+
+// Update implements Store
+func (s *MemoryStore) Update(_ context.Context, key string, ttl time.Duration, fn func(state *State)) error {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.lastSweep) >= sweepInterval {
+		for k, entry := range s.entries {
+			if !entry.expiresAt.After(now) {
+				delete(s.entries, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	entry := s.entries[key]
+	if !entry.expiresAt.After(now) {
+		entry.state = State{}
+	}
+	fn(&entry.state)
+	entry.expiresAt = now.Add(ttl)
+	s.entries[key] = entry
+	return nil
+}
+
+// Bucket is a row of the rate_limit_buckets table
+type Bucket struct {
+	Key       string    `gorm:"primaryKey;size:255"`
+	Value     float64   `gorm:"not null"`
+	Previous  float64   `gorm:"not null"`
+	Stamp     time.Time `gorm:"not null"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+}
+
+// TableName overrides the table name used by Bucket
+func (Bucket) TableName() string {
+	return "rate_limit_buckets"
+}
+
+// Migrate creates or updates the rate_limit_buckets table, e.g. from a migration
+func Migrate(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&Bucket{}); err != nil {
+		return fmt.Errorf("failed to migrate rate limit buckets: %w", err)
+	}
+	return nil
+}
+
+// DBStore keeps states in Postgres, so that replicas of a service share their limits. Each
+// update locks the row of its key in a short transaction on the primary.
+type DBStore struct {
+	db *gorm.DB
+
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+// NewDBStore creates a store kept through db
+func NewDBStore(db *gorm.DB) *DBStore {
+	return &DBStore{db: db}
+}
+
+// Update implements Store
+func (s *DBStore) Update(ctx context.Context, key string, ttl time.Duration, fn func(state *State)) error {
+	// Buckets belong to no tenant
+	ctx = database.WithoutTenantScope(ctx)
+	now := time.Now().UTC()
+
+	err := database.Primary(s.db.WithContext(ctx)).Transaction(func(tx *gorm.DB) error {
+		// Create the row if it is missing and lock it in one round trip
+		var bucket Bucket
+		err := tx.Raw(`INSERT INTO rate_limit_buckets (key, value, previous, stamp, expires_at)
+			VALUES (?, 0, 0, ?, ?)
+			ON CONFLICT (key) DO UPDATE SET key = excluded.key
+			RETURNING key, value, previous, stamp, expires_at`, key, now, now).
+			Scan(&bucket).Error
+		if err != nil {
+			return fmt.Errorf("failed to lock rate limit bucket: %w", err)
+		}
+
+		var state State
+		if bucket.ExpiresAt.After(now) {
+			state = State{Value: bucket.Value, Previous: bucket.Previous, Stamp: bucket.Stamp}
+		}
+		fn(&state)
+
+		err = tx.Model(&Bucket{Key: key}).Updates(map[string]interface{}{
+			"value":      state.Value,
+			"previous":   state.Previous,
+			"stamp":      state.Stamp.UTC(),
+			"expires_at": now.Add(ttl),
+		}).Error
+		if err != nil {
+			return fmt.Errorf("failed to update rate limit bucket: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if s.sweepDue(now) {
+		err := s.db.WithContext(ctx).Where("expires_at < ?", now).Delete(&Bucket{}).Error
+		if err != nil {
+			return fmt.Errorf("failed to delete expired rate limit buckets: %w", err)
+		}
+	}
+	return nil
+}
+
+// sweepDue reports whether expired buckets should be deleted, at most once per sweepInterval
+func (s *DBStore) sweepDue(now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return false
+	}
+	s.lastSweep = now
+	return true
+}
@@ -0,0 +1,26 @@
+package server
+
+import (
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// requestID tags each request with the X-Request-ID of the caller, or a new one, and stores it
+// under "request_id" and a logger with it under "logger" in the echo context
+func requestID(log *zap.Logger) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			id := c.Request().Header.Get(echo.HeaderXRequestID)
+			if id == "" {
+				id = uuid.New().String()
+				c.Request().Header.Set(echo.HeaderXRequestID, id)
+			}
+			c.Response().Header().Set(echo.HeaderXRequestID, id)
+
+			c.Set("request_id", id)
+			c.Set("logger", log.With(zap.String("request_id", id)))
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,397 @@
+// Package server builds the HTTP server of a service the same way for every service: problem
+// details errors, request validation, a fixed middleware chain (recover, request ID, request
+// log, tracing, metrics), health probes, /metrics, the log level endpoint, background workers,
+// and a graceful shutdown on SIGINT or SIGTERM that drains in-flight requests, stops the
+// workers, closes the database pool and flushes the logs.
+//
+//	srv := server.New("supplier-service",
+//		server.WithLogger(log),
+//		server.WithDatabase(db),
+//		server.WithMetrics(httpMetrics),
+//		server.WithHealth(checks),
+//		server.WithLogLevels(cfg.Log.AdminToken, cfg.Log.LevelFile),
+//		server.WithAuth(middleware.AuthMiddleware),
+//		server.WithRoutes(func(r *server.Router) {
+//			suppliers := r.Secure("/api/suppliers")
+//			suppliers.GET("", handler.ListSuppliers)
+//		}),
+//	)
+//	if err := srv.Run(context.Background(), ":"+port); err != nil {
+//		log.Fatal("Server error", zap.Error(err))
+//	}
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	echomiddleware "github.com/labstack/echo/v4/middleware"
+	"github.com/suteetoe/gomicro/database"
+	apperrors "github.com/suteetoe/gomicro/errors"
+	"github.com/suteetoe/gomicro/health"
+	"github.com/suteetoe/gomicro/logger"
+	"github.com/suteetoe/gomicro/metrics"
+	"github.com/suteetoe/gomicro/middleware"
+	"github.com/suteetoe/gomicro/tracing"
+	"github.com/suteetoe/gomicro/validation"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// DefaultShutdownTimeout bounds the graceful shutdown, including draining in-flight requests
+const DefaultShutdownTimeout = 30 * time.Second
+
+// Option configures a Server
+type Option func(*Server)
+
+// WithLogger sets the logger of the server, which request loggers are derived from
+func WithLogger(log *zap.Logger) Option {
+	return func(s *Server) {
+		s.log = log
+	}
+}
+
+// WithDatabase sets the database whose connection pool is closed on shutdown, after the
+// in-flight requests are drained
+func WithDatabase(db *gorm.DB) Option {
+	return func(s *Server) {
+		s.db = db
+	}
+}
+
+// WithMetrics records the HTTP metrics of every request and serves them on /metrics, and the
+// SLO report on /slo
+func WithMetrics(m *metrics.HTTPMetrics) Option {
+	return func(s *Server) {
+		s.metrics = m
+	}
+}
+
+// WithAuth sets the authentication middleware of the groups created with Router.Secure
+func WithAuth(m ...echo.MiddlewareFunc) Option {
+	return func(s *Server) {
+		s.auth = append(s.auth, m...)
+	}
+}
+
+// WithMiddleware adds middleware that runs on every request after the standard chain, e.g. CORS
+// or the metrics a service keeps for compatibility
+func WithMiddleware(m ...echo.MiddlewareFunc) Option {
+	return func(s *Server) {
+		s.middleware = append(s.middleware, m...)
+	}
+}
+
+// WithRoutes registers the routes of the service; routes are registered in the order of the
+// WithRoutes options
+func WithRoutes(routes func(r *Router)) Option {
+	return func(s *Server) {
+		s.routes = append(s.routes, routes)
+	}
+}
+
+// WithRequestLogger replaces the middleware logging each request, logger.Middleware by default
+func WithRequestLogger(m echo.MiddlewareFunc) Option {
+	return func(s *Server) {
+		s.requestLogger = m
+	}
+}
+
+// WithErrorHandler replaces the problem details error handler, e.g. to answer some routes in
+// another error format
+func WithErrorHandler(handler echo.HTTPErrorHandler) Option {
+	return func(s *Server) {
+		s.errorHandler = handler
+	}
+}
+
+// WithHealthHandler replaces the handler of /health
+func WithHealthHandler(handler echo.HandlerFunc) Option {
+	return func(s *Server) {
+		s.health = handler
+	}
+}
+
+// WithHealth serves the liveness probe of checks on /livez and the readiness probe on /readyz
+// and /health, and refreshes the checks in a worker while the server runs
+func WithHealth(checks *health.Health) Option {
+	return func(s *Server) {
+		s.checks = checks
+		s.workers = append(s.workers, worker{name: "health checks", fn: checks.Run})
+	}
+}
+
+// WithLogLevels serves the log levels on GET and PUT /admin/log-level behind the admin token (see
+// logger.LevelHandler and middleware.AdminTokenMiddleware) and, with a level file, re-reads the
+// levels from it on SIGHUP while the server runs
+func WithLogLevels(adminToken, levelFile string) Option {
+	return func(s *Server) {
+		s.levelAuth = middleware.AdminTokenMiddleware(adminToken)
+		if levelFile != "" {
+			s.workers = append(s.workers, worker{name: "log level reload", fn: func(ctx context.Context) {
+				defer logger.ReloadOnSIGHUP(levelFile)()
+				<-ctx.Done()
+			}})
+		}
+	}
+}
+
+// WithShutdownTimeout bounds the graceful shutdown (DefaultShutdownTimeout)
+func WithShutdownTimeout(timeout time.Duration) Option {
+	return func(s *Server) {
+		s.shutdownTimeout = timeout
+	}
+}
+
+// WithShutdownHook runs fn on shutdown once the in-flight requests are drained and the workers
+// stopped, and before the database is closed, e.g. to close a client. Hooks run in reverse order
+// of registration, like deferred calls.
+func WithShutdownHook(name string, fn func(ctx context.Context) error) Option {
+	return func(s *Server) {
+		s.hooks = append(s.hooks, hook{name: name, fn: fn})
+	}
+}
+
+// WithWorker runs fn in the background while the server runs, e.g. an outbox relay. On shutdown
+// its context is canceled once the in-flight requests are drained, and the shutdown waits for fn
+// to return before the hooks run. A nil fn is ignored, for workers disabled by configuration.
+func WithWorker(name string, fn func(ctx context.Context)) Option {
+	return func(s *Server) {
+		if fn != nil {
+			s.workers = append(s.workers, worker{name: name, fn: fn})
+		}
+	}
+}
+
+type worker struct {
+	name string
+	fn   func(ctx context.Context)
+}
+
+type hook struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// Server is the HTTP server of a service
+type Server struct {
+	name string
+	echo *echo.Echo
+
+	log             *zap.Logger
+	db              *gorm.DB
+	metrics         *metrics.HTTPMetrics
+	auth            []echo.MiddlewareFunc
+	middleware      []echo.MiddlewareFunc
+	routes          []func(r *Router)
+	requestLogger   echo.MiddlewareFunc
+	errorHandler    echo.HTTPErrorHandler
+	health          echo.HandlerFunc
+	checks          *health.Health
+	levelAuth       echo.MiddlewareFunc
+	shutdownTimeout time.Duration
+	hooks           []hook
+	workers         []worker
+
+	stopWorkers  context.CancelFunc
+	workersDone  sync.WaitGroup
+	shutdownOnce sync.Once
+	shutdownErr  error
+}
+
+// Router registers the routes of a service, see WithRoutes
+type Router struct {
+	*echo.Echo
+	auth []echo.MiddlewareFunc
+}
+
+// Secure returns a group under prefix whose routes require the authentication of WithAuth,
+// followed by m. It panics without WithAuth rather than serving the routes unauthenticated.
+func (r *Router) Secure(prefix string, m ...echo.MiddlewareFunc) *echo.Group {
+	if len(r.auth) == 0 {
+		panic("server: Secure(" + prefix + ") requires WithAuth")
+	}
+	chain := make([]echo.MiddlewareFunc, 0, len(r.auth)+len(m))
+	return r.Group(prefix, append(append(chain, r.auth...), m...)...)
+}
+
+// New builds the server of the named service
+func New(name string, opts ...Option) *Server {
+	s := &Server{
+		name:            name,
+		log:             zap.NewNop(),
+		shutdownTimeout: DefaultShutdownTimeout,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.requestLogger == nil {
+		s.requestLogger = logger.Middleware()
+	}
+	if s.errorHandler == nil {
+		s.errorHandler = apperrors.NewHTTPErrorHandler(apperrors.WithLogger(s.log))
+	}
+	if s.health == nil && s.checks != nil {
+		s.health = s.checks.ReadinessHandler()
+	}
+	if s.health == nil {
+		s.health = func(c echo.Context) error {
+			return c.JSON(http.StatusOK, echo.Map{"status": "ok", "service": s.name})
+		}
+	}
+
+	e := echo.New()
+	e.HideBanner = true
+	e.HidePort = true
+	e.HTTPErrorHandler = s.errorHandler
+	e.Validator = validation.New()
+
+	// The order matters: handlers and the request log see the request ID, and tracing and
+	// metrics cover the middleware of the service
+	e.Use(echomiddleware.Recover())
+	e.Use(requestID(s.log))
+	e.Use(s.requestLogger)
+	e.Use(tracing.Middleware(name))
+	if s.metrics != nil {
+		e.Use(s.metrics.Middleware())
+	}
+	e.Use(s.middleware...)
+
+	e.GET("/health", s.health)
+	if s.checks != nil {
+		e.GET("/livez", s.checks.LivenessHandler())
+		e.GET("/readyz", s.checks.ReadinessHandler())
+	}
+	if s.metrics != nil {
+		e.GET("/metrics", echo.WrapHandler(s.metrics.Handler()))
+		e.GET("/slo", s.metrics.SLOHandler())
+	}
+	if s.levelAuth != nil {
+		admin := e.Group("/admin", s.levelAuth)
+		admin.GET("/log-level", logger.LevelHandler())
+		admin.PUT("/log-level", logger.LevelHandler())
+	}
+
+	router := &Router{Echo: e, auth: s.auth}
+	for _, routes := range s.routes {
+		routes(router)
+	}
+
+	s.echo = e
+	return s
+}
+
+// Echo returns the Echo instance of the server
+func (s *Server) Echo() *echo.Echo {
+	return s.echo
+}
+
+// Run serves on addr until ctx is done or the process receives SIGINT or SIGTERM, then shuts
+// down gracefully. It returns the error of the server, if it failed to start or stopped
+// unexpectedly, joined with the errors of the shutdown.
+func (s *Server) Run(ctx context.Context, addr string) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	s.startWorkers()
+
+	served := make(chan error, 1)
+	go func() {
+		s.log.Info("Starting server", zap.String("service", s.name), zap.String("address", addr))
+		served <- s.echo.Start(addr)
+	}()
+
+	var err error
+	select {
+	case err = <-served:
+	case <-ctx.Done():
+		s.log.Info("Shutting down, draining in-flight requests", zap.Duration("timeout", s.shutdownTimeout))
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		err = nil
+	}
+	return errors.Join(err, s.Shutdown(context.Background()))
+}
+
+// Shutdown stops accepting connections, waits for the in-flight requests, stops the workers,
+// runs the shutdown hooks, closes the database pool, flushes pending spans and syncs the logger, within the
+// shutdown timeout. Only the first call shuts down; later calls return its result.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.shutdownOnce.Do(func() {
+		ctx, cancel := context.WithTimeout(ctx, s.shutdownTimeout)
+		defer cancel()
+
+		var errs []error
+		if err := s.echo.Shutdown(ctx); err != nil {
+			s.log.Error("Failed to drain in-flight requests", zap.Error(err))
+			errs = append(errs, err)
+		}
+		if err := s.waitWorkers(ctx); err != nil {
+			s.log.Error("Workers did not stop", zap.Error(err))
+			errs = append(errs, err)
+		}
+		for i := len(s.hooks) - 1; i >= 0; i-- {
+			if err := s.hooks[i].fn(ctx); err != nil {
+				s.log.Error("Shutdown hook failed", zap.String("hook", s.hooks[i].name), zap.Error(err))
+				errs = append(errs, err)
+			}
+		}
+		if s.db != nil {
+			if err := database.Close(s.db); err != nil {
+				s.log.Error("Failed to close the database", zap.Error(err))
+				errs = append(errs, err)
+			}
+		}
+		if err := tracing.Shutdown(ctx); err != nil {
+			s.log.Error("Failed to flush traces", zap.Error(err))
+			errs = append(errs, err)
+		}
+		s.log.Info("Server stopped", zap.String("service", s.name))
+
+		// Syncing a console logger fails on some platforms; there is nowhere to report it
+		_ = s.log.Sync()
+		s.shutdownErr = errors.Join(errs...)
+	})
+	return s.shutdownErr
+}
+
+// startWorkers starts the workers of WithWorker
+func (s *Server) startWorkers() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.stopWorkers = cancel
+	for _, w := range s.workers {
+		s.workersDone.Add(1)
+		go func(w worker) {
+			defer s.workersDone.Done()
+			s.log.Info("Starting worker", zap.String("worker", w.name))
+			w.fn(ctx)
+		}(w)
+	}
+}
+
+// waitWorkers cancels the workers and waits for them to return until ctx is done
+func (s *Server) waitWorkers(ctx context.Context) error {
+	if s.stopWorkers == nil {
+		return nil
+	}
+	s.stopWorkers()
+
+	done := make(chan struct{})
+	go func() {
+		s.workersDone.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
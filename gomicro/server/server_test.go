@@ -0,0 +1,211 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	apperrors "github.com/suteetoe/gomicro/errors"
+	"github.com/suteetoe/gomicro/health"
+	"github.com/suteetoe/gomicro/logger"
+)
+
+func TestNew(t *testing.T) {
+	auth := func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if c.Request().Header.Get(echo.HeaderAuthorization) == "" {
+				return apperrors.Unauthorized("authentication required")
+			}
+			return next(c)
+		}
+	}
+	srv := New("test-service",
+		WithAuth(auth),
+		WithRoutes(func(r *Router) {
+			r.GET("/hello", func(c echo.Context) error {
+				return c.String(http.StatusOK, c.Get("request_id").(string))
+			})
+			r.Secure("/api").GET("/items", func(c echo.Context) error {
+				return c.NoContent(http.StatusNoContent)
+			})
+		}),
+	)
+
+	serve := func(path string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		rec := httptest.NewRecorder()
+		srv.Echo().ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := serve("/health", nil); rec.Code != http.StatusOK || rec.Header().Get(echo.HeaderXRequestID) == "" {
+		t.Errorf("health: %d %v", rec.Code, rec.Header())
+	}
+	// The request ID of the caller is kept
+	if rec := serve("/hello", http.Header{echo.HeaderXRequestID: {"req-1"}}); rec.Body.String() != "req-1" ||
+		rec.Header().Get(echo.HeaderXRequestID) != "req-1" {
+		t.Errorf("request ID: %q %v", rec.Body.String(), rec.Header())
+	}
+	if rec := serve("/api/items", nil); rec.Code != http.StatusUnauthorized ||
+		rec.Header().Get(echo.HeaderContentType) != apperrors.MIMEProblemJSON {
+		t.Errorf("secure route without credentials: %d %v", rec.Code, rec.Header())
+	}
+	if rec := serve("/api/items", http.Header{echo.HeaderAuthorization: {"Bearer token"}}); rec.Code != http.StatusNoContent {
+		t.Errorf("secure route: %d", rec.Code)
+	}
+}
+
+func TestWithHealth(t *testing.T) {
+	checks, err := health.New("test-service", health.WithRegisterer(prometheus.NewRegistry()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checks.AddReadiness("database", func(context.Context) error { return errors.New("connection refused") })
+	srv := New("test-service", WithHealth(checks))
+
+	for path, want := range map[string]int{
+		"/livez":  http.StatusOK,
+		"/readyz": http.StatusServiceUnavailable,
+		"/health": http.StatusServiceUnavailable,
+	} {
+		rec := httptest.NewRecorder()
+		srv.Echo().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != want {
+			t.Errorf("%s: %d, want %d", path, rec.Code, want)
+		}
+	}
+}
+
+func TestSecureWithoutAuth(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Secure without WithAuth did not panic")
+		}
+	}()
+	New("test-service", WithRoutes(func(r *Router) {
+		r.Secure("/api")
+	}))
+}
+
+func TestRunDrainsRequests(t *testing.T) {
+	started := make(chan struct{})
+	var hooks []string
+	srv := New("test-service",
+		WithShutdownTimeout(5*time.Second),
+		WithWorker("relay", func(ctx context.Context) {
+			<-ctx.Done()
+			hooks = append(hooks, "worker")
+		}),
+		WithShutdownHook("first", func(context.Context) error {
+			hooks = append(hooks, "first")
+			return nil
+		}),
+		WithShutdownHook("second", func(context.Context) error {
+			hooks = append(hooks, "second")
+			return nil
+		}),
+		WithRoutes(func(r *Router) {
+			r.GET("/slow", func(c echo.Context) error {
+				close(started)
+				time.Sleep(200 * time.Millisecond)
+				return c.String(http.StatusOK, "done")
+			})
+		}),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ran := make(chan error, 1)
+	go func() { ran <- srv.Run(ctx, "127.0.0.1:0") }()
+
+	var addr string
+	for deadline := time.Now().Add(5 * time.Second); addr == "" && time.Now().Before(deadline); {
+		if listener := srv.Echo().ListenerAddr(); listener != nil {
+			addr = listener.String()
+		} else {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	if addr == "" {
+		t.Fatal("server did not start")
+	}
+
+	type response struct {
+		body string
+		err  error
+	}
+	responses := make(chan response, 1)
+	go func() {
+		res, err := http.Get("http://" + addr + "/slow")
+		if err != nil {
+			responses <- response{err: err}
+			return
+		}
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		responses <- response{body: string(body), err: err}
+	}()
+
+	// Shut down while the request is in flight
+	<-started
+	cancel()
+
+	if res := <-responses; res.err != nil || res.body != "done" {
+		t.Errorf("in-flight request: %q %v", res.body, res.err)
+	}
+	if err := <-ran; err != nil {
+		t.Errorf("Run: %v", err)
+	}
+	// Workers stop before the hooks, which run in reverse order
+	if len(hooks) != 3 || hooks[0] != "worker" || hooks[1] != "second" || hooks[2] != "first" {
+		t.Errorf("hooks ran as %v", hooks)
+	}
+}
+
+func TestWithLogLevels(t *testing.T) {
+	t.Cleanup(func() { _ = logger.ApplyLevels(logger.Levels{Level: "info"}) })
+
+	serve := func(srv *Server, method, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/admin/log-level", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		if token != "" {
+			req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		srv.Echo().ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := serve(New("test-service"), http.MethodGet, "admin", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("log levels served without WithLogLevels: %d", rec.Code)
+	}
+	// Without an admin token the endpoint stays closed
+	if rec := serve(New("test-service", WithLogLevels("", "")), http.MethodGet, "admin", ""); rec.Code != http.StatusForbidden {
+		t.Errorf("without an admin token: %d", rec.Code)
+	}
+
+	srv := New("test-service", WithLogLevels("admin", "levels.json"))
+	if rec := serve(srv, http.MethodPut, "guess", `{"level":"debug"}`); rec.Code != http.StatusUnauthorized {
+		t.Errorf("wrong admin token: %d", rec.Code)
+	}
+	rec := serve(srv, http.MethodPut, "admin", `{"component":"database","level":"debug"}`)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"database":"debug"`) {
+		t.Errorf("PUT: %d %s", rec.Code, rec.Body)
+	}
+	if got := logger.GetLevels().Components["database"]; got != "debug" {
+		t.Errorf("database level %q", got)
+	}
+	// The level file is re-read on SIGHUP by a worker
+	if len(srv.workers) != 1 || srv.workers[0].name != "log level reload" {
+		t.Errorf("workers %v", srv.workers)
+	}
+}
@@ -0,0 +1,75 @@
+package tracing
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	apperrors "github.com/suteetoe/gomicro/errors"
+	"github.com/suteetoe/gomicro/metrics"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// Middleware returns an Echo middleware that starts a server span for each request
+func Middleware(serviceName string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+
+			// Continue the trace started by the caller, if any
+			ctx := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+
+			// Requests that matched no route share one span name so raw paths stay out of span names
+			route := c.Path()
+			if route == "" {
+				route = metrics.UnmatchedRouteLabel
+			}
+
+			ctx, span := Tracer().Start(ctx, req.Method+" "+route,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					attribute.String("service", serviceName),
+					semconv.HTTPRequestMethodKey.String(req.Method),
+					semconv.HTTPRoute(route),
+					semconv.URLPath(req.URL.Path),
+					semconv.ClientAddress(c.RealIP()),
+				),
+			)
+			defer span.End()
+
+			c.SetRequest(req.WithContext(ctx))
+
+			// Correlate logs with the trace when a request logger is present
+			if log, ok := c.Get("logger").(*zap.Logger); ok && span.SpanContext().HasTraceID() {
+				c.Set("logger", log.With(zap.String("trace_id", span.SpanContext().TraceID().String())))
+			}
+
+			err := next(c)
+
+			status := c.Response().Status
+			if err != nil {
+				status = apperrors.StatusCode(err)
+				span.RecordError(err)
+			}
+
+			// The router reports the closest route for requests it could not match, so name them after the error
+			if errors.Is(err, echo.ErrNotFound) || errors.Is(err, echo.ErrMethodNotAllowed) {
+				span.SetName(req.Method + " " + metrics.UnmatchedRouteLabel)
+				span.SetAttributes(semconv.HTTPRoute(metrics.UnmatchedRouteLabel))
+			}
+
+			span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+			if status >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(status))
+			}
+
+			return err
+		}
+	}
+}
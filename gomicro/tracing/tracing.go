@@ -0,0 +1,111 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName identifies spans created by this package
+const instrumentationName = "github.com/suteetoe/gomicro/tracing"
+
+// TracingConfig holds tracing configuration
+type TracingConfig struct {
+	ServiceName string
+	Environment string
+	Enabled     bool
+	Endpoint    string // OTLP/HTTP collector address, e.g. "jaeger:4318"
+	Insecure    bool
+	SampleRatio float64
+
+	// Exporter overrides the OTLP exporter when set. Spans are exported
+	// synchronously, so tests can pass tracetest.NewInMemoryExporter().
+	Exporter sdktrace.SpanExporter
+}
+
+var provider *sdktrace.TracerProvider
+
+// InitTracer initializes the global tracer provider and W3C propagator
+func InitTracer(ctx context.Context, config *TracingConfig) error {
+	// Always propagate trace context so upstream traces pass through
+	// even when this service does not export spans itself
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	if !config.Enabled && config.Exporter == nil {
+		return nil
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(config.ServiceName),
+		semconv.DeploymentEnvironment(config.Environment),
+	))
+	if err != nil {
+		return fmt.Errorf("failed to create tracing resource: %w", err)
+	}
+
+	sampleRatio := config.SampleRatio
+	if sampleRatio <= 0 || sampleRatio > 1 {
+		sampleRatio = 1
+	}
+
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+	}
+
+	if config.Exporter != nil {
+		opts = append(opts, sdktrace.WithSyncer(config.Exporter))
+	} else {
+		exporterOpts := []otlptracehttp.Option{}
+		if config.Endpoint != "" {
+			exporterOpts = append(exporterOpts, otlptracehttp.WithEndpoint(config.Endpoint))
+		}
+		if config.Insecure {
+			exporterOpts = append(exporterOpts, otlptracehttp.WithInsecure())
+		}
+
+		exporter, err := otlptracehttp.New(ctx, exporterOpts...)
+		if err != nil {
+			return fmt.Errorf("failed to create OTLP exporter: %w", err)
+		}
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+	}
+
+	provider = sdktrace.NewTracerProvider(opts...)
+	otel.SetTracerProvider(provider)
+
+	return nil
+}
+
+// Shutdown flushes pending spans and stops the tracer provider
+func Shutdown(ctx context.Context) error {
+	if provider == nil {
+		return nil
+	}
+	return provider.Shutdown(ctx)
+}
+
+// Tracer returns the tracer used by gomicro instrumentation
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// TraceID returns the trace ID of the span in ctx, or an empty string if there is none
+func TraceID(ctx context.Context) string {
+	spanCtx := trace.SpanContextFromContext(ctx)
+	if !spanCtx.HasTraceID() {
+		return ""
+	}
+	return spanCtx.TraceID().String()
+}
@@ -0,0 +1,142 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// upstreamTraceparent is the trace context sent by the caller of the service
+const upstreamTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestMiddlewareAndTransportShareTheTrace(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	if err := InitTracer(context.Background(), &TracingConfig{ServiceName: "test-service", Exporter: exporter}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		Shutdown(context.Background())
+		provider = nil
+		otel.SetTracerProvider(noop.NewTracerProvider())
+	})
+
+	// The downstream service records the trace context it receives
+	var received string
+	downstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get("traceparent")
+	}))
+	defer downstream.Close()
+
+	httpClient := &http.Client{Transport: NewTransport(nil)}
+	e := echo.New()
+	e.Use(Middleware("test-service"))
+	e.GET("/items/:id", func(c echo.Context) error {
+		req, err := http.NewRequestWithContext(c.Request().Context(), http.MethodGet, downstream.URL+"/stock", nil)
+		if err != nil {
+			return err
+		}
+		res, err := httpClient.Do(req)
+		if err != nil {
+			return err
+		}
+		res.Body.Close()
+		return c.NoContent(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/items/42", nil)
+	req.Header.Set("traceparent", upstreamTraceparent)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d", rec.Code)
+	}
+
+	// The client span ends first
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("exported %d spans, want the server and the client span", len(spans))
+	}
+	client, server := spans[0], spans[1]
+	if server.SpanKind != trace.SpanKindServer || client.SpanKind != trace.SpanKindClient {
+		t.Fatalf("span kinds %v, %v", server.SpanKind, client.SpanKind)
+	}
+	if server.Name != "GET /items/:id" {
+		t.Errorf("server span named %q", server.Name)
+	}
+
+	// One trace from the caller down to the downstream service
+	traceID := server.SpanContext.TraceID()
+	if traceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || client.SpanContext.TraceID() != traceID {
+		t.Errorf("trace IDs %s, %s", traceID, client.SpanContext.TraceID())
+	}
+	if !server.Parent.IsRemote() || server.Parent.SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("server span parent %s, want the caller's span", server.Parent.SpanID())
+	}
+	if client.Parent.SpanID() != server.SpanContext.SpanID() {
+		t.Errorf("client span parent %s, want the server span %s", client.Parent.SpanID(), server.SpanContext.SpanID())
+	}
+
+	// The injected traceparent names the client span
+	want := "00-" + traceID.String() + "-" + client.SpanContext.SpanID().String() + "-01"
+	if received != want {
+		t.Errorf("downstream received traceparent %q, want %q", received, want)
+	}
+
+	if status := attributeValue(server.Attributes, "http.response.status_code"); status.AsInt64() != http.StatusOK {
+		t.Errorf("server span status %v", status.Emit())
+	}
+	if url := attributeValue(client.Attributes, "url.full"); !strings.HasSuffix(url.AsString(), "/stock") {
+		t.Errorf("client span url %q", url.AsString())
+	}
+}
+
+func TestMiddlewareNamesUnmatchedRoutes(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	if err := InitTracer(context.Background(), &TracingConfig{ServiceName: "test-service", Exporter: exporter}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		Shutdown(context.Background())
+		provider = nil
+		otel.SetTracerProvider(noop.NewTracerProvider())
+	})
+
+	e := echo.New()
+	e.Use(Middleware("test-service"))
+	e.GET("/items/:id", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/wp-login.php", nil))
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodDelete, "/items/42", nil))
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("exported %d spans", len(spans))
+	}
+	for _, span := range spans {
+		if !strings.HasSuffix(span.Name, " unmatched") {
+			t.Errorf("span named %q, want the unmatched route", span.Name)
+		}
+		if path := attributeValue(span.Attributes, "url.path"); path.AsString() == "" {
+			t.Error("span lost the request path attribute")
+		}
+	}
+}
+
+// attributeValue returns the value of the attribute named key
+func attributeValue(attributes []attribute.KeyValue, key attribute.Key) attribute.Value {
+	for _, kv := range attributes {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
@@ -0,0 +1,80 @@
+package validation
+
+import (
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// Custom rules, used in `validate` tags next to the rules of go-playground/validator
+const (
+	// RuleSKU accepts stock keeping units such as PROD-12345, at most 100 characters
+	RuleSKU = "sku"
+	// RulePhone accepts E.164 phone numbers such as +66812345678
+	RulePhone = "phone"
+	// RuleTaxID accepts tax identification numbers such as 0105556000123 or DE 123.456.789
+	RuleTaxID = "tax_id"
+	// RuleRedirectURI accepts OAuth redirect URIs (RFC 6749 section 3.1.2, RFC 8252 section 7)
+	RuleRedirectURI = "redirect_uri"
+)
+
+var (
+	skuPattern   = regexp.MustCompile(`^[A-Za-z0-9]+(?:[-_.][A-Za-z0-9]+)*$`)
+	phonePattern = regexp.MustCompile(`^\+[1-9][0-9]{1,14}$`)
+	taxIDPattern = regexp.MustCompile(`^[A-Za-z0-9]+(?:[-. /][A-Za-z0-9]+)*$`)
+)
+
+// rules are the custom rules registered by New
+var rules = map[string]func(string) bool{
+	RuleSKU:         validSKU,
+	RulePhone:       phonePattern.MatchString,
+	RuleTaxID:       validTaxID,
+	RuleRedirectURI: validRedirectURI,
+}
+
+// stringRule adapts a rule on strings to validator; fields of other kinds fail it
+func stringRule(rule func(string) bool) validator.Func {
+	return func(fl validator.FieldLevel) bool {
+		value, ok := fl.Field().Interface().(string)
+		return ok && rule(value)
+	}
+}
+
+func validSKU(sku string) bool {
+	return len(sku) <= 100 && skuPattern.MatchString(sku)
+}
+
+func validTaxID(taxID string) bool {
+	digits := 0
+	for _, r := range taxID {
+		if r >= '0' && r <= '9' || r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' {
+			digits++
+		}
+	}
+	return digits >= 5 && digits <= 20 && taxIDPattern.MatchString(taxID)
+}
+
+// validRedirectURI accepts absolute URIs without a fragment that use https, http on a loopback
+// address for native apps, or a private-use scheme such as com.example.app
+func validRedirectURI(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil || !u.IsAbs() || strings.Contains(uri, "#") {
+		return false
+	}
+	switch u.Scheme {
+	case "https":
+		return u.Host != ""
+	case "http":
+		host := u.Hostname()
+		if host == "localhost" {
+			return true
+		}
+		ip := net.ParseIP(host)
+		return ip != nil && ip.IsLoopback()
+	default:
+		return strings.Contains(u.Scheme, ".")
+	}
+}
@@ -0,0 +1,127 @@
+// Package validation provides an Echo Validator that enforces the `validate` struct tags of
+// request types (github.com/go-playground/validator) and answers invalid requests with a
+// validation problem listing each invalid field under its JSON name.
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	apperrors "github.com/suteetoe/gomicro/errors"
+)
+
+// messages describe the failed rules; %s is replaced by the parameter of the rule
+var messages = map[string]string{
+	"required":      "is required",
+	"required_if":   "is required",
+	"email":         "must be a valid email address",
+	"url":           "must be a valid URL",
+	"uuid":          "must be a valid UUID",
+	"gt":            "must be greater than %s",
+	"gte":           "must be at least %s",
+	"lt":            "must be less than %s",
+	"lte":           "must be at most %s",
+	"min":           "must be at least %s",
+	"max":           "must be at most %s",
+	"len":           "must have a length of %s",
+	"oneof":         "must be one of: %s",
+	"e164":          "must be an E.164 phone number, e.g. +66812345678",
+	RuleSKU:         "must be letters and digits separated by single hyphens, underscores or dots",
+	RulePhone:       "must be an E.164 phone number, e.g. +66812345678",
+	RuleTaxID:       "must be 5 to 20 letters and digits separated by single hyphens, spaces, dots or slashes",
+	RuleRedirectURI: "must be an absolute https URI without a fragment, an http loopback URI or a private-use URI",
+}
+
+// Validator validates requests for echo.Echo.Validator:
+//
+//	e.Validator = validation.New()
+//
+//	if err := c.Bind(&req); err != nil { ... }
+//	if err := c.Validate(&req); err != nil {
+//		return err
+//	}
+type Validator struct {
+	validate *validator.Validate
+}
+
+// New creates a validator with the custom rules of this package registered
+func New() *Validator {
+	validate := validator.New(validator.WithRequiredStructEnabled())
+
+	// Report fields under the name clients send them with
+	validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		switch name {
+		case "-":
+			return ""
+		case "":
+			return field.Name
+		}
+		return name
+	})
+
+	for tag, rule := range rules {
+		// Rules only fail to register on an invalid tag, which is a programming error
+		if err := validate.RegisterValidation(tag, stringRule(rule)); err != nil {
+			panic(fmt.Sprintf("validation: rule %s: %v", tag, err))
+		}
+	}
+	return &Validator{validate: validate}
+}
+
+// Validate implements echo.Validator. It returns an apperrors validation error listing the
+// invalid fields, or nil when i is valid.
+func (v *Validator) Validate(i interface{}) error {
+	err := v.validate.Struct(i)
+	if err == nil {
+		return nil
+	}
+
+	var invalid validator.ValidationErrors
+	if !errors.As(err, &invalid) {
+		// i is not a struct; the handler passed the wrong value
+		return apperrors.Internal("Failed to validate the request", err)
+	}
+
+	problem := apperrors.Validation("The request has invalid fields")
+	for _, fieldErr := range invalid {
+		problem.WithField(fieldName(fieldErr), message(fieldErr))
+	}
+	return problem
+}
+
+// fieldName returns the path of an invalid field without the name of the request type,
+// e.g. redirect_uris[0]
+func fieldName(fieldErr validator.FieldError) string {
+	if _, path, ok := strings.Cut(fieldErr.Namespace(), "."); ok {
+		return path
+	}
+	return fieldErr.Field()
+}
+
+// message describes the rule a field failed
+func message(fieldErr validator.FieldError) string {
+	msg, ok := messages[fieldErr.Tag()]
+	if !ok {
+		return fmt.Sprintf("failed the %s rule", fieldErr.Tag())
+	}
+	if !strings.Contains(msg, "%s") {
+		return msg
+	}
+	msg = fmt.Sprintf(msg, fieldErr.Param())
+
+	// Lengths are counted in characters for strings and in items for lists
+	switch fieldErr.Tag() {
+	case "min", "max", "len":
+		switch fieldErr.Kind() {
+		case reflect.String:
+			msg += " characters"
+		case reflect.Slice, reflect.Array, reflect.Map:
+			msg += " items"
+		}
+	}
+	return msg
+}
@@ -0,0 +1,79 @@
+package validation
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	apperrors "github.com/suteetoe/gomicro/errors"
+)
+
+func TestValidate(t *testing.T) {
+	type client struct {
+		Name         string   `json:"name" validate:"required"`
+		Email        string   `json:"email,omitempty" validate:"omitempty,email"`
+		Phone        string   `json:"phone" validate:"omitempty,phone"`
+		RedirectURIs []string `json:"redirect_uris" validate:"required,dive,redirect_uri"`
+	}
+	v := New()
+
+	if err := v.Validate(&client{Name: "web", RedirectURIs: []string{"https://app.example.com/callback"}}); err != nil {
+		t.Fatalf("valid request rejected: %v", err)
+	}
+
+	err := v.Validate(&client{Email: "nope", Phone: "0812345678", RedirectURIs: []string{"https://ok.example.com/cb", "http://evil.example.com/cb"}})
+	var problem *apperrors.Error
+	if !errors.As(err, &problem) || problem.Status != http.StatusBadRequest || problem.Type != apperrors.TypeValidation {
+		t.Fatalf("unexpected error %v", err)
+	}
+	got := map[string]string{}
+	for _, field := range problem.Fields {
+		got[field.Field] = field.Message
+	}
+	for _, field := range []string{"name", "email", "phone", "redirect_uris[1]"} {
+		if got[field] == "" {
+			t.Errorf("missing error for %s in %v", field, got)
+		}
+	}
+	if len(got) != 4 {
+		t.Errorf("unexpected field errors %v", got)
+	}
+
+	if err := v.Validate("not a struct"); apperrors.StatusCode(err) != http.StatusInternalServerError {
+		t.Errorf("non-struct: %v", err)
+	}
+}
+
+func TestRules(t *testing.T) {
+	cases := []struct {
+		rule  string
+		value string
+		want  bool
+	}{
+		{RuleSKU, "PROD-12345", true},
+		{RuleSKU, "shirt_red.xl", true},
+		{RuleSKU, "PROD--1", false},
+		{RuleSKU, "-PROD", false},
+		{RuleSKU, "PROD 1", false},
+		{RulePhone, "+66812345678", true},
+		{RulePhone, "0812345678", false},
+		{RulePhone, "+0812345678", false},
+		{RuleTaxID, "0105556000123", true},
+		{RuleTaxID, "DE 123.456.789", true},
+		{RuleTaxID, "12-34", false},
+		{RuleTaxID, "12--345", false},
+		{RuleRedirectURI, "https://app.example.com/callback?x=1", true},
+		{RuleRedirectURI, "http://127.0.0.1:8080/callback", true},
+		{RuleRedirectURI, "http://localhost/callback", true},
+		{RuleRedirectURI, "com.example.app:/oauth2redirect", true},
+		{RuleRedirectURI, "http://app.example.com/callback", false},
+		{RuleRedirectURI, "https://app.example.com/callback#token", false},
+		{RuleRedirectURI, "/callback", false},
+		{RuleRedirectURI, "javascript:alert(1)", false},
+	}
+	for _, tc := range cases {
+		if got := rules[tc.rule](tc.value); got != tc.want {
+			t.Errorf("%s(%q) = %v, want %v", tc.rule, tc.value, got, tc.want)
+		}
+	}
+}
@@ -3,15 +3,29 @@ package main
 import (
 	"auth-service/internal/handler"
 	"auth-service/internal/middleware"
+	"auth-service/internal/migrations"
 	"auth-service/pkg/config"
 	"auth-service/pkg/database"
 	"auth-service/pkg/jwtutil"
 	"auth-service/pkg/logger"
 	"auth-service/prometheus"
+	"context"
+	"os"
+	"time"
 
-	"github.com/labstack/echo/v4"
 	echomiddleware "github.com/labstack/echo/v4/middleware"
+	"github.com/suteetoe/gomicro/audit"
+	gomicroconfig "github.com/suteetoe/gomicro/config"
+	gomicrodb "github.com/suteetoe/gomicro/database"
+	"github.com/suteetoe/gomicro/health"
+	gomicrojwt "github.com/suteetoe/gomicro/jwtutil"
+	gomicrologger "github.com/suteetoe/gomicro/logger"
 	"github.com/suteetoe/gomicro/metrics" // Import the gomicro metrics package
+	gomicromw "github.com/suteetoe/gomicro/middleware"
+	"github.com/suteetoe/gomicro/migrate"
+	"github.com/suteetoe/gomicro/ratelimit"
+	"github.com/suteetoe/gomicro/server"
+	"github.com/suteetoe/gomicro/tracing"
 	"go.uber.org/zap"
 )
 
@@ -27,82 +41,216 @@ func main() {
 	log := logger.GetLogger()
 	log.Info("Starting authentication service...", zap.String("environment", cfg.Server.Env))
 
+	// Initialize distributed tracing
+	if err := tracing.InitTracer(context.Background(), &tracing.TracingConfig{
+		ServiceName: "authen-service",
+		Environment: cfg.Server.Env,
+		Enabled:     cfg.Tracing.Enabled,
+		Endpoint:    cfg.Tracing.Endpoint,
+		Insecure:    cfg.Tracing.Insecure,
+		SampleRatio: cfg.Tracing.SampleRatio,
+	}); err != nil {
+		log.Fatal("Failed to initialize tracing", zap.Error(err))
+	}
+	log.Info("Tracing initialized", zap.Bool("enabled", cfg.Tracing.Enabled))
+
+	// Load service level objectives for the gomicro metrics
+	sloConfig, err := metrics.LoadSLOConfig(cfg.Metrics.SLOConfigPath)
+	if err != nil {
+		log.Fatal("Failed to load SLO config", zap.Error(err))
+	}
+
+	// Initialize HTTP metrics from gomicro on a registry of the service, which /metrics serves
+	httpMetrics, err := metrics.NewHTTPMetrics("authen-service", metrics.WithRegistry(metrics.NewRegistry()), metrics.WithSLOs(sloConfig))
+	if err != nil {
+		log.Fatal("Failed to initialize HTTP metrics", zap.Error(err))
+	}
+	log.Info("gomicro HTTP metrics initialized")
+
+	// Initialize Prometheus metrics of the service on the same registry
+	if err := prometheus.InitMetrics(cfg, httpMetrics.Registerer()); err != nil {
+		log.Fatal("Failed to initialize Prometheus metrics", zap.Error(err))
+	}
+	log.Info("Prometheus metrics initialized")
+
 	// Initialize database
-	if err := database.InitDB(cfg); err != nil {
+	if err := database.InitDB(cfg, httpMetrics.Registerer()); err != nil {
 		log.Fatal("Failed to initialize database", zap.Error(err))
 	}
 	log.Info("Database connection established")
 
-	// Initialize JWT utility
-	jwtutil.Initialize(&cfg.JWT)
-	log.Info("JWT utility initialized")
+	// Apply schema migrations; `authen-service migrate <command>` runs a single migrate command and exits
+	migrator, err := migrate.New(database.GetDB(), "authen-service", migrations.All(), migrate.WithLogger(logger.Component("migrate")))
+	if err != nil {
+		log.Fatal("Invalid migrations", zap.Error(err))
+	}
+	if ran, err := migrate.Command(context.Background(), migrator, os.Args[1:], os.Stdout); ran {
+		if err != nil {
+			log.Fatal("Migrate command failed", zap.Error(err))
+		}
+		return
+	}
+	if cfg.DB.MigrateOnStart {
+		if _, err := migrator.Up(context.Background()); err != nil {
+			log.Fatal("Failed to apply migrations", zap.Error(err))
+		}
+	}
 
-	// Initialize Prometheus metrics
-	prometheus.InitMetrics(cfg)
-	log.Info("Prometheus metrics initialized")
+	// Initialize the audit log
+	handler.InitAudit(audit.NewRecorder(database.GetDB(), "authen-service"))
 
-	// Initialize HTTP metrics from gomicro
-	httpMetrics := metrics.NewHTTPMetrics("authen-service")
-	log.Info("gomicro HTTP metrics initialized")
+	// Authorize tenant roles against the role to permission policy (AUTHZ_POLICY_PATH)
+	policy, err := gomicromw.LoadPolicy(cfg.Authz.PolicyPath)
+	if err != nil {
+		log.Fatal("Failed to load authorization policy", zap.Error(err))
+	}
+	authz, err := gomicromw.NewAuthorizer("authen-service", policy, gomicromw.RoleFromContext("role"))
+	if err != nil {
+		log.Fatal("Failed to initialize authorization", zap.Error(err))
+	}
+	handler.InitAuthz(authz)
+
+	// Initialize the token denylist; `authen-service revoke-user <user-id> [<RFC 3339 time>]`
+	// revokes the tokens of a user issued until then, e.g. during an incident, and exits
+	denylist, err := gomicrojwt.NewDenylist(cfg.JWT.Denylist, database.GetDB())
+	if err != nil {
+		log.Fatal("Invalid JWT denylist", zap.Error(err))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "revoke-user" {
+		if err := revokeUser(context.Background(), denylist, os.Args[2:], os.Stdout); err != nil {
+			log.Fatal("Revoke command failed", zap.Error(err))
+		}
+		return
+	}
+
+	// Initialize JWT utility; asymmetric algorithms sign with rotating keys from jwt_signing_keys,
+	// which are rotated while the server runs
+	var signingKeys *gomicrojwt.KeySet
+	var rotateKeys func(context.Context)
+	if cfg.JWT.Algorithm != gomicrojwt.AlgorithmHS256 {
+		if cfg.JWT.KeyRetention < time.Duration(cfg.JWT.ExpirationHours)*time.Hour {
+			log.Fatal("JWT_KEY_RETENTION must cover JWT_EXPIRATION_HOURS")
+		}
+		signingKeys = gomicrojwt.NewKeySet()
+		rotator, err := gomicrojwt.NewRotator(database.GetDB(), signingKeys, cfg.JWT.Algorithm,
+			gomicrojwt.WithRotationInterval(cfg.JWT.RotationInterval),
+			gomicrojwt.WithKeyRetention(cfg.JWT.KeyRetention),
+			gomicrojwt.WithRotatorLogger(logger.Component("jwt")))
+		if err != nil {
+			log.Fatal("Invalid JWT key rotation settings", zap.Error(err))
+		}
+		if err := rotator.Sync(context.Background()); err != nil {
+			log.Fatal("Failed to load JWT signing keys", zap.Error(err))
+		}
+		rotateKeys = func(ctx context.Context) {
+			rotator.Run(ctx, gomicrojwt.DefaultSyncInterval)
+		}
+	}
+	jwtutil.Initialize(&cfg.JWT, signingKeys, denylist)
+	log.Info("JWT utility initialized", zap.String("algorithm", cfg.JWT.Algorithm))
+
+	// Apply changes to the config file and rotated secrets, such as DB_PASSWORD, without a restart
+	watcher := gomicroconfig.NewWatcher(cfg, log)
+	watcher.Subscribe("logger", gomicrologger.ApplyConfig)
+	watcher.Subscribe("database", gomicrodb.ApplyConfig)
+	watcher.Subscribe("jwt", jwtutil.ApplyConfig)
+	defer watcher.Start(gomicroconfig.DefaultWatchInterval)()
+
+	// Throttle login attempts per IP and API requests per tenant or user (RATE_LIMIT_*)
+	loginLimit, err := ratelimit.LoginRule(cfg)
+	if err != nil {
+		log.Fatal("Invalid login rate limit", zap.Error(err))
+	}
+	apiLimit, err := ratelimit.APIRule(cfg)
+	if err != nil {
+		log.Fatal("Invalid API rate limit", zap.Error(err))
+	}
+	limitStore, err := ratelimit.NewStore(cfg.RateLimit.Store, database.GetDB())
+	if err != nil {
+		log.Fatal("Invalid rate limit store", zap.Error(err))
+	}
+	limiter, err := ratelimit.NewLimiter("authen-service", limitStore, ratelimit.WithRegisterer(httpMetrics.Registerer()))
+	if err != nil {
+		log.Fatal("Failed to initialize rate limiting", zap.Error(err))
+	}
+
+	// Apply changed rate limit rules without a restart
+	watcher.Subscribe("rate_limit", limiter.ApplyConfig(ratelimit.Limits{"login": ratelimit.LoginRule, "api": ratelimit.APIRule}))
+
+	// Report ready while the database answers and the schema is migrated (/livez, /readyz)
+	checks, err := health.New("authen-service", health.WithLogger(log), health.WithRegisterer(httpMetrics.Registerer()))
+	if err != nil {
+		log.Fatal("Failed to initialize health checks", zap.Error(err))
+	}
+	checks.AddReadiness("database", health.Database(database.GetDB()))
+	checks.AddReadiness("migrations", health.Migrations(migrator))
+
+	// Build the HTTP server; it shuts down gracefully on SIGTERM
+	srv := server.New("authen-service",
+		server.WithLogger(log),
+		server.WithDatabase(database.GetDB()),
+		server.WithMetrics(httpMetrics),
+		server.WithHealth(checks),
+		server.WithLogLevels(cfg.Log.AdminToken, cfg.Log.LevelFile),
+		server.WithMiddleware(
+			echomiddleware.CORS(),
+			prometheus.MetricsMiddleware(), // Keep existing metrics middleware for backward compatibility
+		),
+		server.WithAuth(middleware.AuthMiddleware),
+		server.WithWorker("JWT key rotation", rotateKeys),
+		server.WithRoutes(func(r *server.Router) {
+			if signingKeys != nil {
+				// Public keys for the services verifying our tokens (JWT_JWKS_URL)
+				r.GET(gomicrojwt.JWKSPath, gomicrojwt.JWKSHandler(signingKeys))
+			}
+
+			// Authentication routes - these don't belong under /api since they're for getting access to the API
+			auth := r.Group("/auth")
+			auth.POST("/login", handler.Login, limiter.Middleware("login", loginLimit, ratelimit.KeyByIP()))
+			auth.POST("/register", handler.Register)
+			auth.POST("/logout", handler.Logout, middleware.AuthMiddleware)
+
+			// API routes - all require authentication
+			api := r.Secure("/api")
+			api.Use(limiter.Middleware("api", apiLimit, ratelimit.FirstKey(ratelimit.KeyByTenant(), ratelimit.KeyByUser())))
+
+			// User management
+			users := api.Group("/users")
+			users.GET("/profile", handler.GetProfile)
+			users.PATCH("/profile", handler.UpdateProfile)
+			users.POST("/change-password", handler.ChangePassword)
+
+			// Tenant selection - after login but before accessing tenant-specific resources
+			tenantAuth := api.Group("/tenant-auth")
+			tenantAuth.POST("/select", handler.SelectTenant)
+			tenantAuth.POST("/switch", handler.SwitchTenant)
+			tenantAuth.POST("/default", handler.SetDefaultTenant)
+
+			// Tenant management - doesn't require tenant context
+			tenants := api.Group("/tenants")
+			tenants.POST("", handler.CreateTenant)
+			tenants.GET("", handler.ListUserTenants)
+
+			// Tenant-specific operations - requires tenant context
+			tenantSpecific := api.Group("/tenants")
+			tenantSpecific.Use(middleware.RequireTenantContext)
+			tenantSpecific.GET("/:id", handler.GetTenant)
+
+			// Tenant user management - requires tenant context
+			tenantUsers := api.Group("/tenant-users")
+			tenantUsers.Use(middleware.RequireTenantContext)
+			tenantUsers.POST("", handler.AddUserToTenant)
+			tenantUsers.DELETE("/:tenant_id/:user_id", handler.RemoveUserFromTenant)
 
-	// Initialize Echo framework
-	e := echo.New()
-
-	// Apply global middleware - order matters
-	e.Use(echomiddleware.Recover()) // Add recovery middleware
-	e.Use(echomiddleware.CORS())    // Add CORS middleware
-	e.Use(middleware.RequestIDMiddleware)
-	e.Use(logger.Middleware(log))
-	e.Use(prometheus.MetricsMiddleware()) // Keep existing metrics middleware for backward compatibility
-	e.Use(httpMetrics.Middleware())       // Add gomicro metrics middleware
-
-	// Public routes - no authentication required
-	e.GET("/health", handler.HealthCheck)
-	e.GET("/metrics", echo.WrapHandler(metrics.GetPrometheusHandler())) // This now uses gomicro metrics
-
-	// Authentication routes - these don't belong under /api since they're for getting access to the API
-	auth := e.Group("/auth")
-	auth.POST("/login", handler.Login)
-	auth.POST("/register", handler.Register)
-
-	// API routes - all require authentication
-	api := e.Group("/api")
-	api.Use(middleware.AuthMiddleware)
-
-	// User management
-	users := api.Group("/users")
-	users.GET("/profile", handler.GetProfile)
-	users.PATCH("/profile", handler.UpdateProfile)
-	users.POST("/change-password", handler.ChangePassword)
-
-	// Tenant selection - after login but before accessing tenant-specific resources
-	tenantAuth := api.Group("/tenant-auth")
-	tenantAuth.POST("/select", handler.SelectTenant)
-	tenantAuth.POST("/switch", handler.SwitchTenant)
-	tenantAuth.POST("/default", handler.SetDefaultTenant)
-
-	// Tenant management - doesn't require tenant context
-	tenants := api.Group("/tenants")
-	tenants.POST("", handler.CreateTenant)
-	tenants.GET("", handler.ListUserTenants)
-
-	// Tenant-specific operations - requires tenant context
-	tenantSpecific := api.Group("/tenants")
-	tenantSpecific.Use(middleware.RequireTenantContext)
-	tenantSpecific.GET("/:id", handler.GetTenant)
-
-	// Tenant user management - requires tenant context
-	tenantUsers := api.Group("/tenant-users")
-	tenantUsers.Use(middleware.RequireTenantContext)
-	tenantUsers.POST("", handler.AddUserToTenant)
-	tenantUsers.DELETE("/:tenant_id/:user_id", handler.RemoveUserFromTenant)
-
-	// Get server port from configuration
-	port := cfg.Server.Port
+			// Audit history of the current tenant - tenant owners only
+			auditEvents := api.Group("/audit-events")
+			auditEvents.Use(middleware.RequireTenantContext)
+			auditEvents.GET("", handler.GetAuditEvents)
+		}),
+	)
 
 	// Start server
-	log.Info("Starting server", zap.String("port", port))
-	if err := e.Start(":" + port); err != nil {
-		log.Fatal("Failed to start server", zap.Error(err))
+	if err := srv.Run(context.Background(), ":"+cfg.Server.Port); err != nil {
+		log.Fatal("Server error", zap.Error(err))
 	}
 }
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	gomicrojwt "github.com/suteetoe/gomicro/jwtutil"
+)
+
+// revokeUser runs `revoke-user <user-id> [<RFC 3339 time>]`, revoking every token of the user
+// issued until the given time, or until now
+func revokeUser(ctx context.Context, denylist gomicrojwt.Denylist, args []string, out io.Writer) error {
+	if _, ok := denylist.(*gomicrojwt.DBDenylist); !ok {
+		// A memory denylist would only hold the revocation until this command exits
+		return errors.New("revoke-user needs JWT_DENYLIST=postgres")
+	}
+	if len(args) < 1 || len(args) > 2 {
+		return errors.New("usage: revoke-user <user-id> [<RFC 3339 time>]")
+	}
+
+	userID, err := strconv.ParseUint(args[0], 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid user ID %q", args[0])
+	}
+	before := time.Now()
+	if len(args) == 2 {
+		if before, err = time.Parse(time.RFC3339, args[1]); err != nil {
+			return fmt.Errorf("invalid time %q: %w", args[1], err)
+		}
+	}
+
+	if err := denylist.RevokeUser(ctx, uint(userID), before); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Revoked tokens of user %d issued until %s\n", userID, before.UTC().Format(time.RFC3339))
+	return nil
+}
@@ -0,0 +1,37 @@
+package handler
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/suteetoe/gomicro/audit"
+	apperrors "github.com/suteetoe/gomicro/errors"
+)
+
+// auditLog records security-relevant changes; nil until InitAudit is called
+var auditLog *audit.Recorder
+
+// InitAudit sets the recorder used by the handlers
+func InitAudit(recorder *audit.Recorder) {
+	auditLog = recorder
+}
+
+// recordAudit records an action on a resource of the tenant, attributed to the authenticated caller
+func recordAudit(c echo.Context, tenantID uint, action, resourceType, resourceID string, changes audit.Changes) {
+	if auditLog == nil {
+		return
+	}
+	auditLog.RecordRequest(c, audit.Event{
+		TenantID:     &tenantID,
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		Changes:      changes,
+	})
+}
+
+// GetAuditEvents lists the audit history of the caller's tenant; only tenant owners may read it
+func GetAuditEvents(c echo.Context) error {
+	if auditLog == nil {
+		return apperrors.Unavailable("audit log is not available")
+	}
+	return auditLog.Handler(audit.TenantOwner("tenant_id", "role"))(c)
+}
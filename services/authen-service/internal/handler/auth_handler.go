@@ -11,6 +11,7 @@ import (
 
 	"github.com/labstack/echo/v4"
 	"github.com/prometheus/client_golang/prometheus"
+	apperrors "github.com/suteetoe/gomicro/errors"
 	"go.uber.org/zap"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -23,8 +24,8 @@ func Login(c echo.Context) error {
 
 	// Parse request
 	var req struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		Email    string `json:"email" validate:"required"`
+		Password string `json:"password" validate:"required"`
 	}
 
 	if err := c.Bind(&req); err != nil {
@@ -32,28 +33,19 @@ func Login(c echo.Context) error {
 			zap.Error(err),
 			zap.String("remote_ip", c.RealIP()))
 		localprometheus.RecordAuthError("invalid_request")
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error":   "Invalid request format",
-			"message": "The request could not be processed due to invalid format",
-		})
+		return apperrors.BadRequest("The request could not be processed due to invalid format")
 	}
 
 	// Validate required fields
-	if req.Email == "" || req.Password == "" {
+	if err := c.Validate(&req); err != nil {
 		log.Warn("Login attempt with missing credentials",
 			zap.Bool("email_provided", req.Email != ""),
 			zap.Bool("password_provided", req.Password != ""),
 			zap.String("remote_ip", c.RealIP()))
 		localprometheus.RecordAuthError("missing_credentials")
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error":   "Missing credentials",
-			"message": "Both email and password are required",
-		})
+		return err
 	}
 
-	// Track DB operations
-	defer localprometheus.TrackDBOperation("query")(time.Now())
-
 	// Find user by email
 	var user model.User
 	if result := database.GetDB().Where("email = ?", req.Email).First(&user); result.Error != nil {
@@ -63,10 +55,7 @@ func Login(c echo.Context) error {
 			zap.Error(result.Error))
 		localprometheus.RecordAuthError("user_not_found")
 		// Don't reveal whether the user exists - use generic message
-		return c.JSON(http.StatusUnauthorized, echo.Map{
-			"error":   "Invalid credentials",
-			"message": "The provided email or password is incorrect",
-		})
+		return apperrors.Unauthorized("The provided email or password is incorrect")
 	}
 
 	// Check password
@@ -75,10 +64,7 @@ func Login(c echo.Context) error {
 			zap.String("email", req.Email),
 			zap.String("remote_ip", c.RealIP()))
 		localprometheus.RecordAuthError("invalid_password")
-		return c.JSON(http.StatusUnauthorized, echo.Map{
-			"error":   "Invalid credentials",
-			"message": "The provided email or password is incorrect",
-		})
+		return apperrors.Unauthorized("The provided email or password is incorrect")
 	}
 
 	// Generate JWT token without tenant information
@@ -89,10 +75,7 @@ func Login(c echo.Context) error {
 			zap.String("email", user.Email),
 			zap.Uint("user_id", user.ID))
 		localprometheus.RecordAuthError("token_generation_failed")
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error":   "Authentication error",
-			"message": "Could not process the login request at this time",
-		})
+		return apperrors.Internal("Could not process the login request at this time", err)
 	}
 
 	// Increment active tokens gauge
@@ -148,8 +131,8 @@ func Register(c echo.Context) error {
 
 	// Parse request
 	var req struct {
-		Email     string `json:"email"`
-		Password  string `json:"password"`
+		Email     string `json:"email" validate:"required,email"`
+		Password  string `json:"password" validate:"required"`
 		FirstName string `json:"first_name,omitempty"`
 		LastName  string `json:"last_name,omitempty"`
 	}
@@ -159,27 +142,19 @@ func Register(c echo.Context) error {
 			zap.Error(err),
 			zap.String("remote_ip", c.RealIP()))
 		localprometheus.RecordAuthError("invalid_request")
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error":   "Invalid request format",
-			"message": "The request could not be processed due to invalid format",
-		})
+		return apperrors.BadRequest("The request could not be processed due to invalid format")
 	}
 
 	// Validate required fields
-	if req.Email == "" || req.Password == "" {
-		log.Warn("Registration attempt with missing required fields",
-			zap.Bool("email_provided", req.Email != ""),
-			zap.Bool("password_provided", req.Password != ""),
+	if err := c.Validate(&req); err != nil {
+		log.Warn("Registration attempt with invalid fields",
+			zap.Error(err),
 			zap.String("remote_ip", c.RealIP()))
 		localprometheus.RecordAuthError("incomplete_registration")
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error":   "Missing required fields",
-			"message": "Email and password are required for registration",
-		})
+		return err
 	}
 
 	// Check if user already exists
-	defer localprometheus.TrackDBOperation("query")(time.Now())
 	var existingUser model.User
 	result := database.GetDB().Where("email = ?", req.Email).First(&existingUser)
 	if result.Error == nil {
@@ -187,10 +162,7 @@ func Register(c echo.Context) error {
 			zap.String("email", req.Email),
 			zap.String("remote_ip", c.RealIP()))
 		localprometheus.RecordAuthError("email_already_exists")
-		return c.JSON(http.StatusConflict, echo.Map{
-			"error":   "Email already registered",
-			"message": "An account with this email already exists",
-		})
+		return apperrors.Conflict("An account with this email already exists")
 	}
 
 	// Hash password
@@ -200,10 +172,7 @@ func Register(c echo.Context) error {
 			zap.Error(err),
 			zap.String("remote_ip", c.RealIP()))
 		localprometheus.RecordAuthError("password_hash_failed")
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error":   "Registration failed",
-			"message": "Could not process the registration request at this time",
-		})
+		return apperrors.Internal("Could not process the registration request at this time", err)
 	}
 
 	// Create new user
@@ -214,18 +183,14 @@ func Register(c echo.Context) error {
 		LastName:  req.LastName,
 	}
 
-	// Save to database - track DB insert operation
-	defer localprometheus.TrackDBOperation("insert")(time.Now())
+	// Save to database
 	if result := database.GetDB().Create(&user); result.Error != nil {
 		log.Error("Failed to create user record",
 			zap.Error(result.Error),
 			zap.String("email", req.Email),
 			zap.String("remote_ip", c.RealIP()))
 		localprometheus.RecordAuthError("user_creation_failed")
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error":   "Registration failed",
-			"message": "Could not complete the registration process",
-		})
+		return apperrors.Internal("Could not complete the registration process", result.Error)
 	}
 
 	log.Info("User registered successfully",
@@ -258,18 +223,15 @@ func GetProfile(c echo.Context) error {
 	if !ok {
 		log.Error("Failed to get user ID from context")
 		localprometheus.RecordAuthError("unauthorized_profile_access")
-		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "authentication required"})
+		return apperrors.Unauthorized("authentication required")
 	}
 
-	// Track DB operations
-	defer localprometheus.TrackDBOperation("query")(time.Now())
-
 	// Find user by ID
 	var user model.User
 	if result := database.GetDB().First(&user, userID); result.Error != nil {
 		log.Error("Failed to retrieve user profile", zap.Error(result.Error))
 		localprometheus.RecordAuthError("profile_retrieval_failed")
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to retrieve profile"})
+		return apperrors.Internal("failed to retrieve profile", result.Error)
 	}
 
 	// Return user profile (password is excluded via JSON tag in model)
@@ -295,7 +257,7 @@ func UpdateProfile(c echo.Context) error {
 	if !ok {
 		log.Error("Failed to get user ID from context")
 		localprometheus.RecordAuthError("unauthorized_profile_update")
-		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "authentication required"})
+		return apperrors.Unauthorized("authentication required")
 	}
 
 	// Parse request
@@ -308,18 +270,15 @@ func UpdateProfile(c echo.Context) error {
 	if err := c.Bind(&req); err != nil {
 		log.Error("Failed to parse profile update request", zap.Error(err))
 		localprometheus.RecordAuthError("invalid_request")
-		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid request"})
+		return apperrors.BadRequest("invalid request")
 	}
 
-	// Track DB operations
-	defer localprometheus.TrackDBOperation("update")(time.Now())
-
 	// Find user by ID
 	var user model.User
 	if result := database.GetDB().First(&user, userID); result.Error != nil {
 		log.Error("Failed to retrieve user for update", zap.Error(result.Error))
 		localprometheus.RecordAuthError("profile_update_failed")
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to update profile"})
+		return apperrors.Internal("failed to update profile", result.Error)
 	}
 
 	// Update user profile fields
@@ -358,7 +317,7 @@ func UpdateProfile(c echo.Context) error {
 	if result := database.GetDB().Save(&user); result.Error != nil {
 		log.Error("Failed to update profile", zap.Error(result.Error))
 		localprometheus.RecordAuthError("profile_save_failed")
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to save profile updates"})
+		return apperrors.Internal("failed to save profile updates", result.Error)
 	}
 
 	log.Info("Profile updated successfully", zap.Uint("user_id", userID))
@@ -384,43 +343,40 @@ func ChangePassword(c echo.Context) error {
 	if !ok {
 		log.Error("Failed to get user ID from context")
 		localprometheus.RecordAuthError("unauthorized_password_change")
-		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "authentication required"})
+		return apperrors.Unauthorized("authentication required")
 	}
 
 	// Parse request
 	var req struct {
-		CurrentPassword string `json:"current_password"`
-		NewPassword     string `json:"new_password"`
+		CurrentPassword string `json:"current_password" validate:"required"`
+		NewPassword     string `json:"new_password" validate:"required"`
 	}
 
 	if err := c.Bind(&req); err != nil {
 		log.Error("Failed to parse password change request", zap.Error(err))
 		localprometheus.RecordAuthError("invalid_request")
-		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid request"})
+		return apperrors.BadRequest("invalid request")
 	}
 
-	if req.CurrentPassword == "" || req.NewPassword == "" {
-		log.Error("Missing password data")
+	if err := c.Validate(&req); err != nil {
+		log.Error("Missing password data", zap.Error(err))
 		localprometheus.RecordAuthError("incomplete_password_change")
-		return c.JSON(http.StatusBadRequest, echo.Map{"error": "current and new password are required"})
+		return err
 	}
 
-	// Track DB operations
-	defer localprometheus.TrackDBOperation("update")(time.Now())
-
 	// Find user by ID
 	var user model.User
 	if result := database.GetDB().First(&user, userID); result.Error != nil {
 		log.Error("Failed to retrieve user for password change", zap.Error(result.Error))
 		localprometheus.RecordAuthError("user_not_found")
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to update password"})
+		return apperrors.Internal("failed to update password", result.Error)
 	}
 
 	// Verify current password
 	if !checkPasswordHash(req.CurrentPassword, user.Password) {
 		log.Warn("Invalid current password", zap.Uint("user_id", userID))
 		localprometheus.RecordAuthError("invalid_current_password")
-		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "current password is incorrect"})
+		return apperrors.Unauthorized("current password is incorrect")
 	}
 
 	// Hash new password
@@ -428,7 +384,7 @@ func ChangePassword(c echo.Context) error {
 	if err != nil {
 		log.Error("Failed to hash new password", zap.Error(err))
 		localprometheus.RecordAuthError("password_hash_failed")
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to process new password"})
+		return apperrors.Internal("failed to process new password", err)
 	}
 
 	// Update password
@@ -436,7 +392,13 @@ func ChangePassword(c echo.Context) error {
 	if result := database.GetDB().Save(&user); result.Error != nil {
 		log.Error("Failed to save new password", zap.Error(result.Error))
 		localprometheus.RecordAuthError("password_update_failed")
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to update password"})
+		return apperrors.Internal("failed to update password", result.Error)
+	}
+
+	// Sessions opened with the old password end here
+	if err := jwtutil.RevokeUser(c.Request().Context(), userID, time.Now()); err != nil {
+		log.Error("Failed to revoke tokens after password change", zap.Error(err), zap.Uint("user_id", userID))
+		localprometheus.RecordAuthError("token_revocation_failed")
 	}
 
 	log.Info("Password changed successfully", zap.Uint("user_id", userID))
@@ -445,6 +407,31 @@ func ChangePassword(c echo.Context) error {
 	})
 }
 
+// Logout revokes the token of the request
+func Logout(c echo.Context) error {
+	log := logger.FromContext(c)
+	localprometheus.RecordAuthOperation("logout")
+
+	// Get claims from context (set by AuthMiddleware)
+	claims, ok := c.Get("claims").(*jwtutil.UserClaims)
+	if !ok {
+		log.Error("Failed to get claims from context")
+		localprometheus.RecordAuthError("unauthorized_logout")
+		return apperrors.Unauthorized("authentication required")
+	}
+
+	if err := jwtutil.Revoke(c.Request().Context(), claims); err != nil {
+		log.Error("Failed to revoke token", zap.Error(err))
+		localprometheus.RecordAuthError("token_revocation_failed")
+		return apperrors.Internal("failed to log out", err)
+	}
+
+	log.Info("User logged out", zap.Uint("user_id", claims.UserID))
+	return c.JSON(http.StatusOK, echo.Map{
+		"message": "Logged out successfully",
+	})
+}
+
 // Helper function to safely handle nil uint pointers for logging
 func nilSafeUint(val *uint) uint {
 	if val == nil {
@@ -0,0 +1,13 @@
+package handler
+
+import (
+	gomicromw "github.com/suteetoe/gomicro/middleware"
+)
+
+// authz decides what each tenant role may do; nil until InitAuthz is called
+var authz *gomicromw.Authorizer
+
+// InitAuthz sets the authorizer used by the handlers
+func InitAuthz(authorizer *gomicromw.Authorizer) {
+	authz = authorizer
+}
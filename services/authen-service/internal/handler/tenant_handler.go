@@ -11,6 +11,8 @@ import (
 	"time"
 
 	"github.com/labstack/echo/v4"
+	"github.com/suteetoe/gomicro/audit"
+	apperrors "github.com/suteetoe/gomicro/errors"
 	"go.uber.org/zap"
 )
 
@@ -26,15 +28,12 @@ func CreateTenant(c echo.Context) error {
 		log.Error("Failed to get user ID from context",
 			zap.String("remote_ip", c.RealIP()))
 		prometheus.RecordAuthError("unauthorized_tenant_creation")
-		return c.JSON(http.StatusUnauthorized, echo.Map{
-			"error":   "Authentication required",
-			"message": "You must be authenticated to create a tenant",
-		})
+		return apperrors.Unauthorized("You must be authenticated to create a tenant")
 	}
 
 	// Parse request
 	var req struct {
-		Name        string `json:"name"`
+		Name        string `json:"name" validate:"required"`
 		Description string `json:"description"`
 		Settings    string `json:"settings,omitempty"`
 	}
@@ -45,30 +44,21 @@ func CreateTenant(c echo.Context) error {
 			zap.Uint("user_id", userID),
 			zap.String("remote_ip", c.RealIP()))
 		prometheus.RecordAuthError("invalid_request")
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error":   "Invalid request format",
-			"message": "The request could not be processed due to invalid format",
-		})
+		return apperrors.BadRequest("The request could not be processed due to invalid format")
 	}
 
-	if req.Name == "" {
+	if err := c.Validate(&req); err != nil {
 		log.Warn("Tenant creation attempt with missing name",
 			zap.Uint("user_id", userID),
 			zap.String("remote_ip", c.RealIP()))
 		prometheus.RecordAuthError("incomplete_tenant_creation")
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error":   "Missing required field",
-			"message": "Tenant name is required",
-		})
+		return err
 	}
 
 	log.Info("Starting tenant creation process",
 		zap.Uint("user_id", userID),
 		zap.String("tenant_name", req.Name))
 
-	// Track DB operations
-	defer prometheus.TrackDBOperation("transaction")(time.Now())
-
 	// Begin transaction
 	tx := database.GetDB().Begin()
 	if tx.Error != nil {
@@ -77,10 +67,7 @@ func CreateTenant(c echo.Context) error {
 			zap.Uint("user_id", userID),
 			zap.String("tenant_name", req.Name))
 		prometheus.RecordAuthError("database_error")
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error":   "Database error",
-			"message": "Could not create tenant due to a database error",
-		})
+		return apperrors.Internal("Could not create tenant due to a database error", tx.Error)
 	}
 
 	// Create tenant
@@ -100,10 +87,7 @@ func CreateTenant(c echo.Context) error {
 			zap.Uint("user_id", userID),
 			zap.String("tenant_name", req.Name))
 		prometheus.RecordAuthError("tenant_creation_failed")
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error":   "Tenant creation failed",
-			"message": "The system could not create the tenant at this time",
-		})
+		return apperrors.Internal("The system could not create the tenant at this time", result.Error)
 	}
 
 	// Also create UserTenant association with owner role
@@ -122,10 +106,7 @@ func CreateTenant(c echo.Context) error {
 			zap.Uint("user_id", userID),
 			zap.Uint("tenant_id", tenant.ID))
 		prometheus.RecordAuthError("tenant_association_failed")
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error":   "Tenant association failed",
-			"message": "The system could not associate the user with the tenant",
-		})
+		return apperrors.Internal("The system could not associate the user with the tenant", result.Error)
 	}
 
 	// Commit transaction
@@ -135,10 +116,7 @@ func CreateTenant(c echo.Context) error {
 			zap.Uint("user_id", userID),
 			zap.Uint("tenant_id", tenant.ID))
 		prometheus.RecordAuthError("transaction_commit_failed")
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error":   "Transaction failed",
-			"message": "The tenant creation process could not be completed",
-		})
+		return apperrors.Internal("The tenant creation process could not be completed", err)
 	}
 
 	// Update active tenants metric
@@ -171,7 +149,7 @@ func GetTenant(c echo.Context) error {
 	if !ok {
 		log.Error("Failed to get user ID from context")
 		prometheus.RecordAuthError("unauthorized_tenant_access")
-		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "authentication required"})
+		return apperrors.Unauthorized("authentication required")
 	}
 
 	// Get ID from path parameter
@@ -179,18 +157,15 @@ func GetTenant(c echo.Context) error {
 	if err != nil {
 		log.Error("Invalid tenant ID", zap.Error(err))
 		prometheus.RecordAuthError("invalid_tenant_id")
-		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid tenant ID"})
+		return apperrors.BadRequest("invalid tenant ID")
 	}
 
-	// Track DB operations
-	defer prometheus.TrackDBOperation("query")(time.Now())
-
 	// Retrieve tenant from database
 	var tenant model.Tenant
 	if result := database.GetDB().First(&tenant, id); result.Error != nil {
 		log.Error("Tenant not found", zap.Uint64("id", id), zap.Error(result.Error))
 		prometheus.RecordAuthError("tenant_not_found")
-		return c.JSON(http.StatusNotFound, echo.Map{"error": "tenant not found"})
+		return apperrors.NotFound("tenant not found")
 	}
 
 	// Verify user has access to this tenant
@@ -201,7 +176,7 @@ func GetTenant(c echo.Context) error {
 			zap.Uint("requesting_user_id", userID),
 			zap.Uint("tenant_id", uint(id)))
 		prometheus.RecordAuthError("tenant_access_denied")
-		return c.JSON(http.StatusForbidden, echo.Map{"error": "access denied"})
+		return apperrors.Forbidden("access denied")
 	}
 
 	return c.JSON(http.StatusOK, tenant)
@@ -217,18 +192,15 @@ func ListUserTenants(c echo.Context) error {
 	if !ok {
 		log.Error("Failed to get user ID from context")
 		prometheus.RecordAuthError("unauthorized_tenant_listing")
-		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "authentication required"})
+		return apperrors.Unauthorized("authentication required")
 	}
 
-	// Track DB operations
-	defer prometheus.TrackDBOperation("query")(time.Now())
-
 	// Get user's tenants through UserTenant associations
 	var userTenants []model.UserTenant
 	if result := database.GetDB().Preload("Tenant").Where("user_id = ? AND active = ?", userID, true).Find(&userTenants); result.Error != nil {
 		log.Error("Failed to retrieve user's tenants", zap.Error(result.Error))
 		prometheus.RecordAuthError("tenant_retrieval_failed")
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to retrieve tenants"})
+		return apperrors.Internal("failed to retrieve tenants", result.Error)
 	}
 
 	// Format response
@@ -268,10 +240,7 @@ func SwitchTenant(c echo.Context) error {
 		log.Error("Failed to get user ID from context",
 			zap.String("remote_ip", c.RealIP()))
 		prometheus.RecordAuthError("unauthorized_tenant_switch")
-		return c.JSON(http.StatusUnauthorized, echo.Map{
-			"error":   "Authentication required",
-			"message": "You must be authenticated to switch tenants",
-		})
+		return apperrors.Unauthorized("You must be authenticated to switch tenants")
 	}
 
 	// Get email from context
@@ -281,15 +250,12 @@ func SwitchTenant(c echo.Context) error {
 			zap.Uint("user_id", userID),
 			zap.String("remote_ip", c.RealIP()))
 		prometheus.RecordAuthError("context_missing_email")
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error":   "Context error",
-			"message": "Email missing from authentication context",
-		})
+		return apperrors.New(http.StatusInternalServerError, "Email missing from authentication context")
 	}
 
 	// Parse request
 	var req struct {
-		TenantID uint `json:"tenant_id"`
+		TenantID uint `json:"tenant_id" validate:"required"`
 	}
 
 	if err := c.Bind(&req); err != nil {
@@ -298,30 +264,21 @@ func SwitchTenant(c echo.Context) error {
 			zap.Uint("user_id", userID),
 			zap.String("remote_ip", c.RealIP()))
 		prometheus.RecordAuthError("invalid_request")
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error":   "Invalid request format",
-			"message": "The tenant switch request could not be processed",
-		})
+		return apperrors.BadRequest("The tenant switch request could not be processed")
 	}
 
-	if req.TenantID == 0 {
+	if err := c.Validate(&req); err != nil {
 		log.Warn("Tenant switch attempt with invalid tenant ID",
 			zap.Uint("user_id", userID),
 			zap.String("remote_ip", c.RealIP()))
 		prometheus.RecordAuthError("invalid_tenant_id")
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error":   "Missing tenant ID",
-			"message": "A valid tenant ID is required to switch tenants",
-		})
+		return err
 	}
 
 	log.Info("Verifying tenant access permissions",
 		zap.Uint("user_id", userID),
 		zap.Uint("tenant_id", req.TenantID))
 
-	// Track DB operations
-	defer prometheus.TrackDBOperation("query")(time.Now())
-
 	// Verify the user has access to this tenant
 	var userTenant model.UserTenant
 	result := database.GetDB().Where("user_id = ? AND tenant_id = ? AND active = ?", userID, req.TenantID, true).First(&userTenant)
@@ -332,10 +289,7 @@ func SwitchTenant(c echo.Context) error {
 			zap.String("remote_ip", c.RealIP()),
 			zap.Error(result.Error))
 		prometheus.RecordAuthError("tenant_access_denied")
-		return c.JSON(http.StatusForbidden, echo.Map{
-			"error":   "Access denied",
-			"message": "You do not have permission to access the requested tenant",
-		})
+		return apperrors.Forbidden("You do not have permission to access the requested tenant")
 	}
 
 	// Get tenant name
@@ -346,10 +300,7 @@ func SwitchTenant(c echo.Context) error {
 			zap.Uint("user_id", userID),
 			zap.Error(result.Error))
 		prometheus.RecordAuthError("tenant_not_found")
-		return c.JSON(http.StatusNotFound, echo.Map{
-			"error":   "Tenant not found",
-			"message": "The requested tenant could not be found",
-		})
+		return apperrors.NotFound("The requested tenant could not be found")
 	}
 
 	// Generate new JWT token with tenant context
@@ -361,10 +312,7 @@ func SwitchTenant(c echo.Context) error {
 			zap.Uint("user_id", userID),
 			zap.Uint("tenant_id", req.TenantID))
 		prometheus.RecordAuthError("token_generation_failed")
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error":   "Token generation failed",
-			"message": "Unable to generate authentication token for this tenant",
-		})
+		return apperrors.Internal("Unable to generate authentication token for this tenant", err)
 	}
 
 	// Increment active tokens gauge
@@ -398,28 +346,28 @@ func AddUserToTenant(c echo.Context) error {
 	if !ok {
 		log.Error("Failed to get user ID from context")
 		prometheus.RecordAuthError("unauthorized_tenant_user_add")
-		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "authentication required"})
+		return apperrors.Unauthorized("authentication required")
 	}
 
 	// Parse request
 	var req struct {
-		TenantID  uint   `json:"tenant_id"`
-		UserEmail string `json:"user_email"`
-		Role      string `json:"role,omitempty"`
+		TenantID  uint   `json:"tenant_id" validate:"required"`
+		UserEmail string `json:"user_email" validate:"required,email"`
+		Role      string `json:"role,omitempty" validate:"omitempty,oneof=owner admin member"`
 	}
 
 	if err := c.Bind(&req); err != nil {
 		log.Error("Failed to parse add user request", zap.Error(err))
 		prometheus.RecordAuthError("invalid_request")
-		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid request"})
+		return apperrors.BadRequest("invalid request")
 	}
 
-	if req.TenantID == 0 || req.UserEmail == "" {
+	if err := c.Validate(&req); err != nil {
 		log.Error("Invalid request data",
 			zap.Uint("tenant_id", req.TenantID),
 			zap.String("user_email", req.UserEmail))
 		prometheus.RecordAuthError("incomplete_tenant_user_add")
-		return c.JSON(http.StatusBadRequest, echo.Map{"error": "tenant_id and user_email are required"})
+		return err
 	}
 
 	// Default role if not provided
@@ -427,18 +375,25 @@ func AddUserToTenant(c echo.Context) error {
 		req.Role = "member"
 	}
 
-	// Track DB operations
-	defer prometheus.TrackDBOperation("query")(time.Now())
-
-	// Verify the requesting user has permission to add users to this tenant
+	// Verify the requesting user's role in this tenant allows adding users
 	var userTenant model.UserTenant
-	result := database.GetDB().Where("user_id = ? AND tenant_id = ? AND role IN ('owner', 'admin')", userID, req.TenantID).First(&userTenant)
-	if result.Error != nil {
+	result := database.GetDB().Where("user_id = ? AND tenant_id = ?", userID, req.TenantID).First(&userTenant)
+	if result.Error != nil || !authz.Allows(userTenant.Role, "tenant_user:manage") {
 		log.Warn("Unauthorized attempt to add user to tenant",
 			zap.Uint("requesting_user_id", userID),
 			zap.Uint("tenant_id", req.TenantID))
 		prometheus.RecordAuthError("tenant_permission_denied")
-		return c.JSON(http.StatusForbidden, echo.Map{"error": "insufficient permissions"})
+		return authz.Deny(c, "tenant_user:manage")
+	}
+
+	// Callers may only give roles whose permissions they hold themselves
+	if !authz.CanGrant(userTenant.Role, req.Role) {
+		log.Warn("Unauthorized attempt to grant a tenant role",
+			zap.Uint("requesting_user_id", userID),
+			zap.Uint("tenant_id", req.TenantID),
+			zap.String("role", req.Role))
+		prometheus.RecordAuthError("tenant_permission_denied")
+		return authz.DenyGrant(c, req.Role)
 	}
 
 	// Find the user by email
@@ -446,31 +401,18 @@ func AddUserToTenant(c echo.Context) error {
 	if result := database.GetDB().Where("email = ?", req.UserEmail).First(&user); result.Error != nil {
 		log.Error("User not found", zap.String("email", req.UserEmail))
 		prometheus.RecordAuthError("user_not_found")
-		return c.JSON(http.StatusNotFound, echo.Map{"error": "user not found"})
+		return apperrors.NotFound("user not found")
 	}
 
-	// Check if user is already in the tenant
+	// Check if user is already in the tenant; adding a member again must not change their role
 	var existingUserTenant model.UserTenant
 	result = database.GetDB().Where("user_id = ? AND tenant_id = ?", user.ID, req.TenantID).First(&existingUserTenant)
 	if result.Error == nil {
-		// User is already in the tenant, update their role if different
-		if existingUserTenant.Role != req.Role {
-			existingUserTenant.Role = req.Role
-			if err := database.GetDB().Save(&existingUserTenant).Error; err != nil {
-				log.Error("Failed to update user role in tenant", zap.Error(err))
-				prometheus.RecordAuthError("tenant_user_update_failed")
-				return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to update user role"})
-			}
-			log.Info("Updated user role in tenant",
-				zap.Uint("tenant_id", req.TenantID),
-				zap.String("user_email", req.UserEmail),
-				zap.String("role", req.Role))
-		}
-
-		return c.JSON(http.StatusOK, echo.Map{
-			"message":     "User role updated in tenant",
-			"user_tenant": existingUserTenant,
-		})
+		log.Warn("User is already in the tenant",
+			zap.Uint("tenant_id", req.TenantID),
+			zap.String("user_email", req.UserEmail))
+		prometheus.RecordAuthError("tenant_user_exists")
+		return apperrors.Conflict("user is already a member of the tenant")
 	}
 
 	// Add user to tenant
@@ -485,8 +427,10 @@ func AddUserToTenant(c echo.Context) error {
 	if err := database.GetDB().Create(&newUserTenant).Error; err != nil {
 		log.Error("Failed to add user to tenant", zap.Error(err))
 		prometheus.RecordAuthError("tenant_user_add_failed")
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to add user to tenant"})
+		return apperrors.Internal("failed to add user to tenant", err)
 	}
+	recordAudit(c, req.TenantID, "tenant_user.added", "tenant_user",
+		strconv.FormatUint(uint64(user.ID), 10), audit.Diff(nil, newUserTenant))
 
 	log.Info("Added user to tenant",
 		zap.Uint("tenant_id", req.TenantID),
@@ -509,7 +453,7 @@ func RemoveUserFromTenant(c echo.Context) error {
 	if !ok {
 		log.Error("Failed to get user ID from context")
 		prometheus.RecordAuthError("unauthorized_tenant_user_remove")
-		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "authentication required"})
+		return apperrors.Unauthorized("authentication required")
 	}
 
 	// Parse parameters from URL
@@ -517,28 +461,25 @@ func RemoveUserFromTenant(c echo.Context) error {
 	if err != nil {
 		log.Error("Invalid tenant ID", zap.Error(err))
 		prometheus.RecordAuthError("invalid_tenant_id")
-		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid tenant ID"})
+		return apperrors.BadRequest("invalid tenant ID")
 	}
 
 	targetUserID, err := strconv.ParseUint(c.Param("user_id"), 10, 32)
 	if err != nil {
 		log.Error("Invalid user ID", zap.Error(err))
 		prometheus.RecordAuthError("invalid_user_id")
-		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid user ID"})
+		return apperrors.BadRequest("invalid user ID")
 	}
 
-	// Track DB operations
-	defer prometheus.TrackDBOperation("query")(time.Now())
-
-	// Verify the requesting user has permission to remove users from this tenant
+	// Verify the requesting user's role in this tenant allows removing users
 	var userTenant model.UserTenant
-	result := database.GetDB().Where("user_id = ? AND tenant_id = ? AND role IN ('owner', 'admin')", userID, tenantID).First(&userTenant)
-	if result.Error != nil {
+	result := database.GetDB().Where("user_id = ? AND tenant_id = ?", userID, tenantID).First(&userTenant)
+	if result.Error != nil || !authz.Allows(userTenant.Role, "tenant_user:manage") {
 		log.Warn("Unauthorized attempt to remove user from tenant",
 			zap.Uint("requesting_user_id", userID),
 			zap.Uint64("tenant_id", tenantID))
 		prometheus.RecordAuthError("tenant_permission_denied")
-		return c.JSON(http.StatusForbidden, echo.Map{"error": "insufficient permissions"})
+		return authz.Deny(c, "tenant_user:manage")
 	}
 
 	// Check if target user is the tenant owner (can't remove the owner)
@@ -546,7 +487,7 @@ func RemoveUserFromTenant(c echo.Context) error {
 	if result := database.GetDB().First(&tenant, tenantID); result.Error != nil {
 		log.Error("Tenant not found", zap.Uint64("id", tenantID))
 		prometheus.RecordAuthError("tenant_not_found")
-		return c.JSON(http.StatusNotFound, echo.Map{"error": "tenant not found"})
+		return apperrors.NotFound("tenant not found")
 	}
 
 	if tenant.OwnerID == uint(targetUserID) {
@@ -554,19 +495,31 @@ func RemoveUserFromTenant(c echo.Context) error {
 			zap.Uint64("tenant_id", tenantID),
 			zap.Uint64("owner_id", targetUserID))
 		prometheus.RecordAuthError("tenant_owner_removal_blocked")
-		return c.JSON(http.StatusForbidden, echo.Map{"error": "cannot remove tenant owner"})
+		return apperrors.Forbidden("cannot remove tenant owner")
 	}
 
+	// Keep the membership being removed for the audit log
+	var removed model.UserTenant
+	database.GetDB().Where("user_id = ? AND tenant_id = ?", targetUserID, tenantID).First(&removed)
+
 	// Remove the user from the tenant
 	result = database.GetDB().Where("user_id = ? AND tenant_id = ?", targetUserID, tenantID).Delete(&model.UserTenant{})
 	if result.Error != nil {
 		log.Error("Failed to remove user from tenant", zap.Error(result.Error))
 		prometheus.RecordAuthError("tenant_user_remove_failed")
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to remove user from tenant"})
+		return apperrors.Internal("failed to remove user from tenant", result.Error)
 	}
 
 	if result.RowsAffected == 0 {
-		return c.JSON(http.StatusNotFound, echo.Map{"error": "user not found in this tenant"})
+		return apperrors.NotFound("user not found in this tenant")
+	}
+	recordAudit(c, uint(tenantID), "tenant_user.removed", "tenant_user",
+		strconv.FormatUint(targetUserID, 10), audit.Diff(removed, nil))
+
+	// Tokens issued so far may carry the removed membership, so the user has to sign in again
+	if err := jwtutil.RevokeUser(c.Request().Context(), uint(targetUserID), time.Now()); err != nil {
+		log.Error("Failed to revoke tokens of removed user", zap.Error(err), zap.Uint64("user_id", targetUserID))
+		prometheus.RecordAuthError("token_revocation_failed")
 	}
 
 	// Update default tenant status if needed
@@ -595,35 +548,32 @@ func SetDefaultTenant(c echo.Context) error {
 	if !ok {
 		log.Error("Failed to get user ID from context")
 		prometheus.RecordAuthError("unauthorized_default_tenant_set")
-		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "authentication required"})
+		return apperrors.Unauthorized("authentication required")
 	}
 
 	// Parse request
 	var req struct {
-		TenantID uint `json:"tenant_id"`
+		TenantID uint `json:"tenant_id" validate:"required"`
 	}
 
 	if err := c.Bind(&req); err != nil {
 		log.Error("Failed to parse set default tenant request", zap.Error(err))
 		prometheus.RecordAuthError("invalid_request")
-		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid request"})
+		return apperrors.BadRequest("invalid request")
 	}
 
-	if req.TenantID == 0 {
+	if err := c.Validate(&req); err != nil {
 		log.Error("Invalid tenant ID", zap.Uint("tenant_id", req.TenantID))
 		prometheus.RecordAuthError("invalid_tenant_id")
-		return c.JSON(http.StatusBadRequest, echo.Map{"error": "tenant_id is required"})
+		return err
 	}
 
-	// Track DB operations
-	defer prometheus.TrackDBOperation("update")(time.Now())
-
 	// Begin transaction
 	tx := database.GetDB().Begin()
 	if tx.Error != nil {
 		log.Error("Failed to begin transaction", zap.Error(tx.Error))
 		prometheus.RecordAuthError("database_error")
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "database error"})
+		return apperrors.Internal("database error", tx.Error)
 	}
 
 	// Verify the user has access to this tenant
@@ -635,7 +585,7 @@ func SetDefaultTenant(c echo.Context) error {
 			zap.Uint("user_id", userID),
 			zap.Uint("tenant_id", req.TenantID))
 		prometheus.RecordAuthError("tenant_access_denied")
-		return c.JSON(http.StatusForbidden, echo.Map{"error": "access denied to requested tenant"})
+		return apperrors.Forbidden("access denied to requested tenant")
 	}
 
 	// Update all user's tenant associations to not be default
@@ -643,7 +593,7 @@ func SetDefaultTenant(c echo.Context) error {
 		tx.Rollback()
 		log.Error("Failed to update user-tenant associations", zap.Error(err))
 		prometheus.RecordAuthError("tenant_update_failed")
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to update tenant associations"})
+		return apperrors.Internal("failed to update tenant associations", err)
 	}
 
 	// Set the requested tenant as default
@@ -652,14 +602,14 @@ func SetDefaultTenant(c echo.Context) error {
 		tx.Rollback()
 		log.Error("Failed to set default tenant", zap.Error(err))
 		prometheus.RecordAuthError("tenant_update_failed")
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to set default tenant"})
+		return apperrors.Internal("failed to set default tenant", err)
 	}
 
 	// Commit transaction
 	if err := tx.Commit().Error; err != nil {
 		log.Error("Failed to commit transaction", zap.Error(err))
 		prometheus.RecordAuthError("transaction_commit_failed")
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "transaction commit failed"})
+		return apperrors.Internal("transaction commit failed", err)
 	}
 
 	log.Info("Set default tenant for user",
@@ -679,19 +629,24 @@ func SelectTenant(c echo.Context) error {
 
 	// Parse request
 	var req struct {
-		TenantID uint `json:"tenant_id"`
+		TenantID uint `json:"tenant_id" validate:"required"`
 	}
 
 	if err := c.Bind(&req); err != nil {
 		log.Error("Failed to parse tenant selection request", zap.Error(err))
-		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid request"})
+		return apperrors.BadRequest("invalid request")
+	}
+
+	if err := c.Validate(&req); err != nil {
+		log.Error("Invalid tenant ID", zap.Uint("tenant_id", req.TenantID))
+		return err
 	}
 
 	// Get token from Authorization header
 	tokenString := c.Request().Header.Get("Authorization")
 	if tokenString == "" {
 		log.Error("Missing token")
-		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "authentication required"})
+		return apperrors.Unauthorized("authentication required")
 	}
 
 	// Remove "Bearer " prefix if present
@@ -700,29 +655,26 @@ func SelectTenant(c echo.Context) error {
 	}
 
 	// Validate the token
-	claims, err := jwtutil.ValidateToken(tokenString)
+	claims, err := jwtutil.ValidateToken(c.Request().Context(), tokenString)
 	if err != nil {
 		log.Error("Invalid token", zap.Error(err))
-		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "invalid token"})
+		return apperrors.Unauthorized("invalid token")
 	}
 
-	// Track DB operations
-	defer prometheus.TrackDBOperation("query")(time.Now())
-
 	// Verify user has access to the specified tenant
 	var userTenant model.UserTenant
 	if result := database.GetDB().Preload("Tenant").Where("user_id = ? AND tenant_id = ? AND active = ?", claims.UserID, req.TenantID, true).First(&userTenant); result.Error != nil {
 		log.Warn("Tenant selection attempt for unauthorized tenant",
 			zap.Uint("user_id", claims.UserID),
 			zap.Uint("tenant_id", req.TenantID))
-		return c.JSON(http.StatusForbidden, echo.Map{"error": "access denied to the specified tenant"})
+		return apperrors.Forbidden("access denied to the specified tenant")
 	}
 
 	// Generate new JWT token with tenant information
 	token, err := jwtutil.GenerateTokenWithTenant(claims.Email, claims.UserID, &req.TenantID, userTenant.Tenant.Name, userTenant.Role)
 	if err != nil {
 		log.Error("Failed to generate token with tenant", zap.Error(err))
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "token generation failed"})
+		return apperrors.Internal("token generation failed", err)
 	}
 
 	log.Info("User selected tenant",
@@ -5,11 +5,11 @@ import (
 	"auth-service/pkg/logger"
 	localprometheus "auth-service/prometheus"
 	"fmt"
-	"net/http"
 	"strings"
 
 	"github.com/labstack/echo/v4"
 	"github.com/prometheus/client_golang/prometheus"
+	apperrors "github.com/suteetoe/gomicro/errors"
 	"go.uber.org/zap"
 )
 
@@ -26,7 +26,7 @@ func AuthMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 		if tokenString == "" {
 			log.Warn("Missing authorization token")
 			localprometheus.AuthErrorCounter.With(prometheus.Labels{"type": "missing_token"}).Inc()
-			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "authentication required"})
+			return apperrors.Unauthorized("authentication required")
 		}
 
 		// Remove "Bearer " prefix if present
@@ -35,17 +35,18 @@ func AuthMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 		}
 
 		// Validate the token
-		claims, err := jwtutil.ValidateToken(tokenString)
+		claims, err := jwtutil.ValidateToken(c.Request().Context(), tokenString)
 		if err != nil {
 			log.Warn("Invalid token", zap.Error(err))
 			localprometheus.AuthErrorCounter.With(prometheus.Labels{"type": "invalid_token"}).Inc()
-			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "invalid token"})
+			return apperrors.Unauthorized("invalid token")
 		}
 
 		// Increment successful auth counter
 		localprometheus.AuthSuccessCounter.Inc()
 
 		// Store user information in the context
+		c.Set("claims", claims)
 		c.Set("user_id", claims.UserID)
 		c.Set("email", claims.Email)
 
@@ -90,10 +91,7 @@ func RequireTenantContext(next echo.HandlerFunc) echo.HandlerFunc {
 		if !ok || tenantID == 0 {
 			log.Warn("Missing tenant context")
 			localprometheus.TenantContextMissingCounter.Inc()
-			return c.JSON(http.StatusForbidden, echo.Map{
-				"error":   "tenant context required",
-				"message": "Please select a tenant before accessing this resource",
-			})
+			return apperrors.Forbidden("Please select a tenant before accessing this resource")
 		}
 
 		// Tenant context exists, proceed
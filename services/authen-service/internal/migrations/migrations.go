@@ -0,0 +1,58 @@
+package migrations
+
+import (
+	"auth-service/internal/model"
+
+	"github.com/suteetoe/gomicro/audit"
+	"github.com/suteetoe/gomicro/jwtutil"
+	"github.com/suteetoe/gomicro/migrate"
+	"github.com/suteetoe/gomicro/ratelimit"
+	"gorm.io/gorm"
+)
+
+// All returns the schema migrations of the service. Add new versions to the end of the list
+// and never change a version that has been released.
+func All() []migrate.Migration {
+	return []migrate.Migration{
+		{
+			// Version 1 is the schema previously created by AutoMigrate on every boot
+			Version: 1,
+			Name:    "baseline",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&model.User{}, &model.Tenant{}, &model.UserTenant{}, &audit.Event{})
+			},
+			Down: func(tx *gorm.DB) error {
+				// audit_events is shared with the other services and is kept
+				return tx.Migrator().DropTable(&model.UserTenant{}, &model.Tenant{}, &model.User{})
+			},
+		},
+		{
+			// Version 2 stores the rotating signing keys used with JWT_ALGORITHM RS256, ES256 or EdDSA
+			Version: 2,
+			Name:    "jwt_signing_keys",
+			Up:      jwtutil.MigrateKeys,
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable(&jwtutil.SigningKeyRecord{})
+			},
+		},
+		{
+			// Version 3 records revoked tokens for JWT_DENYLIST=postgres
+			Version: 3,
+			Name:    "jwt_denylist",
+			Up:      jwtutil.MigrateDenylist,
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable(&jwtutil.UserRevocation{}, &jwtutil.RevokedToken{})
+			},
+		},
+		{
+			// Version 4 keeps the rate limit counters for RATE_LIMIT_STORE=postgres
+			Version: 4,
+			Name:    "rate_limits",
+			Up:      ratelimit.Migrate,
+			Down: func(tx *gorm.DB) error {
+				// rate_limit_buckets is shared with the other services and is kept
+				return nil
+			},
+		},
+	}
+}
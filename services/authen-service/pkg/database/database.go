@@ -1,68 +1,41 @@
 package database
 
 import (
-	"auth-service/internal/model"
 	"auth-service/pkg/config"
-	"fmt"
-	"log"
 
-	"gorm.io/driver/postgres"
+	"github.com/prometheus/client_golang/prometheus"
+	gomicrodb "github.com/suteetoe/gomicro/database"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
 
 var DB *gorm.DB
 
-// InitDB initializes the database connection with configuration and runs migrations
-func InitDB(config *config.Config) error {
+// InitDB initializes the database connection with configuration; the schema is managed by internal/migrations
+func InitDB(config *config.Config, registerer prometheus.Registerer) error {
 	var err error
 
 	// Configure GORM logger
-	logLevel := logger.Info
+	dbConfig := config.DB
 	if config.Server.Env == "development" {
-		logLevel = logger.Info
+		dbConfig.LogLevel = logger.Info
 	} else {
-		logLevel = logger.Error
+		dbConfig.LogLevel = logger.Error
 	}
 
-	// Create DSN string
-	dsn := config.DB.GetDSN()
-
-	// Configure Postgres options
-	pgConfig := postgres.Config{
-		DSN:                  dsn,
-		PreferSimpleProtocol: true, // Disables implicit prepared statement usage
-	}
-
-	// Open connection
-	DB, err = gorm.Open(postgres.New(pgConfig), &gorm.Config{
-		Logger: logger.Default.LogMode(logLevel),
-	})
-	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
-		return err
-	}
-
-	// Get generic database object SQL
-	sqlDB, err := DB.DB()
-	if err != nil {
-		log.Fatalf("Failed to get database object: %v", err)
-		return err
-	}
-
-	// Set connection pool settings from config
-	sqlDB.SetMaxIdleConns(config.DB.MaxIdleConns)
-	sqlDB.SetMaxOpenConns(config.DB.MaxOpenConns)
-	sqlDB.SetConnMaxLifetime(config.DB.ConnMaxLifetime)
-
-	fmt.Println("Database connected successfully")
-
-	// Run migrations
-	if err := DB.AutoMigrate(&model.User{}, &model.Tenant{}, &model.UserTenant{}); err != nil {
-		return fmt.Errorf("failed to run database migrations: %w", err)
+	// Record query metrics and connection pool statistics, and route reads to the read
+	// replicas, if any; writes and transactions stay on the primary
+	replicas := gomicrodb.NewReplicaRouter("authen-service", config.DB.ReplicaDSNs()...)
+	replicas.Registerer = registerer
+	plugins := []gorm.Plugin{
+		gomicrodb.NewMetricsPlugin("authen-service", gomicrodb.WithRegisterer(registerer)),
+		replicas,
 	}
 
-	return nil
+	// Open the connection through gomicro, retrying while the database is starting, so that
+	// gomicrodb.ApplyConfig can apply a rotated password
+	DB, err = gomicrodb.InitDB(&dbConfig, plugins...)
+	return err
 }
 
 // GetDB returns the database instance
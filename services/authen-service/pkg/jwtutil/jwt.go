@@ -2,28 +2,45 @@ package jwtutil
 
 import (
 	"auth-service/pkg/config"
+	"context"
 	"errors"
-	"fmt"
 	"time"
 
-	"github.com/golang-jwt/jwt/v4"
+	gomicrojwt "github.com/suteetoe/gomicro/jwtutil"
 )
 
-var jwtConfig *config.JWTConfig
+var jwtUtil *gomicrojwt.JWTUtil
+
+// revocation is set when a denylist is configured
+var revocation bool
 
 // UserClaims represents the JWT claims for user authentication
-type UserClaims struct {
-	Email      string `json:"email"`
-	UserID     uint   `json:"user_id"`
-	TenantID   *uint  `json:"tenant_id,omitempty"`   // Adding tenant ID for multi-tenancy
-	TenantName string `json:"tenant_name,omitempty"` // Adding tenant name for convenience
-	Role       string `json:"role,omitempty"`        // User's role in the current tenant
-	jwt.RegisteredClaims
+type UserClaims = gomicrojwt.UserClaims
+
+// Initialize sets up the JWT utility with configuration. With a key set tokens are signed
+// with its active key instead of the shared secret, and HS256 tokens are no longer accepted.
+// With a denylist revoked tokens are rejected.
+func Initialize(config *config.JWTConfig, keys *gomicrojwt.KeySet, denylist gomicrojwt.Denylist) {
+	jwtConfig := &gomicrojwt.JWTConfig{
+		SigningKey:      config.SigningKey,
+		ExpirationHours: config.ExpirationHours,
+		Denylist:        denylist,
+	}
+	if keys != nil {
+		jwtConfig.SigningKey = ""
+		jwtConfig.Keys = keys
+	}
+	jwtUtil = gomicrojwt.NewJWTUtil(jwtConfig)
+	revocation = denylist != nil
 }
 
-// Initialize sets up the JWT utility with configuration
-func Initialize(config *config.JWTConfig) {
-	jwtConfig = config
+// ApplyConfig applies a rotated JWT_SIGNING_KEY, for use with config.Watcher. Rotating keys
+// (JWT_ALGORITHM other than HS256) are rotated by the Rotator instead.
+func ApplyConfig(old, new *config.Config) error {
+	if jwtUtil == nil {
+		return errors.New("JWT configuration not initialized")
+	}
+	return jwtUtil.ApplyConfig(old, new)
 }
 
 // GenerateToken creates a JWT token with user information
@@ -33,58 +50,40 @@ func GenerateToken(email string, userID uint) (string, error) {
 
 // GenerateTokenWithTenant creates a JWT token with user and tenant information
 func GenerateTokenWithTenant(email string, userID uint, tenantID *uint, tenantName string, role string) (string, error) {
-	if jwtConfig == nil {
+	if jwtUtil == nil {
 		return "", errors.New("JWT configuration not initialized")
 	}
-
-	// Get signing key and expiration from configuration
-	signingKey := jwtConfig.SigningKey
-	expirationHours := jwtConfig.ExpirationHours
-
-	claims := UserClaims{
-		Email:      email,
-		UserID:     userID,
-		TenantID:   tenantID,
-		TenantName: tenantName,
-		Role:       role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Duration(expirationHours) * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
-	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(signingKey))
+	return jwtUtil.GenerateTokenWithTenant(email, userID, tenantID, tenantName, role)
 }
 
 // ValidateToken validates and parses the JWT token
-func ValidateToken(tokenString string) (*UserClaims, error) {
-	if jwtConfig == nil {
+func ValidateToken(ctx context.Context, tokenString string) (*UserClaims, error) {
+	if jwtUtil == nil {
 		return nil, errors.New("JWT configuration not initialized")
 	}
+	return jwtUtil.ValidateTokenContext(ctx, tokenString)
+}
 
-	// Get signing key from configuration
-	signingKey := jwtConfig.SigningKey
-
-	token, err := jwt.ParseWithClaims(
-		tokenString,
-		&UserClaims{},
-		func(token *jwt.Token) (interface{}, error) {
-			// Validate the signing method
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return []byte(signingKey), nil
-		},
-	)
-
-	if err != nil {
-		return nil, err
+// Revoke revokes the token of claims. It does nothing when revocation is disabled
+// (JWT_DENYLIST=none).
+func Revoke(ctx context.Context, claims *UserClaims) error {
+	if jwtUtil == nil {
+		return errors.New("JWT configuration not initialized")
 	}
-
-	if claims, ok := token.Claims.(*UserClaims); ok && token.Valid {
-		return claims, nil
+	if !revocation {
+		return nil
 	}
+	return jwtUtil.Revoke(ctx, claims)
+}
 
-	return nil, errors.New("invalid token")
+// RevokeUser revokes every token of the user issued at or before the given time. It does
+// nothing when revocation is disabled (JWT_DENYLIST=none).
+func RevokeUser(ctx context.Context, userID uint, before time.Time) error {
+	if jwtUtil == nil {
+		return errors.New("JWT configuration not initialized")
+	}
+	if !revocation {
+		return nil
+	}
+	return jwtUtil.RevokeUser(ctx, userID, before)
 }
@@ -2,13 +2,12 @@ package prometheus
 
 import (
 	"auth-service/pkg/config"
-	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
+	apperrors "github.com/suteetoe/gomicro/errors"
 )
 
 // Counter metrics
@@ -127,16 +126,6 @@ var (
 		[]string{"endpoint", "method", "status"},
 	)
 
-	// Database operation duration
-	DBOperationDuration = prometheus.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Name:    "auth_db_operation_duration_seconds",
-			Help:    "Duration of database operations in seconds",
-			Buckets: prometheus.DefBuckets,
-		},
-		[]string{"operation"}, // operation can be "query", "insert", "update", "delete"
-	)
-
 	// Tenant operation duration
 	TenantOperationDuration = prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
@@ -185,67 +174,41 @@ var (
 	)
 )
 
-func init() {
-	// Register counters
-	prometheus.MustRegister(LoginCounter)
-	prometheus.MustRegister(RegisterCounter)
-	prometheus.MustRegister(APIRequestsCounter)
-	prometheus.MustRegister(TenantSelectionCounter)
-	prometheus.MustRegister(TenantOperationCounter)
-	prometheus.MustRegister(HTTPRequestCounter)
-	prometheus.MustRegister(AuthErrorCounter)
-	prometheus.MustRegister(TenantErrorCounter)
-	prometheus.MustRegister(AuthOperationCounter)
-
-	// Register additional authentication metrics
-	prometheus.MustRegister(AuthAttemptsCounter)
-	prometheus.MustRegister(AuthSuccessCounter)
-	prometheus.MustRegister(TenantContextMissingCounter)
-
-	// Register histograms
-	prometheus.MustRegister(RequestDuration)
-	prometheus.MustRegister(DBOperationDuration)
-	prometheus.MustRegister(TenantOperationDuration)
-
-	// Register gauges
-	prometheus.MustRegister(ActiveTokensGauge)
-	prometheus.MustRegister(InfoGauge)
-	prometheus.MustRegister(ActiveTenantsGauge)
-	prometheus.MustRegister(UsersPerTenantGauge)
-
-	// Set initial service info
-	InfoGauge.With(prometheus.Labels{"version": "1.0.0"}).Set(1)
-}
-
-// InitMetrics initializes metrics with configuration
-func InitMetrics(cfg *config.Config) {
-	// Set initial service info with metrics prefix
-	metricPrefix := cfg.Metrics.Prefix
-	if metricPrefix != "" {
-		// If we wanted to add the prefix to metric names, we would do it here
-		// For now, we'll just log it and ensure our metrics are initialized
+// InitMetrics registers the service metrics on registerer, the registry of the service's HTTP metrics
+func InitMetrics(cfg *config.Config, registerer prometheus.Registerer) error {
+	for _, collector := range []prometheus.Collector{
+		// Counters
+		LoginCounter,
+		RegisterCounter,
+		APIRequestsCounter,
+		TenantSelectionCounter,
+		TenantOperationCounter,
+		HTTPRequestCounter,
+		AuthErrorCounter,
+		TenantErrorCounter,
+		AuthOperationCounter,
+		AuthAttemptsCounter,
+		AuthSuccessCounter,
+		TenantContextMissingCounter,
+
+		// Histograms
+		RequestDuration,
+		TenantOperationDuration,
+
+		// Gauges
+		ActiveTokensGauge,
+		InfoGauge,
+		ActiveTenantsGauge,
+		UsersPerTenantGauge,
+	} {
+		if err := registerer.Register(collector); err != nil {
+			return err
+		}
 	}
 
 	// Set initial service info
 	InfoGauge.With(prometheus.Labels{"version": "1.0.0"}).Set(1)
-
-	// Additional metrics initialization if needed based on config
-}
-
-// GetPrometheusHandler returns an HTTP handler for the Prometheus metrics
-func GetPrometheusHandler() http.Handler {
-	return promhttp.Handler()
-}
-
-// DBMetricsMiddleware measures database operation durations
-func TrackDBOperation(operation string) func(time.Time) {
-	startTime := time.Now()
-	return func(endTime time.Time) {
-		duration := time.Since(startTime).Seconds()
-		DBOperationDuration.With(prometheus.Labels{
-			"operation": operation,
-		}).Observe(duration)
-	}
+	return nil
 }
 
 // TrackTenantOperation measures tenant operation durations
@@ -271,7 +234,12 @@ func MetricsMiddleware() echo.MiddlewareFunc {
 
 			// Record request duration
 			duration := time.Since(start).Seconds()
-			status := strconv.Itoa(c.Response().Status)
+			code := c.Response().Status
+			if err != nil && !c.Response().Committed {
+				// The error handler has not written the response yet
+				code = apperrors.StatusCode(err)
+			}
+			status := strconv.Itoa(code)
 			endpoint := c.Path()
 			method := c.Request().Method
 
@@ -1,19 +1,29 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"merchant-service/internal/handler"
-	"merchant-service/internal/model"
+	"merchant-service/internal/migrations"
+	merchantmetrics "merchant-service/prometheus"
 	"os"
 
 	"github.com/joho/godotenv"
-	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/suteetoe/gomicro/config"
 	"github.com/suteetoe/gomicro/database"
+	"github.com/suteetoe/gomicro/health"
+	"github.com/suteetoe/gomicro/idempotency"
 	"github.com/suteetoe/gomicro/jwtutil"
 	"github.com/suteetoe/gomicro/logger"
 	"github.com/suteetoe/gomicro/metrics" // Import the new metrics package
 	"github.com/suteetoe/gomicro/middleware"
+	"github.com/suteetoe/gomicro/migrate"
+	"github.com/suteetoe/gomicro/ratelimit"
+	"github.com/suteetoe/gomicro/server"
+	"github.com/suteetoe/gomicro/tracing"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
 )
 
 func main() {
@@ -23,7 +33,7 @@ func main() {
 	}
 
 	// Load configuration using gomicro
-	conf, err := config.Load("merchant")
+	conf, err := config.Load("merchant", config.WithArgs(os.Args[1:]))
 	if err != nil {
 		fmt.Printf("Error loading configuration: %v\n", err)
 		os.Exit(1)
@@ -31,60 +41,191 @@ func main() {
 
 	// Initialize logger
 	err = logger.InitLogger(&logger.LogConfig{
-		Level:       conf.Log.Level,
-		Environment: conf.Server.Env,
-		ServiceName: conf.ServiceName,
+		Level:           conf.Log.Level,
+		Environment:     conf.Server.Env,
+		ServiceName:     conf.ServiceName,
+		Sampling:        logger.NewSamplingConfig(conf.Log.SamplingInitial, conf.Log.SamplingThereafter),
+		RequestSampling: logger.NewSamplingConfig(conf.Log.RequestSamplingInitial, conf.Log.RequestSamplingThereafter),
 	})
 	if err != nil {
 		fmt.Printf("Error initializing logger: %v\n", err)
 		os.Exit(1)
 	}
 	log := logger.GetLogger()
+	log.Info("Configuration loaded", zap.Any("config", conf.Dump()))
+
+	// Initialize distributed tracing
+	if err := tracing.InitTracer(context.Background(), &tracing.TracingConfig{
+		ServiceName: conf.ServiceName,
+		Environment: conf.Server.Env,
+		Enabled:     conf.Tracing.Enabled,
+		Endpoint:    conf.Tracing.Endpoint,
+		Insecure:    conf.Tracing.Insecure,
+		SampleRatio: conf.Tracing.SampleRatio,
+	}); err != nil {
+		log.Fatal("Failed to initialize tracing", zap.Error(err))
+	}
+	log.Info("Tracing initialized", zap.Bool("enabled", conf.Tracing.Enabled))
+
+	// Initialize HTTP metrics on a registry of the service, which /metrics serves
+	httpMetrics, err := metrics.NewHTTPMetrics(conf.ServiceName, metrics.WithRegistry(metrics.NewRegistry()),
+		metrics.WithConstLabels(prometheus.Labels{
+			"version":  conf.Metrics.Version,
+			"instance": conf.Metrics.Instance,
+			"region":   conf.Metrics.Region,
+		}))
+	if err != nil {
+		log.Fatal("Failed to initialize HTTP metrics", zap.Error(err))
+	}
+
+	// Initialize Prometheus metrics of the service on the same registry
+	if err := merchantmetrics.InitMetrics(httpMetrics.Registerer()); err != nil {
+		log.Fatal("Failed to initialize Prometheus metrics", zap.Error(err))
+	}
 
 	// Initialize database connection using the DBConfig from the conf object directly
-	_, err = database.InitDB(&conf.DB)
+	replicas := database.NewReplicaRouter(conf.ServiceName, conf.DB.ReplicaDSNs()...)
+	replicas.Registerer = httpMetrics.Registerer()
+	plugins := []gorm.Plugin{
+		database.NewMetricsPlugin(conf.ServiceName, database.WithRegisterer(httpMetrics.Registerer())),
+		database.NewTenantPlugin(),
+		replicas,
+	}
+	if conf.DB.TenantRLS {
+		// Run statements of a request in its tenant transaction, see TenantTransaction below
+		plugins = append(plugins, database.NewRLSPlugin())
+	}
+	db, err := database.InitDB(&conf.DB, plugins...)
 	if err != nil {
-		log.Fatal("Failed to initialize database")
+		log.Fatal("Failed to initialize database", zap.Error(err))
 	}
 
-	// Run migrations for merchant models
-	if err := database.MigrateModels(&model.Merchant{}); err != nil {
-		log.Fatal("Failed to migrate database models")
+	// Apply changes to the config file and rotated secrets, such as DB_PASSWORD, without a restart
+	watcher := config.NewWatcher(conf, log)
+	watcher.Subscribe("logger", logger.ApplyConfig)
+	watcher.Subscribe("database", database.ApplyConfig)
+	defer watcher.Start(config.DefaultWatchInterval)()
+
+	// Apply schema migrations; `merchant-service migrate <command>` runs a single migrate command and exits
+	migrator, err := migrate.New(database.GetDB(), "merchant-service", migrations.All(), migrate.WithLogger(logger.Component("migrate")),
+		migrate.WithTenantRLS(conf.DB.TenantRLS, migrations.TenantTables...))
+	if err != nil {
+		log.Fatal("Invalid migrations", zap.Error(err))
+	}
+	if ran, err := migrate.Command(context.Background(), migrator, os.Args[1:], os.Stdout); ran {
+		if err != nil {
+			log.Fatal("Migrate command failed", zap.Error(err))
+		}
+		return
+	}
+	if conf.DB.MigrateOnStart {
+		if _, err := migrator.Up(context.Background()); err != nil {
+			log.Fatal("Failed to apply migrations", zap.Error(err))
+		}
+	}
+	if conf.DB.TenantRLS {
+		// Refuse to serve tenants when Postgres would not enforce the policies
+		if err := database.VerifyRLS(context.Background(), database.GetDB(), migrations.TenantTables...); err != nil {
+			log.Fatal("Row level security is not enforced", zap.Error(err))
+		}
 	}
 
-	// Initialize JWT utility
+	// Initialize JWT utility; with a JWKS URL tokens are verified against authen-service's
+	// published keys and the shared secret is not used
 	jwtConfig := &jwtutil.JWTConfig{
 		SigningKey:      conf.JWT.SigningKey,
 		ExpirationHours: conf.JWT.ExpirationHours,
 	}
+	if conf.JWT.JWKSURL != "" {
+		jwtConfig.SigningKey = ""
+		jwtConfig.Resolver = jwtutil.NewJWKSClient(conf.JWT.JWKSURL)
+	}
+	// Reject tokens revoked by authen-service, e.g. on logout
+	denylist, err := jwtutil.NewDenylist(conf.JWT.Denylist, db)
+	if err != nil {
+		log.Fatal("Invalid JWT denylist", zap.Error(err))
+	}
+	jwtConfig.Denylist = denylist
 	jwt := jwtutil.NewJWTUtil(jwtConfig)
+	watcher.Subscribe("jwt", jwt.ApplyConfig)
 
-	// Initialize HTTP metrics
-	httpMetrics := metrics.NewHTTPMetrics(conf.ServiceName)
-
-	// Initialize Echo framework
-	e := echo.New()
-
-	// Apply middleware
-	e.Use(middleware.RequestIDMiddleware())
-	e.Use(logger.Middleware())
-	e.Use(httpMetrics.Middleware()) // Use the centralized metrics middleware
+	// Authorize tenant roles against the role to permission policy (AUTHZ_POLICY_PATH)
+	policy, err := middleware.LoadPolicy(conf.Authz.PolicyPath)
+	if err != nil {
+		log.Fatal("Failed to load authorization policy", zap.Error(err))
+	}
+	authz, err := middleware.NewAuthorizer(conf.ServiceName, policy, middleware.RoleFromClaims(),
+		middleware.WithAuthorizerRegisterer(httpMetrics.Registerer()))
+	if err != nil {
+		log.Fatal("Failed to initialize authorization", zap.Error(err))
+	}
 
-	// Metrics endpoint
-	e.GET("/metrics", echo.WrapHandler(metrics.GetPrometheusHandler()))
+	// Throttle the API requests of each tenant (RATE_LIMIT_STORE, RATE_LIMIT_API)
+	apiLimit, err := ratelimit.APIRule(conf)
+	if err != nil {
+		log.Fatal("Invalid rate limit", zap.Error(err))
+	}
+	limitStore, err := ratelimit.NewStore(conf.RateLimit.Store, db)
+	if err != nil {
+		log.Fatal("Invalid rate limit store", zap.Error(err))
+	}
+	limiter, err := ratelimit.NewLimiter(conf.ServiceName, limitStore, ratelimit.WithRegisterer(httpMetrics.Registerer()))
+	if err != nil {
+		log.Fatal("Failed to initialize rate limiting", zap.Error(err))
+	}
 
-	// Public routes
-	e.GET("/merchant/hello", handler.Hello) // Public endpoint, doesn't need auth
+	// Replay the responses of POST and PATCH requests retried with an Idempotency-Key
+	idempotencyStore, err := idempotency.NewStore(conf.Idempotency.Store, db)
+	if err != nil {
+		log.Fatal("Invalid idempotency store", zap.Error(err))
+	}
+	idempotent, err := idempotency.New(conf.ServiceName, idempotencyStore, idempotency.WithTTL(conf.Idempotency.TTL),
+		idempotency.WithRegisterer(httpMetrics.Registerer()))
+	if err != nil {
+		log.Fatal("Failed to initialize idempotency keys", zap.Error(err))
+	}
 
-	// Secured routes - require authentication
-	merchants := e.Group("/merchants")
-	merchants.Use(middleware.JWTAuthMiddleware(jwt)) // Apply auth middleware to all merchant routes
+	// Apply changed rate limit rules, idempotency TTL without a restart
+	watcher.Subscribe("rate_limit", limiter.ApplyConfig(ratelimit.Limits{"api": ratelimit.APIRule}))
+	watcher.Subscribe("idempotency", idempotent.ApplyConfig)
 
-	merchants.POST("", handler.CreateMerchant)
-	merchants.GET("/:id", handler.GetMerchant)
-	merchants.GET("", handler.ListMerchantsByOwner)
+	// Report ready while the database answers and the schema is migrated (/livez, /readyz)
+	checks, err := health.New(conf.ServiceName, health.WithLogger(log), health.WithRegisterer(httpMetrics.Registerer()))
+	if err != nil {
+		log.Fatal("Failed to initialize health checks", zap.Error(err))
+	}
+	checks.AddReadiness("database", health.Database(db))
+	checks.AddReadiness("migrations", health.Migrations(migrator))
+
+	// Build the HTTP server; it shuts down gracefully on SIGTERM
+	srv := server.New(conf.ServiceName,
+		server.WithLogger(log),
+		server.WithDatabase(db),
+		server.WithMetrics(httpMetrics),
+		server.WithHealth(checks),
+		server.WithLogLevels(conf.Log.AdminToken, conf.Log.LevelFile),
+		server.WithAuth(middleware.JWTAuthMiddleware(jwt)),
+		server.WithRoutes(func(r *server.Router) {
+			// Public routes
+			r.GET("/merchant/hello", handler.Hello) // Public endpoint, doesn't need auth
+
+			// Secured routes - require authentication
+			merchants := r.Secure("/merchants")
+			merchants.Use(limiter.Middleware("api", apiLimit, ratelimit.FirstKey(ratelimit.KeyByTenant(), ratelimit.KeyByUser())))
+			merchants.Use(idempotent.Middleware())
+			if conf.DB.TenantRLS {
+				// In RLS mode each request runs in a transaction bound to its tenant
+				merchants.Use(middleware.TenantTransaction(db))
+			}
+
+			merchants.POST("", handler.CreateMerchant, authz.RequirePermission("merchant:create"))
+			merchants.GET("/:id", handler.GetMerchant, authz.RequirePermission("merchant:read"))
+			merchants.GET("", handler.ListMerchantsByOwner, authz.RequirePermission("merchant:read"))
+		}),
+	)
 
 	// Start server
-	log.Info("Starting merchant-service on port " + conf.Server.Port)
-	e.Logger.Fatal(e.Start(":" + conf.Server.Port))
+	if err := srv.Run(context.Background(), ":"+conf.Server.Port); err != nil {
+		log.Fatal("Server error", zap.Error(err))
+	}
 }
@@ -7,6 +7,7 @@ import (
 
 	"github.com/labstack/echo/v4"
 	"github.com/suteetoe/gomicro/database"
+	apperrors "github.com/suteetoe/gomicro/errors"
 	"github.com/suteetoe/gomicro/jwtutil"
 	"github.com/suteetoe/gomicro/logger"
 	"go.uber.org/zap"
@@ -20,31 +21,31 @@ func CreateMerchant(c echo.Context) error {
 	claims, ok := c.Get("user").(*jwtutil.UserClaims)
 	if !ok {
 		log.Error("Failed to get user claims from context")
-		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "authentication required"})
+		return apperrors.Unauthorized("authentication required")
 	}
 	userID := claims.UserID
 
 	// Get tenant ID from claims
 	if claims.TenantID == nil {
 		log.Error("Tenant ID is missing from user claims")
-		return c.JSON(http.StatusBadRequest, echo.Map{"error": "tenant context required"})
+		return apperrors.BadRequest("tenant context required")
 	}
 	tenantID := *claims.TenantID
 
 	// Parse request
 	var req struct {
-		Name        string `json:"name"`
+		Name        string `json:"name" validate:"required,max=100"`
 		Description string `json:"description"`
 	}
 
 	if err := c.Bind(&req); err != nil {
 		log.Error("Failed to parse merchant creation request", zap.Error(err))
-		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid request"})
+		return apperrors.BadRequest("invalid request")
 	}
 
-	if req.Name == "" {
-		log.Error("Invalid merchant data", zap.String("name", req.Name))
-		return c.JSON(http.StatusBadRequest, echo.Map{"error": "name is required"})
+	if err := c.Validate(&req); err != nil {
+		log.Error("Invalid merchant data", zap.Error(err))
+		return err
 	}
 
 	// Create merchant with tenant ID
@@ -57,9 +58,9 @@ func CreateMerchant(c echo.Context) error {
 	}
 
 	// Save to database
-	if result := database.GetDB().Create(&merchant); result.Error != nil {
+	if result := database.GetDB().WithContext(c.Request().Context()).Create(&merchant); result.Error != nil {
 		log.Error("Failed to create merchant", zap.Error(result.Error))
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "merchant creation failed"})
+		return apperrors.Internal("merchant creation failed", result.Error)
 	}
 
 	log.Info("Merchant created",
@@ -82,14 +83,14 @@ func GetMerchant(c echo.Context) error {
 	claims, ok := c.Get("user").(*jwtutil.UserClaims)
 	if !ok {
 		log.Error("Failed to get user claims from context")
-		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "authentication required"})
+		return apperrors.Unauthorized("authentication required")
 	}
 	userID := claims.UserID
 
 	// Get tenant ID from claims
 	if claims.TenantID == nil {
 		log.Error("Tenant ID is missing from user claims")
-		return c.JSON(http.StatusBadRequest, echo.Map{"error": "tenant context required"})
+		return apperrors.BadRequest("tenant context required")
 	}
 	tenantID := *claims.TenantID
 
@@ -97,14 +98,14 @@ func GetMerchant(c echo.Context) error {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		log.Error("Invalid merchant ID", zap.Error(err))
-		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid merchant ID"})
+		return apperrors.BadRequest("invalid merchant ID")
 	}
 
-	// Retrieve merchant from database
+	// Retrieve merchant from database; the tenant scope hides merchants of other tenants
 	var merchant model.Merchant
-	if result := database.GetDB().First(&merchant, id); result.Error != nil {
+	if result := database.GetDB().WithContext(c.Request().Context()).First(&merchant, id); result.Error != nil {
 		log.Error("Merchant not found", zap.Uint64("id", id), zap.Error(result.Error))
-		return c.JSON(http.StatusNotFound, echo.Map{"error": "merchant not found"})
+		return apperrors.NotFound("merchant not found")
 	}
 
 	// Check if merchant belongs to the same tenant
@@ -112,7 +113,7 @@ func GetMerchant(c echo.Context) error {
 		log.Warn("Cross-tenant merchant access attempt",
 			zap.Uint("requesting_tenant_id", tenantID),
 			zap.Uint("merchant_tenant_id", merchant.TenantID))
-		return c.JSON(http.StatusForbidden, echo.Map{"error": "access denied"})
+		return apperrors.Forbidden("access denied")
 	}
 
 	// Check if user owns this merchant
@@ -120,7 +121,7 @@ func GetMerchant(c echo.Context) error {
 		log.Warn("Unauthorized merchant access attempt",
 			zap.Uint("requesting_user_id", userID),
 			zap.Uint("merchant_owner_id", merchant.OwnerID))
-		return c.JSON(http.StatusForbidden, echo.Map{"error": "access denied"})
+		return apperrors.Forbidden("access denied")
 	}
 
 	return c.JSON(http.StatusOK, merchant)
@@ -134,25 +135,25 @@ func ListMerchantsByOwner(c echo.Context) error {
 	claims, ok := c.Get("user").(*jwtutil.UserClaims)
 	if !ok {
 		log.Error("Failed to get user claims from context")
-		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "authentication required"})
+		return apperrors.Unauthorized("authentication required")
 	}
 	userID := claims.UserID
 
 	// Get tenant ID from claims
 	if claims.TenantID == nil {
 		log.Error("Tenant ID is missing from user claims")
-		return c.JSON(http.StatusBadRequest, echo.Map{"error": "tenant context required"})
+		return apperrors.BadRequest("tenant context required")
 	}
 	tenantID := *claims.TenantID
 
-	// Retrieve merchants from database with tenant isolation
+	// Retrieve merchants from database; the tenant scope limits them to the tenant of the token
 	var merchants []model.Merchant
-	if result := database.GetDB().Where("owner_id = ? AND tenant_id = ?", userID, tenantID).Find(&merchants); result.Error != nil {
+	if result := database.GetDB().WithContext(c.Request().Context()).Where("owner_id = ?", userID).Find(&merchants); result.Error != nil {
 		log.Error("Failed to retrieve merchants",
 			zap.Uint("owner_id", userID),
 			zap.Uint("tenant_id", tenantID),
 			zap.Error(result.Error))
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to retrieve merchants"})
+		return apperrors.Internal("failed to retrieve merchants", result.Error)
 	}
 
 	return c.JSON(http.StatusOK, merchants)
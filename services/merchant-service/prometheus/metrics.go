@@ -1,12 +1,10 @@
 package prometheus
 
 import (
-	"net/http"
 	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 // Existing counters
@@ -40,15 +38,19 @@ var RequestDurationHistogram = prometheus.NewHistogramVec(
 	[]string{"method", "path"},
 )
 
-func init() {
-	prometheus.MustRegister(CreateMerchantCounter)
-	prometheus.MustRegister(GetMerchantCounter)
-	prometheus.MustRegister(ListMerchantsCounter)
-	prometheus.MustRegister(RequestDurationHistogram)
-}
-
-func GetPrometheusHandler() http.Handler {
-	return promhttp.Handler()
+// InitMetrics registers the service metrics on registerer, the registry of the service's HTTP metrics
+func InitMetrics(registerer prometheus.Registerer) error {
+	for _, collector := range []prometheus.Collector{
+		CreateMerchantCounter,
+		GetMerchantCounter,
+		ListMerchantsCounter,
+		RequestDurationHistogram,
+	} {
+		if err := registerer.Register(collector); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // MetricsMiddleware is an Echo middleware function that records HTTP request metrics
@@ -1,16 +1,29 @@
 package main
 
 import (
+	"context"
 	"oauth-service/internal/handler"
 	"oauth-service/internal/middleware"
+	"oauth-service/internal/migrations"
 	"oauth-service/pkg/config"
 	"oauth-service/pkg/database"
 	"oauth-service/pkg/logger"
 	"oauth-service/prometheus"
+	"os"
 
-	"github.com/labstack/echo/v4"
 	echomiddleware "github.com/labstack/echo/v4/middleware"
+	"github.com/suteetoe/gomicro/audit"
+	gomicroconfig "github.com/suteetoe/gomicro/config"
+	gomicrodb "github.com/suteetoe/gomicro/database"
+	apperrors "github.com/suteetoe/gomicro/errors"
+	"github.com/suteetoe/gomicro/health"
+	"github.com/suteetoe/gomicro/idempotency"
+	gomicrologger "github.com/suteetoe/gomicro/logger"
 	"github.com/suteetoe/gomicro/metrics" // Import the gomicro metrics package
+	"github.com/suteetoe/gomicro/migrate"
+	"github.com/suteetoe/gomicro/ratelimit"
+	"github.com/suteetoe/gomicro/server"
+	"github.com/suteetoe/gomicro/tracing"
 	"go.uber.org/zap"
 )
 
@@ -26,64 +39,165 @@ func main() {
 	log := logger.GetLogger()
 	log.Info("Starting OAuth service...", zap.String("environment", cfg.Server.Env))
 
-	// Initialize database (now includes migrations automatically)
-	if err := database.InitDB(cfg); err != nil {
-		log.Fatal("Failed to initialize database", zap.Error(err))
+	// Initialize distributed tracing
+	if err := tracing.InitTracer(context.Background(), &tracing.TracingConfig{
+		ServiceName: "oauth-service",
+		Environment: cfg.Server.Env,
+		Enabled:     cfg.Tracing.Enabled,
+		Endpoint:    cfg.Tracing.Endpoint,
+		Insecure:    cfg.Tracing.Insecure,
+		SampleRatio: cfg.Tracing.SampleRatio,
+	}); err != nil {
+		log.Fatal("Failed to initialize tracing", zap.Error(err))
 	}
-	log.Info("Database connection established and migrations completed")
-
-	// Initialize token handler with configuration
-	handler.InitTokenHandler(cfg)
+	log.Info("Tracing initialized", zap.Bool("enabled", cfg.Tracing.Enabled))
 
-	// Initialize Prometheus metrics
-	prometheus.InitMetrics(cfg)
-	log.Info("Prometheus metrics initialized")
+	// Load service level objectives for the gomicro metrics
+	sloConfig, err := metrics.LoadSLOConfig(cfg.Metrics.SLOConfigPath)
+	if err != nil {
+		log.Fatal("Failed to load SLO config", zap.Error(err))
+	}
 
-	// Initialize HTTP metrics from gomicro
-	httpMetrics := metrics.NewHTTPMetrics("oauth-service")
+	// Initialize HTTP metrics from gomicro on a registry of the service, which /metrics serves
+	httpMetrics, err := metrics.NewHTTPMetrics("oauth-service", metrics.WithRegistry(metrics.NewRegistry()), metrics.WithSLOs(sloConfig))
+	if err != nil {
+		log.Fatal("Failed to initialize HTTP metrics", zap.Error(err))
+	}
 	log.Info("gomicro HTTP metrics initialized")
 
-	// Initialize Echo framework
-	e := echo.New()
+	// Initialize Prometheus metrics of the service on the same registry
+	if err := prometheus.InitMetrics(cfg, httpMetrics.Registerer()); err != nil {
+		log.Fatal("Failed to initialize Prometheus metrics", zap.Error(err))
+	}
+	log.Info("Prometheus metrics initialized")
 
-	// Apply global middleware - order matters
-	e.Use(echomiddleware.Recover()) // Add recovery middleware
-	e.Use(echomiddleware.CORS())    // Add CORS middleware
-	e.Use(middleware.RequestIDMiddleware)
-	e.Use(logger.Middleware(log))
-	e.Use(prometheus.MetricsMiddleware()) // Keep existing metrics middleware for backward compatibility
-	e.Use(httpMetrics.Middleware())       // Add gomicro metrics middleware
+	// Initialize database (now includes migrations automatically)
+	if err := database.InitDB(cfg, httpMetrics.Registerer()); err != nil {
+		log.Fatal("Failed to initialize database", zap.Error(err))
+	}
+	log.Info("Database connection established")
+
+	// Apply changes to the config file and rotated secrets, such as DB_PASSWORD, without a restart
+	watcher := gomicroconfig.NewWatcher(cfg, log)
+	watcher.Subscribe("logger", gomicrologger.ApplyConfig)
+	watcher.Subscribe("database", gomicrodb.ApplyConfig)
+	defer watcher.Start(gomicroconfig.DefaultWatchInterval)()
 
-	// Public routes - no authentication required
-	e.GET("/", handler.Hello)
-	e.GET("/health", handler.HealthCheck)
-	e.GET("/metrics", echo.WrapHandler(metrics.GetPrometheusHandler())) // Use gomicro metrics handler
+	// Apply schema migrations; `oauth-service migrate <command>` runs a single migrate command and exits
+	migrator, err := migrate.New(database.GetDB(), "oauth-service", migrations.All(), migrate.WithLogger(logger.Component("migrate")))
+	if err != nil {
+		log.Fatal("Invalid migrations", zap.Error(err))
+	}
+	if ran, err := migrate.Command(context.Background(), migrator, os.Args[1:], os.Stdout); ran {
+		if err != nil {
+			log.Fatal("Migrate command failed", zap.Error(err))
+		}
+		return
+	}
+	if cfg.DB.MigrateOnStart {
+		if _, err := migrator.Up(context.Background()); err != nil {
+			log.Fatal("Failed to apply migrations", zap.Error(err))
+		}
+	}
 
-	// OAuth2 routes
-	oauth := e.Group("/oauth")
+	// Initialize the audit log
+	handler.InitAudit(audit.NewRecorder(database.GetDB(), "oauth-service"))
 
-	// Client registration and management
-	clients := oauth.Group("/clients")
-	clients.POST("", handler.RegisterClient)
-	clients.GET("/:id", handler.GetClient, middleware.ClientAuthMiddleware)
+	// Initialize token handler with configuration
+	handler.InitTokenHandler(cfg)
 
-	// Token endpoints
-	oauth.POST("/token", handler.IssueToken, middleware.ClientAuthMiddleware)
-	oauth.POST("/revoke", handler.RevokeToken, middleware.ClientAuthMiddleware)
-	oauth.POST("/introspect", handler.ValidateToken, middleware.ClientAuthMiddleware)
+	// Throttle token requests per client and IP and API requests per client (RATE_LIMIT_*)
+	tokenLimit, err := ratelimit.LoginRule(cfg)
+	if err != nil {
+		log.Fatal("Invalid token rate limit", zap.Error(err))
+	}
+	apiLimit, err := ratelimit.APIRule(cfg)
+	if err != nil {
+		log.Fatal("Invalid API rate limit", zap.Error(err))
+	}
+	limitStore, err := ratelimit.NewStore(cfg.RateLimit.Store, database.GetDB())
+	if err != nil {
+		log.Fatal("Invalid rate limit store", zap.Error(err))
+	}
+	limiter, err := ratelimit.NewLimiter("oauth-service", limitStore, ratelimit.WithRegisterer(httpMetrics.Registerer()))
+	if err != nil {
+		log.Fatal("Failed to initialize rate limiting", zap.Error(err))
+	}
 
-	// Protected resource endpoints
-	api := e.Group("/api")
-	api.Use(middleware.BearerTokenMiddleware) // All API routes require a valid access token
+	// Replay the responses of POST and PATCH requests retried with an Idempotency-Key
+	idempotencyStore, err := idempotency.NewStore(cfg.Idempotency.Store, database.GetDB())
+	if err != nil {
+		log.Fatal("Invalid idempotency store", zap.Error(err))
+	}
+	idempotent, err := idempotency.New("oauth-service", idempotencyStore, idempotency.WithTTL(cfg.Idempotency.TTL),
+		idempotency.WithRegisterer(httpMetrics.Registerer()))
+	if err != nil {
+		log.Fatal("Failed to initialize idempotency keys", zap.Error(err))
+	}
 
-	// Add protected API endpoints here
-	// For example:
-	// api.GET("/user", handler.GetUserInfo)
+	// Apply changed rate limit rules, idempotency TTL and token lifetimes without a restart
+	watcher.Subscribe("rate_limit", limiter.ApplyConfig(ratelimit.Limits{
+		"token_ip":     ratelimit.LoginRule,
+		"token_client": ratelimit.LoginRule,
+		"api":          ratelimit.APIRule,
+	}))
+	watcher.Subscribe("idempotency", idempotent.ApplyConfig)
+	watcher.Subscribe("tokens", handler.ApplyTokenConfig)
+
+	// Report ready while the database answers and the schema is migrated (/livez, /readyz)
+	checks, err := health.New("oauth-service", health.WithLogger(log), health.WithRegisterer(httpMetrics.Registerer()))
+	if err != nil {
+		log.Fatal("Failed to initialize health checks", zap.Error(err))
+	}
+	checks.AddReadiness("database", health.Database(database.GetDB()))
+	checks.AddReadiness("migrations", health.Migrations(migrator))
+
+	// Build the HTTP server; it shuts down gracefully on SIGTERM
+	srv := server.New("oauth-service",
+		server.WithLogger(log),
+		server.WithDatabase(database.GetDB()),
+		server.WithMetrics(httpMetrics),
+		server.WithHealth(checks),
+		server.WithLogLevels(cfg.Log.AdminToken, cfg.Log.LevelFile),
+		// Answer errors as problem details, except on the OAuth endpoints which keep the RFC 6749 shape
+		server.WithErrorHandler(handler.ErrorHandler(apperrors.NewHTTPErrorHandler(apperrors.WithLogger(log)))),
+		server.WithMiddleware(
+			echomiddleware.CORS(),
+			prometheus.MetricsMiddleware(), // Keep existing metrics middleware for backward compatibility
+		),
+		server.WithAuth(middleware.BearerTokenMiddleware), // All API routes require a valid access token
+		server.WithRoutes(func(r *server.Router) {
+			// Public routes - no authentication required
+			r.GET("/", handler.Hello)
+
+			// OAuth2 routes
+			oauth := r.Group("/oauth")
+
+			// Client registration and management
+			clients := oauth.Group("/clients")
+			clients.POST("", handler.RegisterClient, idempotent.Middleware())
+			clients.GET("/:id", handler.GetClient, middleware.ClientAuthMiddleware)
+
+			// Token endpoints; token requests are throttled before the client secret is checked
+			oauth.POST("/token", handler.IssueToken,
+				limiter.Middleware("token_ip", tokenLimit, ratelimit.KeyByIP()),
+				limiter.Middleware("token_client", tokenLimit, ratelimit.KeyByClientID()),
+				middleware.ClientAuthMiddleware)
+			oauth.POST("/revoke", handler.RevokeToken, middleware.ClientAuthMiddleware)
+			oauth.POST("/introspect", handler.ValidateToken, middleware.ClientAuthMiddleware)
+
+			// Protected resource endpoints
+			api := r.Secure("/api")
+			api.Use(limiter.Middleware("api", apiLimit, ratelimit.KeyByClientID()))
+
+			// Add protected API endpoints here
+			// For example:
+			// api.GET("/user", handler.GetUserInfo)
+		}),
+	)
 
 	// Start server
-	port := cfg.Server.Port
-	log.Info("Starting server", zap.String("port", port))
-	if err := e.Start(":" + port); err != nil {
-		log.Fatal("Failed to start server", zap.Error(err))
+	if err := srv.Run(context.Background(), ":"+cfg.Server.Port); err != nil {
+		log.Fatal("Server error", zap.Error(err))
 	}
 }
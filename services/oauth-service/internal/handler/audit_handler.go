@@ -0,0 +1,28 @@
+package handler
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/suteetoe/gomicro/audit"
+)
+
+// auditLog records client registrations and token revocations; nil until InitAudit is called
+var auditLog *audit.Recorder
+
+// InitAudit sets the recorder used by the handlers
+func InitAudit(recorder *audit.Recorder) {
+	auditLog = recorder
+}
+
+// recordAudit records an action on an OAuth resource, attributed to the authenticated caller
+func recordAudit(c echo.Context, tenantID *uint, action, resourceType, resourceID string, changes audit.Changes) {
+	if auditLog == nil {
+		return
+	}
+	auditLog.RecordRequest(c, audit.Event{
+		TenantID:     tenantID,
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		Changes:      changes,
+	})
+}
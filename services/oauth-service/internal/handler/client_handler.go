@@ -8,9 +8,10 @@ import (
 	"oauth-service/pkg/database"
 	"oauth-service/pkg/logger"
 	"oauth-service/prometheus"
-	"time"
 
 	"github.com/labstack/echo/v4"
+	"github.com/suteetoe/gomicro/audit"
+	apperrors "github.com/suteetoe/gomicro/errors"
 	"go.uber.org/zap"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -25,8 +26,8 @@ func RegisterClient(c echo.Context) error {
 	// Parse request
 	var req struct {
 		Name         string   `json:"name" validate:"required"`
-		RedirectURIs []string `json:"redirect_uris" validate:"required"`
-		Grants       []string `json:"grants" validate:"required"`
+		RedirectURIs []string `json:"redirect_uris" validate:"required,dive,redirect_uri"`
+		Grants       []string `json:"grants" validate:"required,dive,oneof=client_credentials refresh_token password"`
 		Scopes       []string `json:"scopes"`
 		UserID       *uint    `json:"user_id"`
 		TenantID     *uint    `json:"tenant_id"`
@@ -34,19 +35,13 @@ func RegisterClient(c echo.Context) error {
 
 	if err := c.Bind(&req); err != nil {
 		log.Error("Failed to parse client registration request", zap.Error(err))
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error":             "invalid_request",
-			"error_description": "Could not parse request body",
-		})
+		return apperrors.BadRequest("Could not parse request body")
 	}
 
-	// Basic validation
-	if req.Name == "" || len(req.RedirectURIs) == 0 || len(req.Grants) == 0 {
-		log.Warn("Validation failed for client registration")
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error":             "invalid_request",
-			"error_description": "Name, redirect URIs, and grant types are required",
-		})
+	// Redirect URIs must be exact https, loopback or private-use URIs without a fragment
+	if err := c.Validate(&req); err != nil {
+		log.Warn("Validation failed for client registration", zap.Error(err))
+		return err
 	}
 
 	// Generate client ID and secret
@@ -56,10 +51,7 @@ func RegisterClient(c echo.Context) error {
 	hashedSecret, err := bcrypt.GenerateFromPassword([]byte(clientSecret), bcrypt.DefaultCost)
 	if err != nil {
 		log.Error("Failed to hash client secret", zap.Error(err))
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error":             "server_error",
-			"error_description": "Failed to process client registration",
-		})
+		return apperrors.Internal("Failed to process client registration", err)
 	}
 
 	// Create client record
@@ -74,20 +66,15 @@ func RegisterClient(c echo.Context) error {
 		IsActive:     true,
 	}
 
-	// Track database operation
-	defer prometheus.TrackDBOperation("insert")(time.Now())
-
 	// Save to database
 	if err := database.GetDB().Create(&client).Error; err != nil {
 		log.Error("Failed to create client", zap.Error(err))
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error":             "server_error",
-			"error_description": "Failed to register client",
-		})
+		return apperrors.Internal("Failed to register client", err)
 	}
 
 	// Update metrics
 	prometheus.ActiveClientsGauge.Inc()
+	recordAudit(c, client.TenantID, "client.registered", "client", client.ID, audit.Diff(nil, client))
 
 	// Return client details with plaintext secret (only time it's shown)
 	return c.JSON(http.StatusCreated, echo.Map{
@@ -107,23 +94,14 @@ func GetClient(c echo.Context) error {
 	// Get client ID from path parameter
 	clientID := c.Param("id")
 	if clientID == "" {
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error":             "invalid_request",
-			"error_description": "Client ID is required",
-		})
+		return apperrors.BadRequest("Client ID is required")
 	}
 
-	// Track database operation
-	defer prometheus.TrackDBOperation("query")(time.Now())
-
 	// Retrieve client from database
 	var client model.Client
 	if err := database.GetDB().First(&client, "id = ?", clientID).Error; err != nil {
 		log.Error("Client not found", zap.String("client_id", clientID), zap.Error(err))
-		return c.JSON(http.StatusNotFound, echo.Map{
-			"error":             "not_found",
-			"error_description": "Client not found",
-		})
+		return apperrors.NotFound("Client not found")
 	}
 
 	// Return client details (without secret)
@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"net/http"
+	"oauth-service/pkg/logger"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	apperrors "github.com/suteetoe/gomicro/errors"
+	"go.uber.org/zap"
+)
+
+// rfc6749Endpoints are the endpoints whose errors OAuth clients read in the RFC 6749 shape
+var rfc6749Endpoints = map[string]bool{
+	"/oauth/token":      true,
+	"/oauth/revoke":     true,
+	"/oauth/introspect": true,
+}
+
+// ErrorHandler answers errors of the token, revocation and introspection endpoints in the
+// RFC 6749 shape, {"error": code, "error_description": detail}, so that OAuth clients can read
+// them, and passes every other error, including those of client registration, to problems
+func ErrorHandler(problems echo.HTTPErrorHandler) echo.HTTPErrorHandler {
+	return func(err error, c echo.Context) {
+		if c.Response().Committed {
+			return
+		}
+		if !rfc6749Endpoints[c.Path()] {
+			problems(err, c)
+			return
+		}
+
+		log := logger.FromContext(c)
+		appErr := apperrors.From(err)
+		if appErr.Status >= http.StatusInternalServerError {
+			log.Error("OAuth request failed", zap.Int("status", appErr.Status), zap.Error(err))
+		}
+
+		description := appErr.Detail
+		if description == "" {
+			description = http.StatusText(appErr.Status)
+		}
+		code := oauthErrorCode(appErr.Status)
+		// Validation errors list their fields, e.g. "grant_type is required"
+		if len(appErr.Fields) > 0 {
+			fields := make([]string, 0, len(appErr.Fields))
+			for _, field := range appErr.Fields {
+				fields = append(fields, field.Field+" "+field.Message)
+			}
+			description += ": " + strings.Join(fields, "; ")
+		}
+		if err := c.JSON(appErr.Status, echo.Map{
+			"error":             code,
+			"error_description": description,
+		}); err != nil {
+			log.Error("Failed to write error response", zap.Error(err))
+		}
+	}
+}
+
+// oauthErrorCode returns the RFC 6749 error code of status
+func oauthErrorCode(status int) string {
+	switch {
+	case status == http.StatusUnauthorized:
+		return "invalid_client"
+	case status == http.StatusForbidden:
+		return "unauthorized_client"
+	case status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable:
+		return "temporarily_unavailable"
+	case status >= http.StatusInternalServerError:
+		return "server_error"
+	default:
+		return "invalid_request"
+	}
+}
@@ -0,0 +1,15 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Hello returns a simple welcome message
+func Hello(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]string{
+		"message": "Welcome to OAuth2 Service API",
+		"version": "1.0.0",
+	})
+}
@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 	"oauth-service/internal/model"
 	"oauth-service/pkg/config"
@@ -9,10 +10,13 @@ import (
 	"oauth-service/prometheus"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/labstack/echo/v4"
+	"github.com/suteetoe/gomicro/audit"
 	"go.uber.org/zap"
+	"gorm.io/gorm/clause"
 )
 
 // TokenConfig holds configuration for token generation
@@ -21,14 +25,25 @@ type TokenConfig struct {
 	RefreshTokenLifetime time.Duration
 }
 
-var tokenConfig TokenConfig
+// tokenConfig is replaced by ApplyTokenConfig when the configuration is reloaded
+var tokenConfig atomic.Pointer[TokenConfig]
 
 // InitTokenHandler initializes token handler with configuration
 func InitTokenHandler(cfg *config.Config) {
-	tokenConfig = TokenConfig{
+	tokenConfig.Store(&TokenConfig{
 		AccessTokenLifetime:  cfg.OAuth.AccessTokenExpiration,
 		RefreshTokenLifetime: cfg.OAuth.RefreshTokenExpiration,
+	})
+}
+
+// ApplyTokenConfig uses the token lifetimes of a reloaded configuration, for use with
+// config.Watcher. Tokens issued before keep their expiry.
+func ApplyTokenConfig(old, new *config.Config) error {
+	if new.OAuth.AccessTokenExpiration <= 0 || new.OAuth.RefreshTokenExpiration <= 0 {
+		return errors.New("oauth token expirations must be positive")
 	}
+	InitTokenHandler(new)
+	return nil
 }
 
 // IssueToken handles OAuth2 token requests
@@ -107,9 +122,6 @@ func ValidateToken(c echo.Context) error {
 		})
 	}
 
-	// Track database operation
-	defer prometheus.TrackDBOperation("query")(time.Now())
-
 	// Find token in database
 	var accessToken model.AccessToken
 	if err := database.GetDB().Where("token = ?", token).First(&accessToken).Error; err != nil {
@@ -184,30 +196,31 @@ func RevokeToken(c echo.Context) error {
 		})
 	}
 
-	// Track database operation
-	defer prometheus.TrackDBOperation("update")(time.Now())
-
 	// Try to revoke based on token type hint
 	var success bool
 
 	if tokenTypeHint == "access_token" || tokenTypeHint == "" {
-		// Try to revoke access token
-		if result := database.GetDB().Model(&model.AccessToken{}).
+		// Try to revoke access token; the returned row identifies it in the audit log
+		var accessToken model.AccessToken
+		if result := database.GetDB().Model(&accessToken).Clauses(clause.Returning{}).
 			Where("token = ? AND client_id = ?", token, client.ID).
 			Update("revoked", true); result.RowsAffected > 0 {
 
 			prometheus.RecordTokenRevoked("access_token", "client_request")
+			recordAudit(c, accessToken.TenantID, "token.revoked", "access_token", accessToken.ID, revokedChange)
 			success = true
 		}
 	}
 
 	if (tokenTypeHint == "refresh_token" || tokenTypeHint == "") && !success {
 		// Try to revoke refresh token
-		if result := database.GetDB().Model(&model.RefreshToken{}).
+		var refreshToken model.RefreshToken
+		if result := database.GetDB().Model(&refreshToken).Clauses(clause.Returning{}).
 			Where("token = ? AND client_id = ?", token, client.ID).
 			Update("revoked", true); result.RowsAffected > 0 {
 
 			prometheus.RecordTokenRevoked("refresh_token", "client_request")
+			recordAudit(c, refreshToken.TenantID, "token.revoked", "refresh_token", refreshToken.ID, revokedChange)
 			success = true
 		}
 	}
@@ -216,6 +229,9 @@ func RevokeToken(c echo.Context) error {
 	return c.NoContent(http.StatusOK)
 }
 
+// revokedChange is the audit change recorded for a token revocation
+var revokedChange = audit.Changes{"revoked": {Before: false, After: true}}
+
 // Helper function to check if a grant type is allowed for a client
 func isGrantAllowed(allowedGrants string, requestedGrant string) bool {
 	grants := strings.Split(allowedGrants, ",")
@@ -256,7 +272,7 @@ func handleClientCredentialsGrant(c echo.Context, client model.Client) error {
 	return c.JSON(http.StatusOK, echo.Map{
 		"access_token":  accessToken.Token,
 		"token_type":    "Bearer",
-		"expires_in":    int(tokenConfig.AccessTokenLifetime.Seconds()),
+		"expires_in":    int(tokenConfig.Load().AccessTokenLifetime.Seconds()),
 		"refresh_token": refreshToken.Token,
 		"scope":         finalScopes,
 	})
@@ -277,9 +293,6 @@ func handleRefreshTokenGrant(c echo.Context, client model.Client) error {
 		})
 	}
 
-	// Track database operation
-	defer prometheus.TrackDBOperation("query")(time.Now())
-
 	// Find refresh token in database
 	var refreshToken model.RefreshToken
 	if err := database.GetDB().Where("token = ? AND client_id = ? AND revoked = ?",
@@ -331,7 +344,6 @@ func handleRefreshTokenGrant(c echo.Context, client model.Client) error {
 	}
 
 	// Mark old refresh token as revoked
-	defer prometheus.TrackDBOperation("update")(time.Now())
 	database.GetDB().Model(&refreshToken).Update("revoked", true)
 
 	// Update metrics
@@ -343,7 +355,7 @@ func handleRefreshTokenGrant(c echo.Context, client model.Client) error {
 	return c.JSON(http.StatusOK, echo.Map{
 		"access_token":  accessToken.Token,
 		"token_type":    "Bearer",
-		"expires_in":    int(tokenConfig.AccessTokenLifetime.Seconds()),
+		"expires_in":    int(tokenConfig.Load().AccessTokenLifetime.Seconds()),
 		"refresh_token": newRefreshToken.Token,
 		"scope":         accessToken.Scopes,
 	})
@@ -422,7 +434,7 @@ func handlePasswordGrant(c echo.Context, client model.Client) error {
 	return c.JSON(http.StatusOK, echo.Map{
 		"access_token":  accessToken.Token,
 		"token_type":    "Bearer",
-		"expires_in":    int(tokenConfig.AccessTokenLifetime.Seconds()),
+		"expires_in":    int(tokenConfig.Load().AccessTokenLifetime.Seconds()),
 		"refresh_token": refreshToken.Token,
 		"scope":         finalScopes,
 	})
@@ -457,13 +469,10 @@ func createTokens(clientID string, userID, tenantID *uint, scopes string) (*mode
 		UserID:    userID,
 		TenantID:  tenantID,
 		Scopes:    scopes,
-		ExpiresAt: time.Now().Add(tokenConfig.AccessTokenLifetime),
+		ExpiresAt: time.Now().Add(tokenConfig.Load().AccessTokenLifetime),
 		Revoked:   false,
 	}
 
-	// Track database operation
-	defer prometheus.TrackDBOperation("insert")(time.Now())
-
 	// Save access token to database
 	if err := database.GetDB().Create(accessToken).Error; err != nil {
 		return nil, nil, err
@@ -475,7 +484,7 @@ func createTokens(clientID string, userID, tenantID *uint, scopes string) (*mode
 		ClientID:      clientID,
 		UserID:        userID,
 		TenantID:      tenantID,
-		ExpiresAt:     time.Now().Add(tokenConfig.RefreshTokenLifetime),
+		ExpiresAt:     time.Now().Add(tokenConfig.Load().RefreshTokenLifetime),
 		Revoked:       false,
 	}
 
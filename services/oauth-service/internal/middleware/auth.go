@@ -3,13 +3,13 @@ package middleware
 import (
 	"encoding/base64"
 	"fmt"
-	"net/http"
 	"oauth-service/internal/model"
 	"oauth-service/pkg/database"
 	"oauth-service/pkg/logger"
 	"strings"
 
 	"github.com/labstack/echo/v4"
+	apperrors "github.com/suteetoe/gomicro/errors"
 	"go.uber.org/zap"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -23,48 +23,33 @@ func ClientAuthMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 		authHeader := c.Request().Header.Get("Authorization")
 		if authHeader == "" {
 			log.Warn("Missing client authentication")
-			return c.JSON(http.StatusUnauthorized, echo.Map{
-				"error":             "invalid_client",
-				"error_description": "Client authentication required",
-			})
+			return apperrors.Unauthorized("Client authentication required")
 		}
 
 		// Parse Basic Authentication header
 		if !strings.HasPrefix(authHeader, "Basic ") {
 			log.Warn("Invalid authentication scheme", zap.String("scheme", strings.Split(authHeader, " ")[0]))
-			return c.JSON(http.StatusUnauthorized, echo.Map{
-				"error":             "invalid_client",
-				"error_description": "Client authentication must use Basic scheme",
-			})
+			return apperrors.Unauthorized("Client authentication must use Basic scheme")
 		}
 
 		// Extract client credentials
 		clientID, clientSecret, err := parseBasicAuth(authHeader[6:])
 		if err != nil {
 			log.Warn("Invalid Basic auth header", zap.Error(err))
-			return c.JSON(http.StatusUnauthorized, echo.Map{
-				"error":             "invalid_client",
-				"error_description": "Invalid client credentials format",
-			})
+			return apperrors.Unauthorized("Invalid client credentials format")
 		}
 
 		// Validate client credentials against the database
 		var client model.Client
 		if err := database.GetDB().Where("id = ? AND is_active = ?", clientID, true).First(&client).Error; err != nil {
 			log.Warn("Client not found or inactive", zap.String("client_id", clientID))
-			return c.JSON(http.StatusUnauthorized, echo.Map{
-				"error":             "invalid_client",
-				"error_description": "Unknown client or client is inactive",
-			})
+			return apperrors.Unauthorized("Unknown client or client is inactive")
 		}
 
 		// Verify client secret
 		if !validateClientSecret(client.Secret, clientSecret) {
 			log.Warn("Invalid client secret", zap.String("client_id", clientID))
-			return c.JSON(http.StatusUnauthorized, echo.Map{
-				"error":             "invalid_client",
-				"error_description": "Invalid client credentials",
-			})
+			return apperrors.Unauthorized("Invalid client credentials")
 		}
 
 		// Add client to context
@@ -88,19 +73,13 @@ func BearerTokenMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 		authHeader := c.Request().Header.Get("Authorization")
 		if authHeader == "" {
 			log.Warn("Missing access token")
-			return c.JSON(http.StatusUnauthorized, echo.Map{
-				"error":             "invalid_token",
-				"error_description": "Access token required",
-			})
+			return apperrors.Unauthorized("Access token required")
 		}
 
 		// Parse Bearer token
 		if !strings.HasPrefix(authHeader, "Bearer ") {
 			log.Warn("Invalid token scheme", zap.String("scheme", strings.Split(authHeader, " ")[0]))
-			return c.JSON(http.StatusUnauthorized, echo.Map{
-				"error":             "invalid_token",
-				"error_description": "Token must use Bearer scheme",
-			})
+			return apperrors.Unauthorized("Token must use Bearer scheme")
 		}
 
 		// Extract token
@@ -110,19 +89,13 @@ func BearerTokenMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 		var accessToken model.AccessToken
 		if err := database.GetDB().Where("token = ? AND revoked = ?", tokenString, false).First(&accessToken).Error; err != nil {
 			log.Warn("Token not found or revoked", zap.Error(err))
-			return c.JSON(http.StatusUnauthorized, echo.Map{
-				"error":             "invalid_token",
-				"error_description": "The access token is invalid",
-			})
+			return apperrors.Unauthorized("The access token is invalid")
 		}
 
 		// Check if token is expired
 		if accessToken.IsExpired() {
 			log.Warn("Expired token", zap.String("token_id", accessToken.ID))
-			return c.JSON(http.StatusUnauthorized, echo.Map{
-				"error":             "invalid_token",
-				"error_description": "The access token has expired",
-			})
+			return apperrors.Unauthorized("The access token has expired")
 		}
 
 		// Add token and related info to context
@@ -0,0 +1,50 @@
+package migrations
+
+import (
+	"oauth-service/internal/model"
+
+	"github.com/suteetoe/gomicro/audit"
+	"github.com/suteetoe/gomicro/idempotency"
+	"github.com/suteetoe/gomicro/migrate"
+	"github.com/suteetoe/gomicro/ratelimit"
+	"gorm.io/gorm"
+)
+
+// All returns the schema migrations of the service. Add new versions to the end of the list
+// and never change a version that has been released.
+func All() []migrate.Migration {
+	return []migrate.Migration{
+		{
+			// Version 1 is the schema previously created by AutoMigrate on every boot
+			Version: 1,
+			Name:    "baseline",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&model.Client{}, &model.AccessToken{}, &model.RefreshToken{}, &audit.Event{})
+			},
+			Down: func(tx *gorm.DB) error {
+				// audit_events is shared with the other services and is kept
+				return tx.Migrator().DropTable(&model.RefreshToken{}, &model.AccessToken{}, &model.Client{})
+			},
+		},
+		{
+			// Version 2 keeps the rate limit counters for RATE_LIMIT_STORE=postgres
+			Version: 2,
+			Name:    "rate_limits",
+			Up:      ratelimit.Migrate,
+			Down: func(tx *gorm.DB) error {
+				// rate_limit_buckets is shared with the other services and is kept
+				return nil
+			},
+		},
+		{
+			// Version 3 stores the responses replayed for Idempotency-Key retries with IDEMPOTENCY_STORE=postgres
+			Version: 3,
+			Name:    "idempotency_keys",
+			Up:      idempotency.Migrate,
+			Down: func(tx *gorm.DB) error {
+				// idempotency_keys is shared with the other services and is kept
+				return nil
+			},
+		},
+	}
+}
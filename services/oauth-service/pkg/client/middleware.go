@@ -3,10 +3,10 @@ package client
 import (
 	"errors"
 	"fmt"
-	"net/http"
 	"strings"
 
 	"github.com/labstack/echo/v4"
+	apperrors "github.com/suteetoe/gomicro/errors"
 	"go.uber.org/zap"
 )
 
@@ -17,26 +17,20 @@ func (c *OAuthClient) OAuthMiddleware(requiredScopes []string) echo.MiddlewareFu
 			// Extract token from Authorization header
 			authHeader := ctx.Request().Header.Get("Authorization")
 			if authHeader == "" {
-				return ctx.JSON(http.StatusUnauthorized, map[string]string{
-					"error":             "missing_token",
-					"error_description": "Authorization header is required",
-				})
+				return apperrors.Unauthorized("Authorization header is required")
 			}
 
 			// Check if it's a Bearer token
 			parts := strings.Split(authHeader, " ")
 			if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
-				return ctx.JSON(http.StatusUnauthorized, map[string]string{
-					"error":             "invalid_token",
-					"error_description": "Invalid authorization format, expected Bearer token",
-				})
+				return apperrors.Unauthorized("Invalid authorization format, expected Bearer token")
 			}
 
 			// Extract the token
 			token := parts[1]
 
 			// Validate token with OAuth service
-			validation, err := c.ValidateToken(token)
+			validation, err := c.ValidateToken(ctx.Request().Context(), token)
 			if err != nil {
 				// Try to log the error using the logger from context
 				logger, ok := ctx.Get("logger").(*zap.Logger)
@@ -44,27 +38,18 @@ func (c *OAuthClient) OAuthMiddleware(requiredScopes []string) echo.MiddlewareFu
 					logger.Warn("Token validation failed", zap.Error(err))
 				}
 
-				return ctx.JSON(http.StatusUnauthorized, map[string]string{
-					"error":             "invalid_token",
-					"error_description": "The access token is invalid",
-				})
+				return apperrors.Unauthorized("The access token is invalid")
 			}
 
 			// Check if token is active
 			if !validation.Active {
-				return ctx.JSON(http.StatusUnauthorized, map[string]string{
-					"error":             "invalid_token",
-					"error_description": "The token is inactive or expired",
-				})
+				return apperrors.Unauthorized("The token is inactive or expired")
 			}
 
 			// Validate scopes if required
 			if len(requiredScopes) > 0 {
 				if err := validateScopes(validation.Scope, requiredScopes); err != nil {
-					return ctx.JSON(http.StatusForbidden, map[string]string{
-						"error":             "insufficient_scope",
-						"error_description": fmt.Sprintf("The token does not have the required scope: %s", strings.Join(requiredScopes, " ")),
-					})
+					return apperrors.Forbidden("The token does not have the required scope").With("required_scope", strings.Join(requiredScopes, " "))
 				}
 			}
 
@@ -2,6 +2,7 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -10,6 +11,8 @@ import (
 	"net/url"
 	"strings"
 	"time"
+
+	"github.com/suteetoe/gomicro/tracing"
 )
 
 // OAuthClient represents an OAuth2 client for communicating with the OAuth service
@@ -53,23 +56,26 @@ func NewOAuthClient(baseURL, clientID, clientSecret string) *OAuthClient {
 		BaseURL:      baseURL,
 		ClientID:     clientID,
 		ClientSecret: clientSecret,
-		HTTPClient:   &http.Client{Timeout: 10 * time.Second},
+		HTTPClient: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: tracing.NewTransport(nil), // Propagates the trace context to downstream services
+		},
 	}
 }
 
 // GetClientCredentialsToken obtains an access token using the client credentials grant
-func (c *OAuthClient) GetClientCredentialsToken(scope string) (*TokenResponse, error) {
+func (c *OAuthClient) GetClientCredentialsToken(ctx context.Context, scope string) (*TokenResponse, error) {
 	data := url.Values{}
 	data.Set("grant_type", "client_credentials")
 	if scope != "" {
 		data.Set("scope", scope)
 	}
 
-	return c.requestToken(data)
+	return c.requestToken(ctx, data)
 }
 
 // GetPasswordToken obtains an access token using the password grant
-func (c *OAuthClient) GetPasswordToken(username, password, scope string) (*TokenResponse, error) {
+func (c *OAuthClient) GetPasswordToken(ctx context.Context, username, password, scope string) (*TokenResponse, error) {
 	data := url.Values{}
 	data.Set("grant_type", "password")
 	data.Set("username", username)
@@ -78,24 +84,24 @@ func (c *OAuthClient) GetPasswordToken(username, password, scope string) (*Token
 		data.Set("scope", scope)
 	}
 
-	return c.requestToken(data)
+	return c.requestToken(ctx, data)
 }
 
 // RefreshToken exchanges a refresh token for a new access token
-func (c *OAuthClient) RefreshToken(refreshToken string) (*TokenResponse, error) {
+func (c *OAuthClient) RefreshToken(ctx context.Context, refreshToken string) (*TokenResponse, error) {
 	data := url.Values{}
 	data.Set("grant_type", "refresh_token")
 	data.Set("refresh_token", refreshToken)
 
-	return c.requestToken(data)
+	return c.requestToken(ctx, data)
 }
 
 // ValidateToken performs token introspection to check if a token is valid
-func (c *OAuthClient) ValidateToken(token string) (*TokenValidationResponse, error) {
+func (c *OAuthClient) ValidateToken(ctx context.Context, token string) (*TokenValidationResponse, error) {
 	data := url.Values{}
 	data.Set("token", token)
 
-	req, err := http.NewRequest("POST", fmt.Sprintf("%s/oauth/introspect", c.BaseURL), strings.NewReader(data.Encode()))
+	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/oauth/introspect", c.BaseURL), strings.NewReader(data.Encode()))
 	if err != nil {
 		return nil, err
 	}
@@ -131,14 +137,14 @@ func (c *OAuthClient) ValidateToken(token string) (*TokenValidationResponse, err
 }
 
 // RevokeToken revokes an access or refresh token
-func (c *OAuthClient) RevokeToken(token, tokenTypeHint string) error {
+func (c *OAuthClient) RevokeToken(ctx context.Context, token, tokenTypeHint string) error {
 	data := url.Values{}
 	data.Set("token", token)
 	if tokenTypeHint != "" {
 		data.Set("token_type_hint", tokenTypeHint)
 	}
 
-	req, err := http.NewRequest("POST", fmt.Sprintf("%s/oauth/revoke", c.BaseURL), strings.NewReader(data.Encode()))
+	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/oauth/revoke", c.BaseURL), strings.NewReader(data.Encode()))
 	if err != nil {
 		return err
 	}
@@ -164,11 +170,11 @@ func (c *OAuthClient) RevokeToken(token, tokenTypeHint string) error {
 	return nil
 }
 
-// CallAPI makes an authenticated API call to a protected resource
-func (c *OAuthClient) CallAPI(method, path string, body io.Reader) ([]byte, error) {
+// CallAPI makes an authenticated API call to a protected resource that continues the trace carried by ctx
+func (c *OAuthClient) CallAPI(ctx context.Context, method, path string, body io.Reader) ([]byte, error) {
 	// Ensure we have a valid token
 	if c.AccessToken == "" || time.Now().After(c.TokenExpiry) {
-		tokenResp, err := c.GetClientCredentialsToken("")
+		tokenResp, err := c.GetClientCredentialsToken(ctx, "")
 		if err != nil {
 			return nil, fmt.Errorf("failed to get access token: %w", err)
 		}
@@ -177,7 +183,7 @@ func (c *OAuthClient) CallAPI(method, path string, body io.Reader) ([]byte, erro
 	}
 
 	// Make the API call
-	req, err := http.NewRequest(method, fmt.Sprintf("%s%s", c.BaseURL, path), body)
+	req, err := http.NewRequestWithContext(ctx, method, fmt.Sprintf("%s%s", c.BaseURL, path), body)
 	if err != nil {
 		return nil, err
 	}
@@ -206,8 +212,8 @@ func (c *OAuthClient) CallAPI(method, path string, body io.Reader) ([]byte, erro
 }
 
 // Helper function to make token requests
-func (c *OAuthClient) requestToken(data url.Values) (*TokenResponse, error) {
-	req, err := http.NewRequest("POST", fmt.Sprintf("%s/oauth/token", c.BaseURL), bytes.NewBufferString(data.Encode()))
+func (c *OAuthClient) requestToken(ctx context.Context, data url.Values) (*TokenResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/oauth/token", c.BaseURL), bytes.NewBufferString(data.Encode()))
 	if err != nil {
 		return nil, err
 	}
@@ -2,125 +2,23 @@ package config
 
 import (
 	"os"
-	"strconv"
-	"time"
 
-	"github.com/joho/godotenv"
+	gomicroconfig "github.com/suteetoe/gomicro/config"
 )
 
-// Config represents the application configuration
-type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	OAuth    OAuthConfig
-	JWT      JWTConfig
-	Log      LogConfig
-	Metrics  MetricsConfig
-}
-
-// ServerConfig holds server-related configuration
-type ServerConfig struct {
-	Port string
-	Env  string
-}
-
-// DatabaseConfig holds database-related configuration
-type DatabaseConfig struct {
-	Host            string
-	Port            string
-	User            string
-	Password        string
-	Name            string
-	SSLMode         string
-	MaxIdleConns    int
-	MaxOpenConns    int
-	ConnMaxLifetime time.Duration
-	LogLevel        string
-}
-
-// OAuthConfig holds OAuth2-related configuration
-type OAuthConfig struct {
-	AccessTokenExpiration  time.Duration
-	RefreshTokenExpiration time.Duration
-}
-
-// JWTConfig holds JWT-related configuration
-type JWTConfig struct {
-	SigningKey     string
-	ExpirationTime time.Duration
-}
+// Config holds all configuration. It is loaded by gomicro/config from defaults, a YAML or JSON
+// file (--config or CONFIG_FILE), environment variables and flags, and validated.
+type Config = gomicroconfig.Config
 
-// LogConfig holds logging configuration
-type LogConfig struct {
-	Level string
-}
-
-// MetricsConfig holds metrics-related configuration
-type MetricsConfig struct {
-	Prefix string
-}
-
-// Load loads the application configuration from environment variables
+// Load loads and validates the configuration; a malformed value is an error
 func Load() (*Config, error) {
-	// Load environment variables from .env file if it exists
-	_ = godotenv.Load()
-
-	return &Config{
-		Server: ServerConfig{
-			Port: getEnv("SERVER_PORT", "8084"),
-			Env:  getEnv("APP_ENV", "development"),
-		},
-		Database: DatabaseConfig{
-			Host:            getEnv("DB_HOST", "localhost"),
-			Port:            getEnv("DB_PORT", "5432"),
-			User:            getEnv("DB_USER", "postgres"),
-			Password:        getEnv("DB_PASSWORD", "postgres"),
-			Name:            getEnv("DB_NAME", "oauth_db"),
-			SSLMode:         getEnv("DB_SSL_MODE", "disable"),
-			MaxIdleConns:    getEnvAsInt("DB_MAX_IDLE_CONNS", 10),
-			MaxOpenConns:    getEnvAsInt("DB_MAX_OPEN_CONNS", 100),
-			ConnMaxLifetime: getEnvAsDuration("DB_CONN_MAX_LIFETIME", 1*time.Hour),
-			LogLevel:        getEnv("DB_LOG_LEVEL", "info"),
-		},
-		OAuth: OAuthConfig{
-			AccessTokenExpiration:  getEnvAsDuration("OAUTH_ACCESS_TOKEN_EXPIRATION", 1*time.Hour),
-			RefreshTokenExpiration: getEnvAsDuration("OAUTH_REFRESH_TOKEN_EXPIRATION", 7*24*time.Hour),
-		},
-		JWT: JWTConfig{
-			SigningKey:     getEnv("JWT_SIGNING_KEY", "oauthservicesecretkey"),
-			ExpirationTime: getEnvAsDuration("JWT_EXPIRATION_HOURS", 24*time.Hour),
-		},
-		Log: LogConfig{
-			Level: getEnv("LOG_LEVEL", "info"),
-		},
-		Metrics: MetricsConfig{
-			Prefix: getEnv("METRICS_PREFIX", "oauth"),
-		},
-	}, nil
-}
-
-// Helper functions to get environment variables with defaults
-func getEnv(key, defaultValue string) string {
-	if value, exists := os.LookupEnv(key); exists {
-		return value
-	}
-	return defaultValue
-}
-
-func getEnvAsInt(key string, defaultValue int) int {
-	if value, exists := os.LookupEnv(key); exists {
-		if intValue, err := strconv.Atoi(value); err == nil {
-			return intValue
-		}
-	}
-	return defaultValue
+	return gomicroconfig.Load("oauth-service", gomicroconfig.WithArgs(os.Args[1:]), gomicroconfig.WithDefaults(defaults))
 }
 
-func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
-	if value, exists := os.LookupEnv(key); exists {
-		if duration, err := time.ParseDuration(value); err == nil {
-			return duration
-		}
-	}
-	return defaultValue
+// defaults sets the defaults in which the service differs from gomicro/config
+func defaults(c *Config) {
+	c.Server.Port = "8084"
+	c.DB.DBName = "oauth_db"
+	c.Metrics.Prefix = "oauth"
+	c.Metrics.SLOConfigPath = "slo.yaml"
 }
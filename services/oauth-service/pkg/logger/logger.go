@@ -2,45 +2,31 @@ package logger
 
 import (
 	"oauth-service/pkg/config"
-	"time"
 
-	"github.com/labstack/echo/v4"
+	gomicrologger "github.com/suteetoe/gomicro/logger"
 	"go.uber.org/zap"
-	"go.uber.org/zap/zapcore"
 )
 
 var log *zap.Logger
 
-// InitLogger initializes the global logger
+// InitLogger initializes the global logger. It is built on the gomicro logger, so the global and
+// component levels can be changed while the service runs (LOG_LEVEL_FILE, /admin/log-level).
 func InitLogger(cfg *config.Config) {
-	// Configure logger based on environment
-	var logConfig zap.Config
-
-	if cfg.Server.Env == "production" {
-		// Production mode: structured JSON logs
-		logConfig = zap.NewProductionConfig()
-	} else {
-		// Development mode: colorful, human-readable logs
-		logConfig = zap.NewDevelopmentConfig()
-		logConfig.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
-	}
-
-	// Set log level from config
-	var level zapcore.Level
-	if err := level.UnmarshalText([]byte(cfg.Log.Level)); err != nil {
-		// Default to info level if invalid
-		level = zapcore.InfoLevel
-	}
-	logConfig.Level.SetLevel(level)
-
-	// Build the logger
-	var err error
-	log, err = logConfig.Build()
+	// An invalid level falls back to info
+	err := gomicrologger.InitLogger(&gomicrologger.LogConfig{
+		Level:           cfg.Log.Level,
+		Environment:     cfg.Server.Env,
+		ServiceName:     cfg.ServiceName,
+		Sampling:        gomicrologger.NewSamplingConfig(cfg.Log.SamplingInitial, cfg.Log.SamplingThereafter),
+		RequestSampling: gomicrologger.NewSamplingConfig(cfg.Log.RequestSamplingInitial, cfg.Log.RequestSamplingThereafter),
+	})
 	if err != nil {
 		panic("Failed to initialize logger: " + err.Error())
 	}
+	log = gomicrologger.GetLogger()
+	log.Info("Configuration loaded", zap.Any("config", cfg.Dump()))
 
-	log.Info("Logger initialized", zap.String("level", level.String()))
+	log.Info("Logger initialized", zap.String("level", gomicrologger.GetLevels().Level))
 }
 
 // GetLogger returns the global logger instance
@@ -57,47 +43,7 @@ func GetLogger() *zap.Logger {
 	return log
 }
 
-// Middleware returns an Echo middleware that logs HTTP requests
-func Middleware(logger *zap.Logger) echo.MiddlewareFunc {
-	return func(next echo.HandlerFunc) echo.HandlerFunc {
-		return func(c echo.Context) error {
-			start := time.Now()
-
-			// Get request ID from context if available
-			requestID := c.Request().Header.Get("X-Request-ID")
-			if requestID == "" {
-				requestID = c.Response().Header().Get("X-Request-ID")
-			}
-
-			// Set logger in context
-			ctxLogger := logger.With(zap.String("request_id", requestID))
-			c.Set("logger", ctxLogger)
-
-			// Process the request
-			err := next(c)
-
-			// Log after request is processed
-			latency := time.Since(start)
-
-			// Create structured log entry
-			fields := []zapcore.Field{
-				zap.String("method", c.Request().Method),
-				zap.String("path", c.Request().URL.Path),
-				zap.Int("status", c.Response().Status),
-				zap.Duration("latency", latency),
-				zap.String("ip", c.RealIP()),
-				zap.String("user_agent", c.Request().UserAgent()),
-			}
-
-			// Add error if present
-			if err != nil {
-				fields = append(fields, zap.Error(err))
-				ctxLogger.Error("HTTP request failed", fields...)
-			} else {
-				ctxLogger.Info("HTTP request completed", fields...)
-			}
-
-			return err
-		}
-	}
+// Component returns a named logger whose level can be changed independently of the global level
+func Component(name string) *zap.Logger {
+	return gomicrologger.Component(name)
 }
@@ -2,12 +2,12 @@ package prometheus
 
 import (
 	"oauth-service/pkg/config"
+	"strconv"
 	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
+	apperrors "github.com/suteetoe/gomicro/errors"
 )
 
 var (
@@ -23,9 +23,6 @@ var (
 	InvalidTokenRequestCounter *prometheus.CounterVec
 	ActiveTokensGauge          prometheus.Gauge
 
-	// Database operation metrics
-	DBOperationHistogram *prometheus.HistogramVec
-
 	// Request metrics
 	RequestDurationHistogram *prometheus.HistogramVec
 	APIRequestCounter        *prometheus.CounterVec
@@ -35,25 +32,26 @@ var (
 	namespace string
 )
 
-// InitMetrics initializes all Prometheus metrics
-func InitMetrics(cfg *config.Config) {
+// InitMetrics creates the service metrics and registers them on registerer, the registry of the
+// service's HTTP metrics
+func InitMetrics(cfg *config.Config, registerer prometheus.Registerer) error {
 	namespace = cfg.Metrics.Prefix
 
 	// Client metrics
-	ClientRegistrationCounter = promauto.NewCounter(prometheus.CounterOpts{
+	ClientRegistrationCounter = prometheus.NewCounter(prometheus.CounterOpts{
 		Namespace: namespace,
 		Name:      "client_registration_total",
 		Help:      "Total number of client registrations",
 	})
 
-	ActiveClientsGauge = promauto.NewGauge(prometheus.GaugeOpts{
+	ActiveClientsGauge = prometheus.NewGauge(prometheus.GaugeOpts{
 		Namespace: namespace,
 		Name:      "active_clients",
 		Help:      "Number of currently active clients",
 	})
 
 	// Token metrics
-	TokenRequestCounter = promauto.NewCounterVec(
+	TokenRequestCounter = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Namespace: namespace,
 			Name:      "token_request_total",
@@ -62,7 +60,7 @@ func InitMetrics(cfg *config.Config) {
 		[]string{"grant_type"},
 	)
 
-	TokensIssuedCounter = promauto.NewCounterVec(
+	TokensIssuedCounter = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Namespace: namespace,
 			Name:      "tokens_issued_total",
@@ -71,7 +69,7 @@ func InitMetrics(cfg *config.Config) {
 		[]string{"grant_type", "token_type"},
 	)
 
-	TokensRevokedCounter = promauto.NewCounterVec(
+	TokensRevokedCounter = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Namespace: namespace,
 			Name:      "tokens_revoked_total",
@@ -80,13 +78,13 @@ func InitMetrics(cfg *config.Config) {
 		[]string{"token_type", "reason"},
 	)
 
-	TokensRefreshedCounter = promauto.NewCounter(prometheus.CounterOpts{
+	TokensRefreshedCounter = prometheus.NewCounter(prometheus.CounterOpts{
 		Namespace: namespace,
 		Name:      "tokens_refreshed_total",
 		Help:      "Total number of tokens refreshed using refresh tokens",
 	})
 
-	InvalidTokenRequestCounter = promauto.NewCounterVec(
+	InvalidTokenRequestCounter = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Namespace: namespace,
 			Name:      "invalid_token_request_total",
@@ -95,25 +93,14 @@ func InitMetrics(cfg *config.Config) {
 		[]string{"error_type"},
 	)
 
-	ActiveTokensGauge = promauto.NewGauge(prometheus.GaugeOpts{
+	ActiveTokensGauge = prometheus.NewGauge(prometheus.GaugeOpts{
 		Namespace: namespace,
 		Name:      "active_tokens",
 		Help:      "Number of currently active tokens",
 	})
 
-	// Database operation metrics
-	DBOperationHistogram = promauto.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Namespace: namespace,
-			Name:      "db_operation_duration_seconds",
-			Help:      "Duration of database operations in seconds",
-			Buckets:   prometheus.DefBuckets,
-		},
-		[]string{"operation"},
-	)
-
 	// Request metrics
-	RequestDurationHistogram = promauto.NewHistogramVec(
+	RequestDurationHistogram = prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Namespace: namespace,
 			Name:      "http_request_duration_seconds",
@@ -123,7 +110,7 @@ func InitMetrics(cfg *config.Config) {
 		[]string{"method", "path", "status"},
 	)
 
-	APIRequestCounter = promauto.NewCounterVec(
+	APIRequestCounter = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Namespace: namespace,
 			Name:      "api_requests_total",
@@ -132,7 +119,7 @@ func InitMetrics(cfg *config.Config) {
 		[]string{"method", "path"},
 	)
 
-	APIErrorCounter = promauto.NewCounterVec(
+	APIErrorCounter = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Namespace: namespace,
 			Name:      "api_errors_total",
@@ -140,6 +127,25 @@ func InitMetrics(cfg *config.Config) {
 		},
 		[]string{"method", "path", "status"},
 	)
+
+	for _, collector := range []prometheus.Collector{
+		ClientRegistrationCounter,
+		ActiveClientsGauge,
+		TokenRequestCounter,
+		TokensIssuedCounter,
+		TokensRevokedCounter,
+		TokensRefreshedCounter,
+		InvalidTokenRequestCounter,
+		ActiveTokensGauge,
+		RequestDurationHistogram,
+		APIRequestCounter,
+		APIErrorCounter,
+	} {
+		if err := registerer.Register(collector); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // MetricsMiddleware tracks request metrics
@@ -160,10 +166,14 @@ func MetricsMiddleware() echo.MiddlewareFunc {
 			// Track request duration
 			duration := time.Since(start).Seconds()
 			status := c.Response().Status
+			if err != nil && !c.Response().Committed {
+				// The error handler has not written the response yet
+				status = apperrors.StatusCode(err)
+			}
 			RequestDurationHistogram.With(prometheus.Labels{
 				"method": c.Request().Method,
 				"path":   c.Path(),
-				"status": string(status),
+				"status": strconv.Itoa(status),
 			}).Observe(duration)
 
 			// Track errors
@@ -171,7 +181,7 @@ func MetricsMiddleware() echo.MiddlewareFunc {
 				APIErrorCounter.With(prometheus.Labels{
 					"method": c.Request().Method,
 					"path":   c.Path(),
-					"status": string(status),
+					"status": strconv.Itoa(status),
 				}).Inc()
 			}
 
@@ -180,21 +190,6 @@ func MetricsMiddleware() echo.MiddlewareFunc {
 	}
 }
 
-// HandlerFunc returns a HTTP handler for metrics endpoint
-func HandlerFunc() echo.HandlerFunc {
-	return echo.WrapHandler(promhttp.Handler())
-}
-
-// TrackDBOperation returns a function that tracks database operation duration
-func TrackDBOperation(operation string) func(time.Time) {
-	return func(startTime time.Time) {
-		duration := time.Since(startTime).Seconds()
-		DBOperationHistogram.With(prometheus.Labels{
-			"operation": operation,
-		}).Observe(duration)
-	}
-}
-
 // RecordTokenIssued increments the tokens issued counter
 func RecordTokenIssued(grantType, tokenType string) {
 	TokensIssuedCounter.With(prometheus.Labels{
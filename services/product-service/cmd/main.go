@@ -1,9 +1,11 @@
 package main
 
 import (
-	"net/http"
+	"context"
+	"os"
 	"product-service/internal/handler"
 	mid "product-service/internal/middleware"
+	"product-service/internal/migrations"
 	"product-service/pkg/config"
 	"product-service/pkg/database"
 	"product-service/pkg/jwtutil"
@@ -12,9 +14,20 @@ import (
 	"product-service/prometheus"
 
 	"github.com/joho/godotenv"
-	"github.com/labstack/echo/v4"
-	"github.com/labstack/echo/v4/middleware"
+	"github.com/suteetoe/gomicro/audit"
+	gomicroconfig "github.com/suteetoe/gomicro/config"
+	gomicrodb "github.com/suteetoe/gomicro/database"
+	"github.com/suteetoe/gomicro/health"
+	"github.com/suteetoe/gomicro/idempotency"
+	gomicrojwt "github.com/suteetoe/gomicro/jwtutil"
+	gomicrologger "github.com/suteetoe/gomicro/logger"
 	"github.com/suteetoe/gomicro/metrics" // Import the gomicro metrics package
+	gomicromw "github.com/suteetoe/gomicro/middleware"
+	"github.com/suteetoe/gomicro/migrate"
+	"github.com/suteetoe/gomicro/outbox"
+	"github.com/suteetoe/gomicro/ratelimit"
+	"github.com/suteetoe/gomicro/server"
+	"github.com/suteetoe/gomicro/tracing"
 	"go.uber.org/zap"
 )
 
@@ -43,111 +56,245 @@ func main() {
 		zap.String("environment", appConfig.Server.Env),
 		zap.String("port", appConfig.Server.Port))
 
+	// Initialize distributed tracing
+	if err := tracing.InitTracer(context.Background(), &tracing.TracingConfig{
+		ServiceName: "product-service",
+		Environment: appConfig.Server.Env,
+		Enabled:     appConfig.Tracing.Enabled,
+		Endpoint:    appConfig.Tracing.Endpoint,
+		Insecure:    appConfig.Tracing.Insecure,
+		SampleRatio: appConfig.Tracing.SampleRatio,
+	}); err != nil {
+		log.Fatal("Failed to initialize tracing", zap.Error(err))
+	}
+	log.Info("Tracing initialized", zap.Bool("enabled", appConfig.Tracing.Enabled))
+
 	// Initialize JWT utility (for legacy support)
 	jwtutil.Initialize(&appConfig.JWT)
 	log.Info("JWT utility initialized")
 
-	// Initialize Prometheus metrics
-	prometheus.InitMetrics(appConfig)
+	// Initialize HTTP metrics from gomicro on a registry of the service, which /metrics serves
+	httpMetrics, err := metrics.NewHTTPMetrics("product-service", metrics.WithRegistry(metrics.NewRegistry()))
+	if err != nil {
+		log.Fatal("Failed to initialize HTTP metrics", zap.Error(err))
+	}
+	log.Info("gomicro HTTP metrics initialized")
+
+	// Initialize Prometheus metrics of the service on the same registry
+	if err := prometheus.InitMetrics(appConfig, httpMetrics.Registerer()); err != nil {
+		log.Fatal("Failed to initialize Prometheus metrics", zap.Error(err))
+	}
 	log.Info("Prometheus metrics initialized",
 		zap.String("metrics_prefix", appConfig.Metrics.Prefix))
 
-	// Initialize HTTP metrics from gomicro
-	httpMetrics := metrics.NewHTTPMetrics("product-service")
-	log.Info("gomicro HTTP metrics initialized")
-
 	// Initialize database
-	err = database.InitDB(appConfig)
+	err = database.InitDB(appConfig, httpMetrics.Registerer())
 	if err != nil {
 		log.Fatal("Failed to initialize database", zap.Error(err))
 	}
 	log.Info("Database connection established")
 
+	// Apply changes to the config file and rotated secrets, such as DB_PASSWORD, without a restart
+	watcher := gomicroconfig.NewWatcher(appConfig, log)
+	watcher.Subscribe("logger", gomicrologger.ApplyConfig)
+	watcher.Subscribe("database", gomicrodb.ApplyConfig)
+	watcher.Subscribe("jwt", jwtutil.ApplyConfig)
+	defer watcher.Start(gomicroconfig.DefaultWatchInterval)()
+
+	// Apply schema migrations; `product-service migrate <command>` runs a single migrate command and exits
+	migrator, err := migrate.New(database.GetDB(), "product-service", migrations.All(), migrate.WithLogger(logger.Component("migrate")),
+		migrate.WithTenantRLS(appConfig.DB.TenantRLS, migrations.TenantTables...))
+	if err != nil {
+		log.Fatal("Invalid migrations", zap.Error(err))
+	}
+	if ran, err := migrate.Command(context.Background(), migrator, os.Args[1:], os.Stdout); ran {
+		if err != nil {
+			log.Fatal("Migrate command failed", zap.Error(err))
+		}
+		return
+	}
+	if appConfig.DB.MigrateOnStart {
+		if _, err := migrator.Up(context.Background()); err != nil {
+			log.Fatal("Failed to apply migrations", zap.Error(err))
+		}
+	}
+	if appConfig.DB.TenantRLS {
+		// Refuse to serve tenants when Postgres would not enforce the policies
+		if err := gomicrodb.VerifyRLS(context.Background(), database.GetDB(), migrations.TenantTables...); err != nil {
+			log.Fatal("Row level security is not enforced", zap.Error(err))
+		}
+	}
+
+	// Reject tokens revoked by authen-service, e.g. on logout
+	denylist, err := gomicrojwt.NewDenylist(appConfig.JWT.Denylist, database.GetDB())
+	if err != nil {
+		log.Fatal("Invalid JWT denylist", zap.Error(err))
+	}
+	jwtutil.InitDenylist(denylist)
+
+	// Initialize the audit log
+	handler.InitAudit(audit.NewRecorder(database.GetDB(), "product-service"))
+
+	// Authorize tenant roles, and the scopes of OAuth tokens, against the permission policy (AUTHZ_POLICY_PATH)
+	policy, err := gomicromw.LoadPolicy(appConfig.Authz.PolicyPath)
+	if err != nil {
+		log.Fatal("Failed to load authorization policy", zap.Error(err))
+	}
+	authz, err := gomicromw.NewAuthorizer("product-service", policy, gomicromw.RoleFromContext("role"),
+		gomicromw.WithScopes(gomicromw.ScopesFromContext("token_scopes")), gomicromw.WithAuthorizerRegisterer(httpMetrics.Registerer()))
+	if err != nil {
+		log.Fatal("Failed to initialize authorization", zap.Error(err))
+	}
+
+	// Throttle the API requests of each tenant (RATE_LIMIT_STORE, RATE_LIMIT_API)
+	apiLimit, err := ratelimit.APIRule(appConfig)
+	if err != nil {
+		log.Fatal("Invalid rate limit", zap.Error(err))
+	}
+	limitStore, err := ratelimit.NewStore(appConfig.RateLimit.Store, database.GetDB())
+	if err != nil {
+		log.Fatal("Invalid rate limit store", zap.Error(err))
+	}
+	limiter, err := ratelimit.NewLimiter("product-service", limitStore, ratelimit.WithRegisterer(httpMetrics.Registerer()))
+	if err != nil {
+		log.Fatal("Failed to initialize rate limiting", zap.Error(err))
+	}
+
+	// Replay the responses of POST and PATCH requests retried with an Idempotency-Key
+	idempotencyStore, err := idempotency.NewStore(appConfig.Idempotency.Store, database.GetDB())
+	if err != nil {
+		log.Fatal("Invalid idempotency store", zap.Error(err))
+	}
+	idempotent, err := idempotency.New("product-service", idempotencyStore, idempotency.WithTTL(appConfig.Idempotency.TTL),
+		idempotency.WithRegisterer(httpMetrics.Registerer()))
+	if err != nil {
+		log.Fatal("Failed to initialize idempotency keys", zap.Error(err))
+	}
+
+	// Apply changed rate limit rules, idempotency TTL without a restart
+	watcher.Subscribe("rate_limit", limiter.ApplyConfig(ratelimit.Limits{"api": ratelimit.APIRule}))
+	watcher.Subscribe("idempotency", idempotent.ApplyConfig)
+
+	// Write domain events to the outbox; the relay publishes them while the server runs
+	handler.InitEvents(outbox.NewWriter("product-service"))
+	var relayOutbox func(context.Context)
+	if appConfig.Outbox.Publisher != outbox.PublisherNone {
+		publisher, err := outbox.NewPublisher(appConfig.Outbox.Publisher, database.GetDB(), appConfig.Outbox.Channel)
+		if err != nil {
+			log.Fatal("Invalid outbox publisher", zap.Error(err))
+		}
+		relay, err := outbox.NewRelay(database.GetDB(), "product-service", publisher,
+			outbox.WithPollInterval(appConfig.Outbox.PollInterval),
+			outbox.WithLogger(logger.Component("outbox")),
+			outbox.WithRegisterer(httpMetrics.Registerer()))
+		if err != nil {
+			log.Fatal("Failed to create outbox relay", zap.Error(err))
+		}
+		relayOutbox = relay.Run
+	}
+
 	// Initialize OAuth client if enabled
 	var oauthClient *oauth.Client
-	if appConfig.OAuth.Enabled {
+	if appConfig.OAuthClient.Enabled {
 		oauthClient = oauth.NewClient(
-			appConfig.OAuth.BaseURL,
-			appConfig.OAuth.ClientID,
-			appConfig.OAuth.ClientSecret,
-			log.With(zap.String("component", "oauth_client")),
+			appConfig.OAuthClient.BaseURL,
+			appConfig.OAuthClient.ClientID,
+			appConfig.OAuthClient.ClientSecret,
+			logger.Component("oauth_client"),
 		)
 		log.Info("OAuth client initialized",
-			zap.String("oauth_base_url", appConfig.OAuth.BaseURL),
-			zap.String("oauth_client_id", appConfig.OAuth.ClientID))
+			zap.String("oauth_base_url", appConfig.OAuthClient.BaseURL),
+			zap.String("oauth_client_id", appConfig.OAuthClient.ClientID))
 
 		// Initialize the OAuth client for use in handlers
 		handler.InitOAuthClient(oauthClient)
 	}
 
-	// Initialize Echo instance
-	e := echo.New()
+	// Choose authentication method based on config. Either way each route checks its permission:
+	// users by their tenant role, OAuth tokens by the permissions the policy grants their scopes.
+	authenticate := mid.AuthMiddleware
+	if appConfig.OAuthClient.Enabled && oauthClient != nil {
+		authenticate = oauth.Middleware(oauthClient, nil)
+		log.Info("Using OAuth2 authentication for API routes")
+	} else {
+		log.Info("Using legacy JWT authentication for API routes")
+	}
 
-	// Middleware
-	e.Use(middleware.Recover())
-	e.Use(mid.RequestIDMiddleware)
-	e.Use(mid.MetricsMiddleware) // Keep existing metrics middleware for backward compatibility
-	e.Use(httpMetrics.Middleware()) // Add gomicro metrics middleware
+	// Tenants share one API limit; OAuth clients without a tenant are counted per client
+	apiRateLimit := limiter.Middleware("api", apiLimit,
+		ratelimit.FirstKey(ratelimit.KeyByTenant(), ratelimit.KeyByUser(), ratelimit.KeyByClientID()))
 
-	// Routes
-	// Metrics endpoint
-	e.GET("/metrics", echo.WrapHandler(metrics.GetPrometheusHandler())) // Use gomicro metrics handler
+	// Report ready while the database answers and the schema is migrated (/livez, /readyz)
+	checks, err := health.New("product-service", health.WithLogger(log), health.WithRegisterer(httpMetrics.Registerer()))
+	if err != nil {
+		log.Fatal("Failed to initialize health checks", zap.Error(err))
+	}
+	checks.AddReadiness("database", health.Database(database.GetDB()))
+	checks.AddReadiness("migrations", health.Migrations(migrator))
+	if appConfig.OAuthClient.Enabled {
+		// Requests are authenticated by introspecting their token at oauth-service
+		checks.AddReadiness("oauth", health.HTTP(appConfig.OAuthClient.BaseURL+"/livez"))
+	}
 
-	// Health check endpoint
-	e.GET("/health", func(c echo.Context) error {
-		return c.JSON(http.StatusOK, map[string]string{"status": "ok"})
-	})
+	// Build the HTTP server; it shuts down gracefully on SIGTERM
+	srv := server.New("product-service",
+		server.WithLogger(log),
+		server.WithDatabase(database.GetDB()),
+		server.WithMetrics(httpMetrics),
+		server.WithHealth(checks),
+		server.WithLogLevels(appConfig.Log.AdminToken, appConfig.Log.LevelFile),
+		server.WithMiddleware(mid.MetricsMiddleware), // Keep existing metrics middleware for backward compatibility
+		server.WithWorker("outbox relay", relayOutbox),
+		server.WithRoutes(func(r *server.Router) {
+			// Legacy route
+			r.GET("/merchant/hello", handler.Hello)
 
-	// Legacy route
-	e.GET("/merchant/hello", handler.Hello)
+			// Example route that uses OAuth for service-to-service communication
+			if appConfig.OAuthClient.Enabled {
+				r.GET("/example/suppliers", handler.GetSuppliersExample)
+			}
 
-	// Example route that uses OAuth for service-to-service communication
-	if appConfig.OAuth.Enabled {
-		e.GET("/example/suppliers", handler.GetSuppliersExample)
-	}
+			// Product API routes
+			productAPI := r.Group("/api/products", authenticate)
+			productAPI.Use(apiRateLimit)
+			productAPI.Use(idempotent.Middleware())
 
-	// Product API routes
-	productAPI := e.Group("/api/products")
+			// In RLS mode each request runs in a transaction bound to its tenant
+			if appConfig.DB.TenantRLS {
+				productAPI.Use(gomicromw.TenantTransaction(database.GetDB()))
+			}
 
-	// Choose authentication method based on config
-	if appConfig.OAuth.Enabled && oauthClient != nil {
-		// Use OAuth2 authentication
-		log.Info("Using OAuth2 authentication for API routes")
-		productAPI.Use(oauth.Middleware(oauthClient, []string{"read", "write"}))
-	} else {
-		// Use legacy JWT authentication
-		log.Info("Using legacy JWT authentication for API routes")
-		productAPI.Use(mid.AuthMiddleware)
-	}
+			productAPI.GET("", handler.ListProducts, authz.RequirePermission("product:read"))
+			productAPI.GET("/:id", handler.GetProduct, authz.RequirePermission("product:read"))
+			productAPI.POST("", handler.CreateProduct, authz.RequirePermission("product:create"))
+			productAPI.PUT("/:id", handler.UpdateProduct, authz.RequirePermission("product:update"))
+			productAPI.DELETE("/:id", handler.DeleteProduct, authz.RequirePermission("product:delete"))
 
-	productAPI.GET("", handler.ListProducts)
-	productAPI.GET("/:id", handler.GetProduct)
-	productAPI.POST("", handler.CreateProduct)
-	productAPI.PUT("/:id", handler.UpdateProduct)
-	productAPI.DELETE("/:id", handler.DeleteProduct)
+			// Category API routes
+			categoryAPI := r.Group("/api/categories", authenticate)
+			categoryAPI.Use(apiRateLimit)
+			categoryAPI.Use(idempotent.Middleware())
 
-	// Category API routes
-	categoryAPI := e.Group("/api/categories")
+			// In RLS mode each request runs in a transaction bound to its tenant
+			if appConfig.DB.TenantRLS {
+				categoryAPI.Use(gomicromw.TenantTransaction(database.GetDB()))
+			}
 
-	// Choose authentication method based on config
-	if appConfig.OAuth.Enabled && oauthClient != nil {
-		// Use OAuth2 authentication
-		categoryAPI.Use(oauth.Middleware(oauthClient, []string{"product:read", "product:write"}))
-	} else {
-		// Use legacy JWT authentication
-		categoryAPI.Use(mid.AuthMiddleware)
-	}
+			categoryAPI.GET("", handler.ListCategories, authz.RequirePermission("category:read"))
+			categoryAPI.GET("/:id", handler.GetCategory, authz.RequirePermission("category:read"))
+			categoryAPI.POST("", handler.CreateCategory, authz.RequirePermission("category:create"))
+			categoryAPI.PUT("/:id", handler.UpdateCategory, authz.RequirePermission("category:update"))
+			categoryAPI.DELETE("/:id", handler.DeleteCategory, authz.RequirePermission("category:delete"))
 
-	categoryAPI.GET("", handler.ListCategories)
-	categoryAPI.GET("/:id", handler.GetCategory)
-	categoryAPI.POST("", handler.CreateCategory)
-	categoryAPI.PUT("/:id", handler.UpdateCategory)
-	categoryAPI.DELETE("/:id", handler.DeleteCategory)
+			// Audit history of the current tenant - tenant owners only
+			auditAPI := r.Group("/api/audit-events", authenticate)
+			auditAPI.Use(apiRateLimit)
+			auditAPI.GET("", handler.GetAuditEvents)
+		}),
+	)
 
 	// Start server
-	port := appConfig.Server.Port
-	log.Info("Starting server", zap.String("port", port))
-	if err := e.Start(":" + port); err != nil {
+	if err := srv.Run(context.Background(), ":"+appConfig.Server.Port); err != nil {
 		log.Fatal("Server error", zap.Error(err))
 	}
 }
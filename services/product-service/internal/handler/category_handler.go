@@ -8,12 +8,13 @@ import (
 	"strconv"
 
 	"github.com/labstack/echo/v4"
+	apperrors "github.com/suteetoe/gomicro/errors"
 	"go.uber.org/zap"
 )
 
 // CategoryRequest defines the structure for category creation/update requests
 type CategoryRequest struct {
-	Name     string `json:"name" validate:"required"`
+	Name     string `json:"name" validate:"required,max=100"`
 	TenantID uint   `json:"tenant_id" validate:"required"`
 }
 
@@ -26,22 +27,18 @@ func ListCategories(c echo.Context) error {
 	tenantID, ok := c.Get("tenant_id").(uint)
 	if !ok {
 		log.Warn("Missing tenant_id in context")
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "tenant_id is required",
-		})
+		return apperrors.BadRequest("tenant_id is required")
 	}
 
 	log.Info("Filtering categories by tenant", zap.Uint("tenant_id", tenantID))
 
 	var categories []model.ProductCategory
-	result := database.GetDB().Where("tenant_id = ?", tenantID).Find(&categories)
+	result := database.GetDB().WithContext(c.Request().Context()).Find(&categories)
 	if result.Error != nil {
 		log.Error("Failed to retrieve categories",
 			zap.Error(result.Error),
 			zap.Uint("tenant_id", tenantID))
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": "Failed to retrieve categories",
-		})
+		return apperrors.Internal("Failed to retrieve categories", result.Error)
 	}
 
 	log.Info("Categories retrieved successfully",
@@ -59,9 +56,7 @@ func GetCategory(c echo.Context) error {
 	tenantID, ok := c.Get("tenant_id").(uint)
 	if !ok {
 		log.Warn("Missing tenant_id in context")
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "tenant_id is required",
-		})
+		return apperrors.BadRequest("tenant_id is required")
 	}
 
 	log.Info("Getting category by ID",
@@ -69,15 +64,13 @@ func GetCategory(c echo.Context) error {
 		zap.Uint("tenant_id", tenantID))
 
 	var category model.ProductCategory
-	result := database.GetDB().Where("id = ? AND tenant_id = ?", id, tenantID).First(&category)
+	result := database.GetDB().WithContext(c.Request().Context()).Where("id = ?", id).First(&category)
 	if result.Error != nil {
 		log.Error("Category not found or does not belong to tenant",
 			zap.String("category_id", id),
 			zap.Uint("tenant_id", tenantID),
 			zap.Error(result.Error))
-		return c.JSON(http.StatusNotFound, echo.Map{
-			"error": "Category not found",
-		})
+		return apperrors.NotFound("Category not found")
 	}
 
 	log.Info("Category retrieved successfully",
@@ -95,40 +88,39 @@ func CreateCategory(c echo.Context) error {
 	var req CategoryRequest
 	if err := c.Bind(&req); err != nil {
 		log.Error("Invalid request data", zap.Error(err))
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "Invalid request data",
-		})
+		return apperrors.BadRequest("Invalid request data")
 	}
 
 	// Extract tenant ID from context (set by auth middleware)
 	tenantID, ok := c.Get("tenant_id").(uint)
 	if !ok {
 		log.Warn("Missing tenant_id in context")
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "tenant_id is required",
-		})
+		return apperrors.BadRequest("tenant_id is required")
 	}
 
 	// Override the tenant ID in the request with the one from the JWT token
 	// This ensures users can't create categories for other tenants
 	req.TenantID = tenantID
 
+	if err := c.Validate(&req); err != nil {
+		log.Warn("Invalid category request", zap.Error(err))
+		return err
+	}
+
 	log.Info("Category creation request",
 		zap.String("name", req.Name),
 		zap.Uint("tenant_id", req.TenantID))
 
 	// Check if category with same name exists in the same tenant
 	var count int64
-	database.GetDB().Model(&model.ProductCategory{}).
-		Where("name = ? AND tenant_id = ?", req.Name, req.TenantID).
+	database.GetDB().WithContext(c.Request().Context()).Model(&model.ProductCategory{}).
+		Where("name = ?", req.Name).
 		Count(&count)
 	if count > 0 {
 		log.Warn("Category with this name already exists for this tenant",
 			zap.String("name", req.Name),
 			zap.Uint("tenant_id", req.TenantID))
-		return c.JSON(http.StatusConflict, echo.Map{
-			"error": "Category with this name already exists for this tenant",
-		})
+		return apperrors.Conflict("Category with this name already exists for this tenant")
 	}
 
 	category := model.ProductCategory{
@@ -136,15 +128,13 @@ func CreateCategory(c echo.Context) error {
 		TenantID: req.TenantID,
 	}
 
-	result := database.GetDB().Create(&category)
+	result := database.GetDB().WithContext(c.Request().Context()).Create(&category)
 	if result.Error != nil {
 		log.Error("Failed to create category",
 			zap.String("name", req.Name),
 			zap.Uint("tenant_id", req.TenantID),
 			zap.Error(result.Error))
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": "Failed to create category",
-		})
+		return apperrors.Internal("Failed to create category", result.Error)
 	}
 
 	log.Info("Category created successfully",
@@ -165,34 +155,33 @@ func UpdateCategory(c echo.Context) error {
 		log.Error("Invalid request data",
 			zap.String("category_id", id),
 			zap.Error(err))
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "Invalid request data",
-		})
+		return apperrors.BadRequest("Invalid request data")
 	}
 
 	// Extract tenant ID from context (set by auth middleware)
 	tenantID, ok := c.Get("tenant_id").(uint)
 	if !ok {
 		log.Warn("Missing tenant_id in context")
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "tenant_id is required",
-		})
+		return apperrors.BadRequest("tenant_id is required")
 	}
 
 	// Override the tenant ID in the request with the one from the JWT token
 	// This ensures users can't update categories for other tenants
 	req.TenantID = tenantID
 
+	if err := c.Validate(&req); err != nil {
+		log.Warn("Invalid category request", zap.Error(err))
+		return err
+	}
+
 	// Find existing category and validate tenant ownership
 	var category model.ProductCategory
-	result := database.GetDB().Where("id = ?", id).First(&category)
+	result := database.GetDB().WithContext(c.Request().Context()).Where("id = ?", id).First(&category)
 	if result.Error != nil {
 		log.Error("Category not found",
 			zap.String("category_id", id),
 			zap.Error(result.Error))
-		return c.JSON(http.StatusNotFound, echo.Map{
-			"error": "Category not found",
-		})
+		return apperrors.NotFound("Category not found")
 	}
 
 	// Ensure category belongs to the tenant in JWT token
@@ -201,9 +190,7 @@ func UpdateCategory(c echo.Context) error {
 			zap.String("category_id", id),
 			zap.Uint("category_tenant", category.TenantID),
 			zap.Uint("request_tenant", tenantID))
-		return c.JSON(http.StatusForbidden, echo.Map{
-			"error": "You don't have permission to update this category",
-		})
+		return apperrors.Forbidden("You don't have permission to update this category")
 	}
 
 	oldName := category.Name
@@ -215,16 +202,14 @@ func UpdateCategory(c echo.Context) error {
 			zap.String("new_name", req.Name))
 
 		var count int64
-		database.GetDB().Model(&model.ProductCategory{}).
-			Where("name = ? AND id != ? AND tenant_id = ?", req.Name, id, tenantID).
+		database.GetDB().WithContext(c.Request().Context()).Model(&model.ProductCategory{}).
+			Where("name = ? AND id != ?", req.Name, id).
 			Count(&count)
 		if count > 0 {
 			log.Warn("Category with this name already exists for this tenant",
 				zap.String("name", req.Name),
 				zap.Uint("tenant_id", tenantID))
-			return c.JSON(http.StatusConflict, echo.Map{
-				"error": "Category with this name already exists for this tenant",
-			})
+			return apperrors.Conflict("Category with this name already exists for this tenant")
 		}
 	}
 
@@ -232,14 +217,12 @@ func UpdateCategory(c echo.Context) error {
 	category.Name = req.Name
 	// TenantID remains unchanged - can't change tenant ownership
 
-	result = database.GetDB().Save(&category)
+	result = database.GetDB().WithContext(c.Request().Context()).Save(&category)
 	if result.Error != nil {
 		log.Error("Failed to update category",
 			zap.String("category_id", id),
 			zap.Error(result.Error))
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": "Failed to update category",
-		})
+		return apperrors.Internal("Failed to update category", result.Error)
 	}
 
 	log.Info("Category updated successfully",
@@ -259,9 +242,7 @@ func DeleteCategory(c echo.Context) error {
 	tenantID, ok := c.Get("tenant_id").(uint)
 	if !ok {
 		log.Warn("Missing tenant_id in context")
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "tenant_id is required",
-		})
+		return apperrors.BadRequest("tenant_id is required")
 	}
 
 	log.Info("Deleting category",
@@ -270,41 +251,35 @@ func DeleteCategory(c echo.Context) error {
 
 	// First verify tenant ownership of the category
 	var category model.ProductCategory
-	preResult := database.GetDB().Where("id = ? AND tenant_id = ?", id, tenantID).First(&category)
+	preResult := database.GetDB().WithContext(c.Request().Context()).Where("id = ?", id).First(&category)
 	if preResult.Error != nil {
 		log.Warn("Category not found or does not belong to tenant",
 			zap.String("category_id", id),
 			zap.Uint("tenant_id", tenantID))
-		return c.JSON(http.StatusNotFound, echo.Map{
-			"error": "Category not found",
-		})
+		return apperrors.NotFound("Category not found")
 	}
 
 	// Check if any products from this tenant are using this category
 	var count int64
-	database.GetDB().Model(&model.Product{}).
-		Where("category_id = ? AND tenant_id = ?", id, tenantID).
+	database.GetDB().WithContext(c.Request().Context()).Model(&model.Product{}).
+		Where("category_id = ?", id).
 		Count(&count)
 	if count > 0 {
 		log.Warn("Cannot delete category that is being used by products",
 			zap.String("category_id", id),
 			zap.Uint("tenant_id", category.TenantID),
 			zap.Int64("product_count", count))
-		return c.JSON(http.StatusConflict, echo.Map{
-			"error": "Cannot delete category that is being used by products",
-		})
+		return apperrors.Conflict("Cannot delete category that is being used by products")
 	}
 
 	// Proceed with deletion
-	result := database.GetDB().Delete(&category)
+	result := database.GetDB().WithContext(c.Request().Context()).Delete(&category)
 	if result.Error != nil {
 		log.Error("Failed to delete category",
 			zap.String("category_id", id),
 			zap.Uint("tenant_id", category.TenantID),
 			zap.Error(result.Error))
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": "Failed to delete category",
-		})
+		return apperrors.Internal("Failed to delete category", result.Error)
 	}
 
 	log.Info("Category deleted successfully",
@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"product-service/internal/model"
+	"strconv"
+
+	"github.com/suteetoe/gomicro/outbox"
+	"gorm.io/gorm"
+)
+
+// events writes domain events to the outbox; nil until InitEvents is called
+var events *outbox.Writer
+
+// InitEvents sets the outbox writer used by the handlers
+func InitEvents(writer *outbox.Writer) {
+	events = writer
+}
+
+// publishEvent adds a domain event to the outbox in tx, the transaction of the change it describes
+func publishEvent(tx *gorm.DB, topic, key string, payload interface{}) error {
+	if events == nil {
+		return nil
+	}
+	return events.Write(tx, outbox.Event{Topic: topic, Key: key, Payload: payload})
+}
+
+// StockChanged is the payload of product.stock_changed events
+type StockChanged struct {
+	ProductID uint   `json:"product_id"`
+	SKU       string `json:"sku"`
+	TenantID  uint   `json:"tenant_id"`
+	OldStock  int    `json:"old_stock"`
+	NewStock  int    `json:"new_stock"`
+}
+
+// publishStockChanged adds a product.stock_changed event when the stock of product differs from oldStock
+func publishStockChanged(tx *gorm.DB, product model.Product, oldStock int) error {
+	if product.Stock == oldStock {
+		return nil
+	}
+	return publishEvent(tx, "product.stock_changed", strconv.FormatUint(uint64(product.ID), 10), StockChanged{
+		ProductID: product.ID,
+		SKU:       product.SKU,
+		TenantID:  product.TenantID,
+		OldStock:  oldStock,
+		NewStock:  product.Stock,
+	})
+}
@@ -8,16 +8,20 @@ import (
 	"strconv"
 
 	"github.com/labstack/echo/v4"
+	"github.com/suteetoe/gomicro/audit"
+	gomicrodb "github.com/suteetoe/gomicro/database"
+	apperrors "github.com/suteetoe/gomicro/errors"
 	"go.uber.org/zap"
+	"gorm.io/gorm"
 )
 
 // ProductRequest defines the structure for product creation/update requests
 type ProductRequest struct {
-	Name        string  `json:"name" validate:"required"`
+	Name        string  `json:"name" validate:"required,max=255"`
 	Description string  `json:"description"`
-	SKU         string  `json:"sku" validate:"required"`
+	SKU         string  `json:"sku" validate:"required,sku"`
 	Price       float64 `json:"price" validate:"required,gt=0"`
-	Stock       int     `json:"stock"`
+	Stock       int     `json:"stock" validate:"gte=0"`
 	CategoryID  uint    `json:"category_id"`
 	TenantID    uint    `json:"tenant_id" validate:"required"`
 	IsActive    bool    `json:"is_active"`
@@ -28,20 +32,18 @@ func ListProducts(c echo.Context) error {
 	log := logger.FromContext(c)
 	log.Info("Listing products with filters")
 
-	db := database.GetDB()
+	db := database.GetDB().WithContext(c.Request().Context())
 	var products []model.Product
 
 	// Extract tenant ID from context (set by auth middleware)
 	tenantID, ok := c.Get("tenant_id").(uint)
 	if !ok {
 		log.Warn("Missing tenant_id in context")
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "tenant_id is required",
-		})
+		return apperrors.BadRequest("tenant_id is required")
 	}
 
 	// Handle query parameters for filtering
-	query := db.Where("tenant_id = ?", tenantID)
+	query := db
 	log.Info("Filtering products by tenant", zap.Uint("tenant_id", tenantID))
 
 	// Filter by active status if specified
@@ -68,9 +70,7 @@ func ListProducts(c echo.Context) error {
 	if result.Error != nil {
 		log.Error("Failed to list products",
 			zap.Error(result.Error))
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": "Failed to retrieve products",
-		})
+		return apperrors.Internal("Failed to retrieve products", result.Error)
 	}
 
 	log.Info("Products retrieved successfully",
@@ -88,9 +88,7 @@ func GetProduct(c echo.Context) error {
 	tenantID, ok := c.Get("tenant_id").(uint)
 	if !ok {
 		log.Warn("Missing tenant_id in context")
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "tenant_id is required",
-		})
+		return apperrors.BadRequest("tenant_id is required")
 	}
 
 	log.Info("Getting product by ID",
@@ -98,15 +96,13 @@ func GetProduct(c echo.Context) error {
 		zap.Uint("tenant_id", tenantID))
 
 	var product model.Product
-	result := database.GetDB().Where("id = ? AND tenant_id = ?", id, tenantID).First(&product)
+	result := database.GetDB().WithContext(c.Request().Context()).Where("id = ?", id).First(&product)
 	if result.Error != nil {
 		log.Error("Product not found or does not belong to tenant",
 			zap.String("product_id", id),
 			zap.Uint("tenant_id", tenantID),
 			zap.Error(result.Error))
-		return c.JSON(http.StatusNotFound, echo.Map{
-			"error": "Product not found",
-		})
+		return apperrors.NotFound("Product not found")
 	}
 
 	log.Info("Product retrieved successfully",
@@ -125,24 +121,25 @@ func CreateProduct(c echo.Context) error {
 	var req ProductRequest
 	if err := c.Bind(&req); err != nil {
 		log.Error("Invalid request data", zap.Error(err))
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "Invalid request data",
-		})
+		return apperrors.BadRequest("Invalid request data")
 	}
 
 	// Extract tenant ID from context (set by auth middleware)
 	tenantID, ok := c.Get("tenant_id").(uint)
 	if !ok {
 		log.Warn("Missing tenant_id in context")
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "tenant_id is required",
-		})
+		return apperrors.BadRequest("tenant_id is required")
 	}
 
 	// Override the tenant ID in the request with the one from the JWT token
 	// This ensures users can't create products for other tenants
 	req.TenantID = tenantID
 
+	if err := c.Validate(&req); err != nil {
+		log.Warn("Invalid product request", zap.Error(err))
+		return err
+	}
+
 	log.Info("Product creation request",
 		zap.String("name", req.Name),
 		zap.String("sku", req.SKU),
@@ -152,16 +149,14 @@ func CreateProduct(c echo.Context) error {
 
 	// Check if product with SKU already exists for this tenant
 	var count int64
-	database.GetDB().Model(&model.Product{}).
-		Where("sku = ? AND tenant_id = ?", req.SKU, req.TenantID).
+	database.GetDB().WithContext(c.Request().Context()).Model(&model.Product{}).
+		Where("sku = ?", req.SKU).
 		Count(&count)
 	if count > 0 {
 		log.Warn("Product with this SKU already exists for this tenant",
 			zap.String("sku", req.SKU),
 			zap.Uint("tenant_id", req.TenantID))
-		return c.JSON(http.StatusConflict, echo.Map{
-			"error": "Product with this SKU already exists for this tenant",
-		})
+		return apperrors.Conflict("Product with this SKU already exists for this tenant")
 	}
 
 	// Create the product
@@ -176,16 +171,20 @@ func CreateProduct(c echo.Context) error {
 		IsActive:    req.IsActive,
 	}
 
-	result := database.GetDB().Create(&product)
-	if result.Error != nil {
+	// Create the product and its initial stock event in one transaction
+	err := gomicrodb.Transaction(c.Request().Context(), database.GetDB(), func(tx *gorm.DB) error {
+		if err := tx.Create(&product).Error; err != nil {
+			return err
+		}
+		return publishStockChanged(tx, product, 0)
+	})
+	if err != nil {
 		log.Error("Failed to create product",
 			zap.String("name", req.Name),
 			zap.String("sku", req.SKU),
 			zap.Uint("tenant_id", req.TenantID),
-			zap.Error(result.Error))
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": "Failed to create product",
-		})
+			zap.Error(err))
+		return apperrors.Internal("Failed to create product", err)
 	}
 
 	log.Info("Product created successfully",
@@ -207,34 +206,33 @@ func UpdateProduct(c echo.Context) error {
 		log.Error("Invalid request data",
 			zap.String("product_id", id),
 			zap.Error(err))
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "Invalid request data",
-		})
+		return apperrors.BadRequest("Invalid request data")
 	}
 
 	// Extract tenant ID from context (set by auth middleware)
 	tenantID, ok := c.Get("tenant_id").(uint)
 	if !ok {
 		log.Warn("Missing tenant_id in context")
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "tenant_id is required",
-		})
+		return apperrors.BadRequest("tenant_id is required")
 	}
 
 	// Override the tenant ID in the request with the one from the JWT token
 	// This ensures users can't update products for other tenants
 	req.TenantID = tenantID
 
+	if err := c.Validate(&req); err != nil {
+		log.Warn("Invalid product request", zap.Error(err))
+		return err
+	}
+
 	// Find existing product and validate tenant ownership
 	var product model.Product
-	result := database.GetDB().Where("id = ?", id).First(&product)
+	result := database.GetDB().WithContext(c.Request().Context()).Where("id = ?", id).First(&product)
 	if result.Error != nil {
 		log.Error("Product not found for update",
 			zap.String("product_id", id),
 			zap.Error(result.Error))
-		return c.JSON(http.StatusNotFound, echo.Map{
-			"error": "Product not found",
-		})
+		return apperrors.NotFound("Product not found")
 	}
 
 	// Ensure product belongs to the tenant in JWT token
@@ -243,13 +241,12 @@ func UpdateProduct(c echo.Context) error {
 			zap.String("product_id", id),
 			zap.Uint("product_tenant", product.TenantID),
 			zap.Uint("request_tenant", tenantID))
-		return c.JSON(http.StatusForbidden, echo.Map{
-			"error": "You don't have permission to update this product",
-		})
+		return apperrors.Forbidden("You don't have permission to update this product")
 	}
 
 	oldSKU := product.SKU
 	oldPrice := product.Price
+	oldStock := product.Stock
 
 	// Check if SKU is changed and if new SKU already exists within the same tenant
 	if req.SKU != product.SKU {
@@ -259,16 +256,14 @@ func UpdateProduct(c echo.Context) error {
 			zap.String("new_sku", req.SKU))
 
 		var count int64
-		database.GetDB().Model(&model.Product{}).
-			Where("sku = ? AND id != ? AND tenant_id = ?", req.SKU, id, tenantID).
+		database.GetDB().WithContext(c.Request().Context()).Model(&model.Product{}).
+			Where("sku = ? AND id != ?", req.SKU, id).
 			Count(&count)
 		if count > 0 {
 			log.Warn("Product with this SKU already exists for this tenant",
 				zap.String("sku", req.SKU),
 				zap.Uint("tenant_id", tenantID))
-			return c.JSON(http.StatusConflict, echo.Map{
-				"error": "Product with this SKU already exists for this tenant",
-			})
+			return apperrors.Conflict("Product with this SKU already exists for this tenant")
 		}
 	}
 
@@ -282,14 +277,18 @@ func UpdateProduct(c echo.Context) error {
 	product.IsActive = req.IsActive
 	// TenantID remains unchanged - can't change tenant ownership
 
-	result = database.GetDB().Save(&product)
-	if result.Error != nil {
+	// Save the product and, if its stock changed, a product.stock_changed event in one transaction
+	err := gomicrodb.Transaction(c.Request().Context(), database.GetDB(), func(tx *gorm.DB) error {
+		if err := tx.Save(&product).Error; err != nil {
+			return err
+		}
+		return publishStockChanged(tx, product, oldStock)
+	})
+	if err != nil {
 		log.Error("Failed to update product",
 			zap.String("product_id", id),
-			zap.Error(result.Error))
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": "Failed to update product",
-		})
+			zap.Error(err))
+		return apperrors.Internal("Failed to update product", err)
 	}
 
 	log.Info("Product updated successfully",
@@ -312,9 +311,7 @@ func DeleteProduct(c echo.Context) error {
 	tenantID, ok := c.Get("tenant_id").(uint)
 	if !ok {
 		log.Warn("Missing tenant_id in context")
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "tenant_id is required",
-		})
+		return apperrors.BadRequest("tenant_id is required")
 	}
 
 	log.Info("Deleting product",
@@ -323,15 +320,13 @@ func DeleteProduct(c echo.Context) error {
 
 	// Get product details before deleting and verify tenant ownership
 	var product model.Product
-	preResult := database.GetDB().Where("id = ? AND tenant_id = ?", id, tenantID).First(&product)
+	preResult := database.GetDB().WithContext(c.Request().Context()).Where("id = ?", id).First(&product)
 	if preResult.Error != nil {
 		log.Warn("Product not found or does not belong to tenant",
 			zap.String("product_id", id),
 			zap.Uint("tenant_id", tenantID),
 			zap.Error(preResult.Error))
-		return c.JSON(http.StatusNotFound, echo.Map{
-			"error": "Product not found",
-		})
+		return apperrors.NotFound("Product not found")
 	}
 
 	log.Info("Found product to delete",
@@ -341,16 +336,15 @@ func DeleteProduct(c echo.Context) error {
 		zap.Uint("tenant_id", product.TenantID))
 
 	// Proceed with deletion
-	result := database.GetDB().Delete(&product)
+	result := database.GetDB().WithContext(c.Request().Context()).Delete(&product)
 	if result.Error != nil {
 		log.Error("Failed to delete product",
 			zap.String("product_id", id),
 			zap.Uint("tenant_id", product.TenantID),
 			zap.Error(result.Error))
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": "Failed to delete product",
-		})
+		return apperrors.Internal("Failed to delete product", result.Error)
 	}
+	recordAudit(c, tenantID, "product.deleted", "product", id, audit.Diff(product, nil))
 
 	log.Info("Product deleted successfully",
 		zap.String("product_id", id),
@@ -7,6 +7,7 @@ import (
 	"product-service/pkg/oauth"
 
 	"github.com/labstack/echo/v4"
+	apperrors "github.com/suteetoe/gomicro/errors"
 	"go.uber.org/zap"
 )
 
@@ -33,30 +34,23 @@ func GetSuppliersExample(c echo.Context) error {
 	// Check if OAuth client is available
 	if OAuthClient == nil {
 		log.Error("OAuth client not initialized")
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "OAuth client not configured",
-		})
+		return apperrors.New(http.StatusInternalServerError, "OAuth client not configured")
 	}
 
 	log.Info("Fetching suppliers from supplier service using OAuth")
 
 	// Make an authenticated call to the supplier service
-	response, err := OAuthClient.CallAPI("GET", "http://localhost:8083/api/suppliers?limit=5", nil)
+	response, err := OAuthClient.CallAPI(c.Request().Context(), "GET", "http://localhost:8083/api/suppliers?limit=5", nil)
 	if err != nil {
 		log.Error("Failed to call supplier service", zap.Error(err))
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error":   "Failed to call supplier service",
-			"details": err.Error(),
-		})
+		return apperrors.Internal("Failed to call supplier service", err)
 	}
 
 	// Parse the response
 	var suppliers []ExampleSupplierData
 	if err := json.Unmarshal(response, &suppliers); err != nil {
 		log.Error("Failed to parse supplier response", zap.Error(err))
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "Failed to parse supplier response",
-		})
+		return apperrors.Internal("Failed to parse supplier response", err)
 	}
 
 	log.Info("Successfully fetched suppliers", zap.Int("count", len(suppliers)))
@@ -1,13 +1,14 @@
 package middleware
 
 import (
-	"net/http"
 	"product-service/pkg/jwtutil"
 	"product-service/pkg/logger"
 	"product-service/prometheus"
 	"strings"
 
 	"github.com/labstack/echo/v4"
+	gomicrodb "github.com/suteetoe/gomicro/database"
+	apperrors "github.com/suteetoe/gomicro/errors"
 	"go.uber.org/zap"
 )
 
@@ -24,7 +25,7 @@ func AuthMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 		if authHeader == "" {
 			log.Warn("Missing Authorization header")
 			prometheus.AuthErrorsCounter.Inc()
-			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "missing authorization token"})
+			return apperrors.Unauthorized("missing authorization token")
 		}
 
 		// Check if it's a Bearer token
@@ -32,7 +33,7 @@ func AuthMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 		if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
 			log.Warn("Invalid Authorization header format")
 			prometheus.AuthErrorsCounter.Inc()
-			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "invalid authorization format, expected Bearer token"})
+			return apperrors.Unauthorized("invalid authorization format, expected Bearer token")
 		}
 
 		// Extract the token
@@ -43,7 +44,7 @@ func AuthMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 		if err != nil {
 			log.Error("Invalid JWT token", zap.Error(err))
 			prometheus.AuthErrorsCounter.Inc()
-			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "invalid or expired token"})
+			return apperrors.Unauthorized("invalid or expired token")
 		}
 
 		// Store user info in context for later use
@@ -53,8 +54,10 @@ func AuthMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 		// Store tenant information if available
 		if claims.TenantID != nil {
 			c.Set("tenant_id", *claims.TenantID)
+			// Scope database statements of the request to the tenant
+			c.SetRequest(c.Request().WithContext(gomicrodb.WithTenant(c.Request().Context(), *claims.TenantID)))
 			c.Set("tenant_name", claims.TenantName)
-			c.Set("user_role", claims.Role)
+			c.Set("role", claims.Role)
 
 			// Add tenant info to logger context
 			log = log.With(
@@ -69,7 +72,7 @@ func AuthMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 			log.Warn("JWT token does not contain tenant_id")
 			prometheus.TenantContextMissingCounter.Inc()
 			prometheus.AuthErrorsCounter.Inc()
-			return c.JSON(http.StatusBadRequest, echo.Map{"error": "tenant_id is required in the token"})
+			return apperrors.BadRequest("tenant_id is required in the token")
 		}
 
 		// Increment auth success counter
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/labstack/echo/v4"
+	apperrors "github.com/suteetoe/gomicro/errors"
 )
 
 // MetricsMiddleware adds prometheus metrics to track HTTP requests
@@ -23,7 +24,12 @@ func MetricsMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 		// Get request details
 		method := c.Request().Method
 		path := c.Path()
-		status := strconv.Itoa(c.Response().Status)
+		code := c.Response().Status
+		if err != nil && !c.Response().Committed {
+			// The error handler has not written the response yet
+			code = apperrors.StatusCode(err)
+		}
+		status := strconv.Itoa(code)
 
 		// Record metrics
 		prometheus.HttpRequestsTotal.WithLabelValues(method, path, status).Inc()
@@ -0,0 +1,65 @@
+package migrations
+
+import (
+	"product-service/internal/model"
+
+	"github.com/suteetoe/gomicro/audit"
+	"github.com/suteetoe/gomicro/idempotency"
+	"github.com/suteetoe/gomicro/migrate"
+	"github.com/suteetoe/gomicro/outbox"
+	"github.com/suteetoe/gomicro/ratelimit"
+	"gorm.io/gorm"
+)
+
+// TenantTables are the tables whose rows row level security restricts to the tenant of a request
+var TenantTables = []string{"products", "product_categories"}
+
+// All returns the schema migrations of the service. Add new versions to the end of the list
+// and never change a version that has been released.
+func All() []migrate.Migration {
+	return []migrate.Migration{
+		{
+			// Version 1 is the schema previously created by AutoMigrate on every boot
+			Version: 1,
+			Name:    "baseline",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&model.Product{}, &model.ProductCategory{}, &audit.Event{})
+			},
+			Down: func(tx *gorm.DB) error {
+				// audit_events is shared with the other services and is kept
+				return tx.Migrator().DropTable(&model.ProductCategory{}, &model.Product{})
+			},
+		},
+		// Version 2 lets Postgres enforce the tenant in RLS mode (DB_TENANT_RLS)
+		migrate.TenantPolicies(2, TenantTables...),
+		{
+			Version: 3,
+			Name:    "outbox",
+			Up:      outbox.Migrate,
+			Down: func(tx *gorm.DB) error {
+				// outbox_messages is shared with the other services and is kept
+				return nil
+			},
+		},
+		{
+			// Version 4 keeps the rate limit counters for RATE_LIMIT_STORE=postgres
+			Version: 4,
+			Name:    "rate_limits",
+			Up:      ratelimit.Migrate,
+			Down: func(tx *gorm.DB) error {
+				// rate_limit_buckets is shared with the other services and is kept
+				return nil
+			},
+		},
+		{
+			// Version 5 stores the responses replayed for Idempotency-Key retries with IDEMPOTENCY_STORE=postgres
+			Version: 5,
+			Name:    "idempotency_keys",
+			Up:      idempotency.Migrate,
+			Down: func(tx *gorm.DB) error {
+				// idempotency_keys is shared with the other services and is kept
+				return nil
+			},
+		},
+	}
+}
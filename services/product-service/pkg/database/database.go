@@ -1,68 +1,48 @@
 package database
 
 import (
-	"fmt"
-	"log"
-	"product-service/internal/model"
 	"product-service/pkg/config"
 
-	"gorm.io/driver/postgres"
+	"github.com/prometheus/client_golang/prometheus"
+	gomicrodb "github.com/suteetoe/gomicro/database"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
 
 var db *gorm.DB
 
-// InitDB initializes the database connection with configuration and runs migrations
-func InitDB(config *config.Config) error {
+// InitDB initializes the database connection with configuration; the schema is managed by internal/migrations.
+// Statements on tenant models need a context from gomicrodb.WithTenant, see AuthMiddleware.
+func InitDB(config *config.Config, registerer prometheus.Registerer) error {
 	var err error
 
 	// Configure GORM logger
-	logLevel := logger.Info
+	dbConfig := config.DB
 	if config.Server.Env == "development" {
-		logLevel = logger.Info
+		dbConfig.LogLevel = logger.Info
 	} else {
-		logLevel = logger.Error
+		dbConfig.LogLevel = logger.Error
 	}
 
-	// Create DSN string
-	dsn := config.DB.GetDSN()
-
-	// Configure Postgres options
-	pgConfig := postgres.Config{
-		DSN:                  dsn,
-		PreferSimpleProtocol: true, // Disables implicit prepared statement usage
-	}
-
-	// Open connection
-	db, err = gorm.Open(postgres.New(pgConfig), &gorm.Config{
-		Logger: logger.Default.LogMode(logLevel),
-	})
-	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
-		return err
-	}
-
-	// Get generic database object SQL
-	sqlDB, err := db.DB()
-	if err != nil {
-		log.Fatalf("Failed to get database object: %v", err)
-		return err
+	// Record query metrics and connection pool statistics, and route reads to the read
+	// replicas, if any; writes and transactions stay on the primary
+	replicas := gomicrodb.NewReplicaRouter("product-service", config.DB.ReplicaDSNs()...)
+	replicas.Registerer = registerer
+	plugins := []gorm.Plugin{
+		gomicrodb.NewMetricsPlugin("product-service", gomicrodb.WithRegisterer(registerer)),
+		// Scope statements on tenant models to the tenant of the request context
+		gomicrodb.NewTenantPlugin(),
+		replicas,
 	}
-
-	// Set connection pool settings from config
-	sqlDB.SetMaxIdleConns(config.DB.MaxIdleConns)
-	sqlDB.SetMaxOpenConns(config.DB.MaxOpenConns)
-	sqlDB.SetConnMaxLifetime(config.DB.ConnMaxLifetime)
-
-	fmt.Println("Database connected successfully")
-
-	// Run migrations
-	if err := db.AutoMigrate(&model.Product{}, &model.ProductCategory{}); err != nil {
-		return fmt.Errorf("failed to run database migrations: %w", err)
+	if config.DB.TenantRLS {
+		// In RLS mode, run statements of a request in its transaction, see TenantTransaction in main
+		plugins = append(plugins, gomicrodb.NewRLSPlugin())
 	}
 
-	return nil
+	// Open the connection through gomicro, retrying while the database is starting, so that
+	// gomicrodb.ApplyConfig can apply a rotated password
+	db, err = gomicrodb.InitDB(&dbConfig, plugins...)
+	return err
 }
 
 // GetDB returns the database instance
@@ -2,6 +2,7 @@ package oauth
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -11,6 +12,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/suteetoe/gomicro/tracing"
 	"go.uber.org/zap"
 )
 
@@ -56,13 +58,16 @@ func NewClient(baseURL, clientID, clientSecret string, logger *zap.Logger) *Clie
 		BaseURL:      baseURL,
 		ClientID:     clientID,
 		ClientSecret: clientSecret,
-		HTTPClient:   &http.Client{Timeout: 10 * time.Second},
-		Logger:       logger,
+		HTTPClient: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: tracing.NewTransport(nil), // Propagates the trace context to downstream services
+		},
+		Logger: logger,
 	}
 }
 
 // GetClientCredentialsToken obtains an access token using the client credentials grant
-func (c *Client) GetClientCredentialsToken(scope string) (*TokenResponse, error) {
+func (c *Client) GetClientCredentialsToken(ctx context.Context, scope string) (*TokenResponse, error) {
 	c.Logger.Info("Requesting client credentials token",
 		zap.String("client_id", c.ClientID),
 		zap.String("scope", scope))
@@ -73,18 +78,18 @@ func (c *Client) GetClientCredentialsToken(scope string) (*TokenResponse, error)
 		data.Set("scope", scope)
 	}
 
-	return c.requestToken(data)
+	return c.requestToken(ctx, data)
 }
 
 // ValidateToken performs token introspection to check if a token is valid
-func (c *Client) ValidateToken(token string) (*TokenValidationResponse, error) {
+func (c *Client) ValidateToken(ctx context.Context, token string) (*TokenValidationResponse, error) {
 	c.Logger.Info("Validating token",
 		zap.String("client_id", c.ClientID))
 
 	data := url.Values{}
 	data.Set("token", token)
 
-	req, err := http.NewRequest("POST", fmt.Sprintf("%s/oauth/introspect", c.BaseURL), strings.NewReader(data.Encode()))
+	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/oauth/introspect", c.BaseURL), strings.NewReader(data.Encode()))
 	if err != nil {
 		return nil, err
 	}
@@ -133,12 +138,12 @@ func (c *Client) ValidateToken(token string) (*TokenValidationResponse, error) {
 	return &validationResp, nil
 }
 
-// CallAPI makes an authenticated API call to a protected resource
-func (c *Client) CallAPI(method, path string, body io.Reader) ([]byte, error) {
+// CallAPI makes an authenticated API call to a protected resource that continues the trace carried by ctx
+func (c *Client) CallAPI(ctx context.Context, method, path string, body io.Reader) ([]byte, error) {
 	// Ensure we have a valid token
 	if c.AccessToken == "" || time.Now().After(c.TokenExpiry) {
 		c.Logger.Info("Access token not available or expired, requesting new token")
-		tokenResp, err := c.GetClientCredentialsToken("read write")
+		tokenResp, err := c.GetClientCredentialsToken(ctx, "read write")
 		if err != nil {
 			c.Logger.Error("Failed to get access token", zap.Error(err))
 			return nil, fmt.Errorf("failed to get access token: %w", err)
@@ -154,7 +159,7 @@ func (c *Client) CallAPI(method, path string, body io.Reader) ([]byte, error) {
 		zap.String("method", method),
 		zap.String("path", path))
 
-	req, err := http.NewRequest(method, fmt.Sprintf("%s%s", c.BaseURL, path), body)
+	req, err := http.NewRequestWithContext(ctx, method, fmt.Sprintf("%s%s", c.BaseURL, path), body)
 	if err != nil {
 		c.Logger.Error("Failed to create request", zap.Error(err))
 		return nil, err
@@ -190,8 +195,8 @@ func (c *Client) CallAPI(method, path string, body io.Reader) ([]byte, error) {
 }
 
 // Helper function to make token requests
-func (c *Client) requestToken(data url.Values) (*TokenResponse, error) {
-	req, err := http.NewRequest("POST", fmt.Sprintf("%s/oauth/token", c.BaseURL), bytes.NewBufferString(data.Encode()))
+func (c *Client) requestToken(ctx context.Context, data url.Values) (*TokenResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/oauth/token", c.BaseURL), bytes.NewBufferString(data.Encode()))
 	if err != nil {
 		c.Logger.Error("Failed to create token request", zap.Error(err))
 		return nil, err
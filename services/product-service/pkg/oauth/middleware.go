@@ -3,12 +3,13 @@ package oauth
 import (
 	"errors"
 	"fmt"
-	"net/http"
 	"product-service/prometheus"
 	"strings"
 	"time"
 
 	"github.com/labstack/echo/v4"
+	gomicrodb "github.com/suteetoe/gomicro/database"
+	apperrors "github.com/suteetoe/gomicro/errors"
 	"go.uber.org/zap"
 )
 
@@ -22,20 +23,14 @@ func Middleware(client *Client, requiredScopes []string) echo.MiddlewareFunc {
 			authHeader := ctx.Request().Header.Get("Authorization")
 			if authHeader == "" {
 				prometheus.AuthErrorsCounter.Inc()
-				return ctx.JSON(http.StatusUnauthorized, map[string]string{
-					"error":             "missing_token",
-					"error_description": "Authorization header is required",
-				})
+				return apperrors.Unauthorized("Authorization header is required")
 			}
 
 			// Check if it's a Bearer token
 			parts := strings.Split(authHeader, " ")
 			if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
 				prometheus.AuthErrorsCounter.Inc()
-				return ctx.JSON(http.StatusUnauthorized, map[string]string{
-					"error":             "invalid_token",
-					"error_description": "Invalid authorization format, expected Bearer token",
-				})
+				return apperrors.Unauthorized("Invalid authorization format, expected Bearer token")
 			}
 
 			// Extract the token
@@ -48,14 +43,11 @@ func Middleware(client *Client, requiredScopes []string) echo.MiddlewareFunc {
 			}
 
 			// Validate token with OAuth service
-			validation, err := client.ValidateToken(token)
+			validation, err := client.ValidateToken(ctx.Request().Context(), token)
 			if err != nil {
 				logger.Warn("Token validation failed", zap.Error(err))
 				prometheus.AuthErrorsCounter.Inc()
-				return ctx.JSON(http.StatusUnauthorized, map[string]string{
-					"error":             "invalid_token",
-					"error_description": "The access token is invalid",
-				})
+				return apperrors.Unauthorized("The access token is invalid")
 			}
 
 			// Check if token is active
@@ -63,10 +55,7 @@ func Middleware(client *Client, requiredScopes []string) echo.MiddlewareFunc {
 				logger.Warn("Token is inactive",
 					zap.String("client_id", validation.ClientID))
 				prometheus.AuthErrorsCounter.Inc()
-				return ctx.JSON(http.StatusUnauthorized, map[string]string{
-					"error":             "invalid_token",
-					"error_description": "The token is inactive or expired",
-				})
+				return apperrors.Unauthorized("The token is inactive or expired")
 			}
 
 			// Validate scopes if required
@@ -76,10 +65,7 @@ func Middleware(client *Client, requiredScopes []string) echo.MiddlewareFunc {
 						zap.String("required", strings.Join(requiredScopes, " ")),
 						zap.String("provided", validation.Scope))
 					prometheus.AuthErrorsCounter.Inc()
-					return ctx.JSON(http.StatusForbidden, map[string]string{
-						"error":             "insufficient_scope",
-						"error_description": fmt.Sprintf("The token does not have the required scope: %s", strings.Join(requiredScopes, " ")),
-					})
+					return apperrors.Forbidden("The token does not have the required scope").With("required_scope", strings.Join(requiredScopes, " "))
 				}
 			}
 
@@ -95,6 +81,8 @@ func Middleware(client *Client, requiredScopes []string) echo.MiddlewareFunc {
 
 			if validation.TenantID != 0 {
 				ctx.Set("tenant_id", validation.TenantID)
+				// Scope database statements of the request to the tenant
+				ctx.SetRequest(ctx.Request().WithContext(gomicrodb.WithTenant(ctx.Request().Context(), validation.TenantID)))
 			}
 
 			ctx.Set("token_scopes", validation.Scope)
@@ -2,16 +2,14 @@ package prometheus
 
 import (
 	"product-service/pkg/config"
-	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
 var (
 	// HTTP request metrics
-	HttpRequestsTotal   prometheus.CounterVec
-	HttpRequestDuration prometheus.HistogramVec
+	HttpRequestsTotal   *prometheus.CounterVec
+	HttpRequestDuration *prometheus.HistogramVec
 
 	// Authentication metrics
 	AuthAttemptsCounter   prometheus.Counter
@@ -23,28 +21,28 @@ var (
 	TenantContextMissingCounter prometheus.Counter
 
 	// Database operation metrics
-	DbOperationDuration prometheus.HistogramVec
 
 	// Product metrics
-	ProductOperationsCounter prometheus.CounterVec
+	ProductOperationsCounter *prometheus.CounterVec
 
 	// Category metrics
-	CategoryOperationsCounter prometheus.CounterVec
+	CategoryOperationsCounter *prometheus.CounterVec
 
 	// Inventory metrics
-	ProductInventoryGauge prometheus.GaugeVec
+	ProductInventoryGauge *prometheus.GaugeVec
 
 	// Product popularity metrics
-	ProductViewsCounter prometheus.CounterVec
+	ProductViewsCounter *prometheus.CounterVec
 )
 
-// InitMetrics initializes Prometheus metrics with configuration
-func InitMetrics(config *config.Config) {
+// InitMetrics creates the service metrics and registers them on registerer, the registry of the
+// service's HTTP metrics
+func InitMetrics(config *config.Config, registerer prometheus.Registerer) error {
 	// Use metric prefix from configuration
 	prefix := config.Metrics.Prefix
 
 	// HTTP request metrics
-	HttpRequestsTotal = *promauto.NewCounterVec(
+	HttpRequestsTotal = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: prefix + "_http_requests_total",
 			Help: "Total number of HTTP requests",
@@ -53,7 +51,7 @@ func InitMetrics(config *config.Config) {
 	)
 
 	// HTTP request duration
-	HttpRequestDuration = *promauto.NewHistogramVec(
+	HttpRequestDuration = prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Name:    prefix + "_http_request_duration_seconds",
 			Help:    "Duration of HTTP requests in seconds",
@@ -63,21 +61,21 @@ func InitMetrics(config *config.Config) {
 	)
 
 	// Authentication metrics
-	AuthAttemptsCounter = promauto.NewCounter(
+	AuthAttemptsCounter = prometheus.NewCounter(
 		prometheus.CounterOpts{
 			Name: prefix + "_auth_attempts_total",
 			Help: "Total number of authentication attempts",
 		},
 	)
 
-	AuthSuccessCounter = promauto.NewCounter(
+	AuthSuccessCounter = prometheus.NewCounter(
 		prometheus.CounterOpts{
 			Name: prefix + "_auth_success_total",
 			Help: "Total number of successful authentications",
 		},
 	)
 
-	AuthErrorsCounter = promauto.NewCounter(
+	AuthErrorsCounter = prometheus.NewCounter(
 		prometheus.CounterOpts{
 			Name: prefix + "_auth_errors_total",
 			Help: "Total number of authentication errors",
@@ -85,7 +83,7 @@ func InitMetrics(config *config.Config) {
 	)
 
 	// Add the missing AuthDurationHistogram
-	AuthDurationHistogram = promauto.NewHistogram(
+	AuthDurationHistogram = prometheus.NewHistogram(
 		prometheus.HistogramOpts{
 			Name:    prefix + "_auth_duration_seconds",
 			Help:    "Duration of authentication operations in seconds",
@@ -94,25 +92,15 @@ func InitMetrics(config *config.Config) {
 	)
 
 	// Tenant context metrics
-	TenantContextMissingCounter = promauto.NewCounter(
+	TenantContextMissingCounter = prometheus.NewCounter(
 		prometheus.CounterOpts{
 			Name: prefix + "_tenant_context_missing_total",
 			Help: "Total number of requests without tenant context",
 		},
 	)
 
-	// Database operation metrics
-	DbOperationDuration = *promauto.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Name:    prefix + "_db_operation_duration_seconds",
-			Help:    "Duration of database operations in seconds",
-			Buckets: prometheus.DefBuckets,
-		},
-		[]string{"operation_type"},
-	)
-
 	// Product metrics
-	ProductOperationsCounter = *promauto.NewCounterVec(
+	ProductOperationsCounter = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: prefix + "_operations_total",
 			Help: "Total number of product operations",
@@ -121,7 +109,7 @@ func InitMetrics(config *config.Config) {
 	)
 
 	// Category metrics
-	CategoryOperationsCounter = *promauto.NewCounterVec(
+	CategoryOperationsCounter = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: prefix + "_category_operations_total",
 			Help: "Total number of category operations",
@@ -130,7 +118,7 @@ func InitMetrics(config *config.Config) {
 	)
 
 	// Product inventory metrics
-	ProductInventoryGauge = *promauto.NewGaugeVec(
+	ProductInventoryGauge = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: prefix + "_product_inventory",
 			Help: "Current inventory level for products",
@@ -139,21 +127,32 @@ func InitMetrics(config *config.Config) {
 	)
 
 	// Product popularity metrics
-	ProductViewsCounter = *promauto.NewCounterVec(
+	ProductViewsCounter = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: prefix + "_product_views_total",
 			Help: "Total number of product views",
 		},
 		[]string{"product_id", "category"},
 	)
-}
 
-// TrackDBOperation returns a function that records the duration of a database operation
-func TrackDBOperation(operationType string) func(startTime time.Time) {
-	return func(startTime time.Time) {
-		duration := time.Since(startTime).Seconds()
-		DbOperationDuration.WithLabelValues(operationType).Observe(duration)
+	for _, collector := range []prometheus.Collector{
+		HttpRequestsTotal,
+		HttpRequestDuration,
+		AuthAttemptsCounter,
+		AuthSuccessCounter,
+		AuthErrorsCounter,
+		AuthDurationHistogram,
+		TenantContextMissingCounter,
+		ProductOperationsCounter,
+		CategoryOperationsCounter,
+		ProductInventoryGauge,
+		ProductViewsCounter,
+	} {
+		if err := registerer.Register(collector); err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
 // RecordProductOperation increments the counter for product operations
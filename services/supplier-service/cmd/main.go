@@ -1,19 +1,33 @@
 package main
 
 import (
-	"time"
+	"context"
+	"os"
 
 	"supplier-service/internal/handler"
 	"supplier-service/internal/middleware"
+	"supplier-service/internal/migrations"
 	"supplier-service/pkg/config"
 	"supplier-service/pkg/database"
 	"supplier-service/pkg/jwtutil"
 	"supplier-service/pkg/logger"
 	"supplier-service/prometheus"
 
-	"github.com/labstack/echo/v4"
 	echomiddleware "github.com/labstack/echo/v4/middleware"
+	"github.com/suteetoe/gomicro/audit"
+	gomicroconfig "github.com/suteetoe/gomicro/config"
+	gomicrodb "github.com/suteetoe/gomicro/database"
+	"github.com/suteetoe/gomicro/health"
+	"github.com/suteetoe/gomicro/idempotency"
+	gomicrojwt "github.com/suteetoe/gomicro/jwtutil"
+	gomicrologger "github.com/suteetoe/gomicro/logger"
 	"github.com/suteetoe/gomicro/metrics" // Import the gomicro metrics package
+	gomicromw "github.com/suteetoe/gomicro/middleware"
+	"github.com/suteetoe/gomicro/migrate"
+	"github.com/suteetoe/gomicro/outbox"
+	"github.com/suteetoe/gomicro/ratelimit"
+	"github.com/suteetoe/gomicro/server"
+	"github.com/suteetoe/gomicro/tracing"
 	"go.uber.org/zap"
 )
 
@@ -29,100 +43,195 @@ func main() {
 	log := logger.GetLogger()
 	log.Info("Starting supplier service...", zap.String("environment", cfg.Server.Env))
 
+	// Initialize distributed tracing
+	if err := tracing.InitTracer(context.Background(), &tracing.TracingConfig{
+		ServiceName: "supplier-service",
+		Environment: cfg.Server.Env,
+		Enabled:     cfg.Tracing.Enabled,
+		Endpoint:    cfg.Tracing.Endpoint,
+		Insecure:    cfg.Tracing.Insecure,
+		SampleRatio: cfg.Tracing.SampleRatio,
+	}); err != nil {
+		log.Fatal("Failed to initialize tracing", zap.Error(err))
+	}
+	log.Info("Tracing initialized", zap.Bool("enabled", cfg.Tracing.Enabled))
+
 	// Initialize JWT utilities
 	jwtutil.Initialize(&cfg.JWT)
 	log.Info("JWT utilities initialized")
 
-	// Initialize Prometheus metrics
-	prometheus.InitMetrics(cfg)
-	log.Info("Prometheus metrics initialized")
-
-	// Initialize HTTP metrics from gomicro
-	httpMetrics := metrics.NewHTTPMetrics("supplier-service")
+	// Initialize HTTP metrics from gomicro on a registry of the service, which /metrics serves
+	httpMetrics, err := metrics.NewHTTPMetrics("supplier-service", metrics.WithRegistry(metrics.NewRegistry()))
+	if err != nil {
+		log.Fatal("Failed to initialize HTTP metrics", zap.Error(err))
+	}
 	log.Info("gomicro HTTP metrics initialized")
 
+	// Initialize Prometheus metrics of the service on the same registry
+	if err := prometheus.InitMetrics(cfg, httpMetrics.Registerer()); err != nil {
+		log.Fatal("Failed to initialize Prometheus metrics", zap.Error(err))
+	}
+	log.Info("Prometheus metrics initialized")
+
 	// Initialize database and run migrations
-	if err := database.InitDB(cfg); err != nil {
+	if err := database.InitDB(cfg, httpMetrics.Registerer()); err != nil {
 		log.Fatal("Failed to initialize database", zap.Error(err))
 	}
-	log.Info("Database connection established and migrations completed", zap.String("db_host", cfg.DB.Host), zap.String("db_name", cfg.DB.DBName))
-
-	// Create Echo instance
-	e := echo.New()
-
-	// Middleware
-	e.Use(echomiddleware.Recover())
-	e.Use(echomiddleware.CORS())
-	e.Use(middleware.RequestIDMiddleware)
-	e.Use(httpMetrics.Middleware()) // Add gomicro metrics middleware
-
-	// Request logging middleware
-	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
-		return func(c echo.Context) error {
-			start := time.Now()
-
-			// Process request
-			err := next(c)
-
-			// Calculate duration
-			duration := time.Since(start).Seconds()
-			status := c.Response().Status
-
-			// Log request details
-			log := logger.FromContext(c)
-			log.Info("HTTP Request",
-				zap.String("method", c.Request().Method),
-				zap.String("path", c.Request().URL.Path),
-				zap.Int("status", status),
-				zap.Float64("duration_s", duration),
-				zap.String("ip", c.RealIP()),
-			)
-
-			// Update legacy Prometheus metrics for backward compatibility
-			// (gomicro metrics middleware now handles the standardized metrics)
-			prometheus.HttpRequestsTotal.WithLabelValues(
-				c.Request().Method,
-				c.Request().URL.Path,
-				string(rune(status)),
-			).Inc()
-
-			prometheus.HttpRequestDuration.WithLabelValues(
-				c.Request().Method,
-				c.Request().URL.Path,
-				string(rune(status)),
-			).Observe(duration)
-
-			return err
+	log.Info("Database connection established", zap.String("db_host", cfg.DB.Host), zap.String("db_name", cfg.DB.DBName))
+
+	// Apply changes to the config file and rotated secrets, such as DB_PASSWORD, without a restart
+	watcher := gomicroconfig.NewWatcher(cfg, log)
+	watcher.Subscribe("logger", gomicrologger.ApplyConfig)
+	watcher.Subscribe("database", gomicrodb.ApplyConfig)
+	watcher.Subscribe("jwt", jwtutil.ApplyConfig)
+	defer watcher.Start(gomicroconfig.DefaultWatchInterval)()
+
+	// Apply schema migrations; `supplier-service migrate <command>` runs a single migrate command and exits
+	migrator, err := migrate.New(database.GetDB(), "supplier-service", migrations.All(), migrate.WithLogger(logger.Component("migrate")),
+		migrate.WithTenantRLS(cfg.DB.TenantRLS, migrations.TenantTables...))
+	if err != nil {
+		log.Fatal("Invalid migrations", zap.Error(err))
+	}
+	if ran, err := migrate.Command(context.Background(), migrator, os.Args[1:], os.Stdout); ran {
+		if err != nil {
+			log.Fatal("Migrate command failed", zap.Error(err))
+		}
+		return
+	}
+	if cfg.DB.MigrateOnStart {
+		if _, err := migrator.Up(context.Background()); err != nil {
+			log.Fatal("Failed to apply migrations", zap.Error(err))
+		}
+	}
+	if cfg.DB.TenantRLS {
+		// Refuse to serve tenants when Postgres would not enforce the policies
+		if err := gomicrodb.VerifyRLS(context.Background(), database.GetDB(), migrations.TenantTables...); err != nil {
+			log.Fatal("Row level security is not enforced", zap.Error(err))
 		}
-	})
+	}
 
-	// Routes
-	// Public routes that don't require authentication
-	e.GET("/", handler.Hello)
-	e.GET("/health", handler.Hello)
+	// Reject tokens revoked by authen-service, e.g. on logout
+	denylist, err := gomicrojwt.NewDenylist(cfg.JWT.Denylist, database.GetDB())
+	if err != nil {
+		log.Fatal("Invalid JWT denylist", zap.Error(err))
+	}
+	jwtutil.InitDenylist(denylist)
 
-	// Prometheus metrics endpoint
-	e.GET("/metrics", echo.WrapHandler(metrics.GetPrometheusHandler())) // Use gomicro metrics handler
+	// Initialize the audit log
+	handler.InitAudit(audit.NewRecorder(database.GetDB(), "supplier-service"))
 
-	// API routes that require authentication
-	api := e.Group("/api")
-	api.Use(middleware.AuthMiddleware)
+	// Authorize tenant roles against the role to permission policy (AUTHZ_POLICY_PATH)
+	policy, err := gomicromw.LoadPolicy(cfg.Authz.PolicyPath)
+	if err != nil {
+		log.Fatal("Failed to load authorization policy", zap.Error(err))
+	}
+	authz, err := gomicromw.NewAuthorizer("supplier-service", policy, gomicromw.RoleFromContext("role"),
+		gomicromw.WithAuthorizerRegisterer(httpMetrics.Registerer()))
+	if err != nil {
+		log.Fatal("Failed to initialize authorization", zap.Error(err))
+	}
 
-	// Supplier endpoints with tenant context requirement
-	suppliers := api.Group("/suppliers")
-	suppliers.Use(middleware.RequireTenantContext)
+	// Throttle the API requests of each tenant (RATE_LIMIT_STORE, RATE_LIMIT_API)
+	apiLimit, err := ratelimit.APIRule(cfg)
+	if err != nil {
+		log.Fatal("Invalid rate limit", zap.Error(err))
+	}
+	limitStore, err := ratelimit.NewStore(cfg.RateLimit.Store, database.GetDB())
+	if err != nil {
+		log.Fatal("Invalid rate limit store", zap.Error(err))
+	}
+	limiter, err := ratelimit.NewLimiter("supplier-service", limitStore, ratelimit.WithRegisterer(httpMetrics.Registerer()))
+	if err != nil {
+		log.Fatal("Failed to initialize rate limiting", zap.Error(err))
+	}
 
-	// Register supplier routes
-	suppliers.POST("", handler.CreateSupplier)
-	suppliers.GET("", handler.ListSuppliers)
-	suppliers.GET("/:id", handler.GetSupplier)
-	suppliers.PUT("/:id", handler.UpdateSupplier)
-	suppliers.DELETE("/:id", handler.DeleteSupplier)
+	// Replay the responses of POST and PATCH requests retried with an Idempotency-Key
+	idempotencyStore, err := idempotency.NewStore(cfg.Idempotency.Store, database.GetDB())
+	if err != nil {
+		log.Fatal("Invalid idempotency store", zap.Error(err))
+	}
+	idempotent, err := idempotency.New("supplier-service", idempotencyStore, idempotency.WithTTL(cfg.Idempotency.TTL),
+		idempotency.WithRegisterer(httpMetrics.Registerer()))
+	if err != nil {
+		log.Fatal("Failed to initialize idempotency keys", zap.Error(err))
+	}
+
+	// Apply changed rate limit rules, idempotency TTL without a restart
+	watcher.Subscribe("rate_limit", limiter.ApplyConfig(ratelimit.Limits{"api": ratelimit.APIRule}))
+	watcher.Subscribe("idempotency", idempotent.ApplyConfig)
+
+	// Write domain events to the outbox; the relay publishes them while the server runs
+	handler.InitEvents(outbox.NewWriter("supplier-service"))
+	var relayOutbox func(context.Context)
+	if cfg.Outbox.Publisher != outbox.PublisherNone {
+		publisher, err := outbox.NewPublisher(cfg.Outbox.Publisher, database.GetDB(), cfg.Outbox.Channel)
+		if err != nil {
+			log.Fatal("Invalid outbox publisher", zap.Error(err))
+		}
+		relay, err := outbox.NewRelay(database.GetDB(), "supplier-service", publisher,
+			outbox.WithPollInterval(cfg.Outbox.PollInterval),
+			outbox.WithLogger(logger.Component("outbox")))
+		if err != nil {
+			log.Fatal("Failed to create outbox relay", zap.Error(err))
+		}
+		relayOutbox = relay.Run
+	}
+
+	// Report ready while the database answers and the schema is migrated (/livez, /readyz)
+	checks, err := health.New("supplier-service", health.WithLogger(log), health.WithRegisterer(httpMetrics.Registerer()))
+	if err != nil {
+		log.Fatal("Failed to initialize health checks", zap.Error(err))
+	}
+	checks.AddReadiness("database", health.Database(database.GetDB()))
+	checks.AddReadiness("migrations", health.Migrations(migrator))
+
+	// Build the HTTP server; it shuts down gracefully on SIGTERM
+	srv := server.New("supplier-service",
+		server.WithLogger(log),
+		server.WithDatabase(database.GetDB()),
+		server.WithMetrics(httpMetrics),
+		server.WithHealth(checks),
+		server.WithLogLevels(cfg.Log.AdminToken, cfg.Log.LevelFile),
+		server.WithMiddleware(
+			echomiddleware.CORS(),
+			middleware.MetricsMiddleware, // Keep existing metrics middleware for backward compatibility
+		),
+		server.WithAuth(middleware.AuthMiddleware),
+		server.WithWorker("outbox relay", relayOutbox),
+		server.WithRoutes(func(r *server.Router) {
+			// Public routes that don't require authentication
+			r.GET("/", handler.Hello)
+
+			// API routes that require authentication
+			api := r.Secure("/api")
+			api.Use(limiter.Middleware("api", apiLimit, ratelimit.FirstKey(ratelimit.KeyByTenant(), ratelimit.KeyByUser())))
+
+			// Supplier endpoints with tenant context requirement
+			suppliers := api.Group("/suppliers")
+			suppliers.Use(middleware.RequireTenantContext)
+			suppliers.Use(idempotent.Middleware())
+
+			// In RLS mode each request runs in a transaction bound to its tenant
+			if cfg.DB.TenantRLS {
+				suppliers.Use(gomicromw.TenantTransaction(database.GetDB()))
+			}
+
+			// Register supplier routes
+			suppliers.POST("", handler.CreateSupplier, authz.RequirePermission("supplier:create"))
+			suppliers.GET("", handler.ListSuppliers, authz.RequirePermission("supplier:read"))
+			suppliers.GET("/:id", handler.GetSupplier, authz.RequirePermission("supplier:read"))
+			suppliers.PUT("/:id", handler.UpdateSupplier, authz.RequirePermission("supplier:update"))
+			suppliers.DELETE("/:id", handler.DeleteSupplier, authz.RequirePermission("supplier:delete"))
+
+			// Audit history of the current tenant - tenant owners only
+			auditEvents := api.Group("/audit-events")
+			auditEvents.Use(middleware.RequireTenantContext)
+			auditEvents.GET("", handler.GetAuditEvents)
+		}),
+	)
 
 	// Start server
-	port := cfg.Server.Port
-	log.Info("Starting server", zap.String("port", port))
-	if err := e.Start(":" + port); err != nil {
-		log.Fatal("Failed to start server", zap.Error(err))
+	if err := srv.Run(context.Background(), ":"+cfg.Server.Port); err != nil {
+		log.Fatal("Server error", zap.Error(err))
 	}
 }
@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"strconv"
+	"supplier-service/internal/model"
+	"time"
+
+	"github.com/suteetoe/gomicro/outbox"
+	"gorm.io/gorm"
+)
+
+// events writes domain events to the outbox; nil until InitEvents is called
+var events *outbox.Writer
+
+// InitEvents sets the outbox writer used by the handlers
+func InitEvents(writer *outbox.Writer) {
+	events = writer
+}
+
+// publishEvent adds a domain event to the outbox in tx, the transaction of the change it describes
+func publishEvent(tx *gorm.DB, topic, key string, payload interface{}) error {
+	if events == nil {
+		return nil
+	}
+	return events.Write(tx, outbox.Event{Topic: topic, Key: key, Payload: payload})
+}
+
+// SupplierCreated is the payload of supplier.created events. It carries no contact details or
+// tax ID: NOTIFY payloads reach every listener of the channel, so consumers needing them read
+// the supplier from the API.
+type SupplierCreated struct {
+	SupplierID uint      `json:"supplier_id"`
+	TenantID   uint      `json:"tenant_id"`
+	Name       string    `json:"name"`
+	Code       string    `json:"code"`
+	IsActive   bool      `json:"is_active"`
+	CreatedBy  uint      `json:"created_by"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// publishSupplierCreated adds a supplier.created event for supplier
+func publishSupplierCreated(tx *gorm.DB, supplier model.Supplier) error {
+	return publishEvent(tx, "supplier.created", strconv.FormatUint(uint64(supplier.ID), 10), SupplierCreated{
+		SupplierID: supplier.ID,
+		TenantID:   supplier.TenantID,
+		Name:       supplier.Name,
+		Code:       supplier.Code,
+		IsActive:   supplier.IsActive,
+		CreatedBy:  supplier.CreatedBy,
+		CreatedAt:  supplier.CreatedAt,
+	})
+}
@@ -1,9 +1,9 @@
 package handler
 
 import (
+	"context"
 	"net/http"
 	"strconv"
-	"time"
 
 	"supplier-service/internal/model"
 	"supplier-service/pkg/database"
@@ -11,26 +11,30 @@ import (
 	"supplier-service/prometheus"
 
 	"github.com/labstack/echo/v4"
+	"github.com/suteetoe/gomicro/audit"
+	gomicrodb "github.com/suteetoe/gomicro/database"
+	apperrors "github.com/suteetoe/gomicro/errors"
 	"go.uber.org/zap"
+	"gorm.io/gorm"
 )
 
 // SupplierRequest defines the structure for supplier creation/update requests
 type SupplierRequest struct {
-	Name          string `json:"name" validate:"required"`
-	Code          string `json:"code" validate:"required"`
-	ContactPerson string `json:"contact_person"`
-	Email         string `json:"email"`
-	Phone         string `json:"phone"`
+	Name          string `json:"name" validate:"required,max=100"`
+	Code          string `json:"code" validate:"required,max=50"`
+	ContactPerson string `json:"contact_person" validate:"max=100"`
+	Email         string `json:"email" validate:"omitempty,email,max=100"`
+	Phone         string `json:"phone" validate:"omitempty,phone"`
 	Address       string `json:"address"`
-	City          string `json:"city"`
-	State         string `json:"state"`
-	Country       string `json:"country"`
-	PostalCode    string `json:"postal_code"`
-	TaxID         string `json:"tax_id"`
-	PaymentTerms  string `json:"payment_terms"`
+	City          string `json:"city" validate:"max=50"`
+	State         string `json:"state" validate:"max=50"`
+	Country       string `json:"country" validate:"max=50"`
+	PostalCode    string `json:"postal_code" validate:"max=20"`
+	TaxID         string `json:"tax_id" validate:"omitempty,tax_id"`
+	PaymentTerms  string `json:"payment_terms" validate:"max=100"`
 	Notes         string `json:"notes"`
 	IsActive      bool   `json:"is_active"`
-	Rating        int    `json:"rating"`
+	Rating        int    `json:"rating" validate:"gte=0,lte=5"`
 	TenantID      uint   `json:"tenant_id" validate:"required"`
 }
 
@@ -43,18 +47,14 @@ func CreateSupplier(c echo.Context) error {
 	var req SupplierRequest
 	if err := c.Bind(&req); err != nil {
 		log.Error("Invalid request data", zap.Error(err))
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "Invalid request data",
-		})
+		return apperrors.BadRequest("Invalid request data")
 	}
 
 	// Get user ID from context (set by AuthMiddleware)
 	userID, ok := c.Get("user_id").(uint)
 	if !ok {
 		log.Error("Failed to get user ID from context")
-		return c.JSON(http.StatusUnauthorized, echo.Map{
-			"error": "authentication required",
-		})
+		return apperrors.Unauthorized("authentication required")
 	}
 
 	// Extract tenant ID from context (set by auth middleware)
@@ -62,15 +62,18 @@ func CreateSupplier(c echo.Context) error {
 	if !ok {
 		log.Warn("Missing tenant_id in context")
 		prometheus.TenantContextMissingCounter.Inc()
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "tenant_id is required",
-		})
+		return apperrors.BadRequest("tenant_id is required")
 	}
 
 	// Override the tenant ID in the request with the one from the JWT token
 	// This ensures users can't create suppliers for other tenants
 	req.TenantID = tenantID
 
+	if err := c.Validate(&req); err != nil {
+		log.Warn("Invalid supplier request", zap.Error(err))
+		return err
+	}
+
 	log.Info("Supplier creation request",
 		zap.String("name", req.Name),
 		zap.String("code", req.Code),
@@ -78,16 +81,14 @@ func CreateSupplier(c echo.Context) error {
 
 	// Check if supplier with same code exists in the same tenant
 	var count int64
-	database.GetDB().Model(&model.Supplier{}).
-		Where("code = ? AND tenant_id = ?", req.Code, req.TenantID).
+	database.GetDB().WithContext(c.Request().Context()).Model(&model.Supplier{}).
+		Where("code = ?", req.Code).
 		Count(&count)
 	if count > 0 {
 		log.Warn("Supplier with this code already exists for this tenant",
 			zap.String("code", req.Code),
 			zap.Uint("tenant_id", req.TenantID))
-		return c.JSON(http.StatusConflict, echo.Map{
-			"error": "Supplier with this code already exists for this tenant",
-		})
+		return apperrors.Conflict("Supplier with this code already exists for this tenant")
 	}
 
 	// Create the supplier
@@ -112,19 +113,20 @@ func CreateSupplier(c echo.Context) error {
 		UpdatedBy:     userID,
 	}
 
-	// Track DB operations
-	defer prometheus.TrackDBOperation("insert")(time.Now())
-
-	result := database.GetDB().Create(&supplier)
-	if result.Error != nil {
+	// Create the supplier and its supplier.created event in one transaction
+	err := gomicrodb.Transaction(c.Request().Context(), database.GetDB(), func(tx *gorm.DB) error {
+		if err := tx.Create(&supplier).Error; err != nil {
+			return err
+		}
+		return publishSupplierCreated(tx, supplier)
+	})
+	if err != nil {
 		log.Error("Failed to create supplier",
 			zap.String("name", req.Name),
 			zap.String("code", req.Code),
 			zap.Uint("tenant_id", req.TenantID),
-			zap.Error(result.Error))
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": "Failed to create supplier",
-		})
+			zap.Error(err))
+		return apperrors.Internal("Failed to create supplier", err)
 	}
 
 	// Update supplier count metric
@@ -146,9 +148,7 @@ func GetSupplier(c echo.Context) error {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		log.Error("Invalid supplier ID", zap.Error(err))
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "Invalid supplier ID",
-		})
+		return apperrors.BadRequest("Invalid supplier ID")
 	}
 
 	// Extract tenant ID from context (set by auth middleware)
@@ -156,28 +156,21 @@ func GetSupplier(c echo.Context) error {
 	if !ok {
 		log.Warn("Missing tenant_id in context")
 		prometheus.TenantContextMissingCounter.Inc()
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "tenant_id is required",
-		})
+		return apperrors.BadRequest("tenant_id is required")
 	}
 
 	log.Info("Getting supplier by ID",
 		zap.Uint64("supplier_id", id),
 		zap.Uint("tenant_id", tenantID))
 
-	// Track DB operations
-	defer prometheus.TrackDBOperation("query")(time.Now())
-
 	var supplier model.Supplier
-	result := database.GetDB().Where("id = ? AND tenant_id = ?", id, tenantID).First(&supplier)
+	result := database.GetDB().WithContext(c.Request().Context()).Where("id = ?", id).First(&supplier)
 	if result.Error != nil {
 		log.Error("Supplier not found or does not belong to tenant",
 			zap.Uint64("supplier_id", id),
 			zap.Uint("tenant_id", tenantID),
 			zap.Error(result.Error))
-		return c.JSON(http.StatusNotFound, echo.Map{
-			"error": "Supplier not found",
-		})
+		return apperrors.NotFound("Supplier not found")
 	}
 
 	log.Info("Supplier retrieved successfully",
@@ -199,9 +192,7 @@ func ListSuppliers(c echo.Context) error {
 	if !ok {
 		log.Warn("Missing tenant_id in context")
 		prometheus.TenantContextMissingCounter.Inc()
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "tenant_id is required",
-		})
+		return apperrors.BadRequest("tenant_id is required")
 	}
 
 	// Parse query parameters for pagination
@@ -218,8 +209,8 @@ func ListSuppliers(c echo.Context) error {
 	offset := (page - 1) * limit
 
 	// Handle query parameters for filtering
-	db := database.GetDB()
-	query := db.Where("tenant_id = ?", tenantID)
+	db := database.GetDB().WithContext(c.Request().Context())
+	query := db
 	log.Info("Filtering suppliers by tenant", zap.Uint("tenant_id", tenantID))
 
 	// Filter by active status if specified
@@ -234,9 +225,6 @@ func ListSuppliers(c echo.Context) error {
 		}
 	}
 
-	// Track DB operations
-	defer prometheus.TrackDBOperation("query")(time.Now())
-
 	// Retrieve suppliers from database with pagination and filters
 	var suppliers []model.Supplier
 	result := query.
@@ -249,9 +237,7 @@ func ListSuppliers(c echo.Context) error {
 		log.Error("Failed to retrieve suppliers",
 			zap.Uint("tenant_id", tenantID),
 			zap.Error(result.Error))
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": "Failed to retrieve suppliers",
-		})
+		return apperrors.Internal("Failed to retrieve suppliers", result.Error)
 	}
 
 	// Count total suppliers for pagination info
@@ -282,9 +268,7 @@ func UpdateSupplier(c echo.Context) error {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		log.Error("Invalid supplier ID", zap.Error(err))
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "Invalid supplier ID",
-		})
+		return apperrors.BadRequest("Invalid supplier ID")
 	}
 
 	log.Info("Updating supplier", zap.Uint64("supplier_id", id))
@@ -294,18 +278,14 @@ func UpdateSupplier(c echo.Context) error {
 		log.Error("Invalid request data",
 			zap.Uint64("supplier_id", id),
 			zap.Error(err))
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "Invalid request data",
-		})
+		return apperrors.BadRequest("Invalid request data")
 	}
 
 	// Get user ID from context (set by AuthMiddleware)
 	userID, ok := c.Get("user_id").(uint)
 	if !ok {
 		log.Error("Failed to get user ID from context")
-		return c.JSON(http.StatusUnauthorized, echo.Map{
-			"error": "authentication required",
-		})
+		return apperrors.Unauthorized("authentication required")
 	}
 
 	// Extract tenant ID from context (set by auth middleware)
@@ -313,25 +293,26 @@ func UpdateSupplier(c echo.Context) error {
 	if !ok {
 		log.Warn("Missing tenant_id in context")
 		prometheus.TenantContextMissingCounter.Inc()
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "tenant_id is required",
-		})
+		return apperrors.BadRequest("tenant_id is required")
 	}
 
 	// Override the tenant ID in the request with the one from the JWT token
 	// This ensures users can't update suppliers for other tenants
 	req.TenantID = tenantID
 
+	if err := c.Validate(&req); err != nil {
+		log.Warn("Invalid supplier request", zap.Error(err))
+		return err
+	}
+
 	// Find existing supplier and validate tenant ownership
 	var supplier model.Supplier
-	result := database.GetDB().Where("id = ?", id).First(&supplier)
+	result := database.GetDB().WithContext(c.Request().Context()).Where("id = ?", id).First(&supplier)
 	if result.Error != nil {
 		log.Error("Supplier not found for update",
 			zap.Uint64("supplier_id", id),
 			zap.Error(result.Error))
-		return c.JSON(http.StatusNotFound, echo.Map{
-			"error": "Supplier not found",
-		})
+		return apperrors.NotFound("Supplier not found")
 	}
 
 	// Ensure supplier belongs to the tenant in JWT token
@@ -340,9 +321,7 @@ func UpdateSupplier(c echo.Context) error {
 			zap.Uint64("supplier_id", id),
 			zap.Uint("supplier_tenant", supplier.TenantID),
 			zap.Uint("request_tenant", tenantID))
-		return c.JSON(http.StatusForbidden, echo.Map{
-			"error": "You don't have permission to update this supplier",
-		})
+		return apperrors.Forbidden("You don't have permission to update this supplier")
 	}
 
 	oldCode := supplier.Code
@@ -355,23 +334,19 @@ func UpdateSupplier(c echo.Context) error {
 			zap.String("new_code", req.Code))
 
 		var count int64
-		database.GetDB().Model(&model.Supplier{}).
-			Where("code = ? AND id != ? AND tenant_id = ?", req.Code, id, tenantID).
+		database.GetDB().WithContext(c.Request().Context()).Model(&model.Supplier{}).
+			Where("code = ? AND id != ?", req.Code, id).
 			Count(&count)
 		if count > 0 {
 			log.Warn("Supplier with this code already exists for this tenant",
 				zap.String("code", req.Code),
 				zap.Uint("tenant_id", tenantID))
-			return c.JSON(http.StatusConflict, echo.Map{
-				"error": "Supplier with this code already exists for this tenant",
-			})
+			return apperrors.Conflict("Supplier with this code already exists for this tenant")
 		}
 	}
 
-	// Track DB operations
-	defer prometheus.TrackDBOperation("update")(time.Now())
-
 	// Update supplier fields
+	before := supplier
 	supplier.Name = req.Name
 	supplier.Code = req.Code
 	supplier.ContactPerson = req.ContactPerson
@@ -391,15 +366,15 @@ func UpdateSupplier(c echo.Context) error {
 	// TenantID remains unchanged - can't change tenant ownership
 
 	// Save changes
-	result = database.GetDB().Save(&supplier)
+	result = database.GetDB().WithContext(c.Request().Context()).Save(&supplier)
 	if result.Error != nil {
 		log.Error("Failed to update supplier",
 			zap.Uint64("supplier_id", id),
 			zap.Error(result.Error))
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": "Failed to update supplier",
-		})
+		return apperrors.Internal("Failed to update supplier", result.Error)
 	}
+	recordAudit(c, tenantID, "supplier.updated", "supplier",
+		strconv.FormatUint(id, 10), audit.Diff(before, supplier))
 
 	log.Info("Supplier updated successfully",
 		zap.Uint64("supplier_id", id),
@@ -418,9 +393,7 @@ func DeleteSupplier(c echo.Context) error {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		log.Error("Invalid supplier ID", zap.Error(err))
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "Invalid supplier ID",
-		})
+		return apperrors.BadRequest("Invalid supplier ID")
 	}
 
 	// Extract tenant ID from context (set by auth middleware)
@@ -428,9 +401,7 @@ func DeleteSupplier(c echo.Context) error {
 	if !ok {
 		log.Warn("Missing tenant_id in context")
 		prometheus.TenantContextMissingCounter.Inc()
-		return c.JSON(http.StatusBadRequest, echo.Map{
-			"error": "tenant_id is required",
-		})
+		return apperrors.BadRequest("tenant_id is required")
 	}
 
 	log.Info("Deleting supplier",
@@ -439,15 +410,13 @@ func DeleteSupplier(c echo.Context) error {
 
 	// Get supplier details before deleting and verify tenant ownership
 	var supplier model.Supplier
-	preResult := database.GetDB().Where("id = ? AND tenant_id = ?", id, tenantID).First(&supplier)
+	preResult := database.GetDB().WithContext(c.Request().Context()).Where("id = ?", id).First(&supplier)
 	if preResult.Error != nil {
 		log.Warn("Supplier not found or does not belong to tenant",
 			zap.Uint64("supplier_id", id),
 			zap.Uint("tenant_id", tenantID),
 			zap.Error(preResult.Error))
-		return c.JSON(http.StatusNotFound, echo.Map{
-			"error": "Supplier not found",
-		})
+		return apperrors.NotFound("Supplier not found")
 	}
 
 	log.Info("Found supplier to delete",
@@ -456,20 +425,17 @@ func DeleteSupplier(c echo.Context) error {
 		zap.String("code", supplier.Code),
 		zap.Uint("tenant_id", supplier.TenantID))
 
-	// Track DB operations
-	defer prometheus.TrackDBOperation("delete")(time.Now())
-
 	// Perform soft delete
-	result := database.GetDB().Delete(&supplier)
+	result := database.GetDB().WithContext(c.Request().Context()).Delete(&supplier)
 	if result.Error != nil {
 		log.Error("Failed to delete supplier",
 			zap.Uint64("supplier_id", id),
 			zap.Uint("tenant_id", supplier.TenantID),
 			zap.Error(result.Error))
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": "Failed to delete supplier",
-		})
+		return apperrors.Internal("Failed to delete supplier", result.Error)
 	}
+	recordAudit(c, tenantID, "supplier.deleted", "supplier",
+		strconv.FormatUint(id, 10), audit.Diff(supplier, nil))
 
 	// Update supplier count metric
 	go updateSupplierCount(tenantID)
@@ -485,30 +451,36 @@ func DeleteSupplier(c echo.Context) error {
 
 // Helper function to update supplier count metrics
 func updateSupplierCount(tenantID uint) {
-	// Get tenant name
-	var tenantName string
-	tenantResult := database.GetDB().Table("tenants").
-		Select("name").
-		Where("id = ?", tenantID).
-		Row()
-	tenantResult.Scan(&tenantName)
-
-	// Count active suppliers for the tenant
-	var count int64
-	database.GetDB().Model(&model.Supplier{}).
-		Where("tenant_id = ? AND is_active = ?", tenantID, true).
-		Count(&count)
+	// The metrics span every tenant, so this job runs outside the tenant scope. The transaction
+	// also lets it past the row level security policies in RLS mode.
+	ctx := gomicrodb.WithoutTenantScope(context.Background())
+	gomicrodb.TenantTransaction(ctx, database.GetDB(), func(db *gorm.DB) error {
+		// Get tenant name
+		var tenantName string
+		tenantResult := db.Table("tenants").
+			Select("name").
+			Where("id = ?", tenantID).
+			Row()
+		tenantResult.Scan(&tenantName)
+
+		// Count active suppliers for the tenant
+		var count int64
+		db.Model(&model.Supplier{}).
+			Where("tenant_id = ? AND is_active = ?", tenantID, true).
+			Count(&count)
 
-	// Update the metric
-	prometheus.UpdateSuppliersPerTenant(tenantID, tenantName, int(count))
+		// Update the metric
+		prometheus.UpdateSuppliersPerTenant(tenantID, tenantName, int(count))
 
-	// Count distinct tenants with active suppliers
-	var activeTenants int64
-	database.GetDB().Model(&model.Supplier{}).
-		Distinct("tenant_id").
-		Where("is_active = ?", true).
-		Count(&activeTenants)
+		// Count distinct tenants with active suppliers
+		var activeTenants int64
+		db.Model(&model.Supplier{}).
+			Distinct("tenant_id").
+			Where("is_active = ?", true).
+			Count(&activeTenants)
 
-	// Update active tenants metric
-	prometheus.UpdateActiveTenants(int(activeTenants))
+		// Update active tenants metric
+		prometheus.UpdateActiveTenants(int(activeTenants))
+		return nil
+	})
 }
@@ -1,13 +1,14 @@
 package middleware
 
 import (
-	"net/http"
 	"strings"
 	"supplier-service/pkg/jwtutil"
 	"supplier-service/pkg/logger"
 	"supplier-service/prometheus"
 
 	"github.com/labstack/echo/v4"
+	gomicrodb "github.com/suteetoe/gomicro/database"
+	apperrors "github.com/suteetoe/gomicro/errors"
 	"go.uber.org/zap"
 )
 
@@ -24,7 +25,7 @@ func AuthMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 		if tokenString == "" {
 			log.Warn("Missing authorization token")
 			prometheus.AuthErrorsCounter.Inc()
-			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "authentication required"})
+			return apperrors.Unauthorized("authentication required")
 		}
 
 		// Remove "Bearer " prefix if present
@@ -37,7 +38,7 @@ func AuthMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 		if err != nil {
 			log.Warn("Invalid token", zap.Error(err))
 			prometheus.AuthErrorsCounter.Inc()
-			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "invalid token"})
+			return apperrors.Unauthorized("invalid token")
 		}
 
 		// Increment successful auth counter
@@ -50,6 +51,8 @@ func AuthMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 		// If token has tenant context, store it in the context
 		if claims.TenantID != nil {
 			c.Set("tenant_id", *claims.TenantID)
+			// Scope database statements of the request to the tenant
+			c.SetRequest(c.Request().WithContext(gomicrodb.WithTenant(c.Request().Context(), *claims.TenantID)))
 			c.Set("tenant_name", claims.TenantName)
 			c.Set("role", claims.Role)
 
@@ -83,10 +86,7 @@ func RequireTenantContext(next echo.HandlerFunc) echo.HandlerFunc {
 		if !ok || tenantID == 0 {
 			log.Warn("Missing tenant context")
 			prometheus.TenantContextMissingCounter.Inc()
-			return c.JSON(http.StatusForbidden, echo.Map{
-				"error":   "tenant context required",
-				"message": "Please select a tenant before accessing this resource",
-			})
+			return apperrors.Forbidden("tenant context required, select a tenant before accessing this resource")
 		}
 
 		// Tenant context exists, proceed
@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"strconv"
+	"supplier-service/prometheus"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	apperrors "github.com/suteetoe/gomicro/errors"
+)
+
+// MetricsMiddleware records the legacy Prometheus metrics of HTTP requests
+func MetricsMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		start := time.Now()
+
+		// Process request
+		err := next(c)
+
+		duration := time.Since(start).Seconds()
+		code := c.Response().Status
+		if err != nil && !c.Response().Committed {
+			// The error handler has not written the response yet
+			code = apperrors.StatusCode(err)
+		}
+		method := c.Request().Method
+		path := c.Request().URL.Path
+		status := strconv.Itoa(code)
+
+		prometheus.HttpRequestsTotal.WithLabelValues(method, path, status).Inc()
+		prometheus.HttpRequestDuration.WithLabelValues(method, path, status).Observe(duration)
+
+		return err
+	}
+}
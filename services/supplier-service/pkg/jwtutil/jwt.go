@@ -1,15 +1,25 @@
 package jwtutil
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"supplier-service/pkg/config"
+	"sync/atomic"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	gomicrojwt "github.com/suteetoe/gomicro/jwtutil"
 )
 
-var jwtConfig *config.JWTConfig
+var (
+	// jwtConfig is replaced by ApplyConfig when the signing key rotates
+	jwtConfig atomic.Pointer[config.JWTConfig]
+	// keyResolver is set when tokens are verified against a JWKS
+	keyResolver gomicrojwt.KeyResolver
+	// denylist rejects tokens revoked by authen-service
+	denylist gomicrojwt.Denylist
+)
 
 // TenantClaims extends jwt.StandardClaims to include tenant information
 type TenantClaims struct {
@@ -23,7 +33,27 @@ type TenantClaims struct {
 
 // Initialize sets up the JWT utility with configuration
 func Initialize(config *config.JWTConfig) {
-	jwtConfig = config
+	jwtConfig.Store(config)
+	keyResolver = nil
+	if config.JWKSURL != "" {
+		keyResolver = gomicrojwt.NewJWKSClient(config.JWKSURL)
+	}
+}
+
+// ApplyConfig uses the JWT settings of a reloaded configuration, such as a rotated
+// JWT_SIGNING_KEY, for use with config.Watcher. A changed JWT_JWKS_URL takes a restart.
+func ApplyConfig(old, new *config.Config) error {
+	if jwtConfig.Load() == nil {
+		return errors.New("JWT configuration not initialized")
+	}
+	settings := new.JWT
+	jwtConfig.Store(&settings)
+	return nil
+}
+
+// InitDenylist makes ValidateToken reject revoked tokens
+func InitDenylist(list gomicrojwt.Denylist) {
+	denylist = list
 }
 
 // GenerateToken creates a new JWT token for a user
@@ -38,15 +68,19 @@ func GenerateTokenWithTenant(email string, userID uint, tenantID *uint, tenantNa
 
 // generateTokenWithClaims is a helper function that creates a token with the given claims
 func generateTokenWithClaims(email string, userID uint, tenantID *uint, tenantName, role string) (string, error) {
-	if jwtConfig == nil {
+	current := jwtConfig.Load()
+	if current == nil {
 		return "", errors.New("JWT configuration not initialized")
 	}
+	if keyResolver != nil {
+		return "", errors.New("tokens are issued by the JWKS owner")
+	}
 
 	// Get signing key from configuration
-	signingKey := jwtConfig.SigningKey
+	signingKey := current.SigningKey
 
 	// Token expiration time from configuration
-	expirationHours := jwtConfig.ExpirationHours
+	expirationHours := current.ExpirationHours
 
 	// Create the claims
 	claims := &TenantClaims{
@@ -70,18 +104,32 @@ func generateTokenWithClaims(email string, userID uint, tenantID *uint, tenantNa
 
 // ValidateToken validates the token and returns the claims
 func ValidateToken(tokenString string) (*TenantClaims, error) {
-	if jwtConfig == nil {
+	current := jwtConfig.Load()
+	if current == nil {
 		return nil, errors.New("JWT configuration not initialized")
 	}
 
 	// Get signing key from configuration
-	signingKey := jwtConfig.SigningKey
+	signingKey := current.SigningKey
 
 	// Parse the token
 	token, err := jwt.ParseWithClaims(
 		tokenString,
 		&TenantClaims{},
 		func(token *jwt.Token) (interface{}, error) {
+			// With a JWKS only the published keys are trusted, with the algorithm they declare
+			if keyResolver != nil {
+				kid, _ := token.Header["kid"].(string)
+				key, err := keyResolver.Key(context.Background(), kid)
+				if err != nil {
+					return nil, err
+				}
+				if token.Method.Alg() != key.Algorithm {
+					return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+				}
+				return key.Public, nil
+			}
+
 			// Validate the signing method
 			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
@@ -95,9 +143,24 @@ func ValidateToken(tokenString string) (*TenantClaims, error) {
 	}
 
 	// Validate the token and extract claims
-	if claims, ok := token.Claims.(*TenantClaims); ok && token.Valid {
-		return claims, nil
+	claims, ok := token.Claims.(*TenantClaims)
+	if !ok || !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+
+	if denylist != nil {
+		var issuedAt time.Time
+		if claims.IssuedAt != nil {
+			issuedAt = claims.IssuedAt.Time
+		}
+		revoked, err := denylist.Revoked(context.Background(), claims.ID, claims.UserID, issuedAt)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, gomicrojwt.ErrTokenRevoked
+		}
 	}
 
-	return nil, errors.New("invalid token")
+	return claims, nil
 }
@@ -3,59 +3,29 @@ package logger
 import (
 	"supplier-service/pkg/config"
 
+	gomicrologger "github.com/suteetoe/gomicro/logger"
 	"go.uber.org/zap"
-	"go.uber.org/zap/zapcore"
 )
 
 var log *zap.Logger
 
-// InitLogger initializes the logger with configuration
+// InitLogger initializes the logger with configuration. It is built on the gomicro logger, so
+// the global and component levels can be changed while the service runs (LOG_LEVEL_FILE,
+// /admin/log-level).
 func InitLogger(config *config.Config) {
-	// Get logger environment from config
-	env := config.Server.Env
-	logLevel := config.Log.Level
-
-	// Configure logger based on configured log level
-	var level zapcore.Level
-	switch logLevel {
-	case "debug":
-		level = zapcore.DebugLevel
-	case "info":
-		level = zapcore.InfoLevel
-	case "warn":
-		level = zapcore.WarnLevel
-	case "error":
-		level = zapcore.ErrorLevel
-	default:
-		level = zapcore.InfoLevel
-	}
-
-	var err error
-	if env == "production" {
-		// Production logger configuration
-		prodConfig := zap.NewProductionConfig()
-		prodConfig.Level = zap.NewAtomicLevelAt(level)
-		prodConfig.EncoderConfig.TimeKey = "timestamp"
-		prodConfig.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
-
-		log, err = prodConfig.Build(zap.Fields(
-			config.LogConfig()...,
-		))
-	} else {
-		// Development logger configuration with colors and human-friendly output
-		devConfig := zap.NewDevelopmentConfig()
-		devConfig.Level = zap.NewAtomicLevelAt(level)
-		devConfig.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
-
-		log, err = devConfig.Build(zap.Fields(
-			config.LogConfig()...,
-		))
-	}
-
+	err := gomicrologger.InitLogger(&gomicrologger.LogConfig{
+		Level:           config.Log.Level,
+		Environment:     config.Server.Env,
+		ServiceName:     config.ServiceName,
+		Sampling:        gomicrologger.NewSamplingConfig(config.Log.SamplingInitial, config.Log.SamplingThereafter),
+		RequestSampling: gomicrologger.NewSamplingConfig(config.Log.RequestSamplingInitial, config.Log.RequestSamplingThereafter),
+	})
 	if err != nil {
 		// Can't use the logger here, so using a panic
 		panic("failed to initialize logger: " + err.Error())
 	}
+	log = gomicrologger.GetLogger()
+	log.Info("Configuration loaded", zap.Any("config", config.Dump()))
 
 	// Replace the global logger
 	zap.ReplaceGlobals(log)
@@ -65,3 +35,8 @@ func InitLogger(config *config.Config) {
 func GetLogger() *zap.Logger {
 	return log
 }
+
+// Component returns a named logger whose level can be changed independently of the global level
+func Component(name string) *zap.Logger {
+	return gomicrologger.Component(name)
+}
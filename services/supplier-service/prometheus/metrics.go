@@ -2,16 +2,14 @@ package prometheus
 
 import (
 	"supplier-service/pkg/config"
-	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
 var (
 	// HTTP request metrics
-	HttpRequestsTotal   prometheus.CounterVec
-	HttpRequestDuration prometheus.HistogramVec
+	HttpRequestsTotal   *prometheus.CounterVec
+	HttpRequestDuration *prometheus.HistogramVec
 
 	// Authentication metrics
 	AuthAttemptsCounter prometheus.Counter
@@ -22,25 +20,25 @@ var (
 	TenantContextMissingCounter prometheus.Counter
 
 	// Database operation metrics
-	DbOperationDuration prometheus.HistogramVec
 
 	// Supplier metrics
-	SupplierOperationsCounter prometheus.CounterVec
+	SupplierOperationsCounter *prometheus.CounterVec
 
 	// Tenant specific metrics
-	SuppliersPerTenantGauge prometheus.GaugeVec
+	SuppliersPerTenantGauge *prometheus.GaugeVec
 
 	// Active tenants using the supplier service
 	ActiveTenantsGauge prometheus.Gauge
 )
 
-// InitMetrics initializes Prometheus metrics with configuration
-func InitMetrics(config *config.Config) {
+// InitMetrics creates the service metrics and registers them on registerer, the registry of the
+// service's HTTP metrics
+func InitMetrics(config *config.Config, registerer prometheus.Registerer) error {
 	// Use metric prefix from configuration
 	prefix := config.Metrics.Prefix
 
 	// HTTP request metrics
-	HttpRequestsTotal = *promauto.NewCounterVec(
+	HttpRequestsTotal = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: prefix + "_http_requests_total",
 			Help: "Total number of HTTP requests",
@@ -49,7 +47,7 @@ func InitMetrics(config *config.Config) {
 	)
 
 	// HTTP request duration
-	HttpRequestDuration = *promauto.NewHistogramVec(
+	HttpRequestDuration = prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Name:    prefix + "_http_request_duration_seconds",
 			Help:    "Duration of HTTP requests in seconds",
@@ -59,21 +57,21 @@ func InitMetrics(config *config.Config) {
 	)
 
 	// Authentication metrics
-	AuthAttemptsCounter = promauto.NewCounter(
+	AuthAttemptsCounter = prometheus.NewCounter(
 		prometheus.CounterOpts{
 			Name: prefix + "_auth_attempts_total",
 			Help: "Total number of authentication attempts",
 		},
 	)
 
-	AuthSuccessCounter = promauto.NewCounter(
+	AuthSuccessCounter = prometheus.NewCounter(
 		prometheus.CounterOpts{
 			Name: prefix + "_auth_success_total",
 			Help: "Total number of successful authentications",
 		},
 	)
 
-	AuthErrorsCounter = promauto.NewCounter(
+	AuthErrorsCounter = prometheus.NewCounter(
 		prometheus.CounterOpts{
 			Name: prefix + "_auth_errors_total",
 			Help: "Total number of authentication errors",
@@ -81,25 +79,15 @@ func InitMetrics(config *config.Config) {
 	)
 
 	// Tenant context metrics
-	TenantContextMissingCounter = promauto.NewCounter(
+	TenantContextMissingCounter = prometheus.NewCounter(
 		prometheus.CounterOpts{
 			Name: prefix + "_tenant_context_missing_total",
 			Help: "Total number of requests without tenant context",
 		},
 	)
 
-	// Database operation metrics
-	DbOperationDuration = *promauto.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Name:    prefix + "_db_operation_duration_seconds",
-			Help:    "Duration of database operations in seconds",
-			Buckets: prometheus.DefBuckets,
-		},
-		[]string{"operation_type"},
-	)
-
 	// Supplier metrics
-	SupplierOperationsCounter = *promauto.NewCounterVec(
+	SupplierOperationsCounter = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: prefix + "_operations_total",
 			Help: "Total number of supplier operations",
@@ -108,7 +96,7 @@ func InitMetrics(config *config.Config) {
 	)
 
 	// Tenant specific metrics
-	SuppliersPerTenantGauge = *promauto.NewGaugeVec(
+	SuppliersPerTenantGauge = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: prefix + "_suppliers_per_tenant",
 			Help: "Number of suppliers per tenant",
@@ -117,20 +105,29 @@ func InitMetrics(config *config.Config) {
 	)
 
 	// Active tenants using the supplier service
-	ActiveTenantsGauge = promauto.NewGauge(
+	ActiveTenantsGauge = prometheus.NewGauge(
 		prometheus.GaugeOpts{
 			Name: prefix + "_active_tenants",
 			Help: "Number of active tenants using the supplier service",
 		},
 	)
-}
 
-// TrackDBOperation returns a function that records the duration of a database operation
-func TrackDBOperation(operationType string) func(startTime time.Time) {
-	return func(startTime time.Time) {
-		duration := time.Since(startTime).Seconds()
-		DbOperationDuration.WithLabelValues(operationType).Observe(duration)
+	for _, collector := range []prometheus.Collector{
+		HttpRequestsTotal,
+		HttpRequestDuration,
+		AuthAttemptsCounter,
+		AuthSuccessCounter,
+		AuthErrorsCounter,
+		TenantContextMissingCounter,
+		SupplierOperationsCounter,
+		SuppliersPerTenantGauge,
+		ActiveTenantsGauge,
+	} {
+		if err := registerer.Register(collector); err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
 // RecordSupplierOperation increments the counter for supplier operations